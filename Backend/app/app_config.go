@@ -1,13 +1,106 @@
 package app
 
 import (
-	"os"
+	"project/config"
+	"project/controller"
+	"project/logging"
+	"project/mail"
+	"project/oidc"
+	"project/ratelimit"
+	"project/service"
 
 	log "github.com/sirupsen/logrus"
 )
 
 func init() {
-	log.SetOutput(os.Stdout)
-	log.SetLevel(log.DebugLevel)
 	log.Info("Starting logger system")
 }
+
+// Configure applies the configuration to the packages that read it at request time
+func Configure(cfg config.Config) {
+	// The configuration is validated, so the levels parse
+	if err := logging.Configure(cfg.Log); err != nil {
+		log.Error(err)
+	}
+
+	controller.JwtSecret = []byte(cfg.Auth.JwtSecret)
+	controller.TokenTtl = cfg.Auth.TokenTtl.Duration
+	controller.ImageDir = cfg.Images.Dir
+	controller.MaxSignedUrlTtl = cfg.Images.MaxSignedUrlTtl.Duration
+
+	service.Mailer = mail.New(cfg.Mail)
+	service.AppUrl = cfg.Mail.AppUrl
+	service.PasswordResetTtl = cfg.Auth.ResetTtl.Duration
+	service.EmailVerificationTtl = cfg.Auth.VerificationTtl.Duration
+	service.ConfirmationTtl = cfg.Auth.ConfirmationTtl.Duration
+	service.MfaIssuer = cfg.Auth.MfaIssuer
+	service.MfaRequiredRoles = cfg.Auth.MfaRequiredRoles
+	service.MfaChallengeTtl = cfg.Auth.MfaChallengeTtl.Duration
+
+	service.ImageSigningKey = []byte(cfg.Images.SigningKey)
+
+	service.IdempotencyRetention = cfg.Idempotency.Retention.Duration
+	service.IdempotencyLockTimeout = cfg.Idempotency.LockTimeout.Duration
+
+	service.DeletedRetention = cfg.SoftDelete.Retention.Duration
+
+	service.AuditKey = []byte(cfg.Audit.HmacKey)
+
+	configureOidc(cfg.Oidc)
+	configureRateLimits(cfg.RateLimit)
+
+	log.Info("Configuration loaded for profile ", cfg.Profile)
+}
+
+// configureOidc sets up the providers, their endpoints are discovered on the
+// first login so the API starts while a provider is down
+func configureOidc(cfg config.OidcConfig) {
+	service.OidcProviders = nil
+	service.OidcStateTtl = cfg.StateTtl.Duration
+
+	for _, provider := range cfg.Providers {
+		service.OidcProviders = append(service.OidcProviders, &oidc.Provider{
+			Name:         provider.Name,
+			DisplayName:  provider.DisplayName,
+			Issuer:       provider.Issuer,
+			ClientId:     provider.ClientId,
+			ClientSecret: provider.ClientSecret,
+			RedirectUrl:  provider.RedirectUrl,
+			Scopes:       provider.Scopes,
+		})
+	}
+}
+
+// configureRateLimits shares one store between the route limits and the login
+// lockout, the configuration is validated so the limits parse
+func configureRateLimits(cfg config.RateLimitConfig) {
+	store := ratelimit.NewMemoryStore()
+
+	controller.RateLimitStore = store
+	service.LoginAttempts = store
+
+	controller.RateLimits = map[string]controller.RouteLimit{}
+
+	for _, route := range cfg.Routes {
+		limit := controller.RouteLimit{AccountField: route.AccountField}
+
+		if route.PerIp != "" {
+			limit.PerIp, _ = ratelimit.ParseLimit(route.PerIp)
+		}
+
+		if route.PerAccount != "" {
+			limit.PerAccount, _ = ratelimit.ParseLimit(route.PerAccount)
+		}
+
+		controller.RateLimits[route.Route] = limit
+	}
+
+	service.LoginLockout = service.LockoutPolicy{
+		MaxFailures:    cfg.Login.MaxFailures,
+		Window:         cfg.Login.Window.Duration,
+		Lockout:        cfg.Login.Lockout.Duration,
+		Delay:          cfg.Login.Delay.Duration,
+		MaxDelay:       cfg.Login.MaxDelay.Duration,
+		KnownClientTtl: cfg.Login.KnownClientTtl.Duration,
+	}
+}
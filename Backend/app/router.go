@@ -1,24 +1,194 @@
 package app
 
 import (
+	"context"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"project/config"
+	"project/controller"
+	"project/ratelimit"
+	"project/service"
+	"time"
 )
 
+const serviceName = "miranda-api"
+
 var (
 	router *gin.Engine
 )
 
 func init() {
-	router = gin.Default()
-	router.Use(cors.Default())
+	router = gin.New()
+
+	// The request span is opened first so it covers the whole chain and
+	// continues the trace of an incoming traceparent header
+	router.Use(otelgin.Middleware(serviceName))
+
+	// Access logs and metrics wrap the recovery so panics are counted as 500s
+	router.Use(controller.AccessLog(), controller.Metrics(), gin.CustomRecovery(controller.Recovery))
+
+	// Errors are rendered as problem+json, see controller/errors.go
+	router.Use(controller.RequestId(), controller.ErrorHandler())
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(controller.NoRoute)
+	router.NoMethod(controller.NoMethod)
+}
+
+func newCorsConfig(cfg config.CorsConfig) cors.Config {
+	corsConfig := cors.Config{
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", controller.RequestIdHeader, "traceparent", "tracestate", controller.IdempotencyKeyHeader, "If-Match", "If-None-Match"},
+		ExposeHeaders:    []string{controller.RequestIdHeader, "Retry-After", controller.IdempotencyReplayedHeader, "ETag"},
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           12 * time.Hour,
+	}
+
+	if len(cfg.AllowedOrigins) == 1 && cfg.AllowedOrigins[0] == "*" {
+		corsConfig.AllowAllOrigins = true
+	} else {
+		corsConfig.AllowOrigins = cfg.AllowedOrigins
+	}
+
+	return corsConfig
 }
 
-func StartRoute() {
+// StartRoute serves the API until the process is asked to stop, see server.go
+func StartRoute(cfg config.Config) error {
+	router.Use(cors.New(newCorsConfig(cfg.Cors)))
+	router.Use(controller.MaxBodySize(int64(cfg.Server.MaxBodyBytes)))
+
+	// After cors, so a rejected token can be read by the browser. The services
+	// record who made each change, see service/audit.go
+	router.Use(controller.Identify())
+
+	if cfg.RateLimit.Enabled {
+		router.Use(controller.RateLimit())
+	}
+
+	// Retries are answered after the rate limits, so they count against them
+	router.Use(controller.Idempotency())
+
+	if store, ok := controller.RateLimitStore.(*ratelimit.MemoryStore); ok {
+		Go("rate limit sweep", store.Run(time.Minute))
+	}
+	Go("idempotency key purge", purgeIdempotencyKeys(time.Hour))
+	Go("deleted record purge", purgeDeleted(time.Hour))
+	Go("expired token purge", purgeExpiredTokens(time.Hour))
+	Go("image file purge", purgeImageFiles(time.Hour))
+	Go("audit retry", retryAudit(10*time.Second))
 	mapUrls()
 
-	log.Info("Starting server")
-	router.Run(":80")
+	log.Info("Starting server on ", cfg.Server.Addr)
+	return listen(newServer(cfg.Server), cfg.Server)
+}
+
+// purgeIdempotencyKeys deletes the expired idempotency keys every interval until ctx is done
+func purgeIdempotencyKeys(interval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if count, err := service.IdempotencyService.PurgeExpired(ctx); err != nil {
+					log.WithError(err).Warn("Failed to purge expired idempotency keys")
+				} else if count > 0 {
+					log.Info("Purged expired idempotency keys: ", count)
+				}
+			}
+		}
+	}
+}
+
+// purgeDeleted removes the deleted records past their retention every interval until ctx is done
+func purgeDeleted(interval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := service.PurgeService.PurgeDeleted(ctx); err != nil {
+					log.WithError(err).Warn("Failed to purge deleted records")
+				}
+			}
+		}
+	}
+}
+
+// purgeExpiredTokens deletes the expired tokens mailed to users every interval until ctx is done
+func purgeExpiredTokens(interval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if count, err := service.PurgeService.PurgeExpiredTokens(ctx); err != nil {
+					log.WithError(err).Warn("Failed to purge expired tokens")
+				} else if count > 0 {
+					log.Info("Purged expired tokens: ", count)
+				}
+			}
+		}
+	}
+}
+
+// retryAudit appends the audit entries that failed to be every interval, and
+// once more when ctx is done as the requests have finished by then
+func retryAudit(interval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				final, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+				defer cancel()
+
+				if pending, err := service.AuditService.RetryPending(final); err != nil {
+					log.WithError(err).WithField("pending", pending).Error("Audit entries left unappended at shutdown, they were logged when they failed")
+				}
+				return
+			case <-ticker.C:
+				if pending, err := service.AuditService.RetryPending(ctx); err != nil {
+					log.WithError(err).WithField("pending", pending).Warn("Failed to append the pending audit entries")
+				}
+			}
+		}
+	}
+}
+
+// purgeImageFiles removes the image files no image refers to every interval
+// until ctx is done, leaving those newer than an interval to their upload
+func purgeImageFiles(interval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
 
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if count, err := service.PurgeService.PurgeImageFiles(ctx, controller.ImageDir, interval); err != nil {
+					log.WithError(err).Warn("Failed to purge unused image files")
+				} else if count > 0 {
+					log.Info("Purged unused image files: ", count)
+				}
+			}
+		}
+	}
 }
@@ -0,0 +1,195 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"project/config"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Background workers run until shutdown, which waits for them to return.
+// running counts them by name, to tell which ones didn't, and workerStopped
+// wakes the shutdown whenever one returns.
+var (
+	workersCtx, stopWorkers = context.WithCancel(context.Background())
+
+	runningMu     sync.Mutex
+	running       = map[string]int{}
+	workerStopped = make(chan struct{}, 1)
+)
+
+// Go runs fn in the background, fn must return soon after ctx is done
+func Go(name string, fn func(ctx context.Context)) {
+	countWorker(name, 1)
+
+	go func() {
+		defer countWorker(name, -1)
+
+		fn(workersCtx)
+		log.Debug("Background worker stopped: ", name)
+	}()
+}
+
+func countWorker(name string, delta int) {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+
+	running[name] += delta
+
+	if running[name] <= 0 {
+		delete(running, name)
+	}
+
+	if delta < 0 {
+		// A wake up already pending covers this one
+		select {
+		case workerStopped <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func runningWorkers() []string {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+
+	var names []string
+	for name := range running {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func newServer(cfg config.ServerConfig) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           router,
+		ReadTimeout:       cfg.ReadTimeout.Duration,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout.Duration,
+		WriteTimeout:      cfg.WriteTimeout.Duration,
+		IdleTimeout:       cfg.IdleTimeout.Duration,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// listen serves until SIGINT or SIGTERM, then drains in-flight requests and
+// background workers within the shutdown timeout
+func listen(server *http.Server, cfg config.ServerConfig) error {
+	listener, err := net.Listen("tcp", cfg.Addr)
+
+	if err != nil {
+		return err
+	}
+
+	if cfg.TlsCertFile != "" {
+		certificates, err := newCertReloader(cfg.TlsCertFile, cfg.TlsKeyFile)
+
+		if err != nil {
+			listener.Close()
+			return err
+		}
+
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certificates.GetCertificate,
+		}
+
+		Go("tls certificate reload", certificates.watch(cfg.TlsReloadInterval.Duration))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return serve(ctx, server, listener, cfg.ShutdownTimeout.Duration)
+}
+
+func serve(ctx context.Context, server *http.Server, listener net.Listener, shutdownTimeout time.Duration) error {
+	served := make(chan error, 1)
+
+	go func() {
+		if server.TLSConfig != nil {
+			served <- server.ServeTLS(listener, "", "")
+		} else {
+			served <- server.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-served:
+		waitCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		waitWorkers(waitCtx)
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info("Shutting down, draining in-flight requests")
+
+	return shutdown(server, shutdownTimeout)
+}
+
+// shutdown stops the background workers along with the requests, so both
+// have until the timeout to finish
+func shutdown(server *http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stopWorkers()
+
+	err := server.Shutdown(ctx)
+
+	if err != nil {
+		// Requests still running past the deadline are cut off
+		server.Close()
+	}
+
+	if workersErr := waitWorkers(ctx); err == nil {
+		err = workersErr
+	}
+
+	if err == nil {
+		log.Info("Shutdown complete")
+	}
+
+	return err
+}
+
+// waitWorkers stops the background workers and waits for them until ctx is
+// done, the ones still running then are abandoned
+func waitWorkers(ctx context.Context) error {
+	stopWorkers()
+
+	abandoned := runningWorkers()
+
+	for len(abandoned) > 0 && ctx.Err() == nil {
+		select {
+		case <-workerStopped:
+		case <-ctx.Done():
+		}
+
+		abandoned = runningWorkers()
+	}
+
+	if len(abandoned) == 0 {
+		return nil
+	}
+
+	log.WithField("workers", abandoned).Warn("Background workers abandoned at the shutdown deadline")
+
+	return fmt.Errorf("background workers did not stop before the shutdown timeout: %s", strings.Join(abandoned, ", "))
+}
@@ -0,0 +1,204 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServe_DrainsInFlightRequests(t *testing.T) {
+	a := assert.New(t)
+
+	started := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "booked")
+	})}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	a.Nil(err)
+
+	workerStopped := false
+	Go("test worker", func(ctx context.Context) {
+		<-ctx.Done()
+		workerStopped = true
+	})
+
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+
+	go func() {
+		served <- serve(ctx, server, listener, 5*time.Second)
+	}()
+
+	responses := make(chan string, 1)
+
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String())
+
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		responses <- string(body)
+	}()
+
+	<-started
+	stop()
+
+	a.Equal("booked", <-responses)
+	a.Nil(<-served)
+	a.True(workerStopped)
+
+	_, err = http.Get("http://" + listener.Addr().String())
+	a.NotNil(err)
+}
+
+func TestCertReloader_Reload(t *testing.T) {
+	a := assert.New(t)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	writeCertificate(t, certFile, keyFile, "first")
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	a.Nil(err)
+	a.Equal("first", leafName(t, reloader))
+	a.False(reloader.changed())
+
+	// Make sure the new files get a later modification time
+	writeCertificate(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Second)
+	a.Nil(os.Chtimes(certFile, later, later))
+
+	a.True(reloader.changed())
+	a.Nil(reloader.reload())
+	a.Equal("second", leafName(t, reloader))
+
+	// A broken file keeps the current certificate
+	a.Nil(os.WriteFile(certFile, []byte("not a certificate"), 0o600))
+	a.NotNil(reloader.reload())
+	a.Equal("second", leafName(t, reloader))
+}
+
+func leafName(t *testing.T, reloader *certReloader) string {
+	cert, err := reloader.GetCertificate(&tls.ClientHelloInfo{})
+
+	if err != nil {
+		t.Fatalf("GetCertificate failed: %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+
+	return leaf.Subject.CommonName
+}
+
+func writeCertificate(t *testing.T, certFile string, keyFile string, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	if err := os.WriteFile(certFile, certPem, 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+
+	if err := os.WriteFile(keyFile, keyPem, 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+}
+
+func TestShutdown_WaitsForWorkers(t *testing.T) {
+	a := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	a.Nil(err)
+
+	server := &http.Server{Handler: http.NotFoundHandler()}
+	go server.Serve(listener)
+
+	// Workers get the time left after the requests drained
+	finished := make(chan struct{})
+	Go("slow worker", func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(100 * time.Millisecond)
+		close(finished)
+	})
+
+	a.Nil(shutdown(server, 5*time.Second))
+
+	select {
+	case <-finished:
+	default:
+		t.Fatal("shutdown returned before the worker stopped")
+	}
+
+	a.Empty(runningWorkers())
+}
+
+func TestWaitWorkers_Abandoned(t *testing.T) {
+	a := assert.New(t)
+
+	release := make(chan struct{})
+	Go("stuck worker", func(ctx context.Context) {
+		<-release
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	a.ErrorContains(waitWorkers(ctx), "stuck worker")
+	a.Equal([]string{"stuck worker"}, runningWorkers())
+
+	close(release)
+	a.Nil(waitWorkers(context.Background()))
+	a.Empty(runningWorkers())
+}
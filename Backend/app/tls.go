@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// certReloader serves the certificate from disk and swaps it when the files
+// change or on SIGHUP, so renewed certificates are picked up without a restart
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+
+	return reloader, reloader.reload()
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// reload keeps the current certificate when the new files can't be loaded
+func (r *certReloader) reload() error {
+	modTime := r.lastModified()
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *certReloader) lastModified() time.Time {
+	var latest time.Time
+
+	for _, file := range []string{r.certFile, r.keyFile} {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest
+}
+
+func (r *certReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lastModified().After(r.modTime)
+}
+
+func (r *certReloader) watch(interval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		defer signal.Stop(hangup)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+			case <-ticker.C:
+				if !r.changed() {
+					continue
+				}
+			}
+
+			if err := r.reload(); err != nil {
+				log.Error("Failed to reload TLS certificate, keeping the current one: ", err)
+				continue
+			}
+
+			log.Info("TLS certificate reloaded")
+		}
+	}
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	log "github.com/sirupsen/logrus"
+	"project/auth"
 	"project/controller"
 )
 
@@ -11,6 +12,24 @@ func mapUrls() {
 	router.POST("/user", controller.InsertUser)
 	router.GET("/user/:id", controller.GetUserById)
 	router.GET("/user", controller.GetUsers)
+	router.PATCH("/user/:id", controller.PatchUser)
+	router.DELETE("/user/:id", controller.DeleteUser)
+	router.POST("/user/email/confirm", controller.ConfirmEmailChange)
+	router.POST("/user/email/verify", controller.VerifyEmail)
+
+	router.GET("/me", controller.Authenticated(), controller.GetProfile)
+	router.PATCH("/me", controller.Authenticated(), controller.PatchProfile)
+	router.PUT("/me/password", controller.Authenticated(), controller.ChangePassword)
+	router.POST("/me/email", controller.Authenticated(), controller.RequestEmailChange)
+	router.POST("/me/email/verification", controller.Authenticated(), controller.RequestEmailVerification)
+	router.POST("/me/confirmation", controller.Authenticated(), controller.RequestConfirmation)
+	router.DELETE("/me", controller.Authenticated(), controller.DeleteAccount)
+	router.GET("/me/hotels", controller.Authenticated(), controller.GetProfileHotels)
+	router.GET("/me/mfa", controller.Authenticated(), controller.GetMfaStatus)
+	router.POST("/me/mfa", controller.Authenticated(), controller.StartMfaEnrollment)
+	router.POST("/me/mfa/confirm", controller.Authenticated(), controller.ConfirmMfaEnrollment)
+	router.DELETE("/me/mfa", controller.Authenticated(), controller.DisableMfa)
+	router.POST("/me/mfa/recovery-codes", controller.Authenticated(), controller.RegenerateRecoveryCodes)
 
 	router.POST("/hotel", controller.InsertHotel)
 	router.GET("/hotel/:id", controller.GetHotelById)
@@ -18,6 +37,7 @@ func mapUrls() {
 	router.POST("/hotel/:id/images", controller.InsertImages)
 	router.DELETE("/hotel/:id", controller.DeleteHotel)
 	router.PUT("/hotel/:id", controller.UpdateHotel)
+	router.PATCH("/hotel/:id", controller.PatchHotel)
 
 	router.POST("/reserve", controller.InsertReservation)
 	router.GET("/reservation/:id", controller.GetReservationById)
@@ -31,10 +51,47 @@ func mapUrls() {
 	router.GET("/amenity", controller.GetAmenities)
 
 	router.GET("/image/:id", controller.GetImageById)
+	router.HEAD("/image/:id", controller.GetImageById)
+	router.GET("/image/:id/signed-url", controller.GetSignedImageUrl)
 
 	router.POST("/login", controller.UserLogin)
+	router.POST("/login/mfa", controller.VerifyMfaLogin)
+	router.POST("/login/mfa/enroll", controller.EnrollMfaLogin)
+	router.GET("/auth/oidc/providers", controller.GetOidcProviders)
+	router.POST("/auth/oidc/:provider/start", controller.StartOidcLogin)
+	router.POST("/auth/oidc/:provider/callback", controller.CompleteOidcLogin)
+	router.POST("/password/forgot", controller.ForgotPassword)
+	router.POST("/password/reset", controller.ResetPassword)
 
 	router.GET("/availability", controller.CheckAllAvailability)
 
+	router.GET("/admin/deleted/hotels", controller.GetDeletedHotels)
+	router.GET("/admin/deleted/users", controller.GetDeletedUsers)
+	router.GET("/admin/deleted/reservations", controller.GetDeletedReservations)
+	router.POST("/admin/deleted/hotels/:id/restore", controller.RestoreHotel)
+	router.POST("/admin/deleted/users/:id/restore", controller.RestoreUser)
+	router.POST("/admin/deleted/reservations/:id/restore", controller.RestoreReservation)
+
+	router.POST("/admin/users", controller.CreateUser)
+	router.PUT("/admin/users/:id/role", controller.SetUserRole)
+	router.POST("/admin/users/:id/disable", controller.DisableUser)
+	router.POST("/admin/users/:id/enable", controller.EnableUser)
+	router.GET("/admin/users/:id/hotels", controller.GetAssignedHotels)
+	router.PUT("/admin/users/:id/hotels/:hotelId", controller.AssignHotel)
+	router.DELETE("/admin/users/:id/hotels/:hotelId", controller.UnassignHotel)
+	router.POST("/admin/users/:id/mfa/reset", controller.ResetUserMfa)
+
+	router.GET("/admin/audit", controller.GetAuditEntries)
+	router.GET("/admin/audit/export", controller.ExportAuditEntries)
+	router.GET("/admin/audit/verify", controller.VerifyAuditLog)
+
+	router.GET("/db/stats", controller.Permitted(auth.ViewMonitoring), controller.GetDbStats)
+
+	router.GET("/healthz", controller.Healthz)
+	router.HEAD("/healthz", controller.Healthz)
+	router.GET("/readyz", controller.Readyz)
+	router.GET("/version", controller.GetBuildInfo)
+	router.GET("/metrics", controller.Permitted(auth.ViewMonitoring), controller.GetMetrics)
+
 	log.Info("Finishing mappings configurations")
 }
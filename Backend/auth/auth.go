@@ -0,0 +1,39 @@
+// Package auth carries who a request acts as through its context, from the
+// controllers that read the login token to the services that act on it
+package auth
+
+import "context"
+
+// Identity is the user a request acts as, read from its login token
+type Identity struct {
+	UserId int
+	Role   string
+	// TokenVersion is the version of the password the token was issued for
+	TokenVersion int
+}
+
+type identityKey struct{}
+
+type clientIpKey struct{}
+
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFrom returns the identity of the request, ok is false when it
+// carried no token
+func IdentityFrom(ctx context.Context) (identity Identity, ok bool) {
+	identity, ok = ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// WithClientIp keeps the address the request came from
+func WithClientIp(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIpKey{}, ip)
+}
+
+// ClientIp returns the address the request came from, or "" outside a request
+func ClientIp(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIpKey{}).(string)
+	return ip
+}
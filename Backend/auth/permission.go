@@ -0,0 +1,71 @@
+package auth
+
+// Roles a user can have. Managers run the hotels assigned to them, the front
+// desk books and looks up guests and customers only act on their own account.
+const (
+	RoleAdmin     = "Admin"
+	RoleManager   = "Manager"
+	RoleFrontDesk = "FrontDesk"
+	RoleCustomer  = "Customer"
+)
+
+// Roles lists every role, from the most privileged
+var Roles = []string{RoleAdmin, RoleManager, RoleFrontDesk, RoleCustomer}
+
+// Permission is something a role is allowed to do beyond acting on its own
+// account
+type Permission string
+
+const (
+	// ManageUsers creates accounts with any role, changes roles and disables accounts
+	ManageUsers Permission = "manage_users"
+	// ViewUsers reads the profile of any user
+	ViewUsers Permission = "view_users"
+	// CreateHotels adds new hotels and amenities
+	CreateHotels Permission = "create_hotels"
+	// ManageHotels edits and deletes hotels and uploads their images
+	ManageHotels Permission = "manage_hotels"
+	// ViewReservations reads the reservations of any user or hotel
+	ViewReservations Permission = "view_reservations"
+	// ManageReservations books and cancels reservations for any user
+	ManageReservations Permission = "manage_reservations"
+	// ManageDeleted lists and restores deleted records
+	ManageDeleted Permission = "manage_deleted"
+	// ViewAudit reads, exports and verifies the audit log
+	ViewAudit Permission = "view_audit"
+	// ViewMonitoring reads the internals of the running API, e.g. its database pool
+	ViewMonitoring Permission = "view_monitoring"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		ManageUsers, ViewUsers, CreateHotels, ManageHotels, ViewReservations,
+		ManageReservations, ManageDeleted, ViewAudit, ViewMonitoring,
+	},
+	RoleManager:   {ManageHotels, ViewReservations, ManageReservations},
+	RoleFrontDesk: {ViewUsers, ViewReservations, ManageReservations},
+	RoleCustomer:  {},
+}
+
+// ValidRole tells whether role is one of Roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Can tells whether the role of the identity grants the permission
+func (i Identity) Can(permission Permission) bool {
+	for _, granted := range rolePermissions[i.Role] {
+		if granted == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HotelScoped tells whether the permissions of the identity only apply to the
+// hotels assigned to it
+func (i Identity) HotelScoped() bool {
+	return i.Role == RoleManager
+}
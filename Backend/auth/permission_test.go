@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCan(t *testing.T) {
+	a := assert.New(t)
+
+	for _, permission := range []Permission{ManageUsers, ViewUsers, CreateHotels, ManageHotels, ViewReservations, ManageReservations, ManageDeleted, ViewAudit} {
+		a.True(Identity{Role: RoleAdmin}.Can(permission), permission)
+		a.False(Identity{Role: RoleCustomer}.Can(permission), permission)
+		a.False(Identity{}.Can(permission), permission)
+	}
+
+	a.True(Identity{Role: RoleManager}.Can(ManageHotels))
+	a.False(Identity{Role: RoleManager}.Can(CreateHotels))
+	a.True(Identity{Role: RoleFrontDesk}.Can(ManageReservations))
+	a.False(Identity{Role: RoleFrontDesk}.Can(ManageHotels))
+}
+
+func TestHotelScoped(t *testing.T) {
+	a := assert.New(t)
+
+	a.True(Identity{Role: RoleManager}.HotelScoped())
+	a.False(Identity{Role: RoleAdmin}.HotelScoped())
+	a.False(Identity{Role: RoleFrontDesk}.HotelScoped())
+	a.False(Identity{Role: RoleCustomer}.HotelScoped())
+}
+
+func TestValidRole(t *testing.T) {
+	a := assert.New(t)
+
+	for _, role := range Roles {
+		a.True(ValidRole(role), role)
+	}
+
+	a.False(ValidRole(""))
+	a.False(ValidRole("admin"))
+}
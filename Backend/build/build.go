@@ -0,0 +1,38 @@
+package build
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X project/build.Version=1.4.0 -X project/build.Commit=$(git rev-parse HEAD) -X project/build.Time=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version = "dev"
+	Commit  = ""
+	Time    = ""
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// GetInfo returns the injected build values, the commit falls back to the
+// revision go build stamps when it was not injected
+func GetInfo() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: Time, GoVersion: runtime.Version()}
+
+	if buildInfo, ok := debug.ReadBuildInfo(); ok && info.Commit == "" {
+		for _, setting := range buildInfo.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+
+	return info
+}
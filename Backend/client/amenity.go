@@ -1,17 +1,18 @@
 package client
 
 import (
-	log "github.com/sirupsen/logrus"
+	"context"
 	"project/model"
+	"project/tracing"
 )
 
 type amenityClient struct{}
 
 type amenityClientInterface interface {
-	InsertAmenity(amenity model.Amenity) model.Amenity
-	GetAmenityById(id int) model.Amenity
-	GetAmenityByName(name string) model.Amenity
-	GetAmenities() model.Amenities
+	InsertAmenity(ctx context.Context, amenity model.Amenity) (model.Amenity, error)
+	GetAmenityById(ctx context.Context, id int) (model.Amenity, error)
+	GetAmenityByName(ctx context.Context, name string) (model.Amenity, error)
+	GetAmenities(ctx context.Context) (model.Amenities, error)
 }
 
 var AmenityClient amenityClientInterface
@@ -20,42 +21,53 @@ func init() {
 	AmenityClient = &amenityClient{}
 }
 
-func (c amenityClient) InsertAmenity(amenity model.Amenity) model.Amenity {
+func (c amenityClient) InsertAmenity(ctx context.Context, amenity model.Amenity) (model.Amenity, error) {
+	ctx, span := tracing.Start(ctx, "AmenityClient.InsertAmenity")
+	defer span.End()
 
-	result := Db.Create(&amenity)
+	result := Db.WithContext(ctx).Create(&amenity)
 
 	if result.Error != nil {
-		log.Error("Failed to insert amenity.")
-		return amenity
+		log.Ctx(ctx).WithError(result.Error).Error("Failed to insert amenity")
+		return amenity, translateError(result.Error)
 	}
 
-	log.Debug("Amenity created:", amenity.Id)
-	return amenity
+	log.Ctx(ctx).WithField("amenity_id", amenity.Id).Debug("Amenity created")
+	return amenity, nil
 }
 
-func (c amenityClient) GetAmenityById(id int) model.Amenity {
+func (c amenityClient) GetAmenityById(ctx context.Context, id int) (model.Amenity, error) {
+	ctx, span := tracing.Start(ctx, "AmenityClient.GetAmenityById")
+	defer span.End()
+
 	var amenity model.Amenity
 
-	Db.Where("id = ?", id).First(&amenity)
-	log.Debug("Amenity: ", amenity)
+	err := Db.WithContext(ctx).Where("id = ?", id).First(&amenity).Error
+	log.Ctx(ctx).WithField("amenity_id", amenity.Id).Debug("Amenity loaded")
 
-	return amenity
+	return amenity, translateError(err)
 }
 
-func (c amenityClient) GetAmenityByName(name string) model.Amenity {
+func (c amenityClient) GetAmenityByName(ctx context.Context, name string) (model.Amenity, error) {
+	ctx, span := tracing.Start(ctx, "AmenityClient.GetAmenityByName")
+	defer span.End()
+
 	var amenity model.Amenity
 
-	Db.Where("name = ?", name).First(&amenity)
-	log.Debug("Amenity: ", amenity)
+	err := Db.WithContext(ctx).Where("name = ?", name).First(&amenity).Error
+	log.Ctx(ctx).WithField("amenity_id", amenity.Id).Debug("Amenity loaded")
 
-	return amenity
+	return amenity, translateError(err)
 }
 
-func (c amenityClient) GetAmenities() model.Amenities {
+func (c amenityClient) GetAmenities(ctx context.Context) (model.Amenities, error) {
+	ctx, span := tracing.Start(ctx, "AmenityClient.GetAmenities")
+	defer span.End()
+
 	var amenities model.Amenities
-	Db.Find(&amenities)
+	err := Db.WithContext(ctx).Find(&amenities).Error
 
-	log.Debug("Amenities: ", amenities)
+	log.Ctx(ctx).WithField("count", len(amenities)).Debug("Amenities loaded")
 
-	return amenities
+	return amenities, translateError(err)
 }
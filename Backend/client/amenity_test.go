@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm/logger"
 	"project/model"
@@ -44,7 +45,8 @@ func TestInsertAmenity_Client(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
 
-	result := AmenityClient.InsertAmenity(amenity)
+	result, err := AmenityClient.InsertAmenity(context.Background(), amenity)
+	a.Nil(err)
 
 	a.Equal(amenity, result)
 	a.Equal(1, amenity.Id)
@@ -87,7 +89,8 @@ func TestGetAmenityById_Client(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).
 			AddRow(amenity.Id, amenity.Name))
 
-	result := AmenityClient.GetAmenityById(amenity.Id)
+	result, err := AmenityClient.GetAmenityById(context.Background(), amenity.Id)
+	a.Nil(err)
 
 	a.Equal(amenity, result)
 	a.Equal(1, amenity.Id)
@@ -130,7 +133,8 @@ func TestGetAmenityByName_Client(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).
 			AddRow(amenity.Id, amenity.Name))
 
-	result := AmenityClient.GetAmenityByName(amenity.Name)
+	result, err := AmenityClient.GetAmenityByName(context.Background(), amenity.Name)
+	a.Nil(err)
 
 	a.Equal(amenity, result)
 	a.Equal(amenity.Name, result.Name)
@@ -180,7 +184,8 @@ func TestGetAmenities_Client(t *testing.T) {
 			AddRow(amenities[0].Id, amenities[0].Name).
 			AddRow(amenities[1].Id, amenities[1].Name))
 
-	result := AmenityClient.GetAmenities()
+	result, err := AmenityClient.GetAmenities(context.Background())
+	a.Nil(err)
 
 	a.Equal(amenities, result)
 
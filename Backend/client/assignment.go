@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"project/model"
+	"project/tracing"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/clause"
+)
+
+type assignmentClient struct{}
+
+type assignmentClientInterface interface {
+	AssignHotel(ctx context.Context, assignment model.HotelAssignment) error
+	UnassignHotel(ctx context.Context, userId int, hotelId int) error
+	GetAssignedHotelIds(ctx context.Context, userId int) ([]int, error)
+}
+
+var AssignmentClient assignmentClientInterface
+
+func init() {
+	AssignmentClient = &assignmentClient{}
+}
+
+// AssignHotel stores the assignment, assigning a hotel twice keeps the first one
+func (c assignmentClient) AssignHotel(ctx context.Context, assignment model.HotelAssignment) error {
+	ctx, span := tracing.Start(ctx, "AssignmentClient.AssignHotel")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&assignment).Error
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Error("Failed to assign hotel")
+		return translateError(err)
+	}
+
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": assignment.UserId, "hotel_id": assignment.HotelId}).Debug("Hotel assigned")
+	return nil
+}
+
+// UnassignHotel removes the assignment, ErrNotFound is returned if there was none
+func (c assignmentClient) UnassignHotel(ctx context.Context, userId int, hotelId int) error {
+	ctx, span := tracing.Start(ctx, "AssignmentClient.UnassignHotel")
+	defer span.End()
+
+	result := Db.WithContext(ctx).Where("user_id = ? AND hotel_id = ?", userId, hotelId).Delete(&model.HotelAssignment{})
+
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": userId, "hotel_id": hotelId}).Debug("Hotel unassigned")
+	return translateError(result.Error)
+}
+
+// GetAssignedHotelIds returns the ids of the hotels assigned to the user, in order
+func (c assignmentClient) GetAssignedHotelIds(ctx context.Context, userId int) ([]int, error) {
+	ctx, span := tracing.Start(ctx, "AssignmentClient.GetAssignedHotelIds")
+	defer span.End()
+
+	var hotelIds []int
+
+	err := Db.WithContext(ctx).Model(&model.HotelAssignment{}).Where("user_id = ?", userId).
+		Order("hotel_id").Pluck("hotel_id", &hotelIds).Error
+	log.Ctx(ctx).WithField("count", len(hotelIds)).Debug("Assigned hotels loaded")
+
+	return hotelIds, translateError(err)
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"project/model"
+	"project/tracing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type auditClient struct{}
+
+// AuditFilter narrows the audit entries returned, zero fields match every entry
+// and a zero Limit returns them all
+type AuditFilter struct {
+	ActorId  int
+	Action   string
+	Entity   string
+	EntityId int
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Offset   int
+}
+
+type auditClientInterface interface {
+	InsertAuditEntry(ctx context.Context, entry model.AuditEntry) (model.AuditEntry, error)
+	GetLastAuditEntry(ctx context.Context) (model.AuditEntry, error)
+	GetAuditEntries(ctx context.Context, filter AuditFilter) (model.AuditEntries, error)
+	EachAuditEntry(ctx context.Context, filter AuditFilter, fn func(entry model.AuditEntry) error) error
+}
+
+var AuditClient auditClientInterface
+
+func init() {
+	AuditClient = &auditClient{}
+}
+
+// InsertAuditEntry appends the entry to the chain. ErrConflict is returned
+// when another entry was appended after PrevHash in the meantime.
+func (c auditClient) InsertAuditEntry(ctx context.Context, entry model.AuditEntry) (model.AuditEntry, error) {
+	ctx, span := tracing.Start(ctx, "AuditClient.InsertAuditEntry")
+	defer span.End()
+
+	result := Db.WithContext(ctx).Create(&entry)
+
+	if result.Error != nil {
+		return entry, translateError(result.Error)
+	}
+
+	log.Ctx(ctx).WithField("audit_entry_id", entry.Id).Debug("Audit entry appended")
+	return entry, nil
+}
+
+// GetLastAuditEntry returns the head of the chain, or ErrNotFound while it is empty
+func (c auditClient) GetLastAuditEntry(ctx context.Context) (model.AuditEntry, error) {
+	ctx, span := tracing.Start(ctx, "AuditClient.GetLastAuditEntry")
+	defer span.End()
+
+	var entry model.AuditEntry
+
+	err := Db.WithContext(ctx).Order("id DESC").First(&entry).Error
+
+	return entry, translateError(err)
+}
+
+// GetAuditEntries returns the entries matching the filter, newest first
+func (c auditClient) GetAuditEntries(ctx context.Context, filter AuditFilter) (model.AuditEntries, error) {
+	ctx, span := tracing.Start(ctx, "AuditClient.GetAuditEntries")
+	defer span.End()
+
+	var entries model.AuditEntries
+
+	query := filterAuditEntries(Db.WithContext(ctx).Order("id DESC"), filter)
+
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit).Offset(filter.Offset)
+	}
+
+	err := query.Find(&entries).Error
+
+	log.Ctx(ctx).WithField("count", len(entries)).Debug("Audit entries loaded")
+
+	return entries, translateError(err)
+}
+
+// EachAuditEntry walks the entries matching the filter in chain order, a
+// batch at a time, its limit and offset are ignored
+func (c auditClient) EachAuditEntry(ctx context.Context, filter AuditFilter, fn func(entry model.AuditEntry) error) error {
+	ctx, span := tracing.Start(ctx, "AuditClient.EachAuditEntry")
+	defer span.End()
+
+	var entries model.AuditEntries
+
+	err := filterAuditEntries(Db.WithContext(ctx).Order("id"), filter).FindInBatches(&entries, 500, func(tx *gorm.DB, batch int) error {
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+
+	return translateError(err)
+}
+
+func filterAuditEntries(query *gorm.DB, filter AuditFilter) *gorm.DB {
+	if filter.ActorId != 0 {
+		query = query.Where("actor_id = ?", filter.ActorId)
+	}
+
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+
+	if filter.Entity != "" {
+		query = query.Where("entity = ?", filter.Entity)
+	}
+
+	if filter.EntityId != 0 {
+		query = query.Where("entity_id = ?", filter.EntityId)
+	}
+
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	return query
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("record not found")
+
+	// ErrConflict is returned when a unique constraint rejects the record
+	ErrConflict = errors.New("record already exists")
+
+	// ErrVersionConflict is returned when a record changed since the version being updated was read
+	ErrVersionConflict = errors.New("record was modified")
+
+	// ErrUnavailable is returned when the database cannot be reached in time
+	ErrUnavailable = errors.New("database unavailable")
+)
+
+// translateError maps gorm and driver errors to the client sentinel errors
+func translateError(err error) error {
+	var netErr net.Error
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return fmt.Errorf("%w: %v", ErrConflict, err)
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, sql.ErrConnDone), errors.As(err, &netErr):
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	default:
+		return err
+	}
+}
@@ -1,18 +1,27 @@
 package client
 
 import (
-	log "github.com/sirupsen/logrus"
+	"context"
+	"errors"
 	"project/model"
+	"project/tracing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type hotelClient struct{}
 
 type hotelClientInterface interface {
-	InsertHotel(hotel model.Hotel) model.Hotel
-	GetHotelById(id int) model.Hotel
-	GetHotels() model.Hotels
-	DeleteHotel(hotel model.Hotel) error
-	UpdateHotel(hotel model.Hotel) model.Hotel
+	InsertHotel(ctx context.Context, hotel model.Hotel) (model.Hotel, error)
+	GetHotelById(ctx context.Context, id int) (model.Hotel, error)
+	GetHotels(ctx context.Context) (model.Hotels, error)
+	DeleteHotel(ctx context.Context, hotel model.Hotel, cancelled model.Reservations) error
+	UpdateHotel(ctx context.Context, hotel model.Hotel) (model.Hotel, error)
+	GetDeletedHotels(ctx context.Context) (model.Hotels, error)
+	RestoreHotel(ctx context.Context, id int) error
+	PurgeHotels(ctx context.Context, before time.Time) (int64, error)
 }
 
 var HotelClient hotelClientInterface
@@ -21,67 +30,180 @@ func init() {
 	HotelClient = &hotelClient{}
 }
 
-func (c hotelClient) InsertHotel(hotel model.Hotel) model.Hotel {
+func (c hotelClient) InsertHotel(ctx context.Context, hotel model.Hotel) (model.Hotel, error) {
+	ctx, span := tracing.Start(ctx, "HotelClient.InsertHotel")
+	defer span.End()
 
-	result := Db.Create(&hotel)
+	result := Db.WithContext(ctx).Create(&hotel)
 
 	if result.Error != nil {
-		log.Error("Failed to insert hotel.")
-		return hotel
+		log.Ctx(ctx).WithError(result.Error).Error("Failed to insert hotel")
+		return hotel, translateError(result.Error)
 	}
 
-	log.Debug("Hotel created:", hotel.Id)
-	return hotel
+	log.Ctx(ctx).WithField("hotel_id", hotel.Id).Debug("Hotel created")
+	return hotel, nil
 }
 
-func (c hotelClient) GetHotelById(id int) model.Hotel {
+func (c hotelClient) GetHotelById(ctx context.Context, id int) (model.Hotel, error) {
+	ctx, span := tracing.Start(ctx, "HotelClient.GetHotelById")
+	defer span.End()
+
 	var hotel model.Hotel
 
-	Db.Where("id = ?", id).Preload("Amenities").Preload("Images").First(&hotel)
-	log.Debug("Hotel: ", hotel)
+	err := Db.WithContext(ctx).Where("id = ?", id).Preload("Amenities").Preload("Images").First(&hotel).Error
+	log.Ctx(ctx).WithField("hotel_id", hotel.Id).Debug("Hotel loaded")
 
-	return hotel
+	return hotel, translateError(err)
 }
 
-func (c hotelClient) GetHotels() model.Hotels {
+func (c hotelClient) GetHotels(ctx context.Context) (model.Hotels, error) {
+	ctx, span := tracing.Start(ctx, "HotelClient.GetHotels")
+	defer span.End()
+
 	var hotels model.Hotels
-	Db.Preload("Images").Find(&hotels)
+	err := Db.WithContext(ctx).Preload("Images").Find(&hotels).Error
 
-	log.Debug("Hotels: ", hotels)
+	log.Ctx(ctx).WithField("count", len(hotels)).Debug("Hotels loaded")
 
-	return hotels
+	return hotels, translateError(err)
 }
 
-func (c hotelClient) DeleteHotel(hotel model.Hotel) error {
+// DeleteHotel soft deletes the hotel along with the reservations it cancels
+// in one transaction. Its images and amenities are kept so it can be restored.
+func (c hotelClient) DeleteHotel(ctx context.Context, hotel model.Hotel, cancelled model.Reservations) error {
+	ctx, span := tracing.Start(ctx, "HotelClient.DeleteHotel")
+	defer span.End()
 
-	Db.Model(&hotel).Association("Amenities").Clear()
+	err := Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(cancelled) > 0 {
+			if err := tx.Delete(&cancelled).Error; err != nil {
+				return err
+			}
+		}
 
-	err := Db.Delete(&hotel).Error
+		return tx.Delete(&hotel).Error
+	})
 
 	if err != nil {
-		log.Debug("Failed to delete hotel")
+		log.Ctx(ctx).WithError(err).Warn("Failed to delete hotel")
 	} else {
-		log.Debug("Hotel deleted: ", hotel.Id)
+		log.Ctx(ctx).WithFields(logrus.Fields{"hotel_id": hotel.Id, "cancelled": len(cancelled)}).Debug("Hotel deleted")
 	}
-	return err
+	return translateError(err)
+}
+
+func (c hotelClient) GetDeletedHotels(ctx context.Context) (model.Hotels, error) {
+	ctx, span := tracing.Start(ctx, "HotelClient.GetDeletedHotels")
+	defer span.End()
+
+	var hotels model.Hotels
+	err := Db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").Find(&hotels).Error
+
+	log.Ctx(ctx).WithField("count", len(hotels)).Debug("Deleted hotels loaded")
+
+	return hotels, translateError(err)
 }
 
-func (c hotelClient) UpdateHotel(hotel model.Hotel) model.Hotel {
+// RestoreHotel undeletes the hotel, ErrNotFound is returned if it isn't deleted
+func (c hotelClient) RestoreHotel(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "HotelClient.RestoreHotel")
+	defer span.End()
 
-	var newAmenities model.Amenities
+	result := Db.WithContext(ctx).Unscoped().Model(&model.Hotel{}).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
 
-	for _, amenity := range hotel.Amenities {
-		newAmenities = append(newAmenities, amenity)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
 	}
-	result := Db.Save(&hotel)
 
-	Db.Model(&hotel).Association("Amenities").Replace(newAmenities)
+	log.Ctx(ctx).WithField("hotel_id", id).Debug("Hotel restored")
+	return translateError(result.Error)
+}
 
-	if result.Error != nil {
-		log.Debug("Failed to update hotel")
-		return model.Hotel{}
+// PurgeHotels removes for good the hotels deleted before the given time, with
+// their images, amenities and manager assignments. Hotels still referenced by reservations are kept.
+func (c hotelClient) PurgeHotels(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := tracing.Start(ctx, "HotelClient.PurgeHotels")
+	defer span.End()
+
+	var hotels model.Hotels
+
+	err := Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("deleted_at < ?", before).
+			Where("NOT EXISTS (SELECT 1 FROM reservations WHERE reservations.hotel_id = hotels.id)").
+			Find(&hotels).Error
+
+		if err != nil {
+			return err
+		}
+
+		for _, hotel := range hotels {
+			if err := tx.Where("hotel_id = ?", hotel.Id).Delete(&model.Image{}).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Unscoped().Model(&hotel).Association("Amenities").Clear(); err != nil {
+				return err
+			}
+
+			if err := tx.Where("hotel_id = ?", hotel.Id).Delete(&model.HotelAssignment{}).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Unscoped().Delete(&hotel).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Error("Failed to purge deleted hotels")
+		return 0, translateError(err)
+	}
+
+	return int64(len(hotels)), nil
+}
+
+// UpdateHotel saves the hotel and replaces its amenities in one transaction.
+// The hotel is only written while it is still at hotel.Version, otherwise
+// ErrVersionConflict is returned, and the saved hotel has the next version.
+func (c hotelClient) UpdateHotel(ctx context.Context, hotel model.Hotel) (model.Hotel, error) {
+	ctx, span := tracing.Start(ctx, "HotelClient.UpdateHotel")
+	defer span.End()
+
+	amenities := append(model.Amenities{}, hotel.Amenities...)
+
+	err := Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		version := hotel.Version
+		hotel.Version++
+
+		result := tx.Model(&hotel).Where("version = ?", version).
+			Select("Name", "RoomAmount", "Description", "StreetName", "StreetNumber", "Rate", "Draft", "Version").
+			Updates(&hotel)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+
+		return tx.Model(&hotel).Association("Amenities").Replace(amenities)
+	})
+
+	if errors.Is(err, ErrVersionConflict) {
+		log.Ctx(ctx).WithField("hotel_id", hotel.Id).Info("Hotel was modified concurrently")
+		return model.Hotel{}, err
+	}
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to update hotel")
+		return model.Hotel{}, translateError(err)
 	}
 
-	log.Debug("Updated hotel: ", hotel.Id)
-	return hotel
+	log.Ctx(ctx).WithField("hotel_id", hotel.Id).Debug("Hotel updated")
+	return hotel, nil
 }
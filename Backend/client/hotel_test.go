@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm/logger"
 	"project/model"
@@ -41,15 +42,17 @@ func TestInsertHotel_Client(t *testing.T) {
 		StreetName:   "Sample Street",
 		StreetNumber: 123,
 		Rate:         4.5,
+		Version:      1,
 	}
 
 	mock.ExpectBegin()
-	mock.ExpectQuery(`SET IDENTITY_INSERT "hotels" ON;INSERT INTO "hotels" ("name","room_amount","description","street_name","street_number","rate","id") OUTPUT INSERTED."id" VALUES (@p1,@p2,@p3,@p4,@p5,@p6,@p7);SET IDENTITY_INSERT "hotels" OFF;`).
-		WithArgs(hotel.Name, hotel.RoomAmount, hotel.Description, hotel.StreetName, hotel.StreetNumber, hotel.Rate, hotel.Id).
+	mock.ExpectQuery(`SET IDENTITY_INSERT "hotels" ON;INSERT INTO "hotels" ("name","room_amount","description","street_name","street_number","rate","draft","version","deleted_at","id") OUTPUT INSERTED."id" VALUES (@p1,@p2,@p3,@p4,@p5,@p6,@p7,@p8,@p9,@p10);SET IDENTITY_INSERT "hotels" OFF;`).
+		WithArgs(hotel.Name, hotel.RoomAmount, hotel.Description, hotel.StreetName, hotel.StreetNumber, hotel.Rate, hotel.Draft, hotel.Version, hotel.DeletedAt, hotel.Id).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
 
-	result := HotelClient.InsertHotel(hotel)
+	result, err := HotelClient.InsertHotel(context.Background(), hotel)
+	a.Nil(err)
 
 	a.Equal(hotel, result)
 	a.Equal(1, hotel.Id)
@@ -92,12 +95,22 @@ func TestGetHotelById_Client(t *testing.T) {
 		Rate:         4.5,
 	}
 
-	mock.ExpectQuery(`SELECT * FROM "hotels" WHERE id = @p1 ORDER BY "hotels"."id" OFFSET 0 ROW FETCH NEXT 1 ROWS ONLY`).
+	mock.ExpectQuery(`SELECT * FROM "hotels" WHERE id = @p1 AND "hotels"."deleted_at" IS NULL ORDER BY "hotels"."id" OFFSET 0 ROW FETCH NEXT 1 ROWS ONLY`).
 		WithArgs(hotel.Id).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "room_amount", "description", "street_name", "street_number", "rate"}).
 			AddRow(hotel.Id, hotel.Name, hotel.RoomAmount, hotel.Description, hotel.StreetName, hotel.StreetNumber, hotel.Rate))
+	mock.ExpectQuery(`SELECT * FROM "hotel_amenities" WHERE "hotel_amenities"."hotel_id" = @p1`).
+		WithArgs(hotel.Id).
+		WillReturnRows(sqlmock.NewRows([]string{"hotel_id", "amenity_id"}))
+	mock.ExpectQuery(`SELECT * FROM "images" WHERE "images"."hotel_id" = @p1`).
+		WithArgs(hotel.Id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "path", "hotel_id"}))
 
-	result := HotelClient.GetHotelById(hotel.Id)
+	result, err := HotelClient.GetHotelById(context.Background(), hotel.Id)
+	a.Nil(err)
+
+	hotel.Amenities = model.Amenities{}
+	hotel.Images = model.Images{}
 
 	a.Equal(hotel, result)
 	a.Equal(1, hotel.Id)
@@ -152,12 +165,19 @@ func TestGetHotels_Client(t *testing.T) {
 		},
 	}
 
-	mock.ExpectQuery(`SELECT * FROM "hotels"`).
+	mock.ExpectQuery(`SELECT * FROM "hotels" WHERE "hotels"."deleted_at" IS NULL`).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "room_amount", "description", "street_name", "street_number", "rate"}).
 			AddRow(hotels[0].Id, hotels[0].Name, hotels[0].RoomAmount, hotels[0].Description, hotels[0].StreetName, hotels[0].StreetNumber, hotels[0].Rate).
 			AddRow(hotels[1].Id, hotels[1].Name, hotels[1].RoomAmount, hotels[1].Description, hotels[1].StreetName, hotels[1].StreetNumber, hotels[1].Rate))
+	mock.ExpectQuery(`SELECT * FROM "images" WHERE "images"."hotel_id" IN (@p1,@p2)`).
+		WithArgs(hotels[0].Id, hotels[1].Id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "path", "hotel_id"}))
 
-	result := HotelClient.GetHotels()
+	result, err := HotelClient.GetHotels(context.Background())
+	a.Nil(err)
+
+	hotels[0].Images = model.Images{}
+	hotels[1].Images = model.Images{}
 
 	a.Equal(hotels, result)
 
@@ -199,17 +219,17 @@ func TestDeleteHotel_Client(t *testing.T) {
 		Rate:         4.5,
 	}
 
-	mock.ExpectBegin()
-	mock.ExpectExec(`DELETE FROM "hotel_amenities" WHERE "hotel_amenities"."hotel_id" = @p1`).
-		WithArgs(hotel.Id).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectCommit()
+	cancelled := model.Reservations{{Id: 2, HotelId: 1}, {Id: 3, HotelId: 1}}
 
+	// Amenities and images are kept, so the hotel can be restored
 	mock.ExpectBegin()
-	mock.ExpectExec(`DELETE FROM "hotels" WHERE "hotels"."id" = @p1`).
-		WithArgs(hotel.Id).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE "reservations" SET "deleted_at"=@p1 WHERE "reservations"."id" IN (@p2,@p3) AND "reservations"."deleted_at" IS NULL`).
+		WithArgs(sqlmock.AnyArg(), 2, 3).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE "hotels" SET "deleted_at"=@p1 WHERE "hotels"."id" = @p2 AND "hotels"."deleted_at" IS NULL`).
+		WithArgs(sqlmock.AnyArg(), hotel.Id).WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
-	err = HotelClient.DeleteHotel(hotel)
+	err = HotelClient.DeleteHotel(context.Background(), hotel, cancelled)
 
 	a.Nil(err)
 
@@ -249,18 +269,25 @@ func TestUpdateHotel_Client(t *testing.T) {
 		StreetName:   "Sample Street",
 		StreetNumber: 123,
 		Rate:         4.5,
+		Version:      1,
 		Amenities:    model.Amenities{},
 		Images:       model.Images{},
 	}
 
+	// The hotel and its amenities are written in one transaction
 	mock.ExpectBegin()
-	mock.ExpectExec(`UPDATE "hotels" SET "name"=@p1,"room_amount"=@p2,"description"=@p3,"street_name"=@p4,"street_number"=@p5,"rate"=@p6 WHERE "id" = @p7`).
-		WithArgs(hotel.Name, hotel.RoomAmount, hotel.Description, hotel.StreetName, hotel.StreetNumber, hotel.Rate, hotel.Id).
+	mock.ExpectExec(`UPDATE "hotels" SET "name"=@p1,"room_amount"=@p2,"description"=@p3,"street_name"=@p4,"street_number"=@p5,"rate"=@p6,"draft"=@p7,"version"=@p8 WHERE version = @p9 AND "hotels"."deleted_at" IS NULL AND "id" = @p10`).
+		WithArgs(hotel.Name, hotel.RoomAmount, hotel.Description, hotel.StreetName, hotel.StreetNumber, hotel.Rate, hotel.Draft, 2, 1, hotel.Id).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`DELETE FROM "hotel_amenities" WHERE "hotel_amenities"."hotel_id" = @p1`).
+		WithArgs(hotel.Id).
+		WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectCommit()
 
-	result := HotelClient.UpdateHotel(hotel)
+	result, err := HotelClient.UpdateHotel(context.Background(), hotel)
+	a.Nil(err)
 
+	hotel.Version = 2
 	a.Equal(hotel, result)
 
 	// Check that all expectations were met
@@ -268,3 +295,43 @@ func TestUpdateHotel_Client(t *testing.T) {
 		t.Errorf("There were unfulfilled expectations: %v", err)
 	}
 }
+
+func TestUpdateHotel_Client_VersionConflict(t *testing.T) {
+	a := assert.New(t)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database")
+	}
+	defer db.Close()
+
+	gormDB, err := gorm.Open(sqlserver.New(sqlserver.Config{
+		DriverName: "sqlserver",
+		Conn:       db,
+	}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+	})
+	if err != nil {
+		t.Fatalf("Connection failed to open")
+	}
+
+	Db = gormDB
+	HotelClient = &hotelClient{}
+
+	hotel := model.Hotel{Id: 1, Name: "Sample Hotel", RoomAmount: 10, Rate: 4.5, Version: 1}
+
+	// Another update moved the hotel past version 1, the amenities are left alone
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "hotels" SET "name"=@p1,"room_amount"=@p2,"description"=@p3,"street_name"=@p4,"street_number"=@p5,"rate"=@p6,"draft"=@p7,"version"=@p8 WHERE version = @p9 AND "hotels"."deleted_at" IS NULL AND "id" = @p10`).
+		WithArgs(hotel.Name, hotel.RoomAmount, hotel.Description, hotel.StreetName, hotel.StreetNumber, hotel.Rate, hotel.Draft, 2, 1, hotel.Id).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	_, err = HotelClient.UpdateHotel(context.Background(), hotel)
+	a.ErrorIs(err, ErrVersionConflict)
+
+	// Check that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %v", err)
+	}
+}
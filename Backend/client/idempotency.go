@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"project/model"
+	"project/tracing"
+	"time"
+)
+
+type idempotencyClient struct{}
+
+type idempotencyClientInterface interface {
+	InsertIdempotencyKey(ctx context.Context, key model.IdempotencyKey) (model.IdempotencyKey, error)
+	GetIdempotencyKey(ctx context.Context, key string) (model.IdempotencyKey, error)
+	UpdateIdempotencyKey(ctx context.Context, key model.IdempotencyKey) error
+	DeleteIdempotencyKey(ctx context.Context, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+}
+
+var IdempotencyClient idempotencyClientInterface
+
+func init() {
+	IdempotencyClient = &idempotencyClient{}
+}
+
+// InsertIdempotencyKey returns ErrConflict when the key is already stored
+func (c idempotencyClient) InsertIdempotencyKey(ctx context.Context, key model.IdempotencyKey) (model.IdempotencyKey, error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyClient.InsertIdempotencyKey")
+	defer span.End()
+
+	result := Db.WithContext(ctx).Create(&key)
+
+	if result.Error != nil {
+		return key, translateError(result.Error)
+	}
+
+	log.Ctx(ctx).Debug("Idempotency key stored")
+	return key, nil
+}
+
+func (c idempotencyClient) GetIdempotencyKey(ctx context.Context, key string) (model.IdempotencyKey, error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyClient.GetIdempotencyKey")
+	defer span.End()
+
+	var idempotencyKey model.IdempotencyKey
+
+	err := Db.WithContext(ctx).Where("id = ?", key).First(&idempotencyKey).Error
+
+	return idempotencyKey, translateError(err)
+}
+
+// UpdateIdempotencyKey stores the response of the request
+func (c idempotencyClient) UpdateIdempotencyKey(ctx context.Context, key model.IdempotencyKey) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyClient.UpdateIdempotencyKey")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Model(&key).Select("Status", "ContentType", "Body").Updates(&key).Error
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Error("Failed to store the idempotent response")
+	}
+
+	return translateError(err)
+}
+
+func (c idempotencyClient) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyClient.DeleteIdempotencyKey")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Where("id = ?", key).Delete(&model.IdempotencyKey{}).Error
+
+	return translateError(err)
+}
+
+// DeleteExpiredIdempotencyKeys removes the keys expired at now, returning how many were removed
+func (c idempotencyClient) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyClient.DeleteExpiredIdempotencyKeys")
+	defer span.End()
+
+	result := Db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&model.IdempotencyKey{})
+
+	if result.Error != nil {
+		log.Ctx(ctx).WithError(result.Error).Error("Failed to delete expired idempotency keys")
+		return 0, translateError(result.Error)
+	}
+
+	log.Ctx(ctx).WithField("count", result.RowsAffected).Debug("Expired idempotency keys deleted")
+	return result.RowsAffected, nil
+}
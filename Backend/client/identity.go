@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"project/model"
+	"project/tracing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type identityClient struct{}
+
+type identityClientInterface interface {
+	GetIdentity(ctx context.Context, provider string, subject string) (model.ExternalIdentity, error)
+	InsertIdentity(ctx context.Context, identity model.ExternalIdentity) (model.ExternalIdentity, error)
+	InsertUserWithIdentity(ctx context.Context, user model.User, identity model.ExternalIdentity) (model.User, error)
+	InsertOidcLogin(ctx context.Context, login model.OidcLogin) error
+	TakeOidcLogin(ctx context.Context, provider string, stateHash string) (model.OidcLogin, error)
+	DeleteExpiredOidcLogins(ctx context.Context, now time.Time) (int64, error)
+}
+
+var IdentityClient identityClientInterface
+
+func init() {
+	IdentityClient = &identityClient{}
+}
+
+func (c identityClient) GetIdentity(ctx context.Context, provider string, subject string) (model.ExternalIdentity, error) {
+	ctx, span := tracing.Start(ctx, "IdentityClient.GetIdentity")
+	defer span.End()
+
+	var identity model.ExternalIdentity
+
+	err := Db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+
+	return identity, translateError(err)
+}
+
+// InsertIdentity links the identity to its user, ErrConflict is returned if it
+// is linked already
+func (c identityClient) InsertIdentity(ctx context.Context, identity model.ExternalIdentity) (model.ExternalIdentity, error) {
+	ctx, span := tracing.Start(ctx, "IdentityClient.InsertIdentity")
+	defer span.End()
+
+	result := Db.WithContext(ctx).Create(&identity)
+
+	if result.Error != nil {
+		log.Ctx(ctx).WithError(result.Error).Warn("Failed to link identity")
+		return identity, translateError(result.Error)
+	}
+
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": identity.UserId, "provider": identity.Provider}).Debug("Identity linked")
+	return identity, nil
+}
+
+// InsertUserWithIdentity creates the user and links the identity to it in one
+// transaction, ErrConflict is returned if either exists already
+func (c identityClient) InsertUserWithIdentity(ctx context.Context, user model.User, identity model.ExternalIdentity) (model.User, error) {
+	ctx, span := tracing.Start(ctx, "IdentityClient.InsertUserWithIdentity")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		identity.UserId = user.Id
+
+		return tx.Create(&identity).Error
+	})
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to insert user with identity")
+		return user, translateError(err)
+	}
+
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": user.Id, "provider": identity.Provider}).Debug("User created with identity")
+	return user, nil
+}
+
+func (c identityClient) InsertOidcLogin(ctx context.Context, login model.OidcLogin) error {
+	ctx, span := tracing.Start(ctx, "IdentityClient.InsertOidcLogin")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Create(&login).Error
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Error("Failed to insert login")
+	}
+
+	return translateError(err)
+}
+
+// TakeOidcLogin returns the login with the state and deletes it, so a state is
+// used once. ErrNotFound is returned if it doesn't exist or was used already.
+func (c identityClient) TakeOidcLogin(ctx context.Context, provider string, stateHash string) (model.OidcLogin, error) {
+	ctx, span := tracing.Start(ctx, "IdentityClient.TakeOidcLogin")
+	defer span.End()
+
+	var login model.OidcLogin
+
+	err := Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("provider = ? AND state_hash = ?", provider, stateHash).First(&login).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("id = ?", login.Id).Delete(&model.OidcLogin{})
+
+		// Taken by a concurrent request in between
+		if result.Error == nil && result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return result.Error
+	})
+
+	return login, translateError(err)
+}
+
+// DeleteExpiredOidcLogins removes the logins expired at now, returning how
+// many were removed
+func (c identityClient) DeleteExpiredOidcLogins(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := tracing.Start(ctx, "IdentityClient.DeleteExpiredOidcLogins")
+	defer span.End()
+
+	result := Db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&model.OidcLogin{})
+
+	if result.Error != nil {
+		log.Ctx(ctx).WithError(result.Error).Error("Failed to delete expired logins")
+		return 0, translateError(result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
@@ -1,19 +1,20 @@
 package client
 
 import (
-	log "github.com/sirupsen/logrus"
+	"context"
 	"project/model"
+	"project/tracing"
 )
 
 type imageClient struct{}
 
 type imageClientInterface interface {
-	InsertImage(image model.Image) model.Image
-	InsertImages(images model.Images) model.Images
-	GetImageById(id int) model.Image
-	GetImages() model.Images
-	GetImagesByHotelId(hotelId int) model.Images
-	DeleteImage(image model.Image) error
+	InsertImage(ctx context.Context, image model.Image) (model.Image, error)
+	InsertImages(ctx context.Context, images model.Images) (model.Images, error)
+	GetImageById(ctx context.Context, id int) (model.Image, error)
+	GetImages(ctx context.Context) (model.Images, error)
+	GetImagesByHotelId(ctx context.Context, hotelId int) (model.Images, error)
+	DeleteImage(ctx context.Context, image model.Image) error
 }
 
 var ImageClient imageClientInterface
@@ -22,71 +23,88 @@ func init() {
 	ImageClient = &imageClient{}
 }
 
-func (c imageClient) InsertImage(image model.Image) model.Image {
+func (c imageClient) InsertImage(ctx context.Context, image model.Image) (model.Image, error) {
+	ctx, span := tracing.Start(ctx, "ImageClient.InsertImage")
+	defer span.End()
 
-	result := Db.Create(&image)
+	result := Db.WithContext(ctx).Create(&image)
 
 	if result.Error != nil {
-		log.Error("Failed to insert image.")
-		return image
+		log.Ctx(ctx).WithError(result.Error).Error("Failed to insert image")
+		return image, translateError(result.Error)
 	}
 
-	log.Debug("Image created:", image.Id)
-	return image
+	log.Ctx(ctx).WithField("image_id", image.Id).Debug("Image created")
+	return image, nil
 }
 
-func (c imageClient) InsertImages(images model.Images) model.Images {
+func (c imageClient) InsertImages(ctx context.Context, images model.Images) (model.Images, error) {
+	ctx, span := tracing.Start(ctx, "ImageClient.InsertImages")
+	defer span.End()
 
 	for i := range images {
-		result := Db.Create(&images[i])
+		result := Db.WithContext(ctx).Create(&images[i])
 
 		if result.Error != nil {
-			log.Error("Failed to insert image.")
-			return images
+			log.Ctx(ctx).WithError(result.Error).Error("Failed to insert image")
+			return images, translateError(result.Error)
 		}
 
 		id := images[i].Id
-		Db.First(&images[i], id)
+		if err := Db.WithContext(ctx).First(&images[i], id).Error; err != nil {
+			return images, translateError(err)
+		}
 	}
 
-	return images
+	return images, nil
 }
 
-func (c imageClient) GetImageById(id int) model.Image {
+func (c imageClient) GetImageById(ctx context.Context, id int) (model.Image, error) {
+	ctx, span := tracing.Start(ctx, "ImageClient.GetImageById")
+	defer span.End()
+
 	var image model.Image
 
-	Db.Where("id = ?", id).First(&image)
-	log.Debug("Image: ", image)
+	err := Db.WithContext(ctx).Where("id = ?", id).First(&image).Error
+	log.Ctx(ctx).WithField("image_id", image.Id).Debug("Image loaded")
 
-	return image
+	return image, translateError(err)
 }
 
-func (c imageClient) GetImages() model.Images {
+func (c imageClient) GetImages(ctx context.Context) (model.Images, error) {
+	ctx, span := tracing.Start(ctx, "ImageClient.GetImages")
+	defer span.End()
+
 	var images model.Images
-	Db.Find(&images)
+	err := Db.WithContext(ctx).Find(&images).Error
 
-	log.Debug("Images: ", images)
+	log.Ctx(ctx).WithField("count", len(images)).Debug("Images loaded")
 
-	return images
+	return images, translateError(err)
 }
 
-func (c imageClient) GetImagesByHotelId(hotelId int) model.Images {
+func (c imageClient) GetImagesByHotelId(ctx context.Context, hotelId int) (model.Images, error) {
+	ctx, span := tracing.Start(ctx, "ImageClient.GetImagesByHotelId")
+	defer span.End()
+
 	var images model.Images
 
-	Db.Where("hotel_id = ?", hotelId).Find(&images)
-	log.Debug("Images: ", images)
+	err := Db.WithContext(ctx).Where("hotel_id = ?", hotelId).Find(&images).Error
+	log.Ctx(ctx).WithField("count", len(images)).Debug("Images loaded")
 
-	return images
+	return images, translateError(err)
 }
 
-func (c imageClient) DeleteImage(image model.Image) error {
+func (c imageClient) DeleteImage(ctx context.Context, image model.Image) error {
+	ctx, span := tracing.Start(ctx, "ImageClient.DeleteImage")
+	defer span.End()
 
-	err := Db.Delete(&image).Error
+	err := Db.WithContext(ctx).Delete(&image).Error
 
 	if err != nil {
-		log.Debug("Failed to delete image")
+		log.Ctx(ctx).WithError(err).Warn("Failed to delete image")
 	} else {
-		log.Debug("Image deleted: ", image.Id)
+		log.Ctx(ctx).WithField("image_id", image.Id).Debug("Image deleted")
 	}
-	return err
+	return translateError(err)
 }
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlserver"
@@ -44,7 +45,8 @@ func TestInsertImage_Client(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
 
-	result := ImageClient.InsertImage(image)
+	result, err := ImageClient.InsertImage(context.Background(), image)
+	a.Nil(err)
 
 	a.Equal(image, result)
 	a.Equal(1, result.Id)
@@ -90,8 +92,12 @@ func TestInsertImages_Client(t *testing.T) {
 		WithArgs(images[0].Path, images[0].HotelId, images[0].Id).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT * FROM "images" WHERE "images"."id" = @p1 AND "images"."id" = @p2 ORDER BY "images"."id" OFFSET 0 ROW FETCH NEXT 1 ROWS ONLY`).
+		WithArgs(images[0].Id, images[0].Id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "path", "hotel_id"}).AddRow(images[0].Id, images[0].Path, images[0].HotelId))
 
-	result := ImageClient.InsertImages(images)
+	result, err := ImageClient.InsertImages(context.Background(), images)
+	a.Nil(err)
 
 	a.Equal(images, result)
 
@@ -134,7 +140,8 @@ func TestGetImageById_Client(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id", "path", "hotel_id"}).
 			AddRow(image.Id, image.Path, image.HotelId))
 
-	result := ImageClient.GetImageById(image.Id)
+	result, err := ImageClient.GetImageById(context.Background(), image.Id)
+	a.Nil(err)
 
 	a.Equal(image, result)
 	a.Equal(1, image.Id)
@@ -186,7 +193,8 @@ func TestGetImages_Client(t *testing.T) {
 			AddRow(images[0].Id, images[0].Path, images[0].HotelId).
 			AddRow(images[1].Id, images[1].Path, images[1].HotelId))
 
-	result := ImageClient.GetImages()
+	result, err := ImageClient.GetImages(context.Background())
+	a.Nil(err)
 
 	a.Equal(images, result)
 
@@ -240,7 +248,8 @@ func TestGetImagesByHotelId_Client(t *testing.T) {
 			AddRow(images[0].Id, images[0].Path, images[0].HotelId).
 			AddRow(images[1].Id, images[1].Path, images[1].HotelId))
 
-	result := ImageClient.GetImagesByHotelId(hotelId)
+	result, err := ImageClient.GetImagesByHotelId(context.Background(), hotelId)
+	a.Nil(err)
 
 	a.Equal(images, result)
 
@@ -283,7 +292,7 @@ func TestDeleteImage_Client(t *testing.T) {
 		WithArgs(image.Id).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
-	err = ImageClient.DeleteImage(image)
+	err = ImageClient.DeleteImage(context.Background(), image)
 
 	a.Nil(err)
 
@@ -0,0 +1,743 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"project/client"
+	"project/db"
+	"project/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Integration tests run every client against a migrated, in-memory SQLite database
+
+func openTestDb(t *testing.T) {
+	conn, err := db.Open(db.SQLite, fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()))
+	if err != nil {
+		t.Fatalf("Connection failed to open: %v", err)
+	}
+
+	sqlDb, _ := conn.DB()
+	t.Cleanup(func() { sqlDb.Close() })
+
+	db.Use(conn)
+
+	if err := db.MigrateUp(); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+}
+
+func TestHotel_Integration(t *testing.T) {
+	a := assert.New(t)
+	openTestDb(t)
+	ctx := context.Background()
+
+	pool, err := client.AmenityClient.InsertAmenity(ctx, model.Amenity{Name: "Pool"})
+	a.Nil(err)
+	wifi, err := client.AmenityClient.InsertAmenity(ctx, model.Amenity{Name: "Wifi"})
+	a.Nil(err)
+
+	hotel, err := client.HotelClient.InsertHotel(ctx, model.Hotel{
+		Name:       "Hotel 1",
+		RoomAmount: 10,
+		Rate:       1500,
+		Amenities:  model.Amenities{pool},
+	})
+	a.Nil(err)
+	a.NotZero(hotel.Id)
+
+	images, err := client.ImageClient.InsertImages(ctx, model.Images{
+		{Path: "Images/1.jpg", HotelId: hotel.Id},
+		{Path: "Images/2.jpg", HotelId: hotel.Id},
+	})
+	a.Nil(err)
+	a.Len(images, 2)
+
+	result, err := client.HotelClient.GetHotelById(ctx, hotel.Id)
+	a.Nil(err)
+	a.Equal("Hotel 1", result.Name)
+	a.Len(result.Amenities, 1)
+	a.Len(result.Images, 2)
+
+	a.Equal(1, result.Version)
+
+	stale := result
+
+	result.Name = "Hotel 1 Updated"
+	result.Amenities = model.Amenities{wifi}
+	updated, err := client.HotelClient.UpdateHotel(ctx, result)
+	a.Nil(err)
+	a.Equal(2, updated.Version)
+
+	result, err = client.HotelClient.GetHotelById(ctx, hotel.Id)
+	a.Nil(err)
+	a.Equal("Hotel 1 Updated", result.Name)
+	a.Equal(2, result.Version)
+	a.Equal(model.Amenities{wifi}, result.Amenities)
+
+	// An update based on the first version is rejected and changes nothing
+	stale.Name = "Hotel 1 Stale"
+	stale.Amenities = model.Amenities{}
+	_, err = client.HotelClient.UpdateHotel(ctx, stale)
+	a.ErrorIs(err, client.ErrVersionConflict)
+
+	result, err = client.HotelClient.GetHotelById(ctx, hotel.Id)
+	a.Nil(err)
+	a.Equal("Hotel 1 Updated", result.Name)
+	a.Equal(model.Amenities{wifi}, result.Amenities)
+
+	hotels, err := client.HotelClient.GetHotels(ctx)
+	a.Nil(err)
+	a.Len(hotels, 1)
+
+	a.Nil(client.HotelClient.DeleteHotel(ctx, result, nil))
+
+	_, err = client.HotelClient.GetHotelById(ctx, hotel.Id)
+	a.ErrorIs(err, client.ErrNotFound)
+}
+
+func TestUser_Integration(t *testing.T) {
+	a := assert.New(t)
+	openTestDb(t)
+	ctx := context.Background()
+
+	user, err := client.UserClient.InsertUser(ctx, model.User{
+		Name:     "John",
+		LastName: "Doe",
+		Dni:      "12345678",
+		Email:    "johndoe@email.com",
+		Password: "hash",
+		Role:     "Customer",
+	})
+	a.Nil(err)
+	a.NotZero(user.Id)
+
+	result, err := client.UserClient.GetUserById(ctx, user.Id)
+	a.Nil(err)
+	a.Equal(user, result)
+
+	result, err = client.UserClient.GetUserByEmail(ctx, "johndoe@email.com")
+	a.Nil(err)
+	a.Equal(user, result)
+
+	_, err = client.UserClient.GetUserByEmail(ctx, "unknown@email.com")
+	a.ErrorIs(err, client.ErrNotFound)
+
+	_, err = client.UserClient.InsertUser(ctx, model.User{Name: "Jane", LastName: "Doe", Dni: "1", Email: "johndoe@email.com", Password: "hash", Role: "Customer"})
+	a.ErrorIs(err, client.ErrConflict)
+
+	users, err := client.UserClient.GetUsers(ctx)
+	a.Nil(err)
+	a.Len(users, 1)
+
+	// Only the profile fields are written
+	_, err = client.UserClient.UpdateUser(ctx, model.User{Id: user.Id, Name: "Johnny", LastName: "Doe", Dni: "12345678", Email: "johnny@email.com"})
+	a.Nil(err)
+
+	result, err = client.UserClient.GetUserById(ctx, user.Id)
+	a.Nil(err)
+	a.Equal("Johnny", result.Name)
+	a.Equal("johnny@email.com", result.Email)
+	a.Equal("hash", result.Password)
+	a.Equal("Customer", result.Role)
+
+	other, err := client.UserClient.InsertUser(ctx, model.User{Name: "Jane", LastName: "Doe", Dni: "1", Email: "jane@email.com", Password: "hash", Role: "Customer"})
+	a.Nil(err)
+
+	other.Email = "johnny@email.com"
+	_, err = client.UserClient.UpdateUser(ctx, other)
+	a.ErrorIs(err, client.ErrConflict)
+}
+
+func TestReservation_Integration(t *testing.T) {
+	a := assert.New(t)
+	openTestDb(t)
+	ctx := context.Background()
+
+	user, err := client.UserClient.InsertUser(ctx, model.User{Name: "John", LastName: "Doe", Dni: "1", Email: "john@email.com", Password: "hash", Role: "Customer"})
+	a.Nil(err)
+	hotel, err := client.HotelClient.InsertHotel(ctx, model.Hotel{Name: "Hotel 1", RoomAmount: 1, Rate: 1000})
+	a.Nil(err)
+
+	reservation, err := client.ReservationClient.InsertReservation(ctx, model.Reservation{
+		StartDate: "10-11-2030 15:00",
+		EndDate:   "12-11-2030 11:00",
+		UserId:    user.Id,
+		HotelId:   hotel.Id,
+		Amount:    2000,
+	})
+	a.Nil(err)
+	a.NotZero(reservation.Id)
+
+	result, err := client.ReservationClient.GetReservationById(ctx, reservation.Id)
+	a.Nil(err)
+	a.Equal(reservation, result)
+
+	reservations, err := client.ReservationClient.GetReservations(ctx)
+	a.Nil(err)
+	a.Len(reservations, 1)
+
+	reservations, err = client.ReservationClient.GetReservationsByUser(ctx, user.Id)
+	a.Nil(err)
+	a.Len(reservations, 1)
+
+	reservations, err = client.ReservationClient.GetReservationsByHotel(ctx, hotel.Id)
+	a.Nil(err)
+	a.Len(reservations, 1)
+
+	reservations, err = client.ReservationClient.GetReservationsByHotel(ctx, hotel.Id+1)
+	a.Nil(err)
+	a.Len(reservations, 0)
+
+	a.Nil(client.ReservationClient.DeleteReservation(ctx, reservation))
+
+	_, err = client.ReservationClient.GetReservationById(ctx, reservation.Id)
+	a.ErrorIs(err, client.ErrNotFound)
+}
+
+func TestSoftDelete_Integration(t *testing.T) {
+	a := assert.New(t)
+	openTestDb(t)
+	ctx := context.Background()
+
+	pool, err := client.AmenityClient.InsertAmenity(ctx, model.Amenity{Name: "Pool"})
+	a.Nil(err)
+	user, err := client.UserClient.InsertUser(ctx, model.User{Name: "John", LastName: "Doe", Dni: "1", Email: "john@email.com", Password: "hash", Role: "Customer"})
+	a.Nil(err)
+	hotel, err := client.HotelClient.InsertHotel(ctx, model.Hotel{Name: "Hotel 1", RoomAmount: 1, Rate: 1000, Amenities: model.Amenities{pool}})
+	a.Nil(err)
+	_, err = client.ImageClient.InsertImage(ctx, model.Image{Path: "Images/1.jpg", HotelId: hotel.Id})
+	a.Nil(err)
+	reservation, err := client.ReservationClient.InsertReservation(ctx, model.Reservation{StartDate: "10-11-2030 15:00", EndDate: "12-11-2030 11:00", UserId: user.Id, HotelId: hotel.Id, Amount: 2000})
+	a.Nil(err)
+	manager, err := client.UserClient.InsertUser(ctx, model.User{Name: "Ann", LastName: "Doe", Dni: "2", Email: "ann@email.com", Password: "hash", Role: "Manager"})
+	a.Nil(err)
+	a.Nil(client.AssignmentClient.AssignHotel(ctx, model.HotelAssignment{UserId: manager.Id, HotelId: hotel.Id}))
+
+	// The hotel goes along with the reservation it cancels
+	a.Nil(client.HotelClient.DeleteHotel(ctx, hotel, model.Reservations{reservation}))
+
+	_, err = client.HotelClient.GetHotelById(ctx, hotel.Id)
+	a.ErrorIs(err, client.ErrNotFound)
+	reservations, err := client.ReservationClient.GetReservationsByUser(ctx, user.Id)
+	a.Nil(err)
+	a.Len(reservations, 0)
+
+	hotels, err := client.HotelClient.GetDeletedHotels(ctx)
+	a.Nil(err)
+	a.Len(hotels, 1)
+	a.True(hotels[0].DeletedAt.Valid)
+
+	deleted, err := client.ReservationClient.GetDeletedReservationById(ctx, reservation.Id)
+	a.Nil(err)
+	a.Equal(reservation.HotelId, deleted.HotelId)
+
+	// A restored hotel has its amenities and images back
+	a.Nil(client.HotelClient.RestoreHotel(ctx, hotel.Id))
+	a.ErrorIs(client.HotelClient.RestoreHotel(ctx, hotel.Id), client.ErrNotFound)
+
+	result, err := client.HotelClient.GetHotelById(ctx, hotel.Id)
+	a.Nil(err)
+	a.Len(result.Amenities, 1)
+	a.Len(result.Images, 1)
+
+	a.Nil(client.ReservationClient.RestoreReservation(ctx, reservation.Id))
+	_, err = client.ReservationClient.GetReservationById(ctx, reservation.Id)
+	a.Nil(err)
+
+	a.Nil(client.UserClient.DeleteUser(ctx, user, model.Reservations{reservation}))
+	users, err := client.UserClient.GetDeletedUsers(ctx)
+	a.Nil(err)
+	a.Len(users, 1)
+	a.Nil(client.UserClient.RestoreUser(ctx, user.Id))
+	a.Nil(client.UserClient.DeleteUser(ctx, user, nil))
+
+	a.Nil(client.HotelClient.DeleteHotel(ctx, hotel, nil))
+
+	// Nothing was deleted before the cutoff
+	count, err := client.HotelClient.PurgeHotels(ctx, time.Now().Add(-time.Hour))
+	a.Nil(err)
+	a.Zero(count)
+
+	// The deleted reservation still references the hotel and the user
+	cutoff := time.Now().Add(time.Hour)
+
+	count, err = client.HotelClient.PurgeHotels(ctx, cutoff)
+	a.Nil(err)
+	a.Zero(count)
+	count, err = client.UserClient.PurgeUsers(ctx, cutoff)
+	a.Nil(err)
+	a.Zero(count)
+
+	count, err = client.ReservationClient.PurgeReservations(ctx, cutoff)
+	a.Nil(err)
+	a.Equal(int64(1), count)
+	count, err = client.HotelClient.PurgeHotels(ctx, cutoff)
+	a.Nil(err)
+	a.Equal(int64(1), count)
+	count, err = client.UserClient.PurgeUsers(ctx, cutoff)
+	a.Nil(err)
+	a.Equal(int64(1), count)
+
+	hotels, err = client.HotelClient.GetDeletedHotels(ctx)
+	a.Nil(err)
+	a.Len(hotels, 0)
+	images, err := client.ImageClient.GetImages(ctx)
+	a.Nil(err)
+	a.Len(images, 0)
+	a.ErrorIs(client.HotelClient.RestoreHotel(ctx, hotel.Id), client.ErrNotFound)
+
+	// Purged hotels are no longer assigned
+	hotelIds, err := client.AssignmentClient.GetAssignedHotelIds(ctx, manager.Id)
+	a.Nil(err)
+	a.Empty(hotelIds)
+
+	// The email of a purged user can be registered again
+	_, err = client.UserClient.InsertUser(ctx, model.User{Name: "John", LastName: "Doe", Dni: "1", Email: "john@email.com", Password: "hash", Role: "Customer"})
+	a.Nil(err)
+}
+
+func TestAmenity_Integration(t *testing.T) {
+	a := assert.New(t)
+	openTestDb(t)
+	ctx := context.Background()
+
+	pool, err := client.AmenityClient.InsertAmenity(ctx, model.Amenity{Name: "Pool"})
+	a.Nil(err)
+	a.NotZero(pool.Id)
+
+	_, err = client.AmenityClient.InsertAmenity(ctx, model.Amenity{Name: "Pool"})
+	a.ErrorIs(err, client.ErrConflict)
+
+	result, err := client.AmenityClient.GetAmenityByName(ctx, "Pool")
+	a.Nil(err)
+	a.Equal(pool, result)
+
+	result, err = client.AmenityClient.GetAmenityById(ctx, pool.Id)
+	a.Nil(err)
+	a.Equal(pool, result)
+
+	amenities, err := client.AmenityClient.GetAmenities(ctx)
+	a.Nil(err)
+	a.Len(amenities, 1)
+}
+
+func TestIdempotencyKey_Integration(t *testing.T) {
+	a := assert.New(t)
+	openTestDb(t)
+	ctx := context.Background()
+
+	now := time.Now()
+
+	_, err := client.IdempotencyClient.InsertIdempotencyKey(ctx, model.IdempotencyKey{Id: "key-1", Fingerprint: "abc", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	a.Nil(err)
+
+	_, err = client.IdempotencyClient.InsertIdempotencyKey(ctx, model.IdempotencyKey{Id: "key-1", Fingerprint: "def", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	a.ErrorIs(err, client.ErrConflict)
+
+	a.Nil(client.IdempotencyClient.UpdateIdempotencyKey(ctx, model.IdempotencyKey{Id: "key-1", Status: 201, ContentType: "application/json", Body: []byte(`{"id":1}`)}))
+
+	stored, err := client.IdempotencyClient.GetIdempotencyKey(ctx, "key-1")
+	a.Nil(err)
+	a.Equal("abc", stored.Fingerprint)
+	a.Equal(201, stored.Status)
+	a.Equal(`{"id":1}`, string(stored.Body))
+
+	_, err = client.IdempotencyClient.InsertIdempotencyKey(ctx, model.IdempotencyKey{Id: "key-2", Fingerprint: "abc", CreatedAt: now, ExpiresAt: now.Add(-time.Minute)})
+	a.Nil(err)
+
+	count, err := client.IdempotencyClient.DeleteExpiredIdempotencyKeys(ctx, now)
+	a.Nil(err)
+	a.Equal(int64(1), count)
+
+	_, err = client.IdempotencyClient.GetIdempotencyKey(ctx, "key-2")
+	a.ErrorIs(err, client.ErrNotFound)
+
+	a.Nil(client.IdempotencyClient.DeleteIdempotencyKey(ctx, "key-1"))
+
+	_, err = client.IdempotencyClient.GetIdempotencyKey(ctx, "key-1")
+	a.ErrorIs(err, client.ErrNotFound)
+}
+
+func TestAuditEntry_Integration(t *testing.T) {
+	a := assert.New(t)
+	openTestDb(t)
+	ctx := context.Background()
+
+	_, err := client.AuditClient.GetLastAuditEntry(ctx)
+	a.ErrorIs(err, client.ErrNotFound)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	first, err := client.AuditClient.InsertAuditEntry(ctx, model.AuditEntry{ActorId: 4, Action: "create", Entity: "hotel", EntityId: 1, CreatedAt: now, Hash: "h1"})
+	a.Nil(err)
+	second, err := client.AuditClient.InsertAuditEntry(ctx, model.AuditEntry{Action: "update", Entity: "hotel", EntityId: 1, CreatedAt: now.Add(time.Hour), PrevHash: "h1", Hash: "h2"})
+	a.Nil(err)
+	_, err = client.AuditClient.InsertAuditEntry(ctx, model.AuditEntry{Action: "create", Entity: "user", EntityId: 2, CreatedAt: now.Add(2 * time.Hour), PrevHash: "h2", Hash: "h3"})
+	a.Nil(err)
+
+	// Only one entry can follow another
+	_, err = client.AuditClient.InsertAuditEntry(ctx, model.AuditEntry{Action: "delete", Entity: "hotel", CreatedAt: now, PrevHash: "h1", Hash: "h4"})
+	a.ErrorIs(err, client.ErrConflict)
+
+	last, err := client.AuditClient.GetLastAuditEntry(ctx)
+	a.Nil(err)
+	a.Equal("h3", last.Hash)
+
+	entries, err := client.AuditClient.GetAuditEntries(ctx, client.AuditFilter{Entity: "hotel", EntityId: 1})
+	a.Nil(err)
+	a.Len(entries, 2)
+	a.Equal(second.Id, entries[0].Id)
+	a.True(now.Equal(entries[1].CreatedAt))
+
+	entries, err = client.AuditClient.GetAuditEntries(ctx, client.AuditFilter{ActorId: 4})
+	a.Nil(err)
+	a.Len(entries, 1)
+	a.Equal(first.Id, entries[0].Id)
+
+	entries, err = client.AuditClient.GetAuditEntries(ctx, client.AuditFilter{From: now.Add(time.Minute), To: now.Add(90 * time.Minute)})
+	a.Nil(err)
+	a.Len(entries, 1)
+	a.Equal("h2", entries[0].Hash)
+
+	entries, err = client.AuditClient.GetAuditEntries(ctx, client.AuditFilter{Limit: 1, Offset: 1})
+	a.Nil(err)
+	a.Len(entries, 1)
+	a.Equal("h2", entries[0].Hash)
+
+	var hashes []string
+	a.Nil(client.AuditClient.EachAuditEntry(ctx, client.AuditFilter{}, func(entry model.AuditEntry) error {
+		hashes = append(hashes, entry.Hash)
+		return nil
+	}))
+	a.Equal([]string{"h1", "h2", "h3"}, hashes)
+
+	hashes = nil
+	a.Nil(client.AuditClient.EachAuditEntry(ctx, client.AuditFilter{From: now.Add(time.Minute), Limit: 1}, func(entry model.AuditEntry) error {
+		hashes = append(hashes, entry.Hash)
+		return nil
+	}))
+	a.Equal([]string{"h2", "h3"}, hashes)
+}
+
+func TestUserToken_Integration(t *testing.T) {
+	a := assert.New(t)
+	openTestDb(t)
+	ctx := context.Background()
+
+	expires := time.Now().Add(time.Hour)
+
+	first, err := client.TokenClient.InsertToken(ctx, model.UserToken{UserId: 1, Purpose: "email_change", Hash: "h1", Email: "new@email.com", CreatedAt: time.Now(), ExpiresAt: expires})
+	a.Nil(err)
+	_, err = client.TokenClient.InsertToken(ctx, model.UserToken{UserId: 2, Purpose: "email_change", Hash: "h2", CreatedAt: time.Now(), ExpiresAt: expires})
+	a.Nil(err)
+
+	token, err := client.TokenClient.GetToken(ctx, "email_change", "h1")
+	a.Nil(err)
+	a.Equal(first.Id, token.Id)
+	a.Equal("new@email.com", token.Email)
+
+	_, err = client.TokenClient.GetToken(ctx, "other", "h1")
+	a.ErrorIs(err, client.ErrNotFound)
+
+	// A new token replaces the one sent before to the same user
+	second, err := client.TokenClient.InsertToken(ctx, model.UserToken{UserId: 1, Purpose: "email_change", Hash: "h3", CreatedAt: time.Now(), ExpiresAt: expires})
+	a.Nil(err)
+
+	_, err = client.TokenClient.GetToken(ctx, "email_change", "h1")
+	a.ErrorIs(err, client.ErrNotFound)
+	_, err = client.TokenClient.GetToken(ctx, "email_change", "h2")
+	a.Nil(err)
+
+	a.Nil(client.TokenClient.DeleteToken(ctx, second.Id))
+	a.ErrorIs(client.TokenClient.DeleteToken(ctx, second.Id), client.ErrNotFound)
+
+	_, err = client.TokenClient.InsertToken(ctx, model.UserToken{UserId: 1, Purpose: "password_reset", Hash: "h4", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(-time.Minute)})
+	a.Nil(err)
+
+	count, err := client.TokenClient.DeleteExpiredTokens(ctx, time.Now())
+	a.Nil(err)
+	a.Equal(int64(1), count)
+
+	_, err = client.TokenClient.GetToken(ctx, "password_reset", "h4")
+	a.ErrorIs(err, client.ErrNotFound)
+	_, err = client.TokenClient.GetToken(ctx, "email_change", "h2")
+	a.Nil(err)
+}
+
+func TestUserRole_Integration(t *testing.T) {
+	a := assert.New(t)
+	openTestDb(t)
+	ctx := context.Background()
+
+	admin, err := client.UserClient.InsertUser(ctx, model.User{Name: "Ann", LastName: "Doe", Dni: "12345678", Email: "ann@email.com", Password: "hash", Role: "Admin"})
+	a.Nil(err)
+	user, err := client.UserClient.InsertUser(ctx, model.User{Name: "Jane", LastName: "Doe", Dni: "87654321", Email: "jane@email.com", Password: "hash", Role: "Customer"})
+	a.Nil(err)
+
+	count, err := client.UserClient.CountActiveUsersByRole(ctx, "Admin")
+	a.Nil(err)
+	a.Equal(int64(1), count)
+
+	a.Nil(client.UserClient.UpdateRole(ctx, user.Id, "Admin"))
+	a.Nil(client.UserClient.UpdateDisabled(ctx, admin.Id, true))
+
+	// Disabled admins don't count
+	count, err = client.UserClient.CountActiveUsersByRole(ctx, "Admin")
+	a.Nil(err)
+	a.Equal(int64(1), count)
+
+	result, err := client.UserClient.GetUserById(ctx, admin.Id)
+	a.Nil(err)
+	a.True(result.Disabled)
+	a.Equal("Admin", result.Role)
+
+	result, err = client.UserClient.GetUserById(ctx, user.Id)
+	a.Nil(err)
+	a.False(result.Disabled)
+	a.Equal("Admin", result.Role)
+}
+
+func TestAnonymizeUser_Integration(t *testing.T) {
+	a := assert.New(t)
+	openTestDb(t)
+	ctx := context.Background()
+
+	user, err := client.UserClient.InsertUser(ctx, model.User{Name: "Jane", LastName: "Doe", Dni: "12345678", Email: "jane@email.com", Password: "hash", Role: "Customer"})
+	a.Nil(err)
+	hotel, err := client.HotelClient.InsertHotel(ctx, model.Hotel{Name: "Hotel", RoomAmount: 5, Rate: 100})
+	a.Nil(err)
+
+	past, err := client.ReservationClient.InsertReservation(ctx, model.Reservation{StartDate: "01-01-2024 10:00", EndDate: "05-01-2024 10:00", UserId: user.Id, HotelId: hotel.Id, Amount: 400})
+	a.Nil(err)
+	future, err := client.ReservationClient.InsertReservation(ctx, model.Reservation{StartDate: "01-01-2099 10:00", EndDate: "05-01-2099 10:00", UserId: user.Id, HotelId: hotel.Id, Amount: 400})
+	a.Nil(err)
+
+	_, err = client.TokenClient.InsertToken(ctx, model.UserToken{UserId: user.Id, Purpose: "email_change", Hash: "h1", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)})
+	a.Nil(err)
+	a.Nil(client.MfaClient.SaveMfa(ctx, model.UserMfa{UserId: user.Id, Secret: "JBSWY3DPEHPK3PXP", CreatedAt: time.Now()}))
+	a.Nil(client.MfaClient.EnableMfa(ctx, user.Id, 1, model.RecoveryCodes{{UserId: user.Id, Hash: "r1", CreatedAt: time.Now()}}))
+	_, err = client.IdentityClient.InsertIdentity(ctx, model.ExternalIdentity{UserId: user.Id, Provider: "google", Subject: "1234", CreatedAt: time.Now()})
+	a.Nil(err)
+
+	a.Nil(client.UserClient.UpdatePassword(ctx, user.Id, "new-hash"))
+
+	// A new password revokes the login tokens issued before
+	updated, err := client.UserClient.GetUserById(ctx, user.Id)
+	a.Nil(err)
+	a.Equal("new-hash", updated.Password)
+	a.Equal(user.TokenVersion+1, updated.TokenVersion)
+
+	user.Name, user.LastName, user.Dni, user.Email, user.Password = "Deleted", "User", "", "deleted@invalid", ""
+	a.Nil(client.UserClient.AnonymizeUser(ctx, user, model.Reservations{future}))
+
+	_, err = client.UserClient.GetUserById(ctx, user.Id)
+	a.ErrorIs(err, client.ErrNotFound)
+
+	// The email is free to register again
+	_, err = client.UserClient.GetUserByEmail(ctx, "jane@email.com")
+	a.ErrorIs(err, client.ErrNotFound)
+
+	deleted, err := client.UserClient.GetDeletedUsers(ctx)
+	a.Nil(err)
+	a.Len(deleted, 1)
+	a.Equal("Deleted", deleted[0].Name)
+	a.Equal("deleted@invalid", deleted[0].Email)
+	a.Empty(deleted[0].Password)
+
+	// The past reservation is kept, the one that hadn't started is cancelled
+	reservations, err := client.ReservationClient.GetReservationsByUser(ctx, user.Id)
+	a.Nil(err)
+	a.Len(reservations, 1)
+	a.Equal(past.Id, reservations[0].Id)
+
+	_, err = client.TokenClient.GetToken(ctx, "email_change", "h1")
+	a.ErrorIs(err, client.ErrNotFound)
+
+	hotelIds, err := client.AssignmentClient.GetAssignedHotelIds(ctx, user.Id)
+	a.Nil(err)
+	a.Empty(hotelIds)
+
+	_, err = client.MfaClient.GetMfa(ctx, user.Id)
+	a.ErrorIs(err, client.ErrNotFound)
+	count, err := client.MfaClient.CountRecoveryCodes(ctx, user.Id)
+	a.Nil(err)
+	a.Zero(count)
+
+	// The account at the provider can sign up again
+	_, err = client.IdentityClient.GetIdentity(ctx, "google", "1234")
+	a.ErrorIs(err, client.ErrNotFound)
+}
+
+func TestUserMfa_Integration(t *testing.T) {
+	a := assert.New(t)
+	openTestDb(t)
+	ctx := context.Background()
+
+	user, err := client.UserClient.InsertUser(ctx, model.User{Name: "Ann", LastName: "Doe", Dni: "12345678", Email: "ann@email.com", Password: "hash", Role: "Admin"})
+	a.Nil(err)
+
+	_, err = client.MfaClient.GetMfa(ctx, user.Id)
+	a.ErrorIs(err, client.ErrNotFound)
+
+	// Starting over replaces the secret that wasn't confirmed
+	a.Nil(client.MfaClient.SaveMfa(ctx, model.UserMfa{UserId: user.Id, Secret: "SECRET1", CreatedAt: time.Now()}))
+	a.Nil(client.MfaClient.SaveMfa(ctx, model.UserMfa{UserId: user.Id, Secret: "SECRET2", CreatedAt: time.Now()}))
+
+	mfa, err := client.MfaClient.GetMfa(ctx, user.Id)
+	a.Nil(err)
+	a.Equal("SECRET2", mfa.Secret)
+	a.False(mfa.Enabled)
+
+	// Codes are only accepted once enabled
+	a.ErrorIs(client.MfaClient.UseStep(ctx, user.Id, 100), client.ErrNotFound)
+
+	codes := model.RecoveryCodes{
+		{UserId: user.Id, Hash: "h1", CreatedAt: time.Now()},
+		{UserId: user.Id, Hash: "h2", CreatedAt: time.Now()},
+	}
+	a.Nil(client.MfaClient.EnableMfa(ctx, user.Id, 100, codes))
+	a.ErrorIs(client.MfaClient.EnableMfa(ctx, user.Id, 100, codes), client.ErrNotFound)
+
+	mfa, err = client.MfaClient.GetMfa(ctx, user.Id)
+	a.Nil(err)
+	a.True(mfa.Enabled)
+	a.Equal(int64(100), mfa.LastStep)
+
+	// A step can't be used twice, nor an earlier one
+	a.ErrorIs(client.MfaClient.UseStep(ctx, user.Id, 100), client.ErrNotFound)
+	a.Nil(client.MfaClient.UseStep(ctx, user.Id, 101))
+	a.ErrorIs(client.MfaClient.UseStep(ctx, user.Id, 99), client.ErrNotFound)
+
+	a.Nil(client.MfaClient.UseRecoveryCode(ctx, user.Id, "h1"))
+	a.ErrorIs(client.MfaClient.UseRecoveryCode(ctx, user.Id, "h1"), client.ErrNotFound)
+
+	count, err := client.MfaClient.CountRecoveryCodes(ctx, user.Id)
+	a.Nil(err)
+	a.Equal(int64(1), count)
+
+	a.Nil(client.MfaClient.ReplaceRecoveryCodes(ctx, user.Id, model.RecoveryCodes{
+		{UserId: user.Id, Hash: "h3", CreatedAt: time.Now()},
+		{UserId: user.Id, Hash: "h4", CreatedAt: time.Now()},
+		{UserId: user.Id, Hash: "h5", CreatedAt: time.Now()},
+	}))
+	a.ErrorIs(client.MfaClient.UseRecoveryCode(ctx, user.Id, "h2"), client.ErrNotFound)
+
+	count, err = client.MfaClient.CountRecoveryCodes(ctx, user.Id)
+	a.Nil(err)
+	a.Equal(int64(3), count)
+
+	a.Nil(client.MfaClient.DeleteMfa(ctx, user.Id))
+	a.ErrorIs(client.MfaClient.DeleteMfa(ctx, user.Id), client.ErrNotFound)
+
+	count, err = client.MfaClient.CountRecoveryCodes(ctx, user.Id)
+	a.Nil(err)
+	a.Zero(count)
+}
+
+func TestExternalIdentity_Integration(t *testing.T) {
+	a := assert.New(t)
+	openTestDb(t)
+	ctx := context.Background()
+
+	user, err := client.IdentityClient.InsertUserWithIdentity(ctx,
+		model.User{Name: "Ann", LastName: "Doe", Email: "ann@email.com", Role: "Customer", EmailVerified: true},
+		model.ExternalIdentity{Provider: "google", Subject: "1234", Email: "ann@email.com", CreatedAt: time.Now()})
+	a.Nil(err)
+	a.NotZero(user.Id)
+
+	identity, err := client.IdentityClient.GetIdentity(ctx, "google", "1234")
+	a.Nil(err)
+	a.Equal(user.Id, identity.UserId)
+
+	// The subject is unique per provider only
+	_, err = client.IdentityClient.GetIdentity(ctx, "microsoft", "1234")
+	a.ErrorIs(err, client.ErrNotFound)
+
+	_, err = client.IdentityClient.InsertIdentity(ctx, model.ExternalIdentity{UserId: user.Id, Provider: "microsoft", Subject: "1234", CreatedAt: time.Now()})
+	a.Nil(err)
+
+	_, err = client.IdentityClient.InsertIdentity(ctx, model.ExternalIdentity{UserId: 99, Provider: "google", Subject: "1234", CreatedAt: time.Now()})
+	a.ErrorIs(err, client.ErrConflict)
+
+	// Nothing is created when the email is taken
+	_, err = client.IdentityClient.InsertUserWithIdentity(ctx,
+		model.User{Name: "Ann", LastName: "Doe", Email: "ann@email.com", Role: "Customer"},
+		model.ExternalIdentity{Provider: "google", Subject: "5678", CreatedAt: time.Now()})
+	a.ErrorIs(err, client.ErrConflict)
+
+	_, err = client.IdentityClient.GetIdentity(ctx, "google", "5678")
+	a.ErrorIs(err, client.ErrNotFound)
+
+	now := time.Now()
+	a.Nil(client.IdentityClient.InsertOidcLogin(ctx, model.OidcLogin{Provider: "google", StateHash: "s1", Nonce: "n1", Verifier: "v1", CreatedAt: now, ExpiresAt: now.Add(time.Minute)}))
+	a.Nil(client.IdentityClient.InsertOidcLogin(ctx, model.OidcLogin{Provider: "google", StateHash: "s2", Nonce: "n2", Verifier: "v2", CreatedAt: now, ExpiresAt: now.Add(-time.Minute)}))
+
+	// A state belongs to its provider and is used once
+	_, err = client.IdentityClient.TakeOidcLogin(ctx, "microsoft", "s1")
+	a.ErrorIs(err, client.ErrNotFound)
+
+	login, err := client.IdentityClient.TakeOidcLogin(ctx, "google", "s1")
+	a.Nil(err)
+	a.Equal("v1", login.Verifier)
+	a.Equal("n1", login.Nonce)
+
+	_, err = client.IdentityClient.TakeOidcLogin(ctx, "google", "s1")
+	a.ErrorIs(err, client.ErrNotFound)
+
+	count, err := client.IdentityClient.DeleteExpiredOidcLogins(ctx, now)
+	a.Nil(err)
+	a.Equal(int64(1), count)
+}
+
+func TestHotelAssignment_Integration(t *testing.T) {
+	a := assert.New(t)
+	openTestDb(t)
+	ctx := context.Background()
+
+	manager, err := client.UserClient.InsertUser(ctx, model.User{Name: "Ann", LastName: "Doe", Dni: "12345678", Email: "ann@email.com", Password: "hash", Role: "Manager"})
+	a.Nil(err)
+	user, err := client.UserClient.InsertUser(ctx, model.User{Name: "Jane", LastName: "Doe", Dni: "87654321", Email: "jane@email.com", Password: "hash", Role: "Customer"})
+	a.Nil(err)
+	hotel1, err := client.HotelClient.InsertHotel(ctx, model.Hotel{Name: "Hotel 1", RoomAmount: 5, Rate: 100})
+	a.Nil(err)
+	hotel2, err := client.HotelClient.InsertHotel(ctx, model.Hotel{Name: "Hotel 2", RoomAmount: 5, Rate: 100})
+	a.Nil(err)
+	hotel3, err := client.HotelClient.InsertHotel(ctx, model.Hotel{Name: "Hotel 3", RoomAmount: 5, Rate: 100})
+	a.Nil(err)
+
+	// Assigning a hotel twice is not an error
+	a.Nil(client.AssignmentClient.AssignHotel(ctx, model.HotelAssignment{UserId: manager.Id, HotelId: hotel2.Id}))
+	a.Nil(client.AssignmentClient.AssignHotel(ctx, model.HotelAssignment{UserId: manager.Id, HotelId: hotel1.Id}))
+	a.Nil(client.AssignmentClient.AssignHotel(ctx, model.HotelAssignment{UserId: manager.Id, HotelId: hotel1.Id}))
+
+	hotelIds, err := client.AssignmentClient.GetAssignedHotelIds(ctx, manager.Id)
+	a.Nil(err)
+	a.Equal([]int{hotel1.Id, hotel2.Id}, hotelIds)
+
+	for _, hotelId := range []int{hotel1.Id, hotel2.Id, hotel3.Id} {
+		_, err = client.ReservationClient.InsertReservation(ctx, model.Reservation{StartDate: "01-01-2099 10:00", EndDate: "05-01-2099 10:00", UserId: user.Id, HotelId: hotelId, Amount: 400})
+		a.Nil(err)
+	}
+
+	reservations, err := client.ReservationClient.GetReservationsByHotels(ctx, hotelIds)
+	a.Nil(err)
+	a.Len(reservations, 2)
+	for _, reservation := range reservations {
+		a.NotEqual(hotel3.Id, reservation.HotelId)
+	}
+
+	reservations, err = client.ReservationClient.GetReservationsByHotels(ctx, nil)
+	a.Nil(err)
+	a.Empty(reservations)
+
+	a.Nil(client.AssignmentClient.UnassignHotel(ctx, manager.Id, hotel2.Id))
+	a.ErrorIs(client.AssignmentClient.UnassignHotel(ctx, manager.Id, hotel2.Id), client.ErrNotFound)
+
+	hotelIds, err = client.AssignmentClient.GetAssignedHotelIds(ctx, manager.Id)
+	a.Nil(err)
+	a.Equal([]int{hotel1.Id}, hotelIds)
+}
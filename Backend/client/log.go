@@ -0,0 +1,5 @@
+package client
+
+import "project/logging"
+
+var log = logging.Package("client")
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"project/model"
+	"project/tracing"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type mfaClient struct{}
+
+type mfaClientInterface interface {
+	GetMfa(ctx context.Context, userId int) (model.UserMfa, error)
+	SaveMfa(ctx context.Context, mfa model.UserMfa) error
+	EnableMfa(ctx context.Context, userId int, step int64, codes model.RecoveryCodes) error
+	UseStep(ctx context.Context, userId int, step int64) error
+	DeleteMfa(ctx context.Context, userId int) error
+	ReplaceRecoveryCodes(ctx context.Context, userId int, codes model.RecoveryCodes) error
+	UseRecoveryCode(ctx context.Context, userId int, hash string) error
+	CountRecoveryCodes(ctx context.Context, userId int) (int64, error)
+}
+
+var MfaClient mfaClientInterface
+
+func init() {
+	MfaClient = &mfaClient{}
+}
+
+func (c mfaClient) GetMfa(ctx context.Context, userId int) (model.UserMfa, error) {
+	ctx, span := tracing.Start(ctx, "MfaClient.GetMfa")
+	defer span.End()
+
+	var mfa model.UserMfa
+
+	err := Db.WithContext(ctx).Where("user_id = ?", userId).First(&mfa).Error
+
+	return mfa, translateError(err)
+}
+
+// SaveMfa stores the second factor of the user in place of the one it had
+func (c mfaClient) SaveMfa(ctx context.Context, mfa model.UserMfa) error {
+	ctx, span := tracing.Start(ctx, "MfaClient.SaveMfa")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", mfa.UserId).Delete(&model.UserMfa{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&mfa).Error
+	})
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Error("Failed to save second factor")
+		return translateError(err)
+	}
+
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": mfa.UserId, "enabled": mfa.Enabled}).Debug("Second factor saved")
+	return nil
+}
+
+// EnableMfa turns on the second factor of the user, with the step of the code
+// that confirmed it and its first recovery codes, in one transaction
+func (c mfaClient) EnableMfa(ctx context.Context, userId int, step int64, codes model.RecoveryCodes) error {
+	ctx, span := tracing.Start(ctx, "MfaClient.EnableMfa")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.UserMfa{}).Where("user_id = ? AND enabled = ?", userId, false).
+			Updates(map[string]any{"enabled": true, "last_step": step})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return replaceRecoveryCodes(tx, userId, codes)
+	})
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to enable second factor")
+		return translateError(err)
+	}
+
+	log.Ctx(ctx).WithField("user_id", userId).Debug("Second factor enabled")
+	return nil
+}
+
+// UseStep records that the code of the step was used. ErrNotFound is returned
+// when a code of that step or a later one was used already.
+func (c mfaClient) UseStep(ctx context.Context, userId int, step int64) error {
+	ctx, span := tracing.Start(ctx, "MfaClient.UseStep")
+	defer span.End()
+
+	result := Db.WithContext(ctx).Model(&model.UserMfa{}).Where("user_id = ? AND enabled = ? AND last_step < ?", userId, true, step).
+		Update("last_step", step)
+
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return translateError(result.Error)
+}
+
+// DeleteMfa removes the second factor of the user and its recovery codes,
+// ErrNotFound is returned if it had none
+func (c mfaClient) DeleteMfa(ctx context.Context, userId int) error {
+	ctx, span := tracing.Start(ctx, "MfaClient.DeleteMfa")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("user_id = ?", userId).Delete(&model.UserMfa{})
+
+		if result.Error == nil && result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return result.Error
+	})
+
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Ctx(ctx).WithError(err).Warn("Failed to delete second factor")
+	}
+
+	return translateError(err)
+}
+
+// ReplaceRecoveryCodes stores the codes in place of the ones the user had
+func (c mfaClient) ReplaceRecoveryCodes(ctx context.Context, userId int, codes model.RecoveryCodes) error {
+	ctx, span := tracing.Start(ctx, "MfaClient.ReplaceRecoveryCodes")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userId, codes)
+	})
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Error("Failed to replace recovery codes")
+		return translateError(err)
+	}
+
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": userId, "count": len(codes)}).Debug("Recovery codes replaced")
+	return nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userId int, codes model.RecoveryCodes) error {
+	if err := tx.Where("user_id = ?", userId).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+
+	if len(codes) == 0 {
+		return nil
+	}
+
+	return tx.Create(&codes).Error
+}
+
+// UseRecoveryCode uses up the code of the user with the hash, ErrNotFound is
+// returned if it doesn't exist or was already used
+func (c mfaClient) UseRecoveryCode(ctx context.Context, userId int, hash string) error {
+	ctx, span := tracing.Start(ctx, "MfaClient.UseRecoveryCode")
+	defer span.End()
+
+	result := Db.WithContext(ctx).Where("user_id = ? AND hash = ?", userId, hash).Delete(&model.RecoveryCode{})
+
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return translateError(result.Error)
+}
+
+func (c mfaClient) CountRecoveryCodes(ctx context.Context, userId int) (int64, error) {
+	ctx, span := tracing.Start(ctx, "MfaClient.CountRecoveryCodes")
+	defer span.End()
+
+	var count int64
+
+	err := Db.WithContext(ctx).Model(&model.RecoveryCode{}).Where("user_id = ?", userId).Count(&count).Error
+
+	return count, translateError(err)
+}
@@ -1,19 +1,26 @@
 package client
 
 import (
-	log "github.com/sirupsen/logrus"
+	"context"
 	"project/model"
+	"project/tracing"
+	"time"
 )
 
 type reservationClient struct{}
 
 type reservationClientInterface interface {
-	InsertReservation(reservation model.Reservation) model.Reservation
-	GetReservationById(id int) model.Reservation
-	GetReservations() model.Reservations
-	GetReservationsByUser(userId int) model.Reservations
-	GetReservationsByHotel(hotelId int) model.Reservations
-	DeleteReservation(reservation model.Reservation) error
+	InsertReservation(ctx context.Context, reservation model.Reservation) (model.Reservation, error)
+	GetReservationById(ctx context.Context, id int) (model.Reservation, error)
+	GetReservations(ctx context.Context) (model.Reservations, error)
+	GetReservationsByUser(ctx context.Context, userId int) (model.Reservations, error)
+	GetReservationsByHotel(ctx context.Context, hotelId int) (model.Reservations, error)
+	GetReservationsByHotels(ctx context.Context, hotelIds []int) (model.Reservations, error)
+	DeleteReservation(ctx context.Context, reservation model.Reservation) error
+	GetDeletedReservations(ctx context.Context) (model.Reservations, error)
+	GetDeletedReservationById(ctx context.Context, id int) (model.Reservation, error)
+	RestoreReservation(ctx context.Context, id int) error
+	PurgeReservations(ctx context.Context, before time.Time) (int64, error)
 }
 
 var ReservationClient reservationClientInterface
@@ -22,62 +29,150 @@ func init() {
 	ReservationClient = &reservationClient{}
 }
 
-func (c reservationClient) InsertReservation(reservation model.Reservation) model.Reservation {
+func (c reservationClient) InsertReservation(ctx context.Context, reservation model.Reservation) (model.Reservation, error) {
+	ctx, span := tracing.Start(ctx, "ReservationClient.InsertReservation")
+	defer span.End()
 
-	result := Db.Create(&reservation)
+	result := Db.WithContext(ctx).Create(&reservation)
 
 	if result.Error != nil {
-		log.Error("Failed to insert reservation.")
-		return reservation
+		log.Ctx(ctx).WithError(result.Error).Error("Failed to insert reservation")
+		return reservation, translateError(result.Error)
 	}
 
-	log.Debug("Reservation created:", reservation.Id)
-	return reservation
+	log.Ctx(ctx).WithField("reservation_id", reservation.Id).Debug("Reservation created")
+	return reservation, nil
 }
 
-func (c reservationClient) GetReservationById(id int) model.Reservation {
+func (c reservationClient) GetReservationById(ctx context.Context, id int) (model.Reservation, error) {
+	ctx, span := tracing.Start(ctx, "ReservationClient.GetReservationById")
+	defer span.End()
+
 	var reservation model.Reservation
 
-	Db.Where("id = ?", id).First(&reservation)
-	log.Debug("Reservation: ", reservation)
+	err := Db.WithContext(ctx).Where("id = ?", id).First(&reservation).Error
+	log.Ctx(ctx).WithField("reservation_id", reservation.Id).Debug("Reservation loaded")
 
-	return reservation
+	return reservation, translateError(err)
 }
 
-func (c reservationClient) GetReservations() model.Reservations {
+func (c reservationClient) GetReservations(ctx context.Context) (model.Reservations, error) {
+	ctx, span := tracing.Start(ctx, "ReservationClient.GetReservations")
+	defer span.End()
+
 	var reservations model.Reservations
-	Db.Find(&reservations)
+	err := Db.WithContext(ctx).Find(&reservations).Error
 
-	log.Debug("Reservations: ", reservations)
+	log.Ctx(ctx).WithField("count", len(reservations)).Debug("Reservations loaded")
 
-	return reservations
+	return reservations, translateError(err)
 }
 
-func (c reservationClient) GetReservationsByUser(userId int) model.Reservations {
+func (c reservationClient) GetReservationsByUser(ctx context.Context, userId int) (model.Reservations, error) {
+	ctx, span := tracing.Start(ctx, "ReservationClient.GetReservationsByUser")
+	defer span.End()
+
 	var reservations model.Reservations
 
-	Db.Where("user_id = ?", userId).Find(&reservations)
-	log.Debug("Reservations: ", reservations)
+	err := Db.WithContext(ctx).Where("user_id = ?", userId).Find(&reservations).Error
+	log.Ctx(ctx).WithField("count", len(reservations)).Debug("Reservations loaded")
 
-	return reservations
+	return reservations, translateError(err)
 }
 
-func (c reservationClient) GetReservationsByHotel(hotelId int) model.Reservations {
+func (c reservationClient) GetReservationsByHotel(ctx context.Context, hotelId int) (model.Reservations, error) {
+	ctx, span := tracing.Start(ctx, "ReservationClient.GetReservationsByHotel")
+	defer span.End()
+
 	var reservations model.Reservations
 
-	Db.Where("hotel_id = ?", hotelId).Find(&reservations)
-	log.Debug("Reservations: ", reservations)
+	err := Db.WithContext(ctx).Where("hotel_id = ?", hotelId).Find(&reservations).Error
+	log.Ctx(ctx).WithField("count", len(reservations)).Debug("Reservations loaded")
 
-	return reservations
+	return reservations, translateError(err)
 }
 
-func (c reservationClient) DeleteReservation(reservation model.Reservation) error {
-	err := Db.Delete(&reservation).Error
+// GetReservationsByHotels returns the reservations of any of the hotels,
+// without querying when there are none
+func (c reservationClient) GetReservationsByHotels(ctx context.Context, hotelIds []int) (model.Reservations, error) {
+	ctx, span := tracing.Start(ctx, "ReservationClient.GetReservationsByHotels")
+	defer span.End()
+
+	var reservations model.Reservations
+
+	if len(hotelIds) == 0 {
+		return reservations, nil
+	}
+
+	err := Db.WithContext(ctx).Where("hotel_id IN ?", hotelIds).Find(&reservations).Error
+	log.Ctx(ctx).WithField("count", len(reservations)).Debug("Reservations loaded")
+
+	return reservations, translateError(err)
+}
+
+func (c reservationClient) DeleteReservation(ctx context.Context, reservation model.Reservation) error {
+	ctx, span := tracing.Start(ctx, "ReservationClient.DeleteReservation")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Delete(&reservation).Error
 
 	if err != nil {
-		log.Debug("Failed to delete reservation")
+		log.Ctx(ctx).WithError(err).Warn("Failed to delete reservation")
 	} else {
-		log.Debug("Reservation deleted: ", reservation.Id)
+		log.Ctx(ctx).WithField("reservation_id", reservation.Id).Debug("Reservation deleted")
+	}
+	return translateError(err)
+}
+
+func (c reservationClient) GetDeletedReservations(ctx context.Context) (model.Reservations, error) {
+	ctx, span := tracing.Start(ctx, "ReservationClient.GetDeletedReservations")
+	defer span.End()
+
+	var reservations model.Reservations
+	err := Db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").Find(&reservations).Error
+
+	log.Ctx(ctx).WithField("count", len(reservations)).Debug("Deleted reservations loaded")
+
+	return reservations, translateError(err)
+}
+
+func (c reservationClient) GetDeletedReservationById(ctx context.Context, id int) (model.Reservation, error) {
+	ctx, span := tracing.Start(ctx, "ReservationClient.GetDeletedReservationById")
+	defer span.End()
+
+	var reservation model.Reservation
+
+	err := Db.WithContext(ctx).Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&reservation).Error
+
+	return reservation, translateError(err)
+}
+
+// RestoreReservation undeletes the reservation, ErrNotFound is returned if it isn't deleted
+func (c reservationClient) RestoreReservation(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "ReservationClient.RestoreReservation")
+	defer span.End()
+
+	result := Db.WithContext(ctx).Unscoped().Model(&model.Reservation{}).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
 	}
-	return err
+
+	log.Ctx(ctx).WithField("reservation_id", id).Debug("Reservation restored")
+	return translateError(result.Error)
+}
+
+// PurgeReservations removes for good the reservations deleted before the given time
+func (c reservationClient) PurgeReservations(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := tracing.Start(ctx, "ReservationClient.PurgeReservations")
+	defer span.End()
+
+	result := Db.WithContext(ctx).Unscoped().Where("deleted_at < ?", before).Delete(&model.Reservation{})
+
+	if result.Error != nil {
+		log.Ctx(ctx).WithError(result.Error).Error("Failed to purge deleted reservations")
+		return 0, translateError(result.Error)
+	}
+
+	return result.RowsAffected, nil
 }
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlserver"
@@ -42,12 +43,13 @@ func TestInsertReservation_Client(t *testing.T) {
 	}
 
 	mock.ExpectBegin()
-	mock.ExpectQuery(`SET IDENTITY_INSERT "reservations" ON;INSERT INTO "reservations" ("start_date","end_date","user_id","hotel_id","amount","id") OUTPUT INSERTED."id" VALUES (@p1,@p2,@p3,@p4,@p5,@p6);SET IDENTITY_INSERT "reservations" OFF;`).
-		WithArgs(reservation.StartDate, reservation.EndDate, reservation.UserId, reservation.HotelId, reservation.Amount, reservation.Id).
+	mock.ExpectQuery(`SET IDENTITY_INSERT "reservations" ON;INSERT INTO "reservations" ("start_date","end_date","user_id","hotel_id","amount","deleted_at","id") OUTPUT INSERTED."id" VALUES (@p1,@p2,@p3,@p4,@p5,@p6,@p7);SET IDENTITY_INSERT "reservations" OFF;`).
+		WithArgs(reservation.StartDate, reservation.EndDate, reservation.UserId, reservation.HotelId, reservation.Amount, reservation.DeletedAt, reservation.Id).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
 
-	result := ReservationClient.InsertReservation(reservation)
+	result, err := ReservationClient.InsertReservation(context.Background(), reservation)
+	a.Nil(err)
 
 	a.Equal(reservation, result)
 	a.Equal(1, result.Id)
@@ -89,12 +91,13 @@ func TestGetReservationById_Client(t *testing.T) {
 		Amount:    20500,
 	}
 
-	mock.ExpectQuery(`SELECT * FROM "reservations" WHERE id = @p1 ORDER BY "reservations"."id" OFFSET 0 ROW FETCH NEXT 1 ROWS ONLY`).
+	mock.ExpectQuery(`SELECT * FROM "reservations" WHERE id = @p1 AND "reservations"."deleted_at" IS NULL ORDER BY "reservations"."id" OFFSET 0 ROW FETCH NEXT 1 ROWS ONLY`).
 		WithArgs(reservation.Id).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "start_date", "end_date", "user_id", "hotel_id", "amount"}).
 			AddRow(reservation.Id, reservation.StartDate, reservation.EndDate, reservation.UserId, reservation.HotelId, reservation.Amount))
 
-	result := ReservationClient.GetReservationById(reservation.Id)
+	result, err := ReservationClient.GetReservationById(context.Background(), reservation.Id)
+	a.Nil(err)
 
 	a.Equal(reservation, result)
 	a.Equal(1, result.Id)
@@ -147,12 +150,13 @@ func TestGetReservations_Client(t *testing.T) {
 		},
 	}
 
-	mock.ExpectQuery(`SELECT * FROM "reservations"`).
+	mock.ExpectQuery(`SELECT * FROM "reservations" WHERE "reservations"."deleted_at" IS NULL`).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "start_date", "end_date", "user_id", "hotel_id", "amount"}).
 			AddRow(reservations[0].Id, reservations[0].StartDate, reservations[0].EndDate, reservations[0].UserId, reservations[0].HotelId, reservations[0].Amount).
 			AddRow(reservations[1].Id, reservations[1].StartDate, reservations[1].EndDate, reservations[1].UserId, reservations[1].HotelId, reservations[1].Amount))
 
-	result := ReservationClient.GetReservations()
+	result, err := ReservationClient.GetReservations(context.Background())
+	a.Nil(err)
 
 	a.Equal(reservations, result)
 
@@ -206,13 +210,14 @@ func TestGetReservationByUser_Client(t *testing.T) {
 
 	userId := 1
 
-	mock.ExpectQuery(`SELECT * FROM "reservations" WHERE user_id = @p1`).
+	mock.ExpectQuery(`SELECT * FROM "reservations" WHERE user_id = @p1 AND "reservations"."deleted_at" IS NULL`).
 		WithArgs(userId).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "start_date", "end_date", "user_id", "hotel_id", "amount"}).
 			AddRow(reservations[0].Id, reservations[0].StartDate, reservations[0].EndDate, reservations[0].UserId, reservations[0].HotelId, reservations[0].Amount).
 			AddRow(reservations[1].Id, reservations[1].StartDate, reservations[1].EndDate, reservations[1].UserId, reservations[1].HotelId, reservations[1].Amount))
 
-	result := ReservationClient.GetReservationsByUser(userId)
+	result, err := ReservationClient.GetReservationsByUser(context.Background(), userId)
+	a.Nil(err)
 
 	a.Equal(reservations, result)
 
@@ -266,13 +271,14 @@ func TestGetReservationByHotel_Client(t *testing.T) {
 
 	hotelId := 2
 
-	mock.ExpectQuery(`SELECT * FROM "reservations" WHERE hotel_id = @p1`).
+	mock.ExpectQuery(`SELECT * FROM "reservations" WHERE hotel_id = @p1 AND "reservations"."deleted_at" IS NULL`).
 		WithArgs(hotelId).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "start_date", "end_date", "user_id", "hotel_id", "amount"}).
 			AddRow(reservations[0].Id, reservations[0].StartDate, reservations[0].EndDate, reservations[0].UserId, reservations[0].HotelId, reservations[0].Amount).
 			AddRow(reservations[1].Id, reservations[1].StartDate, reservations[1].EndDate, reservations[1].UserId, reservations[1].HotelId, reservations[1].Amount))
 
-	result := ReservationClient.GetReservationsByHotel(hotelId)
+	result, err := ReservationClient.GetReservationsByHotel(context.Background(), hotelId)
+	a.Nil(err)
 
 	a.Equal(reservations, result)
 
@@ -314,11 +320,11 @@ func TestDeleteReservation_Client(t *testing.T) {
 	}
 
 	mock.ExpectBegin()
-	mock.ExpectExec(`DELETE FROM "reservations" WHERE "reservations"."id" = @p1`).
-		WithArgs(reservation.Id).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE "reservations" SET "deleted_at"=@p1 WHERE "reservations"."id" = @p2 AND "reservations"."deleted_at" IS NULL`).
+		WithArgs(sqlmock.AnyArg(), reservation.Id).WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
-	err = ReservationClient.DeleteReservation(reservation)
+	err = ReservationClient.DeleteReservation(context.Background(), reservation)
 
 	a.Nil(err)
 
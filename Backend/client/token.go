@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"project/model"
+	"project/tracing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type tokenClient struct{}
+
+type tokenClientInterface interface {
+	InsertToken(ctx context.Context, token model.UserToken) (model.UserToken, error)
+	GetToken(ctx context.Context, purpose string, hash string) (model.UserToken, error)
+	DeleteToken(ctx context.Context, id int) error
+	DeleteExpiredTokens(ctx context.Context, now time.Time) (int64, error)
+}
+
+var TokenClient tokenClientInterface
+
+func init() {
+	TokenClient = &tokenClient{}
+}
+
+// InsertToken stores the token in place of the ones the user was sent before
+// for the same purpose, so only the last one sent can be used
+func (c tokenClient) InsertToken(ctx context.Context, token model.UserToken) (model.UserToken, error) {
+	ctx, span := tracing.Start(ctx, "TokenClient.InsertToken")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ?", token.UserId, token.Purpose).Delete(&model.UserToken{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&token).Error
+	})
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Error("Failed to insert token")
+		return token, translateError(err)
+	}
+
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": token.UserId, "purpose": token.Purpose}).Debug("Token created")
+	return token, nil
+}
+
+func (c tokenClient) GetToken(ctx context.Context, purpose string, hash string) (model.UserToken, error) {
+	ctx, span := tracing.Start(ctx, "TokenClient.GetToken")
+	defer span.End()
+
+	var token model.UserToken
+
+	err := Db.WithContext(ctx).Where("purpose = ? AND hash = ?", purpose, hash).First(&token).Error
+
+	return token, translateError(err)
+}
+
+// DeleteToken uses up the token, ErrNotFound is returned if it was already used
+func (c tokenClient) DeleteToken(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "TokenClient.DeleteToken")
+	defer span.End()
+
+	result := Db.WithContext(ctx).Where("id = ?", id).Delete(&model.UserToken{})
+
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return translateError(result.Error)
+}
+
+// DeleteExpiredTokens removes the tokens expired at now, returning how many were removed
+func (c tokenClient) DeleteExpiredTokens(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := tracing.Start(ctx, "TokenClient.DeleteExpiredTokens")
+	defer span.End()
+
+	result := Db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&model.UserToken{})
+
+	if result.Error != nil {
+		log.Ctx(ctx).WithError(result.Error).Error("Failed to delete expired tokens")
+		return 0, translateError(result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
@@ -1,19 +1,32 @@
 package client
 
 import (
+	"context"
 	"project/model"
+	"project/tracing"
+	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
 type userClient struct{}
 
 type userClientInterface interface {
-	InsertUser(user model.User) model.User
-	GetUserById(id int) model.User
-	GetUserByEmail(email string) model.User
-	GetUsers() model.Users
+	InsertUser(ctx context.Context, user model.User) (model.User, error)
+	GetUserById(ctx context.Context, id int) (model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (model.User, error)
+	GetUsers(ctx context.Context) (model.Users, error)
+	UpdateUser(ctx context.Context, user model.User) (model.User, error)
+	UpdatePassword(ctx context.Context, id int, password string) error
+	UpdateRole(ctx context.Context, id int, role string) error
+	UpdateDisabled(ctx context.Context, id int, disabled bool) error
+	CountActiveUsersByRole(ctx context.Context, role string) (int64, error)
+	AnonymizeUser(ctx context.Context, user model.User, cancelled model.Reservations) error
+	DeleteUser(ctx context.Context, user model.User, cancelled model.Reservations) error
+	GetDeletedUsers(ctx context.Context) (model.Users, error)
+	RestoreUser(ctx context.Context, id int) error
+	PurgeUsers(ctx context.Context, before time.Time) (int64, error)
 }
 
 var UserClient userClientInterface
@@ -24,42 +37,269 @@ func init() {
 
 var Db *gorm.DB
 
-func (c userClient) InsertUser(user model.User) model.User {
+func (c userClient) InsertUser(ctx context.Context, user model.User) (model.User, error) {
+	ctx, span := tracing.Start(ctx, "UserClient.InsertUser")
+	defer span.End()
 
-	result := Db.Create(&user)
+	result := Db.WithContext(ctx).Create(&user)
 
 	if result.Error != nil {
-		log.Error("Failed to insert user.")
-		return user
+		log.Ctx(ctx).WithError(result.Error).Error("Failed to insert user")
+		return user, translateError(result.Error)
 	}
 
-	log.Debug("User created:", user.Id)
-	return user
+	log.Ctx(ctx).WithField("user_id", user.Id).Debug("User created")
+	return user, nil
 }
 
-func (c userClient) GetUserById(id int) model.User {
+func (c userClient) GetUserById(ctx context.Context, id int) (model.User, error) {
+	ctx, span := tracing.Start(ctx, "UserClient.GetUserById")
+	defer span.End()
+
 	var user model.User
 
-	Db.Where("id = ?", id).First(&user)
-	log.Debug("User: ", user)
+	err := Db.WithContext(ctx).Where("id = ?", id).First(&user).Error
+	log.Ctx(ctx).WithField("user_id", user.Id).Debug("User loaded")
 
-	return user
+	return user, translateError(err)
 }
 
-func (c userClient) GetUserByEmail(email string) model.User {
+func (c userClient) GetUserByEmail(ctx context.Context, email string) (model.User, error) {
+	ctx, span := tracing.Start(ctx, "UserClient.GetUserByEmail")
+	defer span.End()
+
 	var user model.User
 
-	Db.Where("email = ?", email).First(&user)
-	log.Debug("User: ", user)
+	err := Db.WithContext(ctx).Where("email = ?", email).First(&user).Error
+	log.Ctx(ctx).WithField("user_id", user.Id).Debug("User loaded")
+
+	return user, translateError(err)
+}
+
+func (c userClient) GetUsers(ctx context.Context) (model.Users, error) {
+	ctx, span := tracing.Start(ctx, "UserClient.GetUsers")
+	defer span.End()
+
+	var users model.Users
+	err := Db.WithContext(ctx).Find(&users).Error
+
+	log.Ctx(ctx).WithField("count", len(users)).Debug("Users loaded")
+
+	return users, translateError(err)
+}
+
+// UpdateUser saves the profile fields of the user and whether their email is
+// verified, the password and role are left as they are
+func (c userClient) UpdateUser(ctx context.Context, user model.User) (model.User, error) {
+	ctx, span := tracing.Start(ctx, "UserClient.UpdateUser")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Model(&user).Select("Name", "LastName", "Dni", "Email", "EmailVerified").Updates(&user).Error
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to update user")
+		return user, translateError(err)
+	}
+
+	log.Ctx(ctx).WithField("user_id", user.Id).Debug("User updated")
+	return user, nil
+}
+
+// UpdatePassword replaces the password hash of the user, and moves on their
+// token version so the login tokens issued before are rejected
+func (c userClient) UpdatePassword(ctx context.Context, id int, password string) error {
+	ctx, span := tracing.Start(ctx, "UserClient.UpdatePassword")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Model(&model.User{}).Where("id = ?", id).Updates(map[string]any{
+		"password":      password,
+		"token_version": gorm.Expr("token_version + 1"),
+	}).Error
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to update password")
+	} else {
+		log.Ctx(ctx).WithField("user_id", id).Debug("Password updated")
+	}
+	return translateError(err)
+}
+
+// UpdateRole replaces the role of the user
+func (c userClient) UpdateRole(ctx context.Context, id int, role string) error {
+	ctx, span := tracing.Start(ctx, "UserClient.UpdateRole")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Model(&model.User{}).Where("id = ?", id).Update("role", role).Error
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to update role")
+	} else {
+		log.Ctx(ctx).WithFields(logrus.Fields{"user_id": id, "role": role}).Debug("Role updated")
+	}
+	return translateError(err)
+}
+
+// UpdateDisabled disables the user, or enables them again
+func (c userClient) UpdateDisabled(ctx context.Context, id int, disabled bool) error {
+	ctx, span := tracing.Start(ctx, "UserClient.UpdateDisabled")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Model(&model.User{}).Where("id = ?", id).Update("disabled", disabled).Error
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to update disabled")
+	} else {
+		log.Ctx(ctx).WithFields(logrus.Fields{"user_id": id, "disabled": disabled}).Debug("Disabled updated")
+	}
+	return translateError(err)
+}
+
+// CountActiveUsersByRole counts the users with the role that aren't disabled
+func (c userClient) CountActiveUsersByRole(ctx context.Context, role string) (int64, error) {
+	ctx, span := tracing.Start(ctx, "UserClient.CountActiveUsersByRole")
+	defer span.End()
+
+	var count int64
+
+	err := Db.WithContext(ctx).Model(&model.User{}).Where("role = ? AND disabled = ?", role, false).Count(&count).Error
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to count users")
+	}
+	return count, translateError(err)
+}
+
+// AnonymizeUser overwrites the personal data of the user with the values given
+// and soft deletes it, along with the reservations it cancels, the tokens it
+// was sent, its hotel assignments, second factor and linked identities. The
+// reservations it keeps still point to the user.
+func (c userClient) AnonymizeUser(ctx context.Context, user model.User, cancelled model.Reservations) error {
+	ctx, span := tracing.Start(ctx, "UserClient.AnonymizeUser")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Select("Name", "LastName", "Dni", "Email", "Password").Updates(&user).Error; err != nil {
+			return err
+		}
+
+		if len(cancelled) > 0 {
+			if err := tx.Delete(&cancelled).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("user_id = ?", user.Id).Delete(&model.UserToken{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.Id).Delete(&model.HotelAssignment{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.Id).Delete(&model.UserMfa{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.Id).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
 
-	return user
+		if err := tx.Where("user_id = ?", user.Id).Delete(&model.ExternalIdentity{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&user).Error
+	})
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to anonymize user")
+	} else {
+		log.Ctx(ctx).WithFields(logrus.Fields{"user_id": user.Id, "cancelled": len(cancelled)}).Debug("User anonymized")
+	}
+	return translateError(err)
+}
+
+// DeleteUser soft deletes the user along with the reservations it cancels in one transaction
+func (c userClient) DeleteUser(ctx context.Context, user model.User, cancelled model.Reservations) error {
+	ctx, span := tracing.Start(ctx, "UserClient.DeleteUser")
+	defer span.End()
+
+	err := Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(cancelled) > 0 {
+			if err := tx.Delete(&cancelled).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&user).Error
+	})
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to delete user")
+	} else {
+		log.Ctx(ctx).WithFields(logrus.Fields{"user_id": user.Id, "cancelled": len(cancelled)}).Debug("User deleted")
+	}
+	return translateError(err)
 }
 
-func (c userClient) GetUsers() model.Users {
+func (c userClient) GetDeletedUsers(ctx context.Context) (model.Users, error) {
+	ctx, span := tracing.Start(ctx, "UserClient.GetDeletedUsers")
+	defer span.End()
+
 	var users model.Users
-	Db.Find(&users)
+	err := Db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").Find(&users).Error
+
+	log.Ctx(ctx).WithField("count", len(users)).Debug("Deleted users loaded")
+
+	return users, translateError(err)
+}
+
+// RestoreUser undeletes the user, ErrNotFound is returned if it isn't deleted
+func (c userClient) RestoreUser(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "UserClient.RestoreUser")
+	defer span.End()
 
-	log.Debug("Users: ", users)
+	result := Db.WithContext(ctx).Unscoped().Model(&model.User{}).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	log.Ctx(ctx).WithField("user_id", id).Debug("User restored")
+	return translateError(result.Error)
+}
+
+// PurgeUsers removes for good the users deleted before the given time, with
+// their hotel assignments, second factor and linked identities. Users still
+// referenced by reservations are kept.
+func (c userClient) PurgeUsers(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := tracing.Start(ctx, "UserClient.PurgeUsers")
+	defer span.End()
+
+	var count int64
+
+	err := Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		purged := tx.Unscoped().Model(&model.User{}).Select("id").Where("deleted_at < ?", before).
+			Where("NOT EXISTS (SELECT 1 FROM reservations WHERE reservations.user_id = users.id)")
+
+		for _, value := range []any{&model.HotelAssignment{}, &model.UserMfa{}, &model.RecoveryCode{}, &model.ExternalIdentity{}} {
+			if err := tx.Where("user_id IN (?)", purged).Delete(value).Error; err != nil {
+				return err
+			}
+		}
+
+		result := tx.Unscoped().Where("deleted_at < ?", before).
+			Where("NOT EXISTS (SELECT 1 FROM reservations WHERE reservations.user_id = users.id)").
+			Delete(&model.User{})
+		count = result.RowsAffected
+
+		return result.Error
+	})
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Error("Failed to purge deleted users")
+		return 0, translateError(err)
+	}
 
-	return users
+	return count, nil
 }
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlserver"
@@ -43,12 +44,13 @@ func TestInsertUser_Client(t *testing.T) {
 	}
 
 	mock.ExpectBegin()
-	mock.ExpectQuery(`SET IDENTITY_INSERT "users" ON;INSERT INTO "users" ("name","last_name","dni","email","password","role","id") OUTPUT INSERTED."id" VALUES (@p1,@p2,@p3,@p4,@p5,@p6,@p7);SET IDENTITY_INSERT "users" OFF;`).
-		WithArgs(user.Name, user.LastName, user.Dni, user.Email, user.Password, user.Role, user.Id).
+	mock.ExpectQuery(`SET IDENTITY_INSERT "users" ON;INSERT INTO "users" ("name","last_name","dni","email","password","role","email_verified","disabled","token_version","deleted_at","id") OUTPUT INSERTED."id" VALUES (@p1,@p2,@p3,@p4,@p5,@p6,@p7,@p8,@p9,@p10,@p11);SET IDENTITY_INSERT "users" OFF;`).
+		WithArgs(user.Name, user.LastName, user.Dni, user.Email, user.Password, user.Role, user.EmailVerified, user.Disabled, user.TokenVersion, user.DeletedAt, user.Id).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
 
-	result := UserClient.InsertUser(user)
+	result, err := UserClient.InsertUser(context.Background(), user)
+	a.Nil(err)
 
 	a.Equal(user, result)
 	a.Equal(1, result.Id)
@@ -91,12 +93,13 @@ func TestGetUserById_Client(t *testing.T) {
 		Role:     "Customer",
 	}
 
-	mock.ExpectQuery(`SELECT * FROM "users" WHERE id = @p1 ORDER BY "users"."id" OFFSET 0 ROW FETCH NEXT 1 ROWS ONLY`).
+	mock.ExpectQuery(`SELECT * FROM "users" WHERE id = @p1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" OFFSET 0 ROW FETCH NEXT 1 ROWS ONLY`).
 		WithArgs(user.Id).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "last_name", "dni", "email", "password", "role"}).
 			AddRow(user.Id, user.Name, user.LastName, user.Dni, user.Email, user.Password, user.Role))
 
-	result := UserClient.GetUserById(user.Id)
+	result, err := UserClient.GetUserById(context.Background(), user.Id)
+	a.Nil(err)
 
 	a.Equal(user, result)
 	a.Equal(1, result.Id)
@@ -139,12 +142,13 @@ func TestGetUserByEmail_Client(t *testing.T) {
 		Role:     "Customer",
 	}
 
-	mock.ExpectQuery(`SELECT * FROM "users" WHERE email = @p1 ORDER BY "users"."id" OFFSET 0 ROW FETCH NEXT 1 ROWS ONLY`).
+	mock.ExpectQuery(`SELECT * FROM "users" WHERE email = @p1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" OFFSET 0 ROW FETCH NEXT 1 ROWS ONLY`).
 		WithArgs(user.Email).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "last_name", "dni", "email", "password", "role"}).
 			AddRow(user.Id, user.Name, user.LastName, user.Dni, user.Email, user.Password, user.Role))
 
-	result := UserClient.GetUserByEmail(user.Email)
+	result, err := UserClient.GetUserByEmail(context.Background(), user.Email)
+	a.Nil(err)
 
 	a.Equal(user, result)
 
@@ -198,12 +202,13 @@ func TestGetUsers_Client(t *testing.T) {
 		},
 	}
 
-	mock.ExpectQuery(`SELECT * FROM "users"`).
+	mock.ExpectQuery(`SELECT * FROM "users" WHERE "users"."deleted_at" IS NULL`).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "last_name", "dni", "email", "password", "role"}).
 			AddRow(users[0].Id, users[0].Name, users[0].LastName, users[0].Dni, users[0].Email, users[0].Password, users[0].Role).
 			AddRow(users[1].Id, users[1].Name, users[1].LastName, users[1].Dni, users[1].Email, users[1].Password, users[1].Role))
 
-	result := UserClient.GetUsers()
+	result, err := UserClient.GetUsers(context.Background())
+	a.Nil(err)
 
 	a.Equal(users, result)
 
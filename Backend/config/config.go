@@ -0,0 +1,818 @@
+package config
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	netmail "net/mail"
+	"net/url"
+	"os"
+	"project/auth"
+	"project/ratelimit"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// Config is the effective configuration of the API. Every value is resolved in
+// this order, later sources winning:
+//
+//	defaults < profile (profiles/<profile>.toml) < config file < environment < flags
+//
+// Fields name their environment variable and flag in the env and flag tags,
+// fields tagged secret are redacted by Redacted.
+type Config struct {
+	Profile     string            `toml:"profile"`
+	Server      ServerConfig      `toml:"server"`
+	Database    DatabaseConfig    `toml:"database"`
+	Auth        AuthConfig        `toml:"auth"`
+	Cors        CorsConfig        `toml:"cors"`
+	Log         LogConfig         `toml:"log"`
+	Images      ImagesConfig      `toml:"images"`
+	Tracing     TracingConfig     `toml:"tracing"`
+	RateLimit   RateLimitConfig   `toml:"rate_limit"`
+	Idempotency IdempotencyConfig `toml:"idempotency"`
+	SoftDelete  SoftDeleteConfig  `toml:"soft_delete"`
+	Audit       AuditConfig       `toml:"audit"`
+	Mail        MailConfig        `toml:"mail"`
+	Oidc        OidcConfig        `toml:"oidc"`
+}
+
+type ServerConfig struct {
+	Addr              string   `toml:"addr" env:"SERVER_ADDR" flag:"addr"`
+	ReadTimeout       Duration `toml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout Duration `toml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	WriteTimeout      Duration `toml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       Duration `toml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout   Duration `toml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	MaxHeaderBytes    int      `toml:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES"`
+	MaxBodyBytes      int      `toml:"max_body_bytes" env:"SERVER_MAX_BODY_BYTES"`
+	TlsCertFile       string   `toml:"tls_cert_file" env:"SERVER_TLS_CERT_FILE" flag:"tls-cert"`
+	TlsKeyFile        string   `toml:"tls_key_file" env:"SERVER_TLS_KEY_FILE" flag:"tls-key"`
+	TlsReloadInterval Duration `toml:"tls_reload_interval" env:"SERVER_TLS_RELOAD_INTERVAL"`
+}
+
+type DatabaseConfig struct {
+	Driver          string   `toml:"driver" env:"DB_DRIVER" flag:"db-driver"`
+	Dsn             string   `toml:"dsn" env:"DBCONNSTRING" flag:"db-dsn" secret:"true"`
+	MaxOpenConns    int      `toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int      `toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime Duration `toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	QueryTimeout    Duration `toml:"query_timeout" env:"DB_QUERY_TIMEOUT"`
+	ConnectTimeout  Duration `toml:"connect_timeout" env:"DB_CONNECT_TIMEOUT"`
+}
+
+// AuthConfig signs the login tokens. ResetTtl and VerificationTtl are how long
+// the links mailed to reset a password and to confirm an email last,
+// ConfirmationTtl the codes mailed to accounts without a password in its place. Users
+// with MfaRequiredRoles can't log in without a second factor, MfaIssuer names
+// the service in their authenticator app and MfaChallengeTtl is how long the
+// second step of a login can wait.
+type AuthConfig struct {
+	JwtSecret        string   `toml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	TokenTtl         Duration `toml:"token_ttl" env:"TOKEN_TTL"`
+	ResetTtl         Duration `toml:"reset_ttl" env:"PASSWORD_RESET_TTL"`
+	VerificationTtl  Duration `toml:"verification_ttl" env:"EMAIL_VERIFICATION_TTL"`
+	ConfirmationTtl  Duration `toml:"confirmation_ttl" env:"CONFIRMATION_TTL"`
+	MfaIssuer        string   `toml:"mfa_issuer" env:"MFA_ISSUER"`
+	MfaRequiredRoles []string `toml:"mfa_required_roles" env:"MFA_REQUIRED_ROLES"`
+	MfaChallengeTtl  Duration `toml:"mfa_challenge_ttl" env:"MFA_CHALLENGE_TTL"`
+}
+
+type CorsConfig struct {
+	AllowedOrigins   []string `toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowCredentials bool     `toml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+}
+
+// LogConfig sets the default level, the output format ("json" or "text") and
+// the level of single packages as "package=level", e.g. "client=debug"
+type LogConfig struct {
+	Level    string   `toml:"level" env:"LOG_LEVEL" flag:"log-level"`
+	Format   string   `toml:"format" env:"LOG_FORMAT"`
+	Packages []string `toml:"packages" env:"LOG_PACKAGE_LEVELS"`
+}
+
+// ImagesConfig sets where uploads are stored and how signed URLs to images of
+// draft hotels are made, MaxSignedUrlTtl bounding how long they last
+type ImagesConfig struct {
+	Dir             string   `toml:"dir" env:"IMAGE_DIR" flag:"image-dir"`
+	SigningKey      string   `toml:"signing_key" env:"IMAGE_SIGNING_KEY" secret:"true"`
+	MaxSignedUrlTtl Duration `toml:"max_signed_url_ttl" env:"IMAGE_MAX_SIGNED_URL_TTL"`
+}
+
+// TracingConfig selects where spans are exported: "none", "otlp" (OTLP over
+// HTTP to a collector at Endpoint) or "stdout" for local debugging
+type TracingConfig struct {
+	Exporter    string  `toml:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter"`
+	Endpoint    string  `toml:"endpoint" env:"TRACING_OTLP_ENDPOINT"`
+	ServiceName string  `toml:"service_name" env:"TRACING_SERVICE_NAME"`
+	SampleRatio float64 `toml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// RateLimitConfig throttles the routes listed in Routes when Enabled, and
+// locks accounts after repeated failed logins in any case
+type RateLimitConfig struct {
+	Enabled bool               `toml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	Routes  []RouteLimitConfig `toml:"routes"`
+	Login   LoginLockoutConfig `toml:"login"`
+}
+
+// RouteLimitConfig limits a route, e.g. "POST /login", per client IP and per
+// account. Limits are written "<requests>/<period>", e.g. "10/1m", and the
+// account is read from AccountField in the JSON body.
+type RouteLimitConfig struct {
+	Route        string `toml:"route"`
+	PerIp        string `toml:"per_ip"`
+	PerAccount   string `toml:"per_account"`
+	AccountField string `toml:"account_field"`
+}
+
+// LoginLockoutConfig throttles and locks logins to an account after failures.
+// Clients from an address the account logged in from within KnownClientTtl
+// count apart, so failures from elsewhere don't lock them out, zero turns it off.
+type LoginLockoutConfig struct {
+	MaxFailures    int      `toml:"max_failures" env:"LOGIN_MAX_FAILURES"`
+	Window         Duration `toml:"window" env:"LOGIN_FAILURE_WINDOW"`
+	Lockout        Duration `toml:"lockout" env:"LOGIN_LOCKOUT"`
+	Delay          Duration `toml:"delay" env:"LOGIN_DELAY"`
+	MaxDelay       Duration `toml:"max_delay" env:"LOGIN_MAX_DELAY"`
+	KnownClientTtl Duration `toml:"known_client_ttl" env:"LOGIN_KNOWN_CLIENT_TTL"`
+}
+
+// IdempotencyConfig sets how long responses are replayed for their
+// Idempotency-Key, and after how long a request still holding its key is
+// taken as abandoned
+type IdempotencyConfig struct {
+	Retention   Duration `toml:"retention" env:"IDEMPOTENCY_RETENTION"`
+	LockTimeout Duration `toml:"lock_timeout" env:"IDEMPOTENCY_LOCK_TIMEOUT"`
+}
+
+// SoftDeleteConfig sets how long deleted hotels, users and reservations can
+// be restored before they are purged
+type SoftDeleteConfig struct {
+	Retention Duration `toml:"retention" env:"SOFT_DELETE_RETENTION"`
+}
+
+// AuditConfig keys the hash chain of the audit log, so the entries can't be
+// rewritten by someone who can only write to the database. Changing HmacKey
+// leaves the entries hashed with the previous key failing verification.
+type AuditConfig struct {
+	HmacKey string `toml:"hmac_key" env:"AUDIT_HMAC_KEY" secret:"true"`
+}
+
+// MailConfig sets how the emails to users are sent: through an SMTP server,
+// written to files in Dir for local development, or not at all with "none".
+// The links in the emails point to the frontend at AppUrl.
+type MailConfig struct {
+	Driver string     `toml:"driver" env:"MAIL_DRIVER"`
+	From   string     `toml:"from" env:"MAIL_FROM"`
+	AppUrl string     `toml:"app_url" env:"MAIL_APP_URL"`
+	Dir    string     `toml:"dir" env:"MAIL_DIR"`
+	Smtp   SmtpConfig `toml:"smtp"`
+}
+
+// SmtpConfig is the server the mail is sent through, STARTTLS is used when the
+// server offers it
+type SmtpConfig struct {
+	Host     string `toml:"host" env:"SMTP_HOST"`
+	Port     int    `toml:"port" env:"SMTP_PORT"`
+	Username string `toml:"username" env:"SMTP_USERNAME"`
+	Password string `toml:"password" env:"SMTP_PASSWORD" secret:"true"`
+}
+
+// OidcConfig lists the OpenID Connect providers users can log in with, and
+// how long a login can stay at a provider before it has to start again
+type OidcConfig struct {
+	Providers []OidcProviderConfig `toml:"providers"`
+	StateTtl  Duration             `toml:"state_ttl" env:"OIDC_STATE_TTL"`
+}
+
+// OidcProviderConfig is a provider the API is registered with as a client.
+// Name goes in the URLs, e.g. /auth/oidc/google/start, and the client secret
+// can be left out of files and read from OIDC_<NAME>_CLIENT_SECRET instead.
+type OidcProviderConfig struct {
+	Name         string   `toml:"name"`
+	DisplayName  string   `toml:"display_name"`
+	Issuer       string   `toml:"issuer"`
+	ClientId     string   `toml:"client_id"`
+	ClientSecret string   `toml:"client_secret" secret:"true"`
+	RedirectUrl  string   `toml:"redirect_url"`
+	Scopes       []string `toml:"scopes"`
+}
+
+// SecretEnv is the environment variable the client secret is read from
+func (p OidcProviderConfig) SecretEnv() string {
+	return "OIDC_" + strings.ToUpper(strings.ReplaceAll(p.Name, "-", "_")) + "_CLIENT_SECRET"
+}
+
+// Duration is a time.Duration written as "10s" or "5m" in files and variables
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+
+	if err != nil {
+		return err
+	}
+
+	d.Duration = duration
+	return nil
+}
+
+//go:embed profiles/*.toml
+var profiles embed.FS
+
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:              ":80",
+			ReadTimeout:       Duration{30 * time.Second},
+			ReadHeaderTimeout: Duration{5 * time.Second},
+			WriteTimeout:      Duration{60 * time.Second},
+			IdleTimeout:       Duration{2 * time.Minute},
+			ShutdownTimeout:   Duration{25 * time.Second},
+			MaxHeaderBytes:    1 << 20,
+			MaxBodyBytes:      32 << 20,
+			TlsReloadInterval: Duration{time.Minute},
+		},
+		Database: DatabaseConfig{
+			Driver:          "mysql",
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: Duration{5 * time.Minute},
+			QueryTimeout:    Duration{10 * time.Second},
+			ConnectTimeout:  Duration{time.Minute},
+		},
+		Auth: AuthConfig{
+			TokenTtl:        Duration{24 * time.Hour},
+			ResetTtl:        Duration{time.Hour},
+			VerificationTtl: Duration{48 * time.Hour},
+			ConfirmationTtl: Duration{15 * time.Minute},
+			MfaIssuer:       "Miranda",
+			MfaChallengeTtl: Duration{5 * time.Minute},
+		},
+		Cors:   CorsConfig{AllowedOrigins: []string{"*"}},
+		Log:    LogConfig{Level: "info", Format: "json"},
+		Images: ImagesConfig{Dir: "Images", MaxSignedUrlTtl: Duration{24 * time.Hour}},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			Endpoint:    "http://localhost:4318",
+			ServiceName: "miranda-api",
+			SampleRatio: 1,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Routes: []RouteLimitConfig{
+				{Route: "POST /login", PerIp: "20/1m", PerAccount: "10/1m", AccountField: "email"},
+				{Route: "POST /login/mfa", PerIp: "20/1m"},
+				{Route: "POST /reserve", PerIp: "30/1m", PerAccount: "10/1m", AccountField: "user_id"},
+				{Route: "POST /password/forgot", PerIp: "10/1m", PerAccount: "3/1h", AccountField: "email"},
+				{Route: "POST /me/confirmation", PerIp: "10/1m"},
+				{Route: "POST /auth/oidc/:provider/callback", PerIp: "20/1m"},
+			},
+			Login: LoginLockoutConfig{
+				MaxFailures:    5,
+				Window:         Duration{15 * time.Minute},
+				Lockout:        Duration{15 * time.Minute},
+				Delay:          Duration{time.Second},
+				MaxDelay:       Duration{30 * time.Second},
+				KnownClientTtl: Duration{30 * 24 * time.Hour},
+			},
+		},
+		Idempotency: IdempotencyConfig{
+			Retention:   Duration{24 * time.Hour},
+			LockTimeout: Duration{time.Minute},
+		},
+		SoftDelete: SoftDeleteConfig{
+			Retention: Duration{30 * 24 * time.Hour},
+		},
+		Mail: MailConfig{
+			Driver: "none",
+			From:   "Miranda <no-reply@miranda.local>",
+			Dir:    "Mail",
+			Smtp:   SmtpConfig{Port: 587},
+		},
+		Oidc: OidcConfig{
+			StateTtl: Duration{10 * time.Minute},
+		},
+	}
+}
+
+// Load resolves the configuration from the command line arguments and the
+// environment, returning it along with the arguments left after the flags
+func Load(args []string) (Config, []string, error) {
+	return load(args, os.LookupEnv)
+}
+
+func load(args []string, lookupEnv func(string) (string, bool)) (Config, []string, error) {
+	cfg := Default()
+
+	flags := flag.NewFlagSet("project", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	configFile := flags.String("config", envOr(lookupEnv, "APP_CONFIG", ""), "configuration file")
+	profile := flags.String("profile", envOr(lookupEnv, "APP_PROFILE", ""), "configuration profile (dev, qa or prod)")
+	overrides := registerFlags(flags, reflect.ValueOf(&cfg).Elem())
+
+	if err := flags.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	// Deployments must say where they run, falling back to dev would start them on its settings
+	if *profile == "" {
+		return cfg, nil, errors.New("no profile given, set APP_PROFILE or -profile to dev, qa or prod")
+	}
+
+	cfg.Profile = *profile
+
+	if err := loadProfile(&cfg, *profile); err != nil {
+		return cfg, nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(&cfg, *configFile); err != nil {
+			return cfg, nil, err
+		}
+	}
+
+	// A profile or file may not change which profile is in use
+	cfg.Profile = *profile
+
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem(), lookupEnv); err != nil {
+		return cfg, nil, err
+	}
+
+	// Providers are a list, their secrets are looked up by name
+	for i, provider := range cfg.Oidc.Providers {
+		if secret, ok := lookupEnv(provider.SecretEnv()); ok && secret != "" {
+			cfg.Oidc.Providers[i].ClientSecret = secret
+		}
+	}
+
+	// Only flags given explicitly override the other sources
+	var err error
+
+	flags.Visit(func(f *flag.Flag) {
+		if override, ok := overrides[f.Name]; ok && err == nil {
+			err = setValue(override, f.Value.String())
+		}
+	})
+
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	// No secret ships with dev, without JWT_SECRET logins last until a restart
+	if cfg.Profile == "dev" && cfg.Auth.JwtSecret == "" {
+		if cfg.Auth.JwtSecret, err = randomSecret(); err != nil {
+			return cfg, nil, err
+		}
+	}
+
+	// nor does the audit key, without AUDIT_HMAC_KEY the entries of earlier
+	// runs fail verification
+	if cfg.Profile == "dev" && cfg.Audit.HmacKey == "" {
+		if cfg.Audit.HmacKey, err = randomSecret(); err != nil {
+			return cfg, nil, err
+		}
+	}
+
+	return cfg, flags.Args(), cfg.Validate()
+}
+
+func randomSecret() (string, error) {
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+func loadProfile(cfg *Config, profile string) error {
+	data, err := profiles.ReadFile("profiles/" + profile + ".toml")
+
+	if err != nil {
+		return fmt.Errorf("unknown profile %q", profile)
+	}
+
+	if err := decode(data, cfg); err != nil {
+		return fmt.Errorf("profile %s: %w", profile, err)
+	}
+
+	return nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	if err := decode(data, cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
+
+func decode(data []byte, cfg *Config) error {
+	decoder := toml.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	return decoder.Decode(cfg)
+}
+
+func envOr(lookupEnv func(string) (string, bool), key string, fallback string) string {
+	if value, ok := lookupEnv(key); ok && value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// registerFlags declares a string flag for every field with a flag tag, so
+// values are parsed the same way as environment variables
+func registerFlags(flags *flag.FlagSet, v reflect.Value) map[string]reflect.Value {
+	fields := map[string]reflect.Value{}
+
+	walk(v, func(field reflect.StructField, value reflect.Value) {
+		if name := field.Tag.Get("flag"); name != "" {
+			flags.String(name, "", "overrides "+field.Tag.Get("env"))
+			fields[name] = value
+		}
+	})
+
+	return fields
+}
+
+func applyEnv(v reflect.Value, lookupEnv func(string) (string, bool)) error {
+	var err error
+
+	walk(v, func(field reflect.StructField, value reflect.Value) {
+		key := field.Tag.Get("env")
+
+		if key == "" || err != nil {
+			return
+		}
+
+		if raw, ok := lookupEnv(key); ok && raw != "" {
+			if setErr := setValue(value, raw); setErr != nil {
+				err = fmt.Errorf("%s: %w", key, setErr)
+			}
+		}
+	})
+
+	return err
+}
+
+// walk calls fn for every leaf field of the configuration
+func walk(v reflect.Value, fn func(reflect.StructField, reflect.Value)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		value := v.Field(i)
+
+		if value.Kind() == reflect.Struct && field.Type != reflect.TypeOf(Duration{}) {
+			walk(value, fn)
+			continue
+		}
+
+		fn(field, value)
+	}
+}
+
+func setValue(value reflect.Value, raw string) error {
+	if value.Type() == reflect.TypeOf(Duration{}) {
+		return value.Addr().Interface().(*Duration).UnmarshalText([]byte(raw))
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int:
+		number, err := strconv.Atoi(raw)
+
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+
+		value.SetInt(int64(number))
+	case reflect.Float64:
+		number, err := strconv.ParseFloat(raw, 64)
+
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+
+		value.SetFloat(number)
+	case reflect.Bool:
+		boolean, err := strconv.ParseBool(raw)
+
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+
+		value.SetBool(boolean)
+	case reflect.Slice:
+		var items []string
+
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+
+	return nil
+}
+
+// Validate reports every invalid value at once so startup fails with the full list
+func (c Config) Validate() error {
+	var problems []string
+
+	if c.Server.Addr == "" {
+		problems = append(problems, "server.addr is required")
+	}
+
+	timeouts := []struct {
+		name  string
+		value Duration
+	}{
+		{"read_timeout", c.Server.ReadTimeout},
+		{"read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"write_timeout", c.Server.WriteTimeout},
+		{"idle_timeout", c.Server.IdleTimeout},
+		{"shutdown_timeout", c.Server.ShutdownTimeout},
+	}
+
+	for _, timeout := range timeouts {
+		if timeout.value.Duration <= 0 {
+			problems = append(problems, "server."+timeout.name+" must be positive")
+		}
+	}
+
+	if c.Server.MaxHeaderBytes <= 0 || c.Server.MaxBodyBytes <= 0 {
+		problems = append(problems, "server.max_header_bytes and server.max_body_bytes must be positive")
+	}
+
+	if (c.Server.TlsCertFile == "") != (c.Server.TlsKeyFile == "") {
+		problems = append(problems, "server.tls_cert_file and server.tls_key_file must be set together")
+	}
+
+	if c.Server.TlsCertFile != "" && c.Server.TlsReloadInterval.Duration <= 0 {
+		problems = append(problems, "server.tls_reload_interval must be positive")
+	}
+
+	switch c.Database.Driver {
+	case "mysql", "postgres", "sqlite":
+	default:
+		problems = append(problems, fmt.Sprintf("database.driver %q must be mysql, postgres or sqlite", c.Database.Driver))
+	}
+
+	if c.Database.Dsn == "" {
+		problems = append(problems, "database.dsn is required (DBCONNSTRING)")
+	}
+
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		problems = append(problems, "database connection limits can't be negative")
+	}
+
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		problems = append(problems, "database.max_idle_conns can't exceed database.max_open_conns")
+	}
+
+	if c.Database.ConnectTimeout.Duration <= 0 {
+		problems = append(problems, "database.connect_timeout must be positive")
+	}
+
+	if len(c.Auth.JwtSecret) < 32 {
+		problems = append(problems, "auth.jwt_secret must be at least 32 characters (JWT_SECRET)")
+	}
+
+	if c.Auth.TokenTtl.Duration <= 0 || c.Auth.ResetTtl.Duration <= 0 || c.Auth.VerificationTtl.Duration <= 0 || c.Auth.ConfirmationTtl.Duration <= 0 {
+		problems = append(problems, "auth.token_ttl, auth.reset_ttl, auth.verification_ttl and auth.confirmation_ttl must be positive")
+	}
+
+	if c.Auth.MfaIssuer == "" || strings.Contains(c.Auth.MfaIssuer, ":") {
+		problems = append(problems, "auth.mfa_issuer is required and can't contain a colon")
+	}
+
+	if c.Auth.MfaChallengeTtl.Duration <= 0 {
+		problems = append(problems, "auth.mfa_challenge_ttl must be positive")
+	}
+
+	for _, role := range c.Auth.MfaRequiredRoles {
+		if !auth.ValidRole(role) {
+			problems = append(problems, fmt.Sprintf("auth.mfa_required_roles entry %q is not a role", role))
+		}
+	}
+
+	if len(c.Cors.AllowedOrigins) == 0 {
+		problems = append(problems, "cors.allowed_origins is required")
+	}
+
+	for _, origin := range c.Cors.AllowedOrigins {
+		if origin == "*" && c.Cors.AllowCredentials {
+			problems = append(problems, "cors.allow_credentials can't be used with every origin allowed")
+		}
+	}
+
+	if _, err := log.ParseLevel(c.Log.Level); err != nil {
+		problems = append(problems, fmt.Sprintf("log.level %q is not a valid level", c.Log.Level))
+	}
+
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		problems = append(problems, fmt.Sprintf("log.format %q must be json or text", c.Log.Format))
+	}
+
+	for _, entry := range c.Log.Packages {
+		name, level, found := strings.Cut(entry, "=")
+
+		if _, err := log.ParseLevel(level); !found || name == "" || err != nil {
+			problems = append(problems, fmt.Sprintf("log.packages entry %q must be package=level", entry))
+		}
+	}
+
+	if c.Images.Dir == "" {
+		problems = append(problems, "images.dir is required")
+	}
+
+	if c.Images.MaxSignedUrlTtl.Duration <= 0 {
+		problems = append(problems, "images.max_signed_url_ttl must be positive")
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if c.Tracing.Endpoint == "" {
+			problems = append(problems, "tracing.endpoint is required with the otlp exporter")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter %q must be none, otlp or stdout", c.Tracing.Exporter))
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problems = append(problems, "tracing.sample_ratio must be between 0 and 1")
+	}
+
+	for _, route := range c.RateLimit.Routes {
+		if method, path, _ := strings.Cut(route.Route, " "); method == "" || !strings.HasPrefix(path, "/") {
+			problems = append(problems, fmt.Sprintf("rate_limit.routes route %q must be \"METHOD /path\"", route.Route))
+		}
+
+		for _, limit := range []string{route.PerIp, route.PerAccount} {
+			if _, err := ratelimit.ParseLimit(limit); limit != "" && err != nil {
+				problems = append(problems, "rate_limit.routes "+err.Error())
+			}
+		}
+
+		if route.PerAccount != "" && route.AccountField == "" {
+			problems = append(problems, fmt.Sprintf("rate_limit.routes %q needs account_field to limit per account", route.Route))
+		}
+	}
+
+	login := c.RateLimit.Login
+
+	if login.MaxFailures <= 0 || login.Window.Duration <= 0 || login.Lockout.Duration <= 0 {
+		problems = append(problems, "rate_limit.login max_failures, window and lockout must be positive")
+	}
+
+	if login.Delay.Duration < 0 || login.MaxDelay.Duration < login.Delay.Duration {
+		problems = append(problems, "rate_limit.login.max_delay can't be less than rate_limit.login.delay")
+	}
+
+	if login.KnownClientTtl.Duration < 0 {
+		problems = append(problems, "rate_limit.login.known_client_ttl can't be negative")
+	}
+
+	if c.Idempotency.Retention.Duration <= 0 || c.Idempotency.LockTimeout.Duration <= 0 {
+		problems = append(problems, "idempotency.retention and idempotency.lock_timeout must be positive")
+	}
+
+	if c.SoftDelete.Retention.Duration <= 0 {
+		problems = append(problems, "soft_delete.retention must be positive")
+	}
+
+	if len(c.Audit.HmacKey) < 32 {
+		problems = append(problems, "audit.hmac_key must be at least 32 characters (AUDIT_HMAC_KEY)")
+	}
+
+	switch c.Mail.Driver {
+	case "none":
+	case "smtp":
+		if c.Mail.Smtp.Host == "" || c.Mail.Smtp.Port <= 0 {
+			problems = append(problems, "mail.smtp.host and mail.smtp.port are required with the smtp driver (SMTP_HOST)")
+		}
+	case "file":
+		if c.Mail.Dir == "" {
+			problems = append(problems, "mail.dir is required with the file driver")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("mail.driver %q must be none, smtp or file", c.Mail.Driver))
+	}
+
+	if c.Mail.Driver != "none" {
+		if _, err := netmail.ParseAddress(c.Mail.From); err != nil {
+			problems = append(problems, fmt.Sprintf("mail.from %q is not a valid address", c.Mail.From))
+		}
+
+		if u, err := url.Parse(c.Mail.AppUrl); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, "mail.app_url must be an absolute url, the links in the emails point to it (MAIL_APP_URL)")
+		}
+	}
+
+	if c.Oidc.StateTtl.Duration <= 0 {
+		problems = append(problems, "oidc.state_ttl must be positive")
+	}
+
+	names := map[string]bool{}
+
+	for _, provider := range c.Oidc.Providers {
+		if !validProviderName(provider.Name) || names[provider.Name] {
+			problems = append(problems, fmt.Sprintf("oidc.providers name %q must be unique and only lowercase letters, digits and dashes", provider.Name))
+		}
+
+		names[provider.Name] = true
+
+		if u, err := url.Parse(provider.Issuer); err != nil || u.Host == "" || (u.Scheme != "https" && !(u.Scheme == "http" && isLocalhost(u.Hostname()))) {
+			problems = append(problems, fmt.Sprintf("oidc.providers %q issuer must be an https url", provider.Name))
+		}
+
+		if provider.ClientId == "" {
+			problems = append(problems, fmt.Sprintf("oidc.providers %q client_id is required", provider.Name))
+		}
+
+		if u, err := url.Parse(provider.RedirectUrl); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("oidc.providers %q redirect_url must be an absolute url", provider.Name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+// validProviderName accepts names that are safe in URLs and variable names
+func validProviderName(name string) bool {
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+
+	return name != ""
+}
+
+// isLocalhost allows a plain http issuer for a provider running locally, e.g.
+// a mock issuer in development
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// Redacted returns a copy of the configuration with its secrets masked
+func (c Config) Redacted() Config {
+	redact := func(field reflect.StructField, value reflect.Value) {
+		if field.Tag.Get("secret") == "true" && value.String() != "" {
+			value.SetString("********")
+		}
+	}
+
+	walk(reflect.ValueOf(&c).Elem(), redact)
+
+	// The providers are copied so the original keeps its secrets
+	c.Oidc.Providers = append([]OidcProviderConfig(nil), c.Oidc.Providers...)
+
+	for i := range c.Oidc.Providers {
+		walk(reflect.ValueOf(&c.Oidc.Providers[i]).Elem(), redact)
+	}
+
+	return c
+}
+
+// Print writes the configuration as TOML with its secrets redacted
+func (c Config) Print(w io.Writer) error {
+	return toml.NewEncoder(w).Encode(c.Redacted())
+}
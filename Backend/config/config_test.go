@@ -0,0 +1,299 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	a := assert.New(t)
+
+	file := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(file, []byte(`
+[server]
+addr = ":8080"
+
+[database]
+dsn = "file-dsn"
+query_timeout = "3s"
+
+[log]
+level = "warn"
+`), 0o600)
+	a.Nil(err)
+
+	cfg, args, err := load([]string{"--profile", "qa", "--config", file, "--log-level", "error", "migrate", "up"}, env(map[string]string{
+		"DBCONNSTRING":         "env-dsn",
+		"JWT_SECRET":           testSecret,
+		"AUDIT_HMAC_KEY":       testSecret,
+		"DB_MAX_OPEN_CONNS":    "40",
+		"LOG_LEVEL":            "debug",
+		"TRACING_SAMPLE_RATIO": "0.25",
+	}))
+
+	a.Nil(err)
+	a.Equal([]string{"migrate", "up"}, args)
+
+	a.Equal("qa", cfg.Profile)
+	a.Equal([]string{"https://miranda-frontend-qa.azurewebsites.net"}, cfg.Cors.AllowedOrigins) // profile
+	a.Equal(":8080", cfg.Server.Addr)                                                           // file over default
+	a.Equal(3*time.Second, cfg.Database.QueryTimeout.Duration)                                  // file over default
+	a.Equal("env-dsn", cfg.Database.Dsn)                                                        // env over file
+	a.Equal(40, cfg.Database.MaxOpenConns)                                                      // env over default
+	a.Equal("error", cfg.Log.Level)                                                             // flag over env
+	a.Equal(10, cfg.Database.MaxIdleConns)                                                      // default
+	a.Equal(0.25, cfg.Tracing.SampleRatio)                                                      // env over default
+}
+
+func TestLoad_ProfileFromEnv(t *testing.T) {
+	a := assert.New(t)
+
+	cfg, _, err := load(nil, env(map[string]string{"APP_PROFILE": "prod", "DBCONNSTRING": "dsn", "JWT_SECRET": testSecret, "AUDIT_HMAC_KEY": testSecret}))
+
+	a.Nil(err)
+	a.Equal("prod", cfg.Profile)
+	a.Equal("info", cfg.Log.Level)
+	a.Equal(50, cfg.Database.MaxOpenConns)
+	a.Equal([]string{"Admin"}, cfg.Auth.MfaRequiredRoles)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	a := assert.New(t)
+
+	_, _, err := load(nil, env(map[string]string{"DBCONNSTRING": "dsn", "JWT_SECRET": testSecret}))
+	a.ErrorContains(err, "no profile given")
+
+	_, _, err = load([]string{"--profile", "staging"}, env(nil))
+	a.EqualError(err, `unknown profile "staging"`)
+
+	_, _, err = load([]string{"--profile", "dev"}, env(map[string]string{"DB_QUERY_TIMEOUT": "ten seconds"}))
+	a.ErrorContains(err, "DB_QUERY_TIMEOUT")
+
+	file := filepath.Join(t.TempDir(), "config.toml")
+	a.Nil(os.WriteFile(file, []byte("[server]\nadress = \":80\"\n"), 0o600))
+
+	_, _, err = load([]string{"--profile", "dev", "--config", file}, env(nil))
+	a.ErrorContains(err, file)
+}
+
+func TestLoad_JwtSecret(t *testing.T) {
+	a := assert.New(t)
+
+	// dev makes up a secret of its own when none is given
+	first, _, err := load([]string{"--profile", "dev"}, env(map[string]string{"DBCONNSTRING": "dsn"}))
+	a.Nil(err)
+	second, _, err := load([]string{"--profile", "dev"}, env(map[string]string{"DBCONNSTRING": "dsn"}))
+	a.Nil(err)
+	a.Len(first.Auth.JwtSecret, 64)
+	a.NotEqual(first.Auth.JwtSecret, second.Auth.JwtSecret)
+	a.Len(first.Audit.HmacKey, 64)
+	a.NotEqual(first.Audit.HmacKey, second.Audit.HmacKey)
+	a.NotEqual(first.Auth.JwtSecret, first.Audit.HmacKey)
+
+	cfg, _, err := load([]string{"--profile", "dev"}, env(map[string]string{"DBCONNSTRING": "dsn", "JWT_SECRET": testSecret}))
+	a.Nil(err)
+	a.Equal(testSecret, cfg.Auth.JwtSecret)
+
+	// while the others must be given one
+	_, _, err = load([]string{"--profile", "qa"}, env(map[string]string{"DBCONNSTRING": "dsn"}))
+	a.ErrorContains(err, "auth.jwt_secret")
+	a.ErrorContains(err, "audit.hmac_key")
+}
+
+func TestValidate(t *testing.T) {
+	a := assert.New(t)
+
+	cfg := Default()
+	cfg.Database.Dsn = "dsn"
+	cfg.Auth.JwtSecret = testSecret
+	cfg.Audit.HmacKey = testSecret
+	a.Nil(cfg.Validate())
+
+	cfg.Database.Driver = "oracle"
+	cfg.Auth.JwtSecret = "short"
+	cfg.Audit.HmacKey = "short"
+	cfg.Cors.AllowCredentials = true
+	cfg.Log.Level = "loud"
+	cfg.Log.Packages = []string{"client=debug", "db"}
+	cfg.Tracing.Exporter = "jaeger"
+	cfg.Tracing.SampleRatio = 2
+	cfg.Auth.MfaRequiredRoles = []string{"Admin", "Owner"}
+	cfg.Auth.MfaChallengeTtl = Duration{}
+
+	err := cfg.Validate()
+
+	a.ErrorContains(err, `database.driver "oracle"`)
+	a.ErrorContains(err, "auth.jwt_secret")
+	a.ErrorContains(err, "audit.hmac_key")
+	a.ErrorContains(err, "cors.allow_credentials")
+	a.ErrorContains(err, `log.level "loud"`)
+	a.ErrorContains(err, `log.packages entry "db"`)
+	a.NotContains(err.Error(), "client=debug")
+	a.ErrorContains(err, `tracing.exporter "jaeger"`)
+	a.ErrorContains(err, "tracing.sample_ratio")
+	a.ErrorContains(err, `auth.mfa_required_roles entry "Owner"`)
+	a.NotContains(err.Error(), `entry "Admin"`)
+	a.ErrorContains(err, "auth.mfa_challenge_ttl")
+}
+
+func TestValidate_Mail(t *testing.T) {
+	a := assert.New(t)
+
+	cfg := Default()
+	cfg.Database.Dsn = "dsn"
+	cfg.Auth.JwtSecret = testSecret
+	cfg.Audit.HmacKey = testSecret
+	cfg.Mail.Driver = "smtp"
+	cfg.Mail.From = "not an address"
+
+	err := cfg.Validate()
+
+	a.ErrorContains(err, "mail.smtp.host")
+	a.ErrorContains(err, `mail.from "not an address"`)
+	a.ErrorContains(err, "mail.app_url")
+
+	cfg.Mail.Smtp.Host = "smtp.example.com"
+	cfg.Mail.From = "Miranda <no-reply@example.com>"
+	cfg.Mail.AppUrl = "https://miranda.example.com"
+	a.Nil(cfg.Validate())
+
+	cfg.Mail.Driver = "pigeon"
+	a.ErrorContains(cfg.Validate(), `mail.driver "pigeon"`)
+
+	// The dev profile writes the emails to files
+	cfg, _, err = load([]string{"--profile", "dev"}, env(map[string]string{"DBCONNSTRING": "dsn"}))
+	a.Nil(err)
+	a.Equal("file", cfg.Mail.Driver)
+}
+
+func TestPrint_RedactsSecrets(t *testing.T) {
+	a := assert.New(t)
+
+	cfg := Default()
+	cfg.Database.Dsn = "root:hunter2@tcp(db)/hotels"
+	cfg.Auth.JwtSecret = testSecret
+	cfg.Audit.HmacKey = testSecret
+
+	var out bytes.Buffer
+	a.Nil(cfg.Print(&out))
+
+	a.NotContains(out.String(), "hunter2")
+	a.NotContains(out.String(), testSecret)
+	a.Contains(out.String(), "dsn = '********'")
+	a.Contains(out.String(), "signing_key = ''")
+
+	// The original is left untouched
+	a.Equal(testSecret, cfg.Auth.JwtSecret)
+}
+
+func TestLoad_RateLimitRoutes(t *testing.T) {
+	a := assert.New(t)
+
+	file := filepath.Join(t.TempDir(), "config.toml")
+	a.Nil(os.WriteFile(file, []byte(`
+[[rate_limit.routes]]
+route = "POST /login"
+per_ip = "5/1m"
+`), 0o600))
+
+	cfg, _, err := load([]string{"--profile", "dev", "--config", file}, env(map[string]string{"DBCONNSTRING": "dsn", "JWT_SECRET": testSecret}))
+
+	a.Nil(err)
+	a.Equal([]RouteLimitConfig{{Route: "POST /login", PerIp: "5/1m"}}, cfg.RateLimit.Routes)
+
+	cfg.RateLimit.Routes = []RouteLimitConfig{{Route: "login", PerIp: "5", PerAccount: "5/1m"}}
+	err = cfg.Validate()
+
+	a.ErrorContains(err, `route "login"`)
+	a.ErrorContains(err, `limit "5"`)
+	a.ErrorContains(err, "needs account_field")
+}
+
+func TestLoad_OidcProviders(t *testing.T) {
+	a := assert.New(t)
+
+	file := filepath.Join(t.TempDir(), "config.toml")
+	a.Nil(os.WriteFile(file, []byte(`
+[[oidc.providers]]
+name = "google"
+display_name = "Google"
+issuer = "https://accounts.google.com"
+client_id = "client"
+redirect_url = "https://miranda.example.com/login/oidc/google"
+
+[[oidc.providers]]
+name = "azure-ad"
+display_name = "Microsoft"
+issuer = "https://login.microsoftonline.com/tenant/v2.0"
+client_id = "client"
+client_secret = "from-file"
+redirect_url = "https://miranda.example.com/login/oidc/azure-ad"
+`), 0o600))
+
+	cfg, _, err := load([]string{"--profile", "dev", "--config", file}, env(map[string]string{
+		"DBCONNSTRING":                "dsn",
+		"JWT_SECRET":                  testSecret,
+		"AUDIT_HMAC_KEY":              testSecret,
+		"OIDC_GOOGLE_CLIENT_SECRET":   "google-secret",
+		"OIDC_AZURE_AD_CLIENT_SECRET": "azure-secret",
+		"OIDC_STATE_TTL":              "5m",
+	}))
+
+	a.Nil(err)
+	a.Len(cfg.Oidc.Providers, 2)
+	a.Equal("google-secret", cfg.Oidc.Providers[0].ClientSecret)
+	a.Equal("azure-secret", cfg.Oidc.Providers[1].ClientSecret) // env over file
+	a.Equal(5*time.Minute, cfg.Oidc.StateTtl.Duration)
+
+	var out bytes.Buffer
+	a.Nil(cfg.Print(&out))
+
+	a.NotContains(out.String(), "google-secret")
+	a.NotContains(out.String(), "azure-secret")
+	a.Contains(out.String(), "client_secret = '********'")
+	a.Equal("google-secret", cfg.Oidc.Providers[0].ClientSecret)
+}
+
+func TestValidate_Oidc(t *testing.T) {
+	a := assert.New(t)
+
+	cfg := Default()
+	cfg.Database.Dsn = "dsn"
+	cfg.Auth.JwtSecret = testSecret
+	cfg.Audit.HmacKey = testSecret
+	cfg.Oidc.Providers = []OidcProviderConfig{
+		{Name: "google", Issuer: "https://accounts.google.com", ClientId: "client", RedirectUrl: "https://miranda.example.com/login/oidc/google"},
+		{Name: "mock", Issuer: "http://localhost:8081", ClientId: "client", RedirectUrl: "http://localhost:5173/login/oidc/mock"},
+	}
+	a.Nil(cfg.Validate())
+
+	cfg.Oidc.StateTtl = Duration{}
+	cfg.Oidc.Providers = append(cfg.Oidc.Providers,
+		OidcProviderConfig{Name: "google", Issuer: "https://accounts.google.com", ClientId: "client", RedirectUrl: "https://miranda.example.com/login/oidc/google"},
+		OidcProviderConfig{Name: "Evil Corp", Issuer: "http://evil.example.com", RedirectUrl: "/login"},
+	)
+
+	err := cfg.Validate()
+
+	a.ErrorContains(err, "oidc.state_ttl")
+	a.ErrorContains(err, `oidc.providers name "google"`)
+	a.ErrorContains(err, `oidc.providers name "Evil Corp"`)
+	a.ErrorContains(err, `"Evil Corp" issuer`)
+	a.ErrorContains(err, `"Evil Corp" client_id`)
+	a.ErrorContains(err, `"Evil Corp" redirect_url`)
+	a.NotContains(err.Error(), `"mock"`)
+}
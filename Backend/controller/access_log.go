@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// AccessLog writes one structured line per request once it is answered. The
+// query string is left out, signed image urls carry their signature in it.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		entry := log.Ctx(c.Request.Context()).WithFields(logrus.Fields{
+			"method":     c.Request.Method,
+			"route":      route,
+			"path":       c.Request.URL.Path,
+			"status":     c.Writer.Status(),
+			"bytes":      c.Writer.Size(),
+			"latency_ms": time.Since(start).Milliseconds(),
+			"client_ip":  c.ClientIP(),
+			"user_agent": c.Request.UserAgent(),
+		})
+
+		switch status := c.Writer.Status(); {
+		case status >= http.StatusInternalServerError:
+			entry.Error("Request handled")
+		case status >= http.StatusBadRequest:
+			entry.Warn("Request handled")
+		default:
+			entry.Info("Request handled")
+		}
+	}
+}
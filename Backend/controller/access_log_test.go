@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"project/logging"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLog_Controller(t *testing.T) {
+	a := assert.New(t)
+
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	t.Cleanup(func() { logging.SetOutput(os.Stdout) })
+
+	r := gin.New()
+	r.Use(AccessLog(), RequestId(), ErrorHandler())
+	r.GET("/image/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/image/1?expires=99&signature=a1b2c3", nil)
+	req.Header.Set(RequestIdHeader, "abc-123")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	a.Nil(json.Unmarshal(buf.Bytes(), &entry))
+
+	a.Equal("Request handled", entry["message"])
+	a.Equal("abc-123", entry["request_id"])
+	a.Equal("/image/:id", entry["route"])
+	a.Equal("/image/1", entry["path"])
+	a.Equal(float64(http.StatusOK), entry["status"])
+	a.NotContains(buf.String(), "a1b2c3")
+}
+
+func TestRequestId_Controller_RejectsUnsafeIds(t *testing.T) {
+	a := assert.New(t)
+
+	r := gin.New()
+	r.Use(RequestId())
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, logging.RequestId(c.Request.Context()))
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIdHeader, "abc\n{\"level\":\"error\"}")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	id := w.Header().Get(RequestIdHeader)
+
+	a.Len(id, 32)
+	a.Equal(id, w.Body.String())
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"net/http"
+	"project/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The admin endpoints list the deleted hotels, users and reservations, which
+// can be restored until they are purged, see service.DeletedRetention
+
+func GetDeletedHotels(c *gin.Context) {
+	hotelsDto, err := service.HotelService.GetDeletedHotels(c.Request.Context())
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, hotelsDto)
+}
+
+func GetDeletedUsers(c *gin.Context) {
+	usersDto, err := service.UserService.GetDeletedUsers(c.Request.Context())
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, usersDto)
+}
+
+func GetDeletedReservations(c *gin.Context) {
+	reservationsDto, err := service.ReservationService.GetDeletedReservations(c.Request.Context())
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, reservationsDto)
+}
+
+func RestoreHotel(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	err := service.HotelService.RestoreHotel(c.Request.Context(), id)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Hotel restored"})
+}
+
+func RestoreUser(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	err := service.UserService.RestoreUser(c.Request.Context(), id)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User restored"})
+}
+
+func RestoreReservation(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	err := service.ReservationService.RestoreReservation(c.Request.Context(), id)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reservation restored"})
+}
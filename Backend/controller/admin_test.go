@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"project/dto"
+	"project/service"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestAssignment struct{}
+
+func init() {
+	service.AssignmentService = &TestAssignment{}
+}
+
+func (t *TestAssignment) GetAssignedHotels(ctx context.Context, userId int) (dto.AssignedHotelsDto, error) {
+	if userId > 10 {
+		return dto.AssignedHotelsDto{}, service.ErrUserNotFound
+	}
+
+	return dto.AssignedHotelsDto{UserId: userId, HotelIds: []int{1}}, nil
+}
+
+func (t *TestAssignment) AssignHotel(ctx context.Context, userId int, hotelId int) (dto.AssignedHotelsDto, error) {
+	if hotelId > 10 {
+		return dto.AssignedHotelsDto{}, service.ErrHotelNotFound
+	}
+
+	if userId == 1 {
+		return dto.AssignedHotelsDto{}, service.ErrUserNotManager
+	}
+
+	return dto.AssignedHotelsDto{UserId: userId, HotelIds: []int{1, hotelId}}, nil
+}
+
+func (t *TestAssignment) UnassignHotel(ctx context.Context, userId int, hotelId int) (dto.AssignedHotelsDto, error) {
+	if hotelId != 1 {
+		return dto.AssignedHotelsDto{}, service.ErrAssignmentNotFound
+	}
+
+	return dto.AssignedHotelsDto{UserId: userId, HotelIds: []int{}}, nil
+}
+
+func newAdminTestRouter() *gin.Engine {
+	r := newErrorTestRouter()
+	r.GET("/admin/deleted/hotels", GetDeletedHotels)
+	r.GET("/admin/deleted/users", GetDeletedUsers)
+	r.GET("/admin/deleted/reservations", GetDeletedReservations)
+	r.POST("/admin/deleted/hotels/:id/restore", RestoreHotel)
+	r.POST("/admin/deleted/users/:id/restore", RestoreUser)
+	r.POST("/admin/deleted/reservations/:id/restore", RestoreReservation)
+
+	return r
+}
+
+func TestGetDeleted_Controller(t *testing.T) {
+	a := assert.New(t)
+	r := newAdminTestRouter()
+
+	get := func(path string, obj any) {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		a.Equal(http.StatusOK, w.Code)
+		a.Nil(json.Unmarshal(w.Body.Bytes(), obj))
+	}
+
+	deletedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	var hotels dto.DeletedHotelsDto
+	get("/admin/deleted/hotels", &hotels)
+	a.Equal(dto.DeletedHotelsDto{{HotelDto: dto.HotelDto{Id: 3, Name: "Hotel 3"}, DeletedAt: deletedAt}}, hotels)
+
+	var users dto.DeletedUsersDto
+	get("/admin/deleted/users", &users)
+	a.Equal(dto.DeletedUsersDto{{UserDto: dto.UserDto{Id: 3, Email: "jim@email.com"}, DeletedAt: deletedAt}}, users)
+
+	var reservations dto.DeletedReservationsDto
+	get("/admin/deleted/reservations", &reservations)
+	a.Equal(dto.DeletedReservationsDto{{ReservationDto: dto.ReservationDto{Id: 4, HotelId: 1, UserId: 1}, DeletedAt: deletedAt}}, reservations)
+}
+
+func TestRestore_Controller(t *testing.T) {
+	a := assert.New(t)
+	r := newAdminTestRouter()
+
+	for _, test := range []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/admin/deleted/hotels/3/restore", http.StatusOK, ""},
+		{"/admin/deleted/hotels/12/restore", http.StatusNotFound, "hotel_not_found"},
+		{"/admin/deleted/users/3/restore", http.StatusOK, ""},
+		{"/admin/deleted/users/12/restore", http.StatusNotFound, "user_not_found"},
+		{"/admin/deleted/reservations/4/restore", http.StatusOK, ""},
+		{"/admin/deleted/reservations/8/restore", http.StatusConflict, "no_rooms_available"},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, test.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var problem dto.ProblemDto
+		json.Unmarshal(w.Body.Bytes(), &problem)
+
+		a.Equal(test.status, w.Code, test.path)
+		a.Equal(test.code, problem.Code, test.path)
+	}
+}
+
+func TestAdminUsers_Controller(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+	r.POST("/admin/users", CreateUser)
+	r.PUT("/admin/users/:id/role", SetUserRole)
+	r.POST("/admin/users/:id/disable", DisableUser)
+	r.POST("/admin/users/:id/enable", EnableUser)
+
+	w := sendAs(r, 4, http.MethodPost, "/admin/users", `{"name": "Mary", "last_name": "Doe", "dni": "12345678", "email": "mary@email.com", "password": "Password1!", "role": "Manager"}`)
+
+	var userDto dto.UserDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &userDto))
+
+	a.Equal(http.StatusCreated, w.Code)
+	a.Equal("Manager", userDto.Role)
+
+	w = sendAs(r, 4, http.MethodPost, "/admin/users", `{"name": "Mary", "last_name": "Doe", "dni": "12345678", "email": "mary@email.com", "password": "Password1!", "role": "Owner"}`)
+
+	var problem dto.ProblemDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("role", problem.Errors[0].Field)
+	a.Equal("must be one of Admin, Manager, FrontDesk, Customer", problem.Errors[0].Message)
+
+	w = sendAs(r, 4, http.MethodPut, "/admin/users/7/role", `{"role": "FrontDesk"}`)
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &userDto))
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("FrontDesk", userDto.Role)
+
+	w = sendAs(r, 4, http.MethodPut, "/admin/users/4/role", `{"role": "Customer"}`)
+	a.Equal(http.StatusForbidden, w.Code)
+
+	w = sendAs(r, 4, http.MethodPost, "/admin/users/7/disable", "")
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &userDto))
+
+	a.Equal(http.StatusOK, w.Code)
+	a.True(userDto.Disabled)
+
+	w = sendAs(r, 4, http.MethodPost, "/admin/users/7/enable", "")
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &userDto))
+
+	a.Equal(http.StatusOK, w.Code)
+	a.False(userDto.Disabled)
+
+	w = sendAs(r, 4, http.MethodPost, "/admin/users/12/disable", "")
+	a.Equal(http.StatusNotFound, w.Code)
+}
+
+func TestHotelAssignments_Controller(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+	r.GET("/me/hotels", Authenticated(), GetProfileHotels)
+	r.GET("/admin/users/:id/hotels", GetAssignedHotels)
+	r.PUT("/admin/users/:id/hotels/:hotelId", AssignHotel)
+	r.DELETE("/admin/users/:id/hotels/:hotelId", UnassignHotel)
+
+	var assignedDto dto.AssignedHotelsDto
+
+	w := sendAs(r, 5, http.MethodGet, "/me/hotels", "")
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &assignedDto))
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(dto.AssignedHotelsDto{UserId: 5, HotelIds: []int{1}}, assignedDto)
+
+	w = sendAs(r, 0, http.MethodGet, "/me/hotels", "")
+	a.Equal(http.StatusUnauthorized, w.Code)
+
+	w = sendAs(r, 4, http.MethodPut, "/admin/users/5/hotels/3", "")
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &assignedDto))
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal([]int{1, 3}, assignedDto.HotelIds)
+
+	w = sendAs(r, 4, http.MethodDelete, "/admin/users/5/hotels/1", "")
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &assignedDto))
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal([]int{}, assignedDto.HotelIds)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		code   string
+	}{
+		{http.MethodGet, "/admin/users/12/hotels", http.StatusNotFound, "user_not_found"},
+		{http.MethodPut, "/admin/users/5/hotels/12", http.StatusNotFound, "hotel_not_found"},
+		{http.MethodPut, "/admin/users/1/hotels/3", http.StatusBadRequest, "user_not_manager"},
+		{http.MethodDelete, "/admin/users/5/hotels/3", http.StatusNotFound, "assignment_not_found"},
+	}
+
+	for _, test := range tests {
+		w := sendAs(r, 4, test.method, test.path, "")
+
+		var problem dto.ProblemDto
+		a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+		a.Equal(test.status, w.Code, test.path)
+		a.Equal(test.code, problem.Code, test.path)
+	}
+}
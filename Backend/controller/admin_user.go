@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"net/http"
+	"project/dto"
+	"project/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The admin user endpoints create accounts with any role, change roles,
+// disable accounts, assign hotels to managers and reset second factors. The services check the
+// caller may do so.
+
+func CreateUser(c *gin.Context) {
+	var newUserDto dto.NewUserDto
+	if !bindJSON(c, &newUserDto) {
+		return
+	}
+
+	userDto, err := service.UserService.CreateUser(c.Request.Context(), newUserDto)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, userDto)
+}
+
+func SetUserRole(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var roleDto dto.RoleDto
+	if !bindJSON(c, &roleDto) {
+		return
+	}
+
+	userDto, err := service.UserService.SetRole(c.Request.Context(), id, roleDto.Role)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userDto)
+}
+
+func DisableUser(c *gin.Context) {
+	setUserDisabled(c, true)
+}
+
+func EnableUser(c *gin.Context) {
+	setUserDisabled(c, false)
+}
+
+func setUserDisabled(c *gin.Context, disabled bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	userDto, err := service.UserService.SetDisabled(c.Request.Context(), id, disabled)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userDto)
+}
+
+func GetAssignedHotels(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	assignedDto, err := service.AssignmentService.GetAssignedHotels(c.Request.Context(), id)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, assignedDto)
+}
+
+func AssignHotel(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	hotelId, _ := strconv.Atoi(c.Param("hotelId"))
+
+	assignedDto, err := service.AssignmentService.AssignHotel(c.Request.Context(), id, hotelId)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, assignedDto)
+}
+
+func UnassignHotel(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	hotelId, _ := strconv.Atoi(c.Param("hotelId"))
+
+	assignedDto, err := service.AssignmentService.UnassignHotel(c.Request.Context(), id, hotelId)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, assignedDto)
+}
+
+// ResetUserMfa removes the second factor of a user who lost it, they log in
+// with their password alone or enroll again if their role requires it
+func ResetUserMfa(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	err := service.MfaService.ResetMfa(c.Request.Context(), id)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Second factor reset"})
+}
@@ -6,23 +6,18 @@ import (
 	"project/service"
 
 	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
 )
 
 func InsertAmenity(c *gin.Context) {
 	var amenityDto dto.AmenityDto
-	err := c.BindJSON(&amenityDto)
-
-	if err != nil {
-		log.Error(err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &amenityDto) {
 		return
 	}
 
-	amenityDto, er := service.AmenityService.InsertAmenity(amenityDto)
+	amenityDto, er := service.AmenityService.InsertAmenity(c.Request.Context(), amenityDto)
 
 	if er != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": er.Error()})
+		c.Error(er)
 		return
 	}
 
@@ -33,10 +28,10 @@ func GetAmenities(c *gin.Context) {
 
 	var amenitiesDto dto.AmenitiesDto
 
-	amenitiesDto, err := service.AmenityService.GetAmenities()
+	amenitiesDto, err := service.AmenityService.GetAmenities(c.Request.Context())
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
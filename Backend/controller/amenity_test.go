@@ -1,10 +1,9 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
@@ -20,10 +19,10 @@ func init() {
 	service.AmenityService = &TestAmenity{}
 }
 
-func (t TestAmenity) InsertAmenity(amenityDto dto.AmenityDto) (dto.AmenityDto, error) {
+func (t TestAmenity) InsertAmenity(ctx context.Context, amenityDto dto.AmenityDto) (dto.AmenityDto, error) {
 
 	if amenityDto.Name == "" {
-		return amenityDto, errors.New("error creating amenity")
+		return amenityDto, service.Invalid("invalid_amenity", "error creating amenity")
 	}
 
 	amenityDto.Id = 1
@@ -31,7 +30,7 @@ func (t TestAmenity) InsertAmenity(amenityDto dto.AmenityDto) (dto.AmenityDto, e
 	return amenityDto, nil
 }
 
-func (t TestAmenity) GetAmenities() (dto.AmenitiesDto, error) {
+func (t TestAmenity) GetAmenities(ctx context.Context) (dto.AmenitiesDto, error) {
 
 	return dto.AmenitiesDto{
 		dto.AmenityDto{
@@ -51,6 +50,7 @@ func TestInsertAmenity_Controller_Error(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.POST("/amenity", InsertAmenity)
 
 	body := `{
@@ -70,10 +70,17 @@ func TestInsertAmenity_Controller_Error(t *testing.T) {
 
 	r.ServeHTTP(w, req)
 
-	expectedResponse := `{"error":"error creating amenity"}`
+	var problem dto.ProblemDto
+	err = json.Unmarshal(w.Body.Bytes(), &problem)
+	if err != nil {
+		log.Fatalf("Failed to unmarshal response: %v", err)
+	}
 
 	a.Equal(http.StatusBadRequest, w.Code)
-	a.Equal(expectedResponse, w.Body.String())
+	a.Equal("application/problem+json", w.Header().Get("Content-Type"))
+	a.Equal("validation_failed", problem.Code)
+	a.Equal(dto.FieldErrorsDto{{Field: "name", Code: "required", Message: "is required"}}, problem.Errors)
+	a.NotEmpty(problem.RequestId)
 }
 
 func TestInsertAmenity_Controller_Success(t *testing.T) {
@@ -81,6 +88,7 @@ func TestInsertAmenity_Controller_Success(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.POST("/amenity", InsertAmenity)
 
 	body := `{
@@ -117,6 +125,7 @@ func TestGetAmenities_Controller(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/amenity", GetAmenities)
 
 	req, err := http.NewRequest(http.MethodGet, "/amenity", nil)
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"project/dto"
+	"project/service"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidExportFormat = service.Invalid("invalid_export_format", "format must be csv or ndjson")
+
+var auditCsvHeader = []string{"id", "created_at", "actor_id", "actor_role", "action", "entity", "entity_id", "changes", "ip", "request_id", "prev_hash", "hash"}
+
+// GetAuditEntries lists the audit log newest first, filtered by the query, see dto.AuditFilterDto
+func GetAuditEntries(c *gin.Context) {
+	var filterDto dto.AuditFilterDto
+	if !bindQuery(c, &filterDto) {
+		return
+	}
+
+	entriesDto, err := service.AuditService.GetAuditEntries(c.Request.Context(), filterDto)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entriesDto)
+}
+
+// ExportAuditEntries downloads every entry matching the filter oldest first
+// as csv, or as one json object per line with ?format=ndjson. The entries are
+// written as they are read, so once the first is sent a failure can only cut
+// the download short.
+func ExportAuditEntries(c *gin.Context) {
+	var filterDto dto.AuditFilterDto
+	if !bindQuery(c, &filterDto) {
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+
+	if format != "csv" && format != "ndjson" {
+		c.Error(errInvalidExportFormat)
+		return
+	}
+
+	write, end := csvAuditWriter(c)
+	if format == "ndjson" {
+		write, end = ndjsonAuditWriter(c)
+	}
+
+	err := service.AuditService.ExportAuditEntries(c.Request.Context(), filterDto, write)
+
+	if err == nil {
+		err = end()
+	}
+
+	if err != nil && c.Writer.Written() {
+		log.Ctx(c.Request.Context()).WithError(err).Error("Audit export cut short")
+		c.Abort()
+		return
+	}
+
+	if err != nil {
+		c.Error(err)
+	}
+}
+
+// startAuditExport sends the headers of the download, once
+func startAuditExport(c *gin.Context, format string, contentType string) bool {
+	if c.Writer.Written() {
+		return false
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="audit.`+format+`"`)
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+
+	return true
+}
+
+// ndjsonAuditWriter writes an entry per line, end sends what is left and the
+// headers of an empty download
+func ndjsonAuditWriter(c *gin.Context) (write func(entryDto dto.AuditEntryDto) error, end func() error) {
+	encoder := json.NewEncoder(c.Writer)
+
+	write = func(entryDto dto.AuditEntryDto) error {
+		startAuditExport(c, "ndjson", "application/x-ndjson")
+		return encoder.Encode(entryDto)
+	}
+
+	end = func() error {
+		startAuditExport(c, "ndjson", "application/x-ndjson")
+		c.Writer.Flush()
+		return nil
+	}
+
+	return write, end
+}
+
+// csvAuditWriter writes an entry per row under auditCsvHeader, end sends
+// what is left and the header of an empty download
+func csvAuditWriter(c *gin.Context) (write func(entryDto dto.AuditEntryDto) error, end func() error) {
+	writer := csv.NewWriter(c.Writer)
+
+	start := func() {
+		if startAuditExport(c, "csv", "text/csv; charset=utf-8") {
+			writer.Write(auditCsvHeader)
+		}
+	}
+
+	write = func(entryDto dto.AuditEntryDto) error {
+		start()
+
+		changes := ""
+		if len(entryDto.Changes) > 0 {
+			content, _ := json.Marshal(entryDto.Changes)
+			changes = string(content)
+		}
+
+		return writer.Write([]string{
+			strconv.Itoa(entryDto.Id),
+			entryDto.CreatedAt.Format(time.RFC3339Nano),
+			strconv.Itoa(entryDto.ActorId),
+			entryDto.ActorRole,
+			entryDto.Action,
+			entryDto.Entity,
+			strconv.Itoa(entryDto.EntityId),
+			changes,
+			entryDto.Ip,
+			entryDto.RequestId,
+			entryDto.PrevHash,
+			entryDto.Hash,
+		})
+	}
+
+	end = func() error {
+		start()
+		writer.Flush()
+		c.Writer.Flush()
+		return writer.Error()
+	}
+
+	return write, end
+}
+
+// VerifyAuditLog checks the hash chain of the audit log, a broken chain is
+// reported in the body with a 200 as the check itself succeeded
+func VerifyAuditLog(c *gin.Context) {
+	verification, err := service.AuditService.VerifyAuditLog(c.Request.Context())
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, verification)
+}
@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"project/dto"
+	"project/service"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestAudit struct {
+	filter dto.AuditFilterDto
+}
+
+func newTestAudit(t *testing.T) *TestAudit {
+	previous := service.AuditService
+	mock := &TestAudit{}
+
+	service.AuditService = mock
+	t.Cleanup(func() { service.AuditService = previous })
+
+	return mock
+}
+
+func (t *TestAudit) Record(ctx context.Context, action string, entity string, entityId int, before any, after any) {
+}
+
+func (t *TestAudit) RetryPending(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (t *TestAudit) GetAuditEntries(ctx context.Context, filterDto dto.AuditFilterDto) (dto.AuditEntriesDto, error) {
+	t.filter = filterDto
+	return testAuditEntries(), nil
+}
+
+func (t *TestAudit) ExportAuditEntries(ctx context.Context, filterDto dto.AuditFilterDto, fn func(entryDto dto.AuditEntryDto) error) error {
+	t.filter = filterDto
+
+	if filterDto.Entity == "amenity" {
+		return nil
+	}
+
+	for _, entryDto := range testAuditEntries() {
+		if err := fn(entryDto); err != nil {
+			return err
+		}
+	}
+
+	if filterDto.Entity == "user" {
+		return errors.New("connection reset")
+	}
+
+	return nil
+}
+
+func (t *TestAudit) VerifyAuditLog(ctx context.Context) (dto.AuditVerificationDto, error) {
+	return dto.AuditVerificationDto{Valid: false, Entries: 2, BrokenAt: 2, Detail: "the entry doesn't match its hash"}, nil
+}
+
+func testAuditEntries() dto.AuditEntriesDto {
+	return dto.AuditEntriesDto{
+		{
+			Id:        2,
+			ActorId:   4,
+			ActorRole: "Admin",
+			Action:    "update",
+			Entity:    "hotel",
+			EntityId:  1,
+			Changes:   map[string]dto.AuditChangeDto{"rate": {Before: json.RawMessage("1000"), After: json.RawMessage("1200")}},
+			Ip:        "10.0.0.1",
+			RequestId: "req-1",
+			CreatedAt: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+			PrevHash:  "aaa",
+			Hash:      "bbb",
+		},
+	}
+}
+
+func newAuditTestRouter() *gin.Engine {
+	r := newErrorTestRouter()
+	r.GET("/admin/audit", GetAuditEntries)
+	r.GET("/admin/audit/export", ExportAuditEntries)
+	r.GET("/admin/audit/verify", VerifyAuditLog)
+
+	return r
+}
+
+func getAudit(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func getAuditAs(r *gin.Engine, token string, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestGetAuditEntries_Controller(t *testing.T) {
+	a := assert.New(t)
+	mock := newTestAudit(t)
+	r := newAuditTestRouter()
+
+	w := getAudit(r, "/admin/audit?entity=hotel&entity_id=1&actor_id=4&from=01-01-2024%2000:00&limit=10")
+
+	var entries dto.AuditEntriesDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &entries))
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(testAuditEntries(), entries)
+	a.Equal(dto.AuditFilterDto{ActorId: 4, Entity: "hotel", EntityId: 1, From: "01-01-2024 00:00", Limit: 10}, mock.filter)
+
+	w = getAudit(r, "/admin/audit?from=2024-01-01&limit=5000")
+
+	var problem dto.ProblemDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("validation_failed", problem.Code)
+	a.Len(problem.Errors, 2)
+}
+
+func TestExportAuditEntries_Controller(t *testing.T) {
+	a := assert.New(t)
+	newTestAudit(t)
+	r := newAuditTestRouter()
+
+	w := getAudit(r, "/admin/audit/export?entity=hotel")
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	a.Equal(`attachment; filename="audit.csv"`, w.Header().Get("Content-Disposition"))
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	a.Nil(err)
+	a.Equal([][]string{
+		auditCsvHeader,
+		{"2", "2024-01-01T10:00:00Z", "4", "Admin", "update", "hotel", "1", `{"rate":{"before":1000,"after":1200}}`, "10.0.0.1", "req-1", "aaa", "bbb"},
+	}, records)
+
+	w = getAudit(r, "/admin/audit/export?format=ndjson")
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("application/x-ndjson", w.Header().Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	a.Len(lines, 1)
+
+	var entry dto.AuditEntryDto
+	a.Nil(json.Unmarshal([]byte(lines[0]), &entry))
+	a.Equal(testAuditEntries()[0], entry)
+
+	// An empty export still has its header
+	w = getAudit(r, "/admin/audit/export?entity=amenity")
+
+	a.Equal(http.StatusOK, w.Code)
+	records, err = csv.NewReader(w.Body).ReadAll()
+	a.Nil(err)
+	a.Equal([][]string{auditCsvHeader}, records)
+
+	// Once entries are sent a failure can't become a problem response
+	w = getAudit(r, "/admin/audit/export?entity=user&format=ndjson")
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("application/x-ndjson", w.Header().Get("Content-Type"))
+	a.Len(strings.Split(strings.TrimSpace(w.Body.String()), "\n"), 1)
+
+	w = getAudit(r, "/admin/audit/export?format=xml")
+
+	a.Equal(http.StatusBadRequest, w.Code)
+}
+
+func TestVerifyAuditLog_Controller(t *testing.T) {
+	a := assert.New(t)
+	newTestAudit(t)
+	r := newAuditTestRouter()
+
+	w := getAudit(r, "/admin/audit/verify")
+
+	var verification dto.AuditVerificationDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &verification))
+
+	a.Equal(http.StatusOK, w.Code)
+	a.False(verification.Valid)
+	a.Equal(2, verification.BrokenAt)
+}
+
+func TestAuditLog_Integration(t *testing.T) {
+	a := assert.New(t)
+	openTestDb(t)
+
+	JwtSecret = []byte("test-secret")
+	t.Cleanup(func() { JwtSecret = nil })
+
+	r := newErrorTestRouter()
+	r.Use(Identify())
+	r.GET("/admin/audit", GetAuditEntries)
+	r.GET("/admin/audit/verify", VerifyAuditLog)
+	r.POST("/amenity/:name", func(c *gin.Context) {
+		service.AuditService.Record(c.Request.Context(), service.AuditCreate, "amenity", 1, nil, dto.AmenityDto{Name: c.Param("name")})
+		c.Status(http.StatusCreated)
+	})
+
+	token, _ := generateToken(dto.UserDto{Id: 4, Role: "Admin"})
+
+	for _, name := range []string{"Pool", "Spa"} {
+		req, _ := http.NewRequest(http.MethodPost, "/amenity/"+name, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(RequestIdHeader, "req-"+name)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		a.Equal(http.StatusCreated, w.Code)
+	}
+
+	// Only admins read the log
+	w := getAudit(r, "/admin/audit?entity=amenity")
+	a.Equal(http.StatusUnauthorized, w.Code)
+
+	w = getAuditAs(r, token, "/admin/audit?entity=amenity")
+
+	var entries dto.AuditEntriesDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &entries))
+
+	a.Len(entries, 2)
+	a.Equal(4, entries[0].ActorId)
+	a.Equal("Admin", entries[0].ActorRole)
+	a.Equal("req-Spa", entries[0].RequestId)
+	a.Equal(`"Spa"`, string(entries[0].Changes["name"].After))
+	a.Equal(entries[1].Hash, entries[0].PrevHash)
+
+	// The hashes still match once the entries went through the database
+	w = getAuditAs(r, token, "/admin/audit/verify")
+
+	var verification dto.AuditVerificationDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &verification))
+
+	a.True(verification.Valid)
+	a.Equal(2, verification.Entries)
+	a.Equal(entries[0].Hash, verification.Head)
+}
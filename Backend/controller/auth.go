@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"project/auth"
+	"project/service"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+var errInvalidToken = service.Unauthorized("invalid_token", "the token is invalid or expired, log in again")
+
+// Identify passes who sends the request on to the services: the user of the
+// bearer token returned by UserLogin, if any, with the role they have now, and
+// the client address. Requests without a token go on anonymously, a token that
+// doesn't verify, whose account is gone or that was issued before the password
+// last changed is rejected, as are disabled accounts.
+func Identify() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := auth.WithClientIp(c.Request.Context(), c.ClientIP())
+
+		if header := c.GetHeader("Authorization"); header != "" {
+			identity, err := parseToken(header)
+
+			if err != nil {
+				rejectToken(c, err)
+				return
+			}
+
+			identity, err = service.UserService.Authenticate(ctx, identity)
+
+			if errors.Is(err, service.ErrUserNotFound) || errors.Is(err, service.ErrTokenRevoked) {
+				rejectToken(c, err)
+				return
+			}
+
+			if err != nil {
+				c.Error(err)
+				c.Abort()
+				return
+			}
+
+			ctx = auth.WithIdentity(ctx, identity)
+		}
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+func rejectToken(c *gin.Context, err error) {
+	log.Ctx(c.Request.Context()).WithError(err).Info("Rejected token")
+	c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	c.Error(errInvalidToken)
+	c.Abort()
+}
+
+// Authenticated rejects the requests Identify let through anonymously
+func Authenticated() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := auth.IdentityFrom(c.Request.Context()); !ok {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.Error(service.ErrAuthenticationRequired)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Permitted rejects the requests of users whose role doesn't grant the
+// permission, for handlers that don't go through a service
+func Permitted(permission auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, ok := auth.IdentityFrom(c.Request.Context())
+
+		if !ok {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.Error(service.ErrAuthenticationRequired)
+			c.Abort()
+			return
+		}
+
+		if !identity.Can(permission) {
+			log.Ctx(c.Request.Context()).WithFields(logrus.Fields{"user_id": identity.UserId, "role": identity.Role, "permission": permission}).Warn("Permission denied")
+			c.Error(service.ErrPermissionDenied)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// currentUserId is the user of a request that went through Authenticated
+func currentUserId(c *gin.Context) int {
+	identity, _ := auth.IdentityFrom(c.Request.Context())
+	return identity.UserId
+}
+
+// parseToken verifies a "Bearer <token>" Authorization header signed by generateToken
+func parseToken(header string) (auth.Identity, error) {
+	tokenString, found := strings.CutPrefix(header, "Bearer ")
+
+	if !found {
+		return auth.Identity{}, fmt.Errorf("authorization is not a bearer token")
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return JwtSecret, nil
+	})
+
+	if err != nil {
+		return auth.Identity{}, err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	id, _ := claims["id"].(float64)
+	role, _ := claims["role"].(string)
+	expiration, _ := claims["expiration"].(float64)
+	tokenVersion, _ := claims["token_version"].(float64)
+
+	if id <= 0 {
+		return auth.Identity{}, fmt.Errorf("token has no user id")
+	}
+
+	if time.Now().Unix() >= int64(expiration) {
+		return auth.Identity{}, fmt.Errorf("token expired")
+	}
+
+	return auth.Identity{UserId: int(id), Role: role, TokenVersion: int(tokenVersion)}, nil
+}
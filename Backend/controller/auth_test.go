@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"project/auth"
+	"project/dto"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentify(t *testing.T) {
+	a := assert.New(t)
+
+	JwtSecret = []byte("test-secret")
+	t.Cleanup(func() { JwtSecret = nil })
+
+	r := newErrorTestRouter()
+	r.Use(Identify())
+	r.GET("/whoami", func(c *gin.Context) {
+		identity, ok := auth.IdentityFrom(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"id": identity.UserId, "role": identity.Role, "ok": ok, "ip": auth.ClientIp(c.Request.Context())})
+	})
+
+	whoami := func(authorization string) (*httptest.ResponseRecorder, map[string]any) {
+		req, _ := http.NewRequest(http.MethodGet, "/whoami", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var body map[string]any
+		json.Unmarshal(w.Body.Bytes(), &body)
+
+		return w, body
+	}
+
+	token, err := generateToken(dto.UserDto{Id: 4, Role: "Admin"})
+	a.Nil(err)
+
+	w, body := whoami("Bearer " + token)
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(map[string]any{"id": float64(4), "role": "Admin", "ok": true, "ip": "10.0.0.1"}, body)
+
+	// Requests without a token go on anonymously
+	w, body = whoami("")
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(false, body["ok"])
+
+	expired := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"id": 4, "role": "Admin", "expiration": time.Now().Add(-time.Minute).Unix()})
+	expiredToken, _ := expired.SignedString(JwtSecret)
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"id": 4, "role": "Admin", "expiration": time.Now().Add(time.Hour).Unix()})
+	forgedToken, _ := forged.SignedString([]byte("other-secret"))
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"id": 4, "role": "Admin", "expiration": time.Now().Add(time.Hour).Unix()})
+	unsignedToken, _ := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	for _, authorization := range []string{"Bearer " + expiredToken, "Bearer " + forgedToken, "Bearer " + unsignedToken, "Basic dXNlcjpwYXNz", "Bearer garbage"} {
+		w, body = whoami(authorization)
+
+		a.Equal(http.StatusUnauthorized, w.Code, authorization)
+		a.Equal("invalid_token", body["code"], authorization)
+		a.Equal(`Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+	}
+
+	// Tokens of deleted accounts stop working, those of disabled ones are refused
+	deletedToken, _ := generateToken(dto.UserDto{Id: 14, Role: "Customer"})
+
+	w, body = whoami("Bearer " + deletedToken)
+	a.Equal(http.StatusUnauthorized, w.Code)
+	a.Equal("invalid_token", body["code"])
+
+	disabledToken, _ := generateToken(dto.UserDto{Id: 13, Role: "Customer"})
+
+	w, body = whoami("Bearer " + disabledToken)
+	a.Equal(http.StatusForbidden, w.Code)
+	a.Equal("account_disabled", body["code"])
+
+	// Tokens issued before the password changed are rejected
+	revokedToken, _ := generateToken(dto.UserDto{Id: 15, Role: "Customer"})
+
+	w, body = whoami("Bearer " + revokedToken)
+	a.Equal(http.StatusUnauthorized, w.Code)
+	a.Equal("invalid_token", body["code"])
+
+	currentToken, _ := generateToken(dto.UserDto{Id: 15, Role: "Customer", TokenVersion: 1})
+
+	w, _ = whoami("Bearer " + currentToken)
+	a.Equal(http.StatusOK, w.Code)
+}
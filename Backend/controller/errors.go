@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"project/dto"
+	"project/logging"
+	"project/patch"
+	"project/ratelimit"
+	"project/service"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RequestIdHeader = "X-Request-ID"
+	requestIdKey    = "request_id"
+	problemType     = "application/problem+json"
+)
+
+// Errors raised by the controllers themselves
+var (
+	errInvalidTtl       = service.Invalid("invalid_ttl", "ttl must be a positive number of seconds")
+	errTtlTooLong       = service.Invalid("ttl_too_long", "ttl is longer than signed urls can last")
+	errImageFileMissing = service.NotFound("image_file_not_found", "image file not found")
+	errDbNotConnected   = service.Unavailable("database_unavailable", "database not connected")
+	errRouteNotFound    = service.NotFound("route_not_found", "route not found")
+	errMethodNotAllowed = &service.Error{Code: "method_not_allowed", Message: "method not allowed"}
+	errBodyTooLarge     = &service.Error{Code: "body_too_large", Message: "request body too large"}
+	errRateLimited      = service.TooManyRequests("rate_limited", "too many requests, try again later")
+	errInvalidIfMatch   = service.PreconditionFailed("invalid_if_match", "If-Match must be a single ETag returned by the API")
+	errUnsupportedPatch = &service.Error{Code: "unsupported_media_type", Message: "patches must be sent as " + patch.MergePatchType + " or " + patch.JSONPatchType}
+)
+
+// Incoming request ids are written to the logs, so only plain tokens are kept
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestId tags every request with the id sent by the client, or a new one,
+// and echoes it back so errors can be traced in the logs. The id travels in the
+// request context to the loggers of the service and client layers.
+func RequestId() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIdHeader)
+
+		if !requestIdPattern.MatchString(id) {
+			id = newRequestId()
+		}
+
+		c.Set(requestIdKey, id)
+		c.Header(RequestIdHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestId(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// GetRequestId returns the id assigned to the request by RequestId
+func GetRequestId(c *gin.Context) string {
+	return c.GetString(requestIdKey)
+}
+
+func newRequestId() string {
+	buf := make([]byte, 16)
+
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+// ErrorHandler renders the last error added with c.Error as problem+json,
+// handlers only need to call c.Error(err) and return
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		last := c.Errors.Last()
+
+		var maxBytesError *http.MaxBytesError
+
+		if errors.As(last.Err, &maxBytesError) {
+			problemResponse(c, errBodyTooLarge)
+			return
+		}
+
+		if last.IsType(gin.ErrorTypeBind) {
+			problemResponse(c, service.Invalid("invalid_body", last.Err.Error()))
+			return
+		}
+
+		problemResponse(c, last.Err)
+	}
+}
+
+// Recovery turns a panic into an internal_error problem instead of an empty 500
+func Recovery(c *gin.Context, recovered any) {
+	problemResponse(c, fmt.Errorf("panic: %v", recovered))
+}
+
+// NoRoute and NoMethod answer unknown routes with a problem as well
+func NoRoute(c *gin.Context) {
+	c.Error(errRouteNotFound)
+}
+
+func NoMethod(c *gin.Context) {
+	c.Error(errMethodNotAllowed)
+}
+
+// errorStatus maps a service error to its HTTP status code
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, errMethodNotAllowed):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, errBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errUnsupportedPatch):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrTooManyRequests):
+		return http.StatusTooManyRequests
+	case errors.Is(err, service.ErrUnprocessable):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, service.ErrPrecondition):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, service.ErrPreconditionRequired):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, service.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newProblem builds the response body for an error, hiding the details of infrastructure failures
+func newProblem(c *gin.Context, err error) dto.ProblemDto {
+	status := errorStatus(err)
+
+	problem := dto.ProblemDto{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Instance:  c.Request.URL.Path,
+		RequestId: GetRequestId(c),
+	}
+
+	var serviceError *service.Error
+
+	switch {
+	case errors.As(err, &serviceError) && status < http.StatusInternalServerError:
+		problem.Code = serviceError.Code
+		problem.Detail = serviceError.Message
+		problem.Errors = serviceError.Fields
+	case errors.As(err, &serviceError) && serviceError.Code != "":
+		problem.Code = serviceError.Code
+	case status == http.StatusServiceUnavailable:
+		problem.Code = "service_unavailable"
+	default:
+		problem.Code = "internal_error"
+	}
+
+	return problem
+}
+
+func problemResponse(c *gin.Context, err error) {
+	problem := newProblem(c, err)
+
+	if problem.Status >= http.StatusInternalServerError {
+		log.Ctx(c.Request.Context()).WithError(err).Error("Request failed")
+	}
+
+	var serviceError *service.Error
+
+	if errors.As(err, &serviceError) && serviceError.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(ratelimit.RetryAfterSeconds(serviceError.RetryAfter)))
+	}
+
+	c.Header("Content-Type", problemType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
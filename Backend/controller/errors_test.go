@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"project/dto"
+	"project/service"
+	"strings"
+	"testing"
+)
+
+func newErrorTestRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(gin.CustomRecovery(Recovery), RequestId(), ErrorHandler())
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(NoRoute)
+	r.NoMethod(NoMethod)
+
+	return r
+}
+
+func serveProblem(r *gin.Engine, req *http.Request) (*httptest.ResponseRecorder, dto.ProblemDto) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var problem dto.ProblemDto
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		log.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	return w, problem
+}
+
+func TestErrorHandler_Controller_RequestId(t *testing.T) {
+	a := assert.New(t)
+
+	r := newErrorTestRouter()
+	r.GET("/hotel/:id", GetHotelById)
+
+	req, _ := http.NewRequest(http.MethodGet, "/hotel/400", nil)
+	req.Header.Set(RequestIdHeader, "abc-123")
+
+	w, problem := serveProblem(r, req)
+
+	a.Equal(http.StatusNotFound, w.Code)
+	a.Equal("abc-123", w.Header().Get(RequestIdHeader))
+	a.Equal("abc-123", problem.RequestId)
+	a.Equal("/hotel/400", problem.Instance)
+	a.Equal("Not Found", problem.Title)
+	a.Equal(http.StatusNotFound, problem.Status)
+}
+
+func TestErrorHandler_Controller_InvalidBody(t *testing.T) {
+	a := assert.New(t)
+
+	r := newErrorTestRouter()
+	r.POST("/hotel", InsertHotel)
+
+	req, _ := http.NewRequest(http.MethodPost, "/hotel", strings.NewReader(`{"name": `))
+	req.Header.Set("Content-Type", "application/json")
+
+	w, problem := serveProblem(r, req)
+
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("invalid_body", problem.Code)
+}
+
+func TestErrorHandler_Controller_FieldErrors(t *testing.T) {
+	a := assert.New(t)
+
+	r := newErrorTestRouter()
+	r.GET("/fields", func(c *gin.Context) {
+		c.Error(service.ErrInvalidDateRange.WithFields(dto.FieldErrorDto{Field: "end_date", Code: "before_start", Message: "must be after start_date"}))
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/fields", nil)
+
+	w, problem := serveProblem(r, req)
+
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("invalid_date_range", problem.Code)
+	a.Equal(dto.FieldErrorsDto{{Field: "end_date", Code: "before_start", Message: "must be after start_date"}}, problem.Errors)
+}
+
+func TestErrorHandler_Controller_InternalError(t *testing.T) {
+	a := assert.New(t)
+
+	r := newErrorTestRouter()
+	r.GET("/internal", func(c *gin.Context) {
+		c.Error(errors.New("dial tcp 10.0.0.1:3306: connection refused"))
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	for _, path := range []string{"/internal", "/panic"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+
+		w, problem := serveProblem(r, req)
+
+		a.Equal(http.StatusInternalServerError, w.Code)
+		a.Equal("internal_error", problem.Code)
+		a.Empty(problem.Detail)
+	}
+}
+
+func TestErrorHandler_Controller_NoRoute(t *testing.T) {
+	a := assert.New(t)
+
+	r := newErrorTestRouter()
+	r.GET("/hotel/:id", GetHotelById)
+
+	req, _ := http.NewRequest(http.MethodGet, "/unknown", nil)
+	w, problem := serveProblem(r, req)
+
+	a.Equal(http.StatusNotFound, w.Code)
+	a.Equal("route_not_found", problem.Code)
+
+	req, _ = http.NewRequest(http.MethodPatch, "/hotel/1", nil)
+	w, problem = serveProblem(r, req)
+
+	a.Equal(http.StatusMethodNotAllowed, w.Code)
+	a.Equal("method_not_allowed", problem.Code)
+}
+
+func TestMaxBodySize_Controller(t *testing.T) {
+	a := assert.New(t)
+
+	r := newErrorTestRouter()
+	r.Use(MaxBodySize(64))
+	r.POST("/hotel", InsertHotel)
+
+	body := `{"name": "` + strings.Repeat("a", 100) + `"}`
+
+	req, _ := http.NewRequest(http.MethodPost, "/hotel", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w, problem := serveProblem(r, req)
+
+	a.Equal(http.StatusRequestEntityTooLarge, w.Code)
+	a.Equal("body_too_large", problem.Code)
+
+	// Without a Content-Length the limit is enforced while reading
+	req, _ = http.NewRequest(http.MethodPost, "/hotel", io.NopCloser(strings.NewReader(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	w, problem = serveProblem(r, req)
+
+	a.Equal(http.StatusRequestEntityTooLarge, w.Code)
+	a.Equal("body_too_large", problem.Code)
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"project/build"
+	"project/db"
+	"project/dto"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// readinessTimeout bounds every readiness check so a hung dependency fails the probe instead of blocking it
+const readinessTimeout = 2 * time.Second
+
+type readinessCheck func(ctx context.Context) (string, error)
+
+// readinessChecks are the dependencies a replica needs before it takes traffic
+var readinessChecks = map[string]readinessCheck{
+	"database":   checkDatabase,
+	"migrations": checkMigrations,
+	"images":     checkImageStorage,
+}
+
+// Healthz only tells the process is alive and serving
+func Healthz(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, dto.HealthDto{Status: "ok"})
+}
+
+// Readyz runs every readiness check and answers 503 when any of them fails.
+// Probes are unauthenticated, so they only learn which checks failed and the
+// details are logged instead.
+func Readyz(c *gin.Context) {
+	health := dto.HealthDto{Status: "ok", Checks: map[string]string{}}
+	status := http.StatusOK
+
+	for name, check := range readinessChecks {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+		start := time.Now()
+
+		detail, err := check(ctx)
+		cancel()
+
+		entry := log.Ctx(c.Request.Context()).WithFields(logrus.Fields{
+			"check":      name,
+			"detail":     detail,
+			"latency_ms": time.Since(start).Milliseconds(),
+		})
+
+		if err != nil {
+			entry.WithError(err).Warn("Readiness check failed")
+			health.Checks[name] = "unavailable"
+			health.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+
+		entry.Debug("Readiness check passed")
+		health.Checks[name] = "ok"
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, health)
+}
+
+func GetBuildInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, build.GetInfo())
+}
+
+func checkDatabase(ctx context.Context) (string, error) {
+	return "", db.Ping(ctx)
+}
+
+func checkMigrations(ctx context.Context) (string, error) {
+	version, err := db.SchemaVersion(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	expected := db.LatestSchemaVersion()
+	detail := fmt.Sprintf("version %d of %d", version, expected)
+
+	if version != expected {
+		return detail, fmt.Errorf("schema is at version %d, expected %d", version, expected)
+	}
+
+	return detail, nil
+}
+
+// checkImageStorage makes sure uploads have a writable directory to go to,
+// without writing to it on every probe
+func checkImageStorage(ctx context.Context) (string, error) {
+	info, err := os.Stat(ImageDir)
+
+	if err != nil {
+		return ImageDir, err
+	}
+
+	if !info.IsDir() {
+		return ImageDir, fmt.Errorf("%s is not a directory", ImageDir)
+	}
+
+	if info.Mode().Perm()&0o200 == 0 {
+		return ImageDir, fmt.Errorf("%s is not writable", ImageDir)
+	}
+
+	return ImageDir, nil
+}
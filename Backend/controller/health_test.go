@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"project/build"
+	"project/db"
+	"project/dto"
+	"testing"
+)
+
+func openTestDb(t *testing.T) {
+	conn, err := db.Open(db.SQLite, fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()))
+	if err != nil {
+		t.Fatalf("Connection failed to open: %v", err)
+	}
+
+	sqlDb, _ := conn.DB()
+	t.Cleanup(func() { sqlDb.Close() })
+
+	db.Use(conn)
+
+	if err := db.MigrateUp(); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+}
+
+func getHealth(path string) (*httptest.ResponseRecorder, dto.HealthDto) {
+	r := gin.Default()
+	r.GET("/healthz", Healthz)
+	r.GET("/readyz", Readyz)
+
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var health dto.HealthDto
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+		log.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	return w, health
+}
+
+func TestHealthz_Controller(t *testing.T) {
+	a := assert.New(t)
+
+	w, health := getHealth("/healthz")
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("ok", health.Status)
+}
+
+func TestReadyz_Controller_Ready(t *testing.T) {
+	a := assert.New(t)
+
+	openTestDb(t)
+	ImageDir = t.TempDir()
+	t.Cleanup(func() { ImageDir = "Images" })
+
+	w, health := getHealth("/readyz")
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("ok", health.Status)
+	a.Equal(map[string]string{"database": "ok", "migrations": "ok", "images": "ok"}, health.Checks)
+}
+
+func TestReadyz_Controller_Unavailable(t *testing.T) {
+	a := assert.New(t)
+
+	openTestDb(t)
+	a.Nil(db.MigrateTo(1))
+
+	ImageDir = filepath.Join(t.TempDir(), "missing")
+	t.Cleanup(func() { ImageDir = "Images" })
+
+	w, health := getHealth("/readyz")
+
+	a.Equal(http.StatusServiceUnavailable, w.Code)
+	a.Equal("unavailable", health.Status)
+	a.Equal(map[string]string{"database": "ok", "migrations": "unavailable", "images": "unavailable"}, health.Checks)
+
+	// The details are only logged
+	a.NotContains(w.Body.String(), "schema is at version")
+	a.NotContains(w.Body.String(), ImageDir)
+
+	detail, err := checkMigrations(context.Background())
+	a.Equal(fmt.Sprintf("version 1 of %d", db.LatestSchemaVersion()), detail)
+	a.EqualError(err, fmt.Sprintf("schema is at version 1, expected %d", db.LatestSchemaVersion()))
+}
+
+func TestCheckImageStorage(t *testing.T) {
+	a := assert.New(t)
+
+	ImageDir = t.TempDir()
+	t.Cleanup(func() { ImageDir = "Images" })
+
+	_, err := checkImageStorage(context.Background())
+	a.Nil(err)
+
+	// Nothing is written to check it
+	entries, err := os.ReadDir(ImageDir)
+	a.Nil(err)
+	a.Empty(entries)
+
+	file := filepath.Join(ImageDir, "image.jpg")
+	a.Nil(os.WriteFile(file, []byte("jpg"), 0o600))
+	ImageDir = file
+
+	_, err = checkImageStorage(context.Background())
+	a.ErrorContains(err, "is not a directory")
+
+	ImageDir = t.TempDir()
+	a.Nil(os.Chmod(ImageDir, 0o500))
+
+	_, err = checkImageStorage(context.Background())
+	a.ErrorContains(err, "is not writable")
+}
+
+func TestCheckMigrations_Timeout(t *testing.T) {
+	a := assert.New(t)
+
+	openTestDb(t)
+	a.Nil(db.MigrateUp())
+
+	// The readiness timeout bounds the query
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := checkMigrations(ctx)
+	a.ErrorIs(err, context.Canceled)
+}
+
+func TestGetBuildInfo_Controller(t *testing.T) {
+	a := assert.New(t)
+
+	build.Version = "1.2.3"
+	build.Commit = "abc123"
+	t.Cleanup(func() { build.Version, build.Commit = "dev", "" })
+
+	r := gin.Default()
+	r.GET("/version", GetBuildInfo)
+
+	req, _ := http.NewRequest(http.MethodGet, "/version", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var info build.Info
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &info))
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("1.2.3", info.Version)
+	a.Equal("abc123", info.Commit)
+	a.NotEmpty(info.GoVersion)
+}
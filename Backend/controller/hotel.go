@@ -5,25 +5,21 @@ import (
 	"project/dto"
 	"project/service"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
 )
 
 func InsertHotel(c *gin.Context) {
 	var hotelDto dto.HotelDto
-	err := c.BindJSON(&hotelDto)
-
-	if err != nil {
-		log.Error(err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &hotelDto) {
 		return
 	}
 
-	hotelDto, er := service.HotelService.InsertHotel(hotelDto)
+	hotelDto, er := service.HotelService.InsertHotel(c.Request.Context(), hotelDto)
 
 	if er != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": er.Error()})
+		c.Error(er)
 		return
 	}
 
@@ -35,12 +31,21 @@ func GetHotelById(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var hotelDto dto.HotelDto
 
-	hotelDto, err := service.HotelService.GetHotelById(id)
+	hotelDto, err := service.HotelService.GetHotelById(c.Request.Context(), id)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
+
+	etag := hotelETag(hotelDto.Version)
+	c.Header("ETag", etag)
+
+	if ifNoneMatch(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
 	c.JSON(http.StatusOK, hotelDto)
 }
 
@@ -48,10 +53,10 @@ func GetHotels(c *gin.Context) {
 
 	var hotelsDto dto.HotelsDto
 
-	hotelsDto, err := service.HotelService.GetHotels()
+	hotelsDto, err := service.HotelService.GetHotels(c.Request.Context())
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -62,26 +67,36 @@ func CheckAllAvailability(c *gin.Context) {
 
 	var hotelsDto dto.HotelsDto
 
-	startDate := c.Query("start_date")
-	endDate := c.Query("end_date")
+	var dateRange dto.DateRangeDto
 
-	hotelsDto, err := service.HotelService.CheckAllAvailability(startDate, endDate)
+	if !bindQuery(c, &dateRange) {
+		return
+	}
+
+	hotelsDto, err := service.HotelService.CheckAllAvailability(c.Request.Context(), dateRange.StartDate, dateRange.EndDate)
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, hotelsDto)
 }
 
+// DeleteHotel soft deletes the hotel, ?force=true cancels its reservations
+// that haven't ended instead of refusing the deletion
 func DeleteHotel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 
-	err := service.HotelService.DeleteHotel(id)
+	var options dto.DeleteOptionsDto
+	if !bindQuery(c, &options) {
+		return
+	}
+
+	err := service.HotelService.DeleteHotel(c.Request.Context(), id, options.Force)
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -91,22 +106,134 @@ func DeleteHotel(c *gin.Context) {
 func UpdateHotel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var hotelDto dto.HotelDto
-	err := c.BindJSON(&hotelDto)
+	if !bindJSON(c, &hotelDto) {
+		return
+	}
+
+	hotelDto.Id = id
+
+	// If-Match takes precedence over the version in the body
+	version, ok := ifMatchVersion(c.GetHeader("If-Match"))
+
+	if !ok {
+		c.Error(errInvalidIfMatch)
+		return
+	}
+
+	if version != 0 {
+		hotelDto.Version = version
+	}
+
+	// "*" replaces whichever version there is
+	if strings.TrimSpace(c.GetHeader("If-Match")) == "*" {
+		current, err := service.HotelService.GetHotelById(c.Request.Context(), id)
+
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		hotelDto.Version = current.Version
+	}
+
+	hotelDto, err := service.HotelService.UpdateHotel(c.Request.Context(), hotelDto)
 
 	if err != nil {
-		log.Error(err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", hotelETag(hotelDto.Version))
+	c.JSON(http.StatusOK, hotelDto)
+}
+
+// PatchHotel updates the fields present in a merge patch or JSON patch, see
+// bindPatch. The hotel is only written if nobody changed it since it was read
+// here, or since the version in If-Match.
+func PatchHotel(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	version, ok := ifMatchVersion(c.GetHeader("If-Match"))
+
+	if !ok {
+		c.Error(errInvalidIfMatch)
+		return
+	}
+
+	current, err := service.HotelService.GetHotelById(c.Request.Context(), id)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if version != 0 && version != current.Version {
+		c.Error(service.ErrHotelModified)
+		return
+	}
+
+	var hotelDto dto.HotelDto
+	if !bindPatch(c, current, &hotelDto) {
 		return
 	}
 
 	hotelDto.Id = id
+	hotelDto.Version = current.Version
 
-	hotelDto, err = service.HotelService.UpdateHotel(hotelDto)
+	hotelDto, err = service.HotelService.UpdateHotel(c.Request.Context(), hotelDto)
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
+	c.Header("ETag", hotelETag(hotelDto.Version))
 	c.JSON(http.StatusOK, hotelDto)
 }
+
+// hotelETag is the strong ETag of a hotel version, sent back in If-Match to
+// update the hotel only if nobody changed it in the meantime
+func hotelETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatchVersion reads the version in an If-Match header, zero when the
+// header is missing or "*". Only a single ETag from hotelETag is accepted.
+func ifMatchVersion(header string) (int, bool) {
+	header = strings.TrimSpace(header)
+
+	if header == "" || header == "*" {
+		return 0, true
+	}
+
+	unquoted, found := strings.CutPrefix(header, `"`)
+	unquoted, closed := strings.CutSuffix(unquoted, `"`)
+	version, err := strconv.Atoi(unquoted)
+
+	if !found || !closed || err != nil || version <= 0 {
+		return 0, false
+	}
+
+	return version, true
+}
+
+// ifNoneMatch tells whether an If-None-Match header matches etag. It may list
+// several ETags, weak ones compare by their value as GET allows, and "*"
+// matches any.
+func ifNoneMatch(header string, etag string) bool {
+	header = strings.TrimSpace(header)
+
+	if header == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,10 +1,9 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
@@ -21,58 +20,87 @@ func init() {
 	service.HotelService = &TestHotel{}
 }
 
-func (t TestHotel) GetHotelById(id int) (dto.HotelDto, error) {
+func (t TestHotel) GetHotelById(ctx context.Context, id int) (dto.HotelDto, error) {
 
 	if id > 10 {
-		return dto.HotelDto{}, errors.New("hotel not found")
+		return dto.HotelDto{}, service.ErrHotelNotFound
 	}
 
-	return dto.HotelDto{Id: id}, nil
+	return dto.HotelDto{Id: id, Version: 3}, nil
 }
 
-func (t TestHotel) GetHotels() (dto.HotelsDto, error) {
+func (t TestHotel) GetHotels(ctx context.Context) (dto.HotelsDto, error) {
 	return dto.HotelsDto{dto.HotelDto{Id: 1}, dto.HotelDto{Id: 2}}, nil
 }
 
-func (t TestHotel) InsertHotel(hotelDto dto.HotelDto) (dto.HotelDto, error) {
+func (t TestHotel) InsertHotel(ctx context.Context, hotelDto dto.HotelDto) (dto.HotelDto, error) {
 	hotelDto.Id = 1
 	return hotelDto, nil
 }
 
-func (t TestHotel) CheckAvailability(hotelId int, startDate time.Time, endDate time.Time) bool {
+func (t TestHotel) CheckAvailability(ctx context.Context, hotelId int, startDate time.Time, endDate time.Time) (bool, error) {
 
 	if hotelId > 10 {
-		return false
+		return false, nil
 	}
 
-	return true
+	return true, nil
 }
 
-func (t TestHotel) CheckAllAvailability(startDate string, endDate string) (dto.HotelsDto, error) {
+func (t TestHotel) CheckAllAvailability(ctx context.Context, startDate string, endDate string) (dto.HotelsDto, error) {
 	reservationStart, _ := time.Parse("02-01-2006 15:04", startDate)
 	reservationEnd, _ := time.Parse("02-01-2006 15:04", endDate)
 
 	if reservationStart.After(reservationEnd) {
-		return dto.HotelsDto{}, errors.New("a reservation cant end before it starts")
+		return dto.HotelsDto{}, service.ErrInvalidDateRange
 	}
 	return dto.HotelsDto{dto.HotelDto{Id: 1}, dto.HotelDto{Id: 2}}, nil
 }
 
-func (t TestHotel) DeleteHotel(id int) error {
+func (t TestHotel) DeleteHotel(ctx context.Context, id int, force bool) error {
 
 	if id > 10 {
-		return errors.New("hotel not found")
+		return service.ErrHotelNotFound
+	}
+
+	// Hotel 7 has reservations that haven't ended
+	if id == 7 && !force {
+		return service.ErrHotelHasReservations
+	}
+
+	return nil
+}
+
+func (t TestHotel) GetDeletedHotels(ctx context.Context) (dto.DeletedHotelsDto, error) {
+	return dto.DeletedHotelsDto{{HotelDto: dto.HotelDto{Id: 3, Name: "Hotel 3"}, DeletedAt: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}}, nil
+}
+
+func (t TestHotel) RestoreHotel(ctx context.Context, id int) error {
+
+	if id > 10 {
+		return service.ErrHotelNotFound
 	}
 
 	return nil
 }
 
-func (t TestHotel) UpdateHotel(hotelDto dto.HotelDto) (dto.HotelDto, error) {
+func (t TestHotel) UpdateHotel(ctx context.Context, hotelDto dto.HotelDto) (dto.HotelDto, error) {
 
 	if hotelDto.Id > 10 {
-		return hotelDto, errors.New("hotel not found")
+		return hotelDto, service.ErrHotelNotFound
+	}
+
+	if hotelDto.Version == 0 {
+		return hotelDto, service.ErrHotelVersionRequired
+	}
+
+	// Every hotel is at version 3
+	if hotelDto.Version != 3 {
+		return hotelDto, service.ErrHotelModified
 	}
 
+	hotelDto.Version = 4
+
 	return hotelDto, nil
 }
 
@@ -80,6 +108,7 @@ func TestInsertHotel_Controller(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.POST("/hotel", InsertHotel)
 
 	body := `{
@@ -118,6 +147,7 @@ func TestGetHotelById_Controller_NotFound(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/hotel/:id", GetHotelById)
 
 	req, err := http.NewRequest(http.MethodGet, "/hotel/400", nil)
@@ -134,10 +164,17 @@ func TestGetHotelById_Controller_NotFound(t *testing.T) {
 
 	r.ServeHTTP(w, req)
 
-	expectedResponse := `{"error":"hotel not found"}`
+	var problem dto.ProblemDto
+	err = json.Unmarshal(w.Body.Bytes(), &problem)
+	if err != nil {
+		log.Fatalf("Failed to unmarshal response: %v", err)
+	}
 
 	a.Equal(http.StatusNotFound, w.Code)
-	a.Equal(expectedResponse, w.Body.String())
+	a.Equal("application/problem+json", w.Header().Get("Content-Type"))
+	a.Equal("hotel_not_found", problem.Code)
+	a.Equal("hotel not found", problem.Detail)
+	a.NotEmpty(problem.RequestId)
 }
 
 func TestGetHotelById_Controller_Found(t *testing.T) {
@@ -145,6 +182,7 @@ func TestGetHotelById_Controller_Found(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/hotel/:id", GetHotelById)
 
 	req, err := http.NewRequest(http.MethodGet, "/hotel/1", nil)
@@ -167,7 +205,7 @@ func TestGetHotelById_Controller_Found(t *testing.T) {
 		log.Fatalf("Failed to unmarshal response: %v", err)
 	}
 
-	expectedResponse := dto.HotelDto{Id: 1}
+	expectedResponse := dto.HotelDto{Id: 1, Version: 3}
 
 	a.Equal(http.StatusOK, w.Code)
 	a.Equal(expectedResponse, response)
@@ -179,6 +217,7 @@ func TestGetHotels_Controller(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/hotel", GetHotels)
 
 	req, err := http.NewRequest(http.MethodGet, "/hotel", nil)
@@ -212,6 +251,7 @@ func TestCheckAllAvailability_Controller_Error(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/availability", CheckAllAvailability)
 
 	req, err := http.NewRequest(http.MethodGet, "/availability?start_date=16-06-2023+15:00&end_date=15-06-2023+11:00", nil)
@@ -228,17 +268,22 @@ func TestCheckAllAvailability_Controller_Error(t *testing.T) {
 
 	r.ServeHTTP(w, req)
 
-	a.Equal(http.StatusBadRequest, w.Code)
-
-	expectedResponse := `{"error":"a reservation cant end before it starts"}`
+	var problem dto.ProblemDto
+	err = json.Unmarshal(w.Body.Bytes(), &problem)
+	if err != nil {
+		log.Fatalf("Failed to unmarshal response: %v", err)
+	}
 
-	a.Equal(expectedResponse, w.Body.String())
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("validation_failed", problem.Code)
+	a.Equal(dto.FieldErrorsDto{{Field: "end_date", Code: "after", Message: "must be after start_date"}}, problem.Errors)
 }
 
 func TestCheckAllAvailability_Controller_Success(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/availability", CheckAllAvailability)
 
 	req, err := http.NewRequest(http.MethodGet, "/availability?start_date=16-06-2023+15:00&end_date=17-06-2023+11:00", nil)
@@ -272,6 +317,7 @@ func TestDeleteHotel_Controller_NotFound(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.DELETE("/hotel/:id", DeleteHotel)
 
 	req, err := http.NewRequest(http.MethodDelete, "/hotel/400", nil)
@@ -288,10 +334,17 @@ func TestDeleteHotel_Controller_NotFound(t *testing.T) {
 
 	r.ServeHTTP(w, req)
 
-	expectedResponse := `{"error":"hotel not found"}`
+	var problem dto.ProblemDto
+	err = json.Unmarshal(w.Body.Bytes(), &problem)
+	if err != nil {
+		log.Fatalf("Failed to unmarshal response: %v", err)
+	}
 
-	a.Equal(http.StatusBadRequest, w.Code)
-	a.Equal(expectedResponse, w.Body.String())
+	a.Equal(http.StatusNotFound, w.Code)
+	a.Equal("application/problem+json", w.Header().Get("Content-Type"))
+	a.Equal("hotel_not_found", problem.Code)
+	a.Equal("hotel not found", problem.Detail)
+	a.NotEmpty(problem.RequestId)
 
 }
 
@@ -300,6 +353,7 @@ func TestDeleteHotel_Controller_Found(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.DELETE("/hotel/:id", DeleteHotel)
 
 	req, err := http.NewRequest(http.MethodDelete, "/hotel/1", nil)
@@ -323,10 +377,44 @@ func TestDeleteHotel_Controller_Found(t *testing.T) {
 
 }
 
+func TestDeleteHotel_Controller_Force(t *testing.T) {
+
+	a := assert.New(t)
+
+	r := newErrorTestRouter()
+	r.DELETE("/hotel/:id", DeleteHotel)
+
+	deleteHotel := func(path string) (*httptest.ResponseRecorder, dto.ProblemDto) {
+		req, _ := http.NewRequest(http.MethodDelete, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var problem dto.ProblemDto
+		json.Unmarshal(w.Body.Bytes(), &problem)
+
+		return w, problem
+	}
+
+	w, problem := deleteHotel("/hotel/7")
+
+	a.Equal(http.StatusConflict, w.Code)
+	a.Equal("hotel_has_reservations", problem.Code)
+
+	w, _ = deleteHotel("/hotel/7?force=true")
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(`{"message":"Hotel deleted"}`, w.Body.String())
+
+	w, _ = deleteHotel("/hotel/7?force=maybe")
+
+	a.Equal(http.StatusBadRequest, w.Code)
+}
+
 func TestUpdateHotel_Controller_NotFound(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.PUT("/hotel/:id", UpdateHotel)
 
 	body := `{
@@ -352,16 +440,24 @@ func TestUpdateHotel_Controller_NotFound(t *testing.T) {
 
 	r.ServeHTTP(w, req)
 
-	expectedResponse := `{"error":"hotel not found"}`
+	var problem dto.ProblemDto
+	err = json.Unmarshal(w.Body.Bytes(), &problem)
+	if err != nil {
+		log.Fatalf("Failed to unmarshal response: %v", err)
+	}
 
-	a.Equal(http.StatusBadRequest, w.Code)
-	a.Equal(expectedResponse, w.Body.String())
+	a.Equal(http.StatusNotFound, w.Code)
+	a.Equal("application/problem+json", w.Header().Get("Content-Type"))
+	a.Equal("hotel_not_found", problem.Code)
+	a.Equal("hotel not found", problem.Detail)
+	a.NotEmpty(problem.RequestId)
 }
 
 func TestUpdateHotel_Controller_Found(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.PUT("/hotel/:id", UpdateHotel)
 
 	body := `{
@@ -371,7 +467,8 @@ func TestUpdateHotel_Controller_Found(t *testing.T) {
         "description": "Test hotel description",
         "street_name": "Test Street",
         "street_number": 123,
-        "rate": 4.5
+        "rate": 4.5,
+        "version": 3
     }`
 
 	req, err := http.NewRequest(http.MethodPut, "/hotel/1", strings.NewReader(body))
@@ -395,6 +492,7 @@ func TestUpdateHotel_Controller_Found(t *testing.T) {
 		StreetName:   "Test Street",
 		StreetNumber: 123,
 		Rate:         4.5,
+		Version:      4,
 	}
 
 	var response dto.HotelDto
@@ -404,6 +502,129 @@ func TestUpdateHotel_Controller_Found(t *testing.T) {
 	}
 
 	a.Equal(http.StatusOK, w.Code)
+	a.Equal(`"4"`, w.Header().Get("ETag"))
 
 	a.Equal(expectedResponse, response)
 }
+
+func TestHotel_Controller_ETag(t *testing.T) {
+	a := assert.New(t)
+
+	r := newErrorTestRouter()
+	r.GET("/hotel/:id", GetHotelById)
+	r.PUT("/hotel/:id", UpdateHotel)
+
+	req, _ := http.NewRequest(http.MethodGet, "/hotel/1", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(`"3"`, w.Header().Get("ETag"))
+
+	// Lists, weak ETags and "*" are understood too
+	for _, ifNoneMatch := range []string{`"3"`, `"2", "3"`, `W/"3"`, `*`} {
+		req, _ = http.NewRequest(http.MethodGet, "/hotel/1", nil)
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		a.Equal(http.StatusNotModified, w.Code, ifNoneMatch)
+		a.Empty(w.Body.String(), ifNoneMatch)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/hotel/1", nil)
+	req.Header.Set("If-None-Match", `"2", W/"4"`)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	a.Equal(http.StatusOK, w.Code)
+
+	update := func(ifMatch string) (*httptest.ResponseRecorder, dto.ProblemDto) {
+		body := `{"name": "Hotel Test", "room_amount": 10, "description": "Test", "street_name": "Test Street", "street_number": 123, "rate": 4.5}`
+		req, _ := http.NewRequest(http.MethodPut, "/hotel/1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var problem dto.ProblemDto
+		json.Unmarshal(w.Body.Bytes(), &problem)
+
+		return w, problem
+	}
+
+	w, _ = update(`"3"`)
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(`"4"`, w.Header().Get("ETag"))
+
+	w, problem := update(`"2"`)
+	a.Equal(http.StatusPreconditionFailed, w.Code)
+	a.Equal("hotel_modified", problem.Code)
+
+	w, problem = update(`W/"3"`)
+	a.Equal(http.StatusPreconditionFailed, w.Code)
+	a.Equal("invalid_if_match", problem.Code)
+
+	w, _ = update("*")
+	a.Equal(http.StatusOK, w.Code)
+
+	// Replacing the hotel blindly could undo someone else's changes
+	w, problem = update("")
+	a.Equal(http.StatusPreconditionRequired, w.Code)
+	a.Equal("hotel_version_required", problem.Code)
+}
+
+func TestPatchHotel_Controller(t *testing.T) {
+	a := assert.New(t)
+
+	r := newErrorTestRouter()
+	r.PATCH("/hotel/:id", PatchHotel)
+
+	patchHotel := func(ifMatch string, body string) (*httptest.ResponseRecorder, dto.ProblemDto) {
+		req, _ := http.NewRequest(http.MethodPatch, "/hotel/1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var problem dto.ProblemDto
+		json.Unmarshal(w.Body.Bytes(), &problem)
+
+		return w, problem
+	}
+
+	// The stored hotel of the mock has no fields, they must all be given
+	body := `{"name": "Hotel", "room_amount": 12, "description": "Test", "street_name": "Street", "street_number": 1, "rate": 10}`
+
+	w, _ := patchHotel("", body)
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(`"4"`, w.Header().Get("ETag"))
+
+	var hotelDto dto.HotelDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &hotelDto))
+	a.Equal(1, hotelDto.Id)
+	a.Equal(12, hotelDto.RoomAmount)
+
+	w, problem := patchHotel(`"2"`, body)
+	a.Equal(http.StatusPreconditionFailed, w.Code)
+	a.Equal("hotel_modified", problem.Code)
+
+	w, problem = patchHotel("", `{"room_amount": 0}`)
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("validation_failed", problem.Code)
+
+	req, _ := http.NewRequest(http.MethodPatch, "/hotel/11", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	w, problem = serveProblem(r, req)
+
+	a.Equal(http.StatusNotFound, w.Code)
+	a.Equal("hotel_not_found", problem.Code)
+}
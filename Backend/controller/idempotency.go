@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"project/auth"
+	"project/dto"
+	"project/service"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotency-Replayed"
+)
+
+var errInvalidIdempotencyKey = service.Invalid("invalid_idempotency_key", "Idempotency-Key must be 1 to 255 visible ascii characters")
+
+var idempotencyKeyPattern = regexp.MustCompile(`^[\x21-\x7e]{1,255}$`)
+
+// credentialRoutes are left out of idempotency, their requests and responses
+// carry passwords, tokens and codes that must not be kept
+var credentialRoutes = map[string]bool{
+	"POST /login":                        true,
+	"POST /login/mfa":                    true,
+	"POST /login/mfa/enroll":             true,
+	"POST /auth/oidc/:provider/start":    true,
+	"POST /auth/oidc/:provider/callback": true,
+	"POST /password/forgot":              true,
+	"POST /password/reset":               true,
+	"POST /user/email/confirm":           true,
+	"POST /user/email/verify":            true,
+	"PUT /me/password":                   true,
+	"POST /me/confirmation":              true,
+	"POST /me/email":                     true,
+	"DELETE /me":                         true,
+	"POST /me/mfa":                       true,
+	"POST /me/mfa/confirm":               true,
+	"DELETE /me/mfa":                     true,
+	"POST /me/mfa/recovery-codes":        true,
+	"POST /admin/users/:id/mfa/reset":    true,
+}
+
+// Idempotency lets clients retry POST, PUT, PATCH and DELETE requests safely
+// by sending an Idempotency-Key header. The first response written for a key
+// is stored and replayed, flagged with Idempotency-Replayed, to retries of the
+// same request until the key expires. Reusing the key for another request is
+// answered with idempotency_key_reused, and a retry arriving while the first
+// request runs with idempotency_key_in_progress. Keys belong to the signed in
+// user, or to the client address for anonymous requests, so nobody else can
+// replay or block them.
+//
+// Errors added with c.Error and 5xx responses are not stored, a retry after
+// one of them runs the request again. The credential routes aren't stored at
+// all.
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+
+		if key == "" || !isMutating(c.Request.Method) || credentialRoutes[c.Request.Method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		if !idempotencyKeyPattern.MatchString(key) {
+			c.Error(errInvalidIdempotencyKey)
+			c.Abort()
+			return
+		}
+
+		body, err := peekBody(c)
+
+		if err != nil {
+			// The handler fails reading the body the same way
+			c.Next()
+			return
+		}
+
+		owner := idempotencyOwner(c)
+		key = scopedIdempotencyKey(owner, key)
+		fingerprint := requestFingerprint(owner, c.Request, body)
+		stored, replay, err := service.IdempotencyService.Begin(c.Request.Context(), key, fingerprint)
+
+		if err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+
+		if replay {
+			c.Header(IdempotencyReplayedHeader, "true")
+			c.Data(stored.Status, stored.ContentType, stored.Body)
+			c.Abort()
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		c.Writer = writer.ResponseWriter
+
+		// The client may have given up waiting, which is when it retries, so
+		// the outcome is kept even if the request was canceled
+		ctx := context.WithoutCancel(c.Request.Context())
+		status := c.Writer.Status()
+
+		if !c.Writer.Written() || status >= http.StatusInternalServerError {
+			err = service.IdempotencyService.Release(ctx, key)
+		} else {
+			err = service.IdempotencyService.Complete(ctx, key, dto.IdempotentResponseDto{
+				Status:      status,
+				ContentType: c.Writer.Header().Get("Content-Type"),
+				Body:        writer.body.Bytes(),
+			})
+		}
+
+		if err != nil {
+			log.Ctx(ctx).WithError(err).Error("Failed to save the idempotency key")
+		}
+	}
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// idempotencyOwner is who the keys of the request belong to
+func idempotencyOwner(c *gin.Context) string {
+	if identity, ok := auth.IdentityFrom(c.Request.Context()); ok {
+		return "user:" + strconv.Itoa(identity.UserId)
+	}
+
+	return "ip:" + c.ClientIP()
+}
+
+// scopedIdempotencyKey is the key as stored, hashed with its owner so it still
+// fits the column
+func scopedIdempotencyKey(owner string, key string) string {
+	hash := sha256.Sum256([]byte(owner + "\n" + key))
+	return hex.EncodeToString(hash[:])
+}
+
+// requestFingerprint hashes what makes two requests the same one
+func requestFingerprint(owner string, r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(owner + "\n" + r.Method + " " + r.URL.RequestURI() + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordingWriter keeps a copy of the response body
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"project/auth"
+	"project/db"
+	"project/service"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newIdempotencyTestRouter(t *testing.T, calls *int) *gin.Engine {
+	openTestDb(t)
+
+	r := newErrorTestRouter()
+
+	// Stands in for Identify
+	r.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-User"); user != "" {
+			id, _ := strconv.Atoi(user)
+			c.Request = c.Request.WithContext(auth.WithIdentity(c.Request.Context(), auth.Identity{UserId: id, Role: auth.RoleCustomer}))
+		}
+	})
+	r.Use(Idempotency())
+
+	r.POST("/login", func(c *gin.Context) {
+		*calls++
+		c.JSON(http.StatusOK, gin.H{"token": "secret"})
+	})
+
+	r.POST("/reserve", func(c *gin.Context) {
+		*calls++
+
+		if c.Query("fail") != "" {
+			c.Error(service.ErrNoRoomsAvailable)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"id": *calls})
+	})
+
+	return r
+}
+
+func reserve(r *gin.Engine, key string, body string) *httptest.ResponseRecorder {
+	return send(r, "/reserve", key, body, "", "")
+}
+
+func send(r *gin.Engine, path string, key string, body string, user string, remoteAddr string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	if remoteAddr != "" {
+		req.RemoteAddr = remoteAddr
+	}
+
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+
+	if user != "" {
+		req.Header.Set("X-User", user)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestIdempotency_Controller_Replay(t *testing.T) {
+	a := assert.New(t)
+
+	calls := 0
+	r := newIdempotencyTestRouter(t, &calls)
+
+	w := reserve(r, "key-1", `{"hotel_id":1}`)
+
+	a.Equal(http.StatusCreated, w.Code)
+	a.Equal(`{"id":1}`, w.Body.String())
+	a.Empty(w.Header().Get(IdempotencyReplayedHeader))
+
+	// The retry gets the first response without running the handler again
+	w = reserve(r, "key-1", `{"hotel_id":1}`)
+
+	a.Equal(http.StatusCreated, w.Code)
+	a.Equal(`{"id":1}`, w.Body.String())
+	a.Equal("true", w.Header().Get(IdempotencyReplayedHeader))
+	a.Contains(w.Header().Get("Content-Type"), "application/json")
+	a.Equal(1, calls)
+
+	// Other keys and requests without a key run as usual
+	a.Equal(`{"id":2}`, reserve(r, "key-2", `{"hotel_id":1}`).Body.String())
+	a.Equal(`{"id":3}`, reserve(r, "", `{"hotel_id":1}`).Body.String())
+}
+
+func TestIdempotency_Controller_KeyReused(t *testing.T) {
+	a := assert.New(t)
+
+	calls := 0
+	r := newIdempotencyTestRouter(t, &calls)
+
+	reserve(r, "key-1", `{"hotel_id":1}`)
+
+	req, _ := http.NewRequest(http.MethodPost, "/reserve", strings.NewReader(`{"hotel_id":2}`))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	w, problem := serveProblem(r, req)
+
+	a.Equal(http.StatusUnprocessableEntity, w.Code)
+	a.Equal("idempotency_key_reused", problem.Code)
+	a.Equal(1, calls)
+}
+
+func TestIdempotency_Controller_ErrorsNotStored(t *testing.T) {
+	a := assert.New(t)
+
+	calls := 0
+	r := newIdempotencyTestRouter(t, &calls)
+
+	req, _ := http.NewRequest(http.MethodPost, "/reserve?fail=1", strings.NewReader(`{}`))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	w, problem := serveProblem(r, req)
+
+	a.Equal(http.StatusConflict, w.Code)
+	a.Equal("no_rooms_available", problem.Code)
+
+	// The key was released, so the retry runs the request again
+	req, _ = http.NewRequest(http.MethodPost, "/reserve?fail=1", strings.NewReader(`{}`))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	w, _ = serveProblem(r, req)
+
+	a.Equal(http.StatusConflict, w.Code)
+	a.Empty(w.Header().Get(IdempotencyReplayedHeader))
+	a.Equal(2, calls)
+}
+
+func TestIdempotency_Controller_InvalidKey(t *testing.T) {
+	a := assert.New(t)
+
+	calls := 0
+	r := newIdempotencyTestRouter(t, &calls)
+
+	req, _ := http.NewRequest(http.MethodPost, "/reserve", strings.NewReader(`{}`))
+	req.Header.Set(IdempotencyKeyHeader, "two words")
+	w, problem := serveProblem(r, req)
+
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("invalid_idempotency_key", problem.Code)
+	a.Equal(0, calls)
+}
+
+func TestIdempotency_Controller_Owners(t *testing.T) {
+	a := assert.New(t)
+
+	calls := 0
+	r := newIdempotencyTestRouter(t, &calls)
+
+	// The same key sent by someone else is theirs, it neither replays nor blocks
+	a.Equal(`{"id":1}`, send(r, "/reserve", "key-1", `{"hotel_id":1}`, "1", "192.0.2.1:1234").Body.String())
+	a.Equal(`{"id":2}`, send(r, "/reserve", "key-1", `{"hotel_id":1}`, "2", "192.0.2.1:1234").Body.String())
+	a.Equal(`{"id":3}`, send(r, "/reserve", "key-1", `{"hotel_id":1}`, "", "192.0.2.1:1234").Body.String())
+	a.Equal(`{"id":4}`, send(r, "/reserve", "key-1", `{"hotel_id":1}`, "", "198.51.100.7:4000").Body.String())
+
+	// while their own retries are replayed, from wherever a user sends them
+	w := send(r, "/reserve", "key-1", `{"hotel_id":1}`, "1", "198.51.100.7:4000")
+	a.Equal(`{"id":1}`, w.Body.String())
+	a.Equal("true", w.Header().Get(IdempotencyReplayedHeader))
+
+	w = send(r, "/reserve", "key-1", `{"hotel_id":1}`, "", "198.51.100.7:4000")
+	a.Equal(`{"id":4}`, w.Body.String())
+	a.Equal(4, calls)
+}
+
+func TestIdempotency_Controller_CredentialRoutes(t *testing.T) {
+	a := assert.New(t)
+
+	calls := 0
+	r := newIdempotencyTestRouter(t, &calls)
+
+	send(r, "/login", "key-1", `{"email":"ana@mail.com","password":"password1"}`, "", "192.0.2.1:1234")
+	w := send(r, "/login", "key-1", `{"email":"ana@mail.com","password":"password1"}`, "", "192.0.2.1:1234")
+
+	// Nothing is kept, the retry logs in again
+	a.Equal(http.StatusOK, w.Code)
+	a.Empty(w.Header().Get(IdempotencyReplayedHeader))
+	a.Equal(2, calls)
+
+	var stored int64
+	a.Nil(db.Db.Table("idempotency_keys").Count(&stored).Error)
+	a.Zero(stored)
+}
@@ -1,48 +1,116 @@
 package controller
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path"
 	"project/dto"
 	"project/service"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+type imageETag struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// ImageDir is where uploaded images are stored and MaxSignedUrlTtl how long a
+// signed URL can last, they are set from the configuration at startup
+var (
+	ImageDir        = "Images"
+	MaxSignedUrlTtl = 24 * time.Hour
+)
+
+// imageETags caches the content hash of each served file, keyed by path
+var imageETags sync.Map
+
 func InsertImages(c *gin.Context) {
 	var imagesDto dto.ImagesDto
 
 	id, _ := strconv.Atoi(c.Param("id"))
 
-	form, _ := c.MultipartForm()
+	form, err := c.MultipartForm()
+
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
 	files := form.File["images"]
 
-	for i, file := range files {
+	if len(files) == 0 {
+		c.Error(service.ErrValidation.WithFields(dto.FieldErrorDto{Field: "images", Code: "required", Message: "is required"}))
+		return
+	}
 
-		fileExt := path.Ext(file.Filename)
+	for _, file := range files {
 
-		//Filename as [hotel_id]-[image_number].[file_extension]
-		fileName := fmt.Sprintf("%d-%d%s", id, i+1, fileExt)
+		hash, err := contentHash(file)
 
-		if err := c.SaveUploadedFile(file, "Images/"+fileName); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		if err != nil {
+			c.Error(err)
 			return
 		}
 
+		//Filename as [sha256_of_content].[file_extension] so it can be cached as immutable
+		fileName := fmt.Sprintf("%s%s", hash, path.Ext(file.Filename))
+
 		imageDTO := dto.ImageDto{
 			HotelId: id,
-			Path:    "Images/" + fileName,
+			Path:    path.Join(ImageDir, fileName),
 		}
 		imagesDto = append(imagesDto, imageDTO)
 	}
 
-	imagesDto, err := service.ImageService.InsertImages(imagesDto)
+	if !check(c, validateStruct(imagesDto)) {
+		return
+	}
+
+	// Nothing is written for those who can't add the images
+	if err := service.ImageService.CheckImageUpload(c.Request.Context(), id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	var saved []string
+
+	for i, file := range files {
+		filePath := imagesDto[i].Path
+
+		// Files are named by their content, another image may have it already.
+		// Touching it keeps the purge of unused files from removing it meanwhile.
+		if _, err := os.Stat(filePath); err == nil {
+			now := time.Now()
+
+			if err := os.Chtimes(filePath, now, now); err == nil {
+				continue
+			}
+		}
+
+		if err := c.SaveUploadedFile(file, filePath); err != nil {
+			removeFiles(c, saved)
+			c.Error(err)
+			return
+		}
+
+		saved = append(saved, filePath)
+	}
+
+	imagesDto, err = service.ImageService.InsertImages(c.Request.Context(), imagesDto)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		removeFiles(c, saved)
+		c.Error(err)
 		return
 	}
 
@@ -53,10 +121,19 @@ func GetImageById(c *gin.Context) {
 	var imageDto dto.ImageDto
 	id, _ := strconv.Atoi(c.Param("id"))
 
-	imageDto, err := service.ImageService.GetImageById(id)
+	imageDto, err := service.ImageService.GetImageById(c.Request.Context(), id)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+
+	signature := c.Query("signature")
+
+	err = service.ImageService.CheckImageAccess(c.Request.Context(), imageDto, c.Query("expires"), signature)
+
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -65,18 +142,126 @@ func GetImageById(c *gin.Context) {
 	file, err := os.Open(filePath)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(errImageFileMissing)
 		return
 	}
 
 	defer file.Close()
 
-	c.Header("Content-Type", "image/jpg")
+	info, err := file.Stat()
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	etag, err := fileETag(filePath, file, info)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", etag)
+
+	switch {
+	case signature != "":
+		c.Header("Cache-Control", "private, no-cache")
+	case isContentAddressed(filePath, etag):
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		c.Header("Cache-Control", "public, no-cache")
+	}
+
+	// Handles Range, If-None-Match and If-Modified-Since
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
+
+func GetSignedImageUrl(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	ttl, err := strconv.Atoi(c.DefaultQuery("ttl", "3600"))
 
-	_, err = io.Copy(c.Writer, file)
+	if err != nil || ttl <= 0 {
+		c.Error(errInvalidTtl)
+		return
+	}
+
+	// In seconds, so a huge ttl can't overflow past the maximum
+	if ttl > int(MaxSignedUrlTtl/time.Second) {
+		c.Error(errTtlTooLong)
+		return
+	}
+
+	url, err := service.ImageService.SignImageUrl(c.Request.Context(), id, time.Duration(ttl)*time.Second)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
+
+	c.JSON(http.StatusOK, gin.H{"url": url})
+}
+
+// removeFiles removes the files saved for images that weren't inserted, the
+// purge of unused files takes those that fail
+func removeFiles(c *gin.Context, filePaths []string) {
+	for _, filePath := range filePaths {
+		if err := os.Remove(filePath); err != nil {
+			log.Ctx(c.Request.Context()).WithError(err).Warn("Failed to remove image file")
+		}
+	}
+}
+
+func contentHash(file *multipart.FileHeader) (string, error) {
+	src, err := file.Open()
+
+	if err != nil {
+		return "", err
+	}
+
+	defer src.Close()
+
+	hash := sha256.New()
+
+	if _, err := io.Copy(hash, src); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func fileETag(filePath string, file *os.File, info os.FileInfo) (string, error) {
+
+	if cached, ok := imageETags.Load(filePath); ok {
+		cached := cached.(imageETag)
+
+		if cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+			return cached.etag, nil
+		}
+	}
+
+	hash := sha256.New()
+
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+
+	imageETags.Store(filePath, imageETag{modTime: info.ModTime(), size: info.Size(), etag: etag})
+
+	return etag, nil
+}
+
+// isContentAddressed reports whether the file is named after its own hash,
+// meaning the content behind its id can never change
+func isContentAddressed(filePath string, etag string) bool {
+	name := strings.TrimSuffix(path.Base(filePath), path.Ext(filePath))
+
+	return name == strings.Trim(etag, `"`)
 }
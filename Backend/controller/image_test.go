@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"project/dto"
+	"project/service"
+	"testing"
+	"time"
+)
+
+type TestImage struct {
+	path string
+}
+
+var testImage = &TestImage{}
+
+func init() {
+	service.ImageService = testImage
+}
+
+// CheckImageUpload lets images be added to hotels 1 to 10 but 7
+func (t TestImage) CheckImageUpload(ctx context.Context, hotelId int) error {
+	if hotelId == 7 {
+		return service.ErrPermissionDenied
+	}
+
+	if hotelId > 10 {
+		return service.ErrHotelNotFound
+	}
+
+	return nil
+}
+
+// InsertImages fails for hotel 8
+func (t TestImage) InsertImages(ctx context.Context, imagesDto dto.ImagesDto) (dto.ImagesDto, error) {
+	if imagesDto[0].HotelId == 8 {
+		return imagesDto, errors.New("insert failed")
+	}
+
+	for i := range imagesDto {
+		imagesDto[i].Id = i + 1
+	}
+
+	return imagesDto, nil
+}
+
+func (t TestImage) GetImageById(ctx context.Context, id int) (dto.ImageDto, error) {
+
+	if id > 10 {
+		return dto.ImageDto{}, service.ErrImageNotFound
+	}
+
+	return dto.ImageDto{Id: id, Path: t.path, HotelId: id}, nil
+}
+
+func (t TestImage) SignImageUrl(ctx context.Context, id int, ttl time.Duration) (string, error) {
+	return "/image/1?expires=1&signature=abc", nil
+}
+
+func (t TestImage) CheckImageAccess(ctx context.Context, imageDto dto.ImageDto, expires string, signature string) error {
+
+	// Hotel 5 is a draft in these tests
+	if imageDto.HotelId == 5 && signature == "" {
+		return service.ErrImageSignatureRequired
+	}
+
+	return nil
+}
+
+func TestGetImageById_Controller_Cache(t *testing.T) {
+
+	a := assert.New(t)
+
+	testImage.path = filepath.Join(t.TempDir(), "1-1.jpg")
+	err := os.WriteFile(testImage.path, []byte("0123456789"), 0644)
+	a.Nil(err)
+
+	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
+	r.GET("/image/:id", GetImageById)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/image/1", nil)
+	r.ServeHTTP(w, req)
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("0123456789", w.Body.String())
+	a.Equal("public, no-cache", w.Header().Get("Cache-Control"))
+
+	etag := w.Header().Get("ETag")
+	a.NotEmpty(etag)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/image/1", nil)
+	req.Header.Set("If-None-Match", etag)
+	r.ServeHTTP(w, req)
+
+	a.Equal(http.StatusNotModified, w.Code)
+}
+
+func TestGetImageById_Controller_Range(t *testing.T) {
+
+	a := assert.New(t)
+
+	testImage.path = filepath.Join(t.TempDir(), "1-1.jpg")
+	err := os.WriteFile(testImage.path, []byte("0123456789"), 0644)
+	a.Nil(err)
+
+	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
+	r.GET("/image/:id", GetImageById)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/image/1", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	r.ServeHTTP(w, req)
+
+	a.Equal(http.StatusPartialContent, w.Code)
+	a.Equal("2345", w.Body.String())
+	a.Equal("bytes 2-5/10", w.Header().Get("Content-Range"))
+}
+
+func TestGetImageById_Controller_Immutable(t *testing.T) {
+
+	a := assert.New(t)
+
+	// sha256 of "0123456789"
+	testImage.path = filepath.Join(t.TempDir(), "84d89877f0d4041efb6bf91a16f0248f2fd573e6af05c19f96bedb9f882f7882.jpg")
+	err := os.WriteFile(testImage.path, []byte("0123456789"), 0644)
+	a.Nil(err)
+
+	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
+	r.GET("/image/:id", GetImageById)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/image/1", nil)
+	r.ServeHTTP(w, req)
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("public, max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+}
+
+func TestGetImageById_Controller_Forbidden(t *testing.T) {
+
+	a := assert.New(t)
+
+	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
+	r.GET("/image/:id", GetImageById)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/image/5", nil)
+	r.ServeHTTP(w, req)
+
+	a.Equal(http.StatusForbidden, w.Code)
+}
+
+func TestGetImageById_Controller_NotFound(t *testing.T) {
+
+	a := assert.New(t)
+
+	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
+	r.GET("/image/:id", GetImageById)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/image/20", nil)
+	r.ServeHTTP(w, req)
+
+	a.Equal(http.StatusNotFound, w.Code)
+}
+
+func TestInsertImages_Controller(t *testing.T) {
+
+	a := assert.New(t)
+
+	ImageDir = t.TempDir()
+	t.Cleanup(func() { ImageDir = "Images" })
+
+	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
+	r.POST("/hotel/:id/images", InsertImages)
+
+	upload := func(hotelId string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("images", "room.jpg")
+		part.Write([]byte("room"))
+		writer.Close()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/hotel/"+hotelId+"/images", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	files := func() int {
+		entries, _ := os.ReadDir(ImageDir)
+		return len(entries)
+	}
+
+	// Nothing is written for those who can't add images, nor for missing hotels
+	a.Equal(http.StatusForbidden, upload("7").Code)
+	a.Equal(http.StatusNotFound, upload("20").Code)
+	a.Zero(files())
+
+	// Nor kept when the images aren't inserted
+	a.Equal(http.StatusInternalServerError, upload("8").Code)
+	a.Zero(files())
+
+	a.Equal(http.StatusOK, upload("1").Code)
+	a.Equal(1, files())
+
+	// The file of an image already there is kept when the insert fails
+	a.Equal(http.StatusInternalServerError, upload("8").Code)
+	a.Equal(1, files())
+}
+
+func TestGetSignedImageUrl_Controller_Ttl(t *testing.T) {
+
+	a := assert.New(t)
+
+	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
+	r.GET("/image/:id/signed-url", GetSignedImageUrl)
+
+	for query, expected := range map[string]string{
+		"":                         "",
+		"?ttl=86400":               "",
+		"?ttl=86401":               "ttl_too_long",
+		"?ttl=9223372036854775807": "ttl_too_long",
+		"?ttl=0":                   "invalid_ttl",
+		"?ttl=an-hour":             "invalid_ttl",
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "/image/1/signed-url"+query, nil)
+		w, problem := serveProblem(r, req)
+
+		if expected == "" {
+			a.Equal(http.StatusOK, w.Code, query)
+		} else {
+			a.Equal(http.StatusBadRequest, w.Code, query)
+			a.Equal(expected, problem.Code, query)
+		}
+	}
+}
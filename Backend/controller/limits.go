@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"project/ratelimit"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxBodySize rejects request bodies larger than limit bytes with a body_too_large problem
+func MaxBodySize(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			c.Error(errBodyTooLarge)
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// RouteLimit throttles one route per client IP and per account, the account
+// being the value of AccountField in the JSON body. Clients spreading their
+// requests to an account over many addresses share its limit. A zero Limit is
+// not applied.
+type RouteLimit struct {
+	PerIp        ratelimit.Limit
+	PerAccount   ratelimit.Limit
+	AccountField string
+}
+
+// RateLimits holds the limits by "METHOD /route", it is set from the
+// configuration at startup. RateLimitStore keeps the buckets.
+var (
+	RateLimits                     = map[string]RouteLimit{}
+	RateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+)
+
+// RateLimit answers requests over the limits of their route with a
+// rate_limited problem and a Retry-After header
+func RateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		limit, ok := RateLimits[route]
+
+		if !ok {
+			c.Next()
+			return
+		}
+
+		if limit.PerIp.Burst > 0 && !takeToken(c, "ip:"+route+":"+c.ClientIP(), limit.PerIp) {
+			return
+		}
+
+		if limit.PerAccount.Burst > 0 {
+			if account := accountKey(c, limit.AccountField); account != "" && !takeToken(c, "account:"+route+":"+account, limit.PerAccount) {
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// takeToken reports whether the request may go on, requests are let through
+// when the store fails so an outage of a shared store doesn't take the API down
+func takeToken(c *gin.Context, key string, limit ratelimit.Limit) bool {
+	decision, err := RateLimitStore.Take(c.Request.Context(), key, limit)
+
+	if err != nil {
+		log.Ctx(c.Request.Context()).WithError(err).Warn("Rate limit store failed, letting the request through")
+		return true
+	}
+
+	if decision.Allowed {
+		return true
+	}
+
+	c.Error(errRateLimited.WithRetryAfter(decision.RetryAfter))
+	c.Abort()
+
+	return false
+}
+
+// accountKey reads field from the JSON body
+func accountKey(c *gin.Context, field string) string {
+	body, err := peekBody(c)
+
+	if err != nil {
+		return ""
+	}
+
+	var values map[string]json.RawMessage
+
+	if json.Unmarshal(body, &values) != nil {
+		return ""
+	}
+
+	return strings.ToLower(strings.Trim(string(values[field]), `" `))
+}
+
+// peekBody reads the request body and puts it back for the handler
+func peekBody(c *gin.Context) ([]byte, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errorReader{err}))
+
+	return body, err
+}
+
+// errorReader replays a read error, so a body over the size limit still fails
+// with body_too_large once the handler reads it
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read([]byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	return 0, io.EOF
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"project/dto"
+	"project/ratelimit"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRateLimitTestRouter(t *testing.T, limits map[string]RouteLimit) *gin.Engine {
+	previous, previousStore := RateLimits, RateLimitStore
+
+	RateLimits = limits
+	RateLimitStore = ratelimit.NewMemoryStore()
+	t.Cleanup(func() { RateLimits, RateLimitStore = previous, previousStore })
+
+	r := newErrorTestRouter()
+	r.Use(RateLimit())
+
+	return r
+}
+
+func TestRateLimit_Controller_PerIp(t *testing.T) {
+	a := assert.New(t)
+
+	r := newRateLimitTestRouter(t, map[string]RouteLimit{
+		"GET /hotel/:id": {PerIp: ratelimit.Limit{Burst: 2, Period: time.Minute}},
+	})
+	r.GET("/hotel/:id", GetHotelById)
+	r.GET("/hotel", GetHotels)
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "/hotel/1", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		a.Equal(http.StatusOK, w.Code)
+	}
+
+	// The limit holds for the route, whatever the id
+	req, _ := http.NewRequest(http.MethodGet, "/hotel/2", nil)
+	w, problem := serveProblem(r, req)
+
+	a.Equal(http.StatusTooManyRequests, w.Code)
+	a.Equal("rate_limited", problem.Code)
+	a.Equal("30", w.Header().Get("Retry-After"))
+
+	// Routes without limits are not throttled
+	req, _ = http.NewRequest(http.MethodGet, "/hotel", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	a.Equal(http.StatusOK, w.Code)
+}
+
+func TestRateLimit_Controller_PerAccount(t *testing.T) {
+	a := assert.New(t)
+
+	r := newRateLimitTestRouter(t, map[string]RouteLimit{
+		"POST /login": {PerAccount: ratelimit.Limit{Burst: 1, Period: time.Minute}, AccountField: "email"},
+	})
+
+	var bound []string
+
+	r.POST("/login", func(c *gin.Context) {
+		var loginDto dto.LoginDto
+
+		if bindJSON(c, &loginDto) {
+			bound = append(bound, loginDto.Email)
+			c.Status(http.StatusAccepted)
+		}
+	})
+
+	login := func(email string) int {
+		req, _ := http.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email": "`+email+`", "password": "password1"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	a.Equal(http.StatusAccepted, login("ana@mail.com"))
+	a.Equal(http.StatusTooManyRequests, login("ANA@mail.com"))
+	a.Equal(http.StatusAccepted, login("juan@mail.com"))
+
+	// The handler still reads the body after the limiter
+	a.Equal([]string{"ana@mail.com", "juan@mail.com"}, bound)
+}
+
+func TestRateLimit_Controller_PerAccountAcrossIps(t *testing.T) {
+	a := assert.New(t)
+
+	r := newRateLimitTestRouter(t, map[string]RouteLimit{
+		"POST /login": {PerAccount: ratelimit.Limit{Burst: 2, Period: time.Minute}, AccountField: "email"},
+	})
+	r.POST("/login", func(c *gin.Context) {
+		c.Status(http.StatusAccepted)
+	})
+
+	login := func(remoteAddr string) int {
+		req, _ := http.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email": "ana@mail.com", "password": "password1"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	a.Equal(http.StatusAccepted, login("198.51.100.7:4000"))
+	a.Equal(http.StatusAccepted, login("198.51.100.8:4000"))
+
+	// Another address doesn't get a limit of its own
+	a.Equal(http.StatusTooManyRequests, login("198.51.100.9:4000"))
+}
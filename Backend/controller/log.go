@@ -0,0 +1,5 @@
+package controller
+
+import "project/logging"
+
+var log = logging.Package("controller")
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"project/metrics"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_Controller(t *testing.T) {
+	a := assert.New(t)
+
+	// Metrics wraps the error handler, as in the app router, to see the final status
+	r := gin.New()
+	r.Use(Metrics(), gin.CustomRecovery(Recovery), RequestId(), ErrorHandler())
+	r.NoRoute(NoRoute)
+	r.GET("/hotel/:id", GetHotelById)
+	r.GET("/metrics", GetMetrics)
+
+	found := metrics.HttpRequests.WithLabelValues(http.MethodGet, "/hotel/:id", "200")
+	notFound := metrics.HttpRequests.WithLabelValues(http.MethodGet, "/hotel/:id", "404")
+	unmatched := metrics.HttpRequests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")
+
+	foundBefore := testutil.ToFloat64(found)
+	notFoundBefore := testutil.ToFloat64(notFound)
+	unmatchedBefore := testutil.ToFloat64(unmatched)
+
+	for _, path := range []string{"/hotel/1", "/hotel/400", "/hotel/2/unknown"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Requests are labelled by route template, not by path
+	a.Equal(foundBefore+1, testutil.ToFloat64(found))
+	a.Equal(notFoundBefore+1, testutil.ToFloat64(notFound))
+	a.Equal(unmatchedBefore+1, testutil.ToFloat64(unmatched))
+
+	req, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	body, _ := io.ReadAll(w.Body)
+
+	a.Equal(http.StatusOK, w.Code)
+	a.True(strings.Contains(string(body), `miranda_http_request_duration_seconds_count{method="GET",route="/hotel/:id"}`))
+	a.True(strings.Contains(string(body), "miranda_reservations_created_total"))
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"net/http"
+	"project/dto"
+	"project/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The second step of a login answers the challenge returned by UserLogin, it
+// needs no login yet
+
+// VerifyMfaLogin finishes the login with a code from the authenticator app or
+// a recovery code
+func VerifyMfaLogin(c *gin.Context) {
+	var loginDto dto.MfaLoginDto
+	if !bindJSON(c, &loginDto) {
+		return
+	}
+
+	result, err := service.MfaService.CompleteMfaLogin(c.Request.Context(), loginDto)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	loginResponse(c, result)
+}
+
+// EnrollMfaLogin returns the secret to add to the app when the role of the
+// user requires a second factor they don't have yet
+func EnrollMfaLogin(c *gin.Context) {
+	var tokenDto dto.MfaTokenDto
+	if !bindJSON(c, &tokenDto) {
+		return
+	}
+
+	enrollmentDto, err := service.MfaService.EnrollMfaAtLogin(c.Request.Context(), tokenDto)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollmentDto)
+}
+
+// The handlers below act on the second factor of the signed in user, they go
+// after Authenticated
+
+func GetMfaStatus(c *gin.Context) {
+	statusDto, err := service.MfaService.GetMfaStatus(c.Request.Context(), currentUserId(c))
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statusDto)
+}
+
+// StartMfaEnrollment returns the secret to add to the app, the second factor
+// is on once ConfirmMfaEnrollment gets a code from it
+func StartMfaEnrollment(c *gin.Context) {
+	var setupDto dto.MfaSetupDto
+	if !bindJSON(c, &setupDto) {
+		return
+	}
+
+	enrollmentDto, err := service.MfaService.StartMfaEnrollment(c.Request.Context(), currentUserId(c), setupDto)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollmentDto)
+}
+
+// ConfirmMfaEnrollment returns the recovery codes, they aren't shown again
+func ConfirmMfaEnrollment(c *gin.Context) {
+	var codeDto dto.MfaCodeDto
+	if !bindJSON(c, &codeDto) {
+		return
+	}
+
+	codesDto, err := service.MfaService.ConfirmMfaEnrollment(c.Request.Context(), currentUserId(c), codeDto)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, codesDto)
+}
+
+func DisableMfa(c *gin.Context) {
+	var disableDto dto.MfaDisableDto
+	if !bindJSON(c, &disableDto) {
+		return
+	}
+
+	err := service.MfaService.DisableMfa(c.Request.Context(), currentUserId(c), disableDto)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Second factor disabled"})
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var codeDto dto.MfaCodeDto
+	if !bindJSON(c, &codeDto) {
+		return
+	}
+
+	codesDto, err := service.MfaService.RegenerateRecoveryCodes(c.Request.Context(), currentUserId(c), codeDto)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, codesDto)
+}
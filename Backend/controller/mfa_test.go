@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"project/dto"
+	"project/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMfa accepts the code "123456" and the challenge "challenge"
+type TestMfa struct{}
+
+func init() {
+	service.MfaService = &TestMfa{}
+}
+
+func (t *TestMfa) GetMfaStatus(ctx context.Context, userId int) (dto.MfaStatusDto, error) {
+	return dto.MfaStatusDto{Enabled: true, RecoveryCodesLeft: 10}, nil
+}
+
+func (t *TestMfa) StartMfaEnrollment(ctx context.Context, userId int, setupDto dto.MfaSetupDto) (dto.MfaEnrollmentDto, error) {
+	if setupDto.Password != "password1" {
+		return dto.MfaEnrollmentDto{}, service.ErrCurrentPasswordIncorrect
+	}
+
+	return dto.MfaEnrollmentDto{Secret: "JBSWY3DPEHPK3PXP", ProvisioningUri: "otpauth://totp/Miranda:john@email.com?secret=JBSWY3DPEHPK3PXP"}, nil
+}
+
+func (t *TestMfa) ConfirmMfaEnrollment(ctx context.Context, userId int, codeDto dto.MfaCodeDto) (dto.RecoveryCodesDto, error) {
+	if codeDto.Code != "123456" {
+		return dto.RecoveryCodesDto{}, service.ErrMfaCodeIncorrect
+	}
+
+	return dto.RecoveryCodesDto{RecoveryCodes: []string{"aaaa-bbbb-cccc-dddd"}}, nil
+}
+
+func (t *TestMfa) DisableMfa(ctx context.Context, userId int, disableDto dto.MfaDisableDto) error {
+	return service.ErrMfaRequired
+}
+
+func (t *TestMfa) RegenerateRecoveryCodes(ctx context.Context, userId int, codeDto dto.MfaCodeDto) (dto.RecoveryCodesDto, error) {
+	return dto.RecoveryCodesDto{}, service.ErrMfaNotEnrolled
+}
+
+func (t *TestMfa) ResetMfa(ctx context.Context, userId int) error {
+	if userId > 10 {
+		return service.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (t *TestMfa) EnrollMfaAtLogin(ctx context.Context, tokenDto dto.MfaTokenDto) (dto.MfaEnrollmentDto, error) {
+	if tokenDto.MfaToken != "challenge" {
+		return dto.MfaEnrollmentDto{}, service.ErrMfaChallengeInvalid
+	}
+
+	return dto.MfaEnrollmentDto{Secret: "JBSWY3DPEHPK3PXP"}, nil
+}
+
+func (t *TestMfa) CompleteMfaLogin(ctx context.Context, loginDto dto.MfaLoginDto) (dto.LoginResultDto, error) {
+	if loginDto.MfaToken != "challenge" {
+		return dto.LoginResultDto{}, service.ErrMfaChallengeInvalid
+	}
+
+	if loginDto.Code != "123456" {
+		return dto.LoginResultDto{}, service.ErrMfaCodeIncorrect
+	}
+
+	return dto.LoginResultDto{User: dto.UserDto{Id: 4, Email: "admin@email.com", Role: "Admin"}, RecoveryCodes: []string{"aaaa-bbbb-cccc-dddd"}}, nil
+}
+
+func TestUserLogin_Controller_Mfa(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+	r.POST("/login", UserLogin)
+	r.POST("/login/mfa", VerifyMfaLogin)
+	r.POST("/login/mfa/enroll", EnrollMfaLogin)
+
+	// Without a second factor the token comes straight away
+	w := sendAs(r, 0, http.MethodPost, "/login", `{"email":"john@email.com","password":"password1"}`)
+	a.Equal(http.StatusAccepted, w.Code)
+	a.Contains(w.Body.String(), `"token"`)
+
+	w = sendAs(r, 0, http.MethodPost, "/login", `{"email":"admin@email.com","password":"password1"}`)
+
+	var challengeDto dto.MfaChallengeDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &challengeDto))
+
+	a.Equal(http.StatusAccepted, w.Code)
+	a.NotContains(w.Body.String(), `"token"`)
+	a.Equal(dto.MfaChallengeDto{MfaRequired: true, MfaToken: "challenge", ExpiresIn: 300}, challengeDto)
+
+	w = sendAs(r, 0, http.MethodPost, "/login/mfa", `{"mfa_token":"challenge","code":"123456"}`)
+
+	var response struct {
+		Token         string      `json:"token"`
+		User          dto.UserDto `json:"user"`
+		RecoveryCodes []string    `json:"recovery_codes"`
+	}
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &response))
+
+	a.Equal(http.StatusAccepted, w.Code)
+	a.NotEmpty(response.Token)
+	a.Equal(4, response.User.Id)
+	a.Equal([]string{"aaaa-bbbb-cccc-dddd"}, response.RecoveryCodes)
+
+	w = sendAs(r, 0, http.MethodPost, "/login/mfa/enroll", `{"mfa_token":"challenge"}`)
+	a.Equal(http.StatusOK, w.Code)
+	a.Contains(w.Body.String(), `"secret":"JBSWY3DPEHPK3PXP"`)
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"/login/mfa", `{"mfa_token":"challenge"}`, http.StatusBadRequest, "validation_failed"},
+		{"/login/mfa", `{"mfa_token":"expired","code":"123456"}`, http.StatusUnauthorized, "mfa_challenge_invalid"},
+		{"/login/mfa", `{"mfa_token":"challenge","code":"654321"}`, http.StatusUnauthorized, "mfa_code_incorrect"},
+		{"/login/mfa/enroll", `{}`, http.StatusBadRequest, "validation_failed"},
+	}
+
+	for _, test := range tests {
+		w := sendAs(r, 0, http.MethodPost, test.path, test.body)
+
+		var problem dto.ProblemDto
+		a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+		a.Equal(test.status, w.Code, test.body)
+		a.Equal(test.code, problem.Code, test.body)
+	}
+}
+
+func TestMfa_Controller(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+	r.GET("/me/mfa", Authenticated(), GetMfaStatus)
+	r.POST("/me/mfa", Authenticated(), StartMfaEnrollment)
+	r.POST("/me/mfa/confirm", Authenticated(), ConfirmMfaEnrollment)
+	r.DELETE("/me/mfa", Authenticated(), DisableMfa)
+	r.POST("/me/mfa/recovery-codes", Authenticated(), RegenerateRecoveryCodes)
+	r.POST("/admin/users/:id/mfa/reset", ResetUserMfa)
+
+	w := sendAs(r, 1, http.MethodGet, "/me/mfa", "")
+	a.Equal(http.StatusOK, w.Code)
+	a.JSONEq(`{"enabled":true,"required":false,"recovery_codes_left":10}`, w.Body.String())
+
+	w = sendAs(r, 1, http.MethodPost, "/me/mfa", `{"password":"password1"}`)
+	a.Equal(http.StatusOK, w.Code)
+	a.Contains(w.Body.String(), `"provisioning_uri":"otpauth://totp/`)
+
+	w = sendAs(r, 1, http.MethodPost, "/me/mfa/confirm", `{"code":"123456"}`)
+	a.Equal(http.StatusOK, w.Code)
+	a.JSONEq(`{"recovery_codes":["aaaa-bbbb-cccc-dddd"]}`, w.Body.String())
+
+	w = sendAs(r, 4, http.MethodPost, "/admin/users/7/mfa/reset", "")
+	a.Equal(http.StatusOK, w.Code)
+
+	tests := []struct {
+		userId int
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{0, http.MethodGet, "/me/mfa", "", http.StatusUnauthorized, "authentication_required"},
+		{1, http.MethodPost, "/me/mfa", `{"password":"wrong"}`, http.StatusForbidden, "current_password_incorrect"},
+		{1, http.MethodPost, "/me/mfa/confirm", `{}`, http.StatusBadRequest, "validation_failed"},
+		{1, http.MethodPost, "/me/mfa/confirm", `{"code":"654321"}`, http.StatusUnauthorized, "mfa_code_incorrect"},
+		{1, http.MethodDelete, "/me/mfa", `{"password":"password1","code":"123456"}`, http.StatusForbidden, "mfa_required"},
+		{1, http.MethodPost, "/me/mfa/recovery-codes", `{"code":"123456"}`, http.StatusBadRequest, "mfa_not_enrolled"},
+		{4, http.MethodPost, "/admin/users/12/mfa/reset", "", http.StatusNotFound, "user_not_found"},
+	}
+
+	for _, test := range tests {
+		w := sendAs(r, test.userId, test.method, test.path, test.body)
+
+		var problem dto.ProblemDto
+		a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+		a.Equal(test.status, w.Code, test.path)
+		a.Equal(test.code, problem.Code, test.path)
+	}
+}
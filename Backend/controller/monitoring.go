@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"net/http"
+	"project/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetDbStats(c *gin.Context) {
+	stats, err := db.Stats()
+
+	if err != nil {
+		c.Error(errDbNotConnected)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"max_open_connections": stats.MaxOpenConnections,
+		"open_connections":     stats.OpenConnections,
+		"in_use":               stats.InUse,
+		"idle":                 stats.Idle,
+		"wait_count":           stats.WaitCount,
+		"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+		"max_idle_closed":      stats.MaxIdleClosed,
+		"max_lifetime_closed":  stats.MaxLifetimeClosed,
+	})
+}
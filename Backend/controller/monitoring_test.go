@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"project/auth"
+	"project/dto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonitoring_Controller_Permission(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+	r.GET("/db/stats", Permitted(auth.ViewMonitoring), GetDbStats)
+	r.GET("/metrics", Permitted(auth.ViewMonitoring), GetMetrics)
+
+	tests := []struct {
+		role   string
+		status int
+		code   string
+	}{
+		{"", http.StatusUnauthorized, "authentication_required"},
+		{"Customer", http.StatusForbidden, "permission_denied"},
+		{"Manager", http.StatusForbidden, "permission_denied"},
+	}
+
+	send := func(path, role string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+
+		if role != "" {
+			token, _ := generateToken(dto.UserDto{Id: 4, Role: role})
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	// Whether a database is connected depends on the other tests
+	w := send("/db/stats", "Admin")
+	a.NotEqual(http.StatusUnauthorized, w.Code)
+	a.NotEqual(http.StatusForbidden, w.Code)
+
+	w = send("/metrics", "Admin")
+	a.Equal(http.StatusOK, w.Code)
+
+	for _, path := range []string{"/db/stats", "/metrics"} {
+		for _, test := range tests {
+			w := send(path, test.role)
+
+			var problem dto.ProblemDto
+			a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+			a.Equal(test.status, w.Code, path, test.role)
+			a.Equal(test.code, problem.Code, path, test.role)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"net/http"
+	"project/dto"
+	"project/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The OpenID Connect login runs in the frontend: it sends the browser to the
+// authorization URL from StartOidcLogin, and posts the code and state the
+// provider redirects back with to CompleteOidcLogin
+
+func GetOidcProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, service.OidcService.GetProviders(c.Request.Context()))
+}
+
+func StartOidcLogin(c *gin.Context) {
+	authorizationDto, err := service.OidcService.StartLogin(c.Request.Context(), c.Param("provider"))
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, authorizationDto)
+}
+
+// CompleteOidcLogin answers like UserLogin, with the token or the challenge
+// for the second factor
+func CompleteOidcLogin(c *gin.Context) {
+	var callbackDto dto.OidcCallbackDto
+	if !bindJSON(c, &callbackDto) {
+		return
+	}
+
+	result, err := service.OidcService.CompleteLogin(c.Request.Context(), c.Param("provider"), callbackDto)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	loginResponse(c, result)
+}
@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"project/dto"
+	"project/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOidc knows the provider "google", which logs in user 1 with the code
+// "code" and asks admins for the second factor with the code "admin"
+type TestOidc struct{}
+
+func init() {
+	service.OidcService = &TestOidc{}
+}
+
+func (t *TestOidc) GetProviders(ctx context.Context) dto.OidcProvidersDto {
+	return dto.OidcProvidersDto{{Name: "google", DisplayName: "Google"}}
+}
+
+func (t *TestOidc) StartLogin(ctx context.Context, provider string) (dto.OidcAuthorizationDto, error) {
+	if provider != "google" {
+		return dto.OidcAuthorizationDto{}, service.ErrOidcProviderNotFound
+	}
+
+	return dto.OidcAuthorizationDto{AuthorizationUrl: "https://accounts.google.com/o/oauth2/v2/auth?state=state"}, nil
+}
+
+func (t *TestOidc) CompleteLogin(ctx context.Context, provider string, callbackDto dto.OidcCallbackDto) (dto.LoginResultDto, error) {
+	if provider != "google" {
+		return dto.LoginResultDto{}, service.ErrOidcProviderNotFound
+	}
+
+	if callbackDto.State != "state" {
+		return dto.LoginResultDto{}, service.ErrOidcStateInvalid
+	}
+
+	switch callbackDto.Code {
+	case "code":
+		return dto.LoginResultDto{User: dto.UserDto{Id: 1, Email: "john@email.com", Role: "Customer"}}, nil
+	case "admin":
+		return dto.LoginResultDto{Challenge: &dto.MfaChallengeDto{MfaRequired: true, MfaToken: "challenge", ExpiresIn: 300}}, nil
+	}
+
+	return dto.LoginResultDto{}, service.ErrOidcLoginFailed
+}
+
+func TestOidc_Controller(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+	r.GET("/auth/oidc/providers", GetOidcProviders)
+	r.POST("/auth/oidc/:provider/start", StartOidcLogin)
+	r.POST("/auth/oidc/:provider/callback", CompleteOidcLogin)
+
+	w := sendAs(r, 0, http.MethodGet, "/auth/oidc/providers", "")
+	a.Equal(http.StatusOK, w.Code)
+	a.JSONEq(`[{"name":"google","display_name":"Google"}]`, w.Body.String())
+
+	w = sendAs(r, 0, http.MethodPost, "/auth/oidc/google/start", "")
+	a.Equal(http.StatusOK, w.Code)
+	a.JSONEq(`{"authorization_url":"https://accounts.google.com/o/oauth2/v2/auth?state=state"}`, w.Body.String())
+
+	w = sendAs(r, 0, http.MethodPost, "/auth/oidc/google/callback", `{"code":"code","state":"state"}`)
+
+	var response struct {
+		Token string      `json:"token"`
+		User  dto.UserDto `json:"user"`
+	}
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &response))
+
+	a.Equal(http.StatusAccepted, w.Code)
+	a.NotEmpty(response.Token)
+	a.Equal(1, response.User.Id)
+
+	// Users with a second factor get the challenge, as with a password
+	w = sendAs(r, 0, http.MethodPost, "/auth/oidc/google/callback", `{"code":"admin","state":"state"}`)
+
+	var challengeDto dto.MfaChallengeDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &challengeDto))
+
+	a.Equal(http.StatusAccepted, w.Code)
+	a.NotContains(w.Body.String(), `"token"`)
+	a.Equal("challenge", challengeDto.MfaToken)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{http.MethodPost, "/auth/oidc/github/start", "", http.StatusNotFound, "oidc_provider_not_found"},
+		{http.MethodPost, "/auth/oidc/github/callback", `{"code":"code","state":"state"}`, http.StatusNotFound, "oidc_provider_not_found"},
+		{http.MethodPost, "/auth/oidc/google/callback", `{"code":"code"}`, http.StatusBadRequest, "validation_failed"},
+		{http.MethodPost, "/auth/oidc/google/callback", `{"code":"code","state":"expired"}`, http.StatusUnauthorized, "oidc_state_invalid"},
+		{http.MethodPost, "/auth/oidc/google/callback", `{"code":"forged","state":"state"}`, http.StatusUnauthorized, "oidc_login_failed"},
+	}
+
+	for _, test := range tests {
+		w := sendAs(r, 0, test.method, test.path, test.body)
+
+		var problem dto.ProblemDto
+		a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+		a.Equal(test.status, w.Code, test.path+" "+test.body)
+		a.Equal(test.code, problem.Code, test.path+" "+test.body)
+	}
+}
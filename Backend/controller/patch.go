@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"project/patch"
+	"project/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// bindPatch applies the patch in the body to current and decodes the result
+// into obj, which is validated as a whole. The patch is a JSON Merge Patch,
+// also accepted as plain JSON, or a JSON Patch, depending on the Content-Type.
+// On failure the error is recorded for the ErrorHandler and false is returned.
+func bindPatch(c *gin.Context, current any, obj any) bool {
+	body, err := io.ReadAll(c.Request.Body)
+
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return false
+	}
+
+	doc, err := json.Marshal(current)
+
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+
+	var patched []byte
+
+	switch c.ContentType() {
+	case patch.MergePatchType, binding.MIMEJSON:
+		patched, err = patch.Merge(doc, body)
+	case patch.JSONPatchType:
+		patched, err = patch.Apply(doc, body)
+	default:
+		c.Error(errUnsupportedPatch)
+		return false
+	}
+
+	switch {
+	case errors.Is(err, patch.ErrInvalid):
+		c.Error(service.Invalid("invalid_patch", err.Error()))
+		return false
+	case errors.Is(err, patch.ErrNotApplicable):
+		c.Error(service.Unprocessable("patch_not_applicable", err.Error()))
+		return false
+	case errors.Is(err, patch.ErrTestFailed):
+		c.Error(service.Conflict("patch_test_failed", err.Error()))
+		return false
+	case err != nil:
+		c.Error(err)
+		return false
+	}
+
+	// Unknown fields are rejected, a misspelled field would be ignored otherwise
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(obj); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return false
+	}
+
+	return check(c, validateStruct(obj))
+}
@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"net/http"
+	"project/dto"
+	"project/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The handlers below act on the signed in user, they go after Authenticated
+
+func GetProfile(c *gin.Context) {
+	userDto, err := service.UserService.GetUserById(c.Request.Context(), currentUserId(c))
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userDto)
+}
+
+// GetProfileHotels lists the hotels assigned to the manager logged in
+func GetProfileHotels(c *gin.Context) {
+	assignedDto, err := service.AssignmentService.GetAssignedHotels(c.Request.Context(), currentUserId(c))
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, assignedDto)
+}
+
+// PatchProfile updates the name, last name and dni in a merge patch or JSON
+// patch, see bindPatch
+func PatchProfile(c *gin.Context) {
+	id := currentUserId(c)
+
+	userDto, err := service.UserService.GetUserById(c.Request.Context(), id)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	current := dto.ProfileDto{
+		Name:     userDto.Name,
+		LastName: userDto.LastName,
+		Dni:      userDto.Dni,
+	}
+
+	var profileDto dto.ProfileDto
+	if !bindPatch(c, current, &profileDto) {
+		return
+	}
+
+	userDto, err = service.UserService.UpdateProfile(c.Request.Context(), id, profileDto)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userDto)
+}
+
+func ChangePassword(c *gin.Context) {
+	var passwordDto dto.PasswordChangeDto
+	if !bindJSON(c, &passwordDto) {
+		return
+	}
+
+	err := service.UserService.ChangePassword(c.Request.Context(), currentUserId(c), passwordDto)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed, log in again"})
+}
+
+// RequestEmailChange mails a code to the new email, it is sent back to
+// ConfirmEmailChange to make the change
+func RequestEmailChange(c *gin.Context) {
+	var emailDto dto.EmailChangeDto
+	if !bindJSON(c, &emailDto) {
+		return
+	}
+
+	err := service.UserService.RequestEmailChange(c.Request.Context(), currentUserId(c), emailDto)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Check your new email to confirm the change"})
+}
+
+// ConfirmEmailChange needs no login, the code may be opened on another device
+func ConfirmEmailChange(c *gin.Context) {
+	var tokenDto dto.TokenDto
+	if !bindJSON(c, &tokenDto) {
+		return
+	}
+
+	userDto, err := service.UserService.ConfirmEmailChange(c.Request.Context(), tokenDto.Token)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userDto)
+}
+
+// RequestEmailVerification sends the link confirming the email of the signed in user again
+func RequestEmailVerification(c *gin.Context) {
+	err := service.UserService.RequestEmailVerification(c.Request.Context(), currentUserId(c))
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Check your email to verify it"})
+}
+
+// RequestConfirmation mails a code to users without a password, they send it
+// in its place to change their password, email, second factor or to delete
+// their account
+func RequestConfirmation(c *gin.Context) {
+	err := service.UserService.RequestConfirmation(c.Request.Context(), currentUserId(c))
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Check your email for the code"})
+}
+
+// VerifyEmail needs no login, like ConfirmEmailChange
+func VerifyEmail(c *gin.Context) {
+	var tokenDto dto.TokenDto
+	if !bindJSON(c, &tokenDto) {
+		return
+	}
+
+	userDto, err := service.UserService.VerifyEmail(c.Request.Context(), tokenDto.Token)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userDto)
+}
+
+// DeleteAccount erases the personal data of the signed in user and closes
+// their account, ?force=true cancels their reservations that haven't ended
+// instead of refusing the deletion
+func DeleteAccount(c *gin.Context) {
+	var options dto.DeleteOptionsDto
+	if !bindQuery(c, &options) {
+		return
+	}
+
+	var deletionDto dto.AccountDeletionDto
+	if !bindJSON(c, &deletionDto) {
+		return
+	}
+
+	err := service.UserService.DeleteAccount(c.Request.Context(), currentUserId(c), deletionDto, options.Force)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"project/dto"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newProfileTestRouter(t *testing.T) *gin.Engine {
+	JwtSecret = []byte("test-secret")
+	t.Cleanup(func() { JwtSecret = nil })
+
+	r := newErrorTestRouter()
+	r.Use(Identify())
+	r.POST("/user/email/confirm", ConfirmEmailChange)
+	r.POST("/user/email/verify", VerifyEmail)
+	r.POST("/password/forgot", ForgotPassword)
+	r.POST("/password/reset", ResetPassword)
+	r.GET("/me", Authenticated(), GetProfile)
+	r.PATCH("/me", Authenticated(), PatchProfile)
+	r.PUT("/me/password", Authenticated(), ChangePassword)
+	r.POST("/me/email", Authenticated(), RequestEmailChange)
+	r.POST("/me/email/verification", Authenticated(), RequestEmailVerification)
+	r.POST("/me/confirmation", Authenticated(), RequestConfirmation)
+	r.DELETE("/me", Authenticated(), DeleteAccount)
+
+	return r
+}
+
+// sendAs sends the request as the given user, or anonymously for 0
+func sendAs(r *gin.Engine, userId int, method string, path string, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	if userId != 0 {
+		token, _ := generateToken(dto.UserDto{Id: userId, Role: "Customer"})
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestProfile_Controller_Unauthenticated(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+
+	w := sendAs(r, 0, http.MethodGet, "/me", "")
+
+	var problem dto.ProblemDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+	a.Equal(http.StatusUnauthorized, w.Code)
+	a.Equal("authentication_required", problem.Code)
+	a.Equal("Bearer", w.Header().Get("WWW-Authenticate"))
+
+	w = sendAs(r, 0, http.MethodDelete, "/me", `{"password": "password1"}`)
+	a.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func TestGetProfile_Controller(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+
+	w := sendAs(r, 4, http.MethodGet, "/me", "")
+
+	var userDto dto.UserDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &userDto))
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(4, userDto.Id)
+	a.Equal("john@email.com", userDto.Email)
+}
+
+func TestPatchProfile_Controller(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+
+	w := sendAs(r, 4, http.MethodPatch, "/me", `{"name": "Johnny"}`)
+
+	var userDto dto.UserDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &userDto))
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(dto.UserDto{Id: 4, Name: "Johnny", LastName: "Doe", Dni: "12345678", Email: "john@email.com", Role: "Customer"}, userDto)
+
+	// The email isn't part of the profile, it is changed through /me/email
+	w = sendAs(r, 4, http.MethodPatch, "/me", `{"email": "johnny@email.com"}`)
+
+	a.Equal(http.StatusBadRequest, w.Code)
+}
+
+func TestChangePassword_Controller(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+
+	w := sendAs(r, 4, http.MethodPut, "/me/password", `{"current_password": "password1", "new_password": "Password2!"}`)
+	a.Equal(http.StatusOK, w.Code)
+
+	w = sendAs(r, 4, http.MethodPut, "/me/password", `{"current_password": "wrong", "new_password": "Password2!"}`)
+
+	var problem dto.ProblemDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+	a.Equal(http.StatusForbidden, w.Code)
+	a.Equal("current_password_incorrect", problem.Code)
+
+	w = sendAs(r, 4, http.MethodPut, "/me/password", `{"current_password": "password1", "new_password": "weak"}`)
+
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("new_password", problem.Errors[0].Field)
+}
+
+func TestEmailChange_Controller(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+
+	w := sendAs(r, 4, http.MethodPost, "/me/email", `{"email": "johnny@email.com", "password": "password1"}`)
+	a.Equal(http.StatusAccepted, w.Code)
+
+	w = sendAs(r, 4, http.MethodPost, "/me/email", `{"email": "taken@email.com", "password": "password1"}`)
+	a.Equal(http.StatusConflict, w.Code)
+
+	// The code is confirmed without logging in
+	w = sendAs(r, 0, http.MethodPost, "/user/email/confirm", `{"token": "valid-token"}`)
+
+	var userDto dto.UserDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &userDto))
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("johnny@email.com", userDto.Email)
+
+	w = sendAs(r, 0, http.MethodPost, "/user/email/confirm", `{"token": "used-token"}`)
+
+	var problem dto.ProblemDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("token_invalid", problem.Code)
+}
+
+func TestDeleteAccount_Controller(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+
+	w := sendAs(r, 4, http.MethodDelete, "/me", `{"password": "wrong"}`)
+	a.Equal(http.StatusForbidden, w.Code)
+
+	w = sendAs(r, 4, http.MethodDelete, "/me", `{"password": "password1"}`)
+	a.Equal(http.StatusOK, w.Code)
+
+	// User 7 has reservations that haven't ended
+	w = sendAs(r, 7, http.MethodDelete, "/me", `{"password": "password1"}`)
+	a.Equal(http.StatusConflict, w.Code)
+
+	w = sendAs(r, 7, http.MethodDelete, "/me?force=true", `{"password": "password1"}`)
+	a.Equal(http.StatusOK, w.Code)
+
+	// Accounts without a password confirm with a mailed code
+	w = sendAs(r, 4, http.MethodDelete, "/me", `{"confirmation_code": "valid-code"}`)
+	a.Equal(http.StatusOK, w.Code)
+
+	w = sendAs(r, 4, http.MethodDelete, "/me", `{}`)
+	a.Equal(http.StatusBadRequest, w.Code)
+}
+
+func TestRequestConfirmation_Controller(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+
+	w := sendAs(r, 0, http.MethodPost, "/me/confirmation", "")
+	a.Equal(http.StatusUnauthorized, w.Code)
+
+	w = sendAs(r, 4, http.MethodPost, "/me/confirmation", "")
+	a.Equal(http.StatusAccepted, w.Code)
+
+	// User 7 confirms with their password
+	w = sendAs(r, 7, http.MethodPost, "/me/confirmation", "")
+
+	var problem dto.ProblemDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+	a.Equal(http.StatusConflict, w.Code)
+	a.Equal("password_set", problem.Code)
+}
+
+func TestEmailVerification_Controller(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+
+	w := sendAs(r, 0, http.MethodPost, "/me/email/verification", "")
+	a.Equal(http.StatusUnauthorized, w.Code)
+
+	w = sendAs(r, 4, http.MethodPost, "/me/email/verification", "")
+	a.Equal(http.StatusAccepted, w.Code)
+
+	// User 7 already verified the email
+	w = sendAs(r, 7, http.MethodPost, "/me/email/verification", "")
+	a.Equal(http.StatusConflict, w.Code)
+
+	w = sendAs(r, 0, http.MethodPost, "/user/email/verify", `{"token": "valid-token"}`)
+
+	var userDto dto.UserDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &userDto))
+
+	a.Equal(http.StatusOK, w.Code)
+	a.True(userDto.EmailVerified)
+
+	w = sendAs(r, 0, http.MethodPost, "/user/email/verify", `{"token": "used-token"}`)
+	a.Equal(http.StatusBadRequest, w.Code)
+}
+
+func TestPasswordReset_Controller(t *testing.T) {
+	a := assert.New(t)
+	r := newProfileTestRouter(t)
+
+	w := sendAs(r, 0, http.MethodPost, "/password/forgot", `{"email": "nobody@email.com"}`)
+	a.Equal(http.StatusAccepted, w.Code)
+
+	w = sendAs(r, 0, http.MethodPost, "/password/forgot", `{"email": "not an email"}`)
+	a.Equal(http.StatusBadRequest, w.Code)
+
+	w = sendAs(r, 0, http.MethodPost, "/password/reset", `{"token": "valid-token", "new_password": "Password2!"}`)
+	a.Equal(http.StatusOK, w.Code)
+
+	w = sendAs(r, 0, http.MethodPost, "/password/reset", `{"token": "valid-token", "new_password": "weak"}`)
+
+	var problem dto.ProblemDto
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("new_password", problem.Errors[0].Field)
+
+	w = sendAs(r, 0, http.MethodPost, "/password/reset", `{"token": "used-token", "new_password": "Password2!"}`)
+
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("token_invalid", problem.Code)
+}
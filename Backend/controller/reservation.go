@@ -7,23 +7,18 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
 )
 
 func InsertReservation(c *gin.Context) {
 	var reservationDto dto.ReservationDto
-	err := c.BindJSON(&reservationDto)
-
-	if err != nil {
-		log.Error(err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &reservationDto) {
 		return
 	}
 
-	reservationDto, er := service.ReservationService.InsertReservation(reservationDto)
+	reservationDto, er := service.ReservationService.InsertReservation(c.Request.Context(), reservationDto)
 
 	if er != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": er.Error()})
+		c.Error(er)
 		return
 	}
 
@@ -35,10 +30,10 @@ func GetReservationById(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var reservationDto dto.ReservationDto
 
-	reservationDto, err := service.ReservationService.GetReservationById(id)
+	reservationDto, err := service.ReservationService.GetReservationById(c.Request.Context(), id)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, reservationDto)
@@ -48,10 +43,10 @@ func GetReservations(c *gin.Context) {
 
 	var reservationsDto dto.ReservationsDto
 
-	reservationsDto, err := service.ReservationService.GetReservations()
+	reservationsDto, err := service.ReservationService.GetReservations(c.Request.Context())
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -62,10 +57,10 @@ func GetReservationsByUser(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var userReservations dto.UserReservationsDto
 
-	userReservations, err := service.ReservationService.GetReservationsByUser(id)
+	userReservations, err := service.ReservationService.GetReservationsByUser(c.Request.Context(), id)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -77,13 +72,16 @@ func GetReservationsByUserRange(c *gin.Context) {
 	var reservationsDto dto.ReservationsDto
 
 	id, _ := strconv.Atoi(c.Param("id"))
-	startDate := c.Query("start_date")
-	endDate := c.Query("end_date")
+	var dateRange dto.DateRangeDto
+
+	if !bindQuery(c, &dateRange) {
+		return
+	}
 
-	reservationsDto, err := service.ReservationService.GetReservationsByUserRange(id, startDate, endDate)
+	reservationsDto, err := service.ReservationService.GetReservationsByUserRange(c.Request.Context(), id, dateRange.StartDate, dateRange.EndDate)
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -94,10 +92,10 @@ func GetReservationsByHotel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var hotelReservations dto.HotelReservationsDto
 
-	hotelReservations, err := service.ReservationService.GetReservationsByHotel(id)
+	hotelReservations, err := service.ReservationService.GetReservationsByHotel(c.Request.Context(), id)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -108,10 +106,10 @@ func GetReservationsByHotel(c *gin.Context) {
 func DeleteReservation(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 
-	err := service.ReservationService.DeleteReservation(id)
+	err := service.ReservationService.DeleteReservation(c.Request.Context(), id)
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -1,10 +1,9 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
@@ -21,10 +20,10 @@ func init() {
 	service.ReservationService = &TestReservation{}
 }
 
-func (t TestReservation) InsertReservation(reservationDto dto.ReservationDto) (dto.ReservationDto, error) {
+func (t TestReservation) InsertReservation(ctx context.Context, reservationDto dto.ReservationDto) (dto.ReservationDto, error) {
 
 	if reservationDto.StartDate == "" {
-		return reservationDto, errors.New("error creating reservation")
+		return reservationDto, service.ErrInvalidDateRange
 	}
 
 	reservationDto.Id = 1
@@ -32,16 +31,16 @@ func (t TestReservation) InsertReservation(reservationDto dto.ReservationDto) (d
 	return reservationDto, nil
 }
 
-func (t TestReservation) GetReservationById(id int) (dto.ReservationDto, error) {
+func (t TestReservation) GetReservationById(ctx context.Context, id int) (dto.ReservationDto, error) {
 
 	if id > 10 {
-		return dto.ReservationDto{}, errors.New("reservation not found")
+		return dto.ReservationDto{}, service.ErrReservationNotFound
 	}
 
 	return dto.ReservationDto{Id: id}, nil
 }
 
-func (t TestReservation) GetReservations() (dto.ReservationsDto, error) {
+func (t TestReservation) GetReservations(ctx context.Context) (dto.ReservationsDto, error) {
 
 	return dto.ReservationsDto{
 		dto.ReservationDto{Id: 1},
@@ -49,10 +48,10 @@ func (t TestReservation) GetReservations() (dto.ReservationsDto, error) {
 	}, nil
 }
 
-func (t TestReservation) GetReservationsByUser(userId int) (dto.UserReservationsDto, error) {
+func (t TestReservation) GetReservationsByUser(ctx context.Context, userId int) (dto.UserReservationsDto, error) {
 
 	if userId > 10 {
-		return dto.UserReservationsDto{}, errors.New("user not found")
+		return dto.UserReservationsDto{}, service.ErrUserNotFound
 	}
 
 	return dto.UserReservationsDto{
@@ -64,23 +63,23 @@ func (t TestReservation) GetReservationsByUser(userId int) (dto.UserReservations
 	}, nil
 }
 
-func (t TestReservation) GetReservationsByUserRange(userId int, startDate string, endDate string) (dto.ReservationsDto, error) {
+func (t TestReservation) GetReservationsByUserRange(ctx context.Context, userId int, startDate string, endDate string) (dto.ReservationsDto, error) {
 
 	rangeStart, _ := time.Parse("02-01-2006 15:04", startDate)
 	rangeEnd, _ := time.Parse("02-01-2006 15:04", endDate)
 
 	if rangeStart.After(rangeEnd) {
-		return dto.ReservationsDto{}, errors.New("a reservation cant end before it starts")
+		return dto.ReservationsDto{}, service.ErrInvalidDateRange
 	}
 
 	return dto.ReservationsDto{dto.ReservationDto{Id: 1, UserId: userId}, dto.ReservationDto{Id: 2, UserId: userId}}, nil
 
 }
 
-func (t TestReservation) GetReservationsByHotel(hotelId int) (dto.HotelReservationsDto, error) {
+func (t TestReservation) GetReservationsByHotel(ctx context.Context, hotelId int) (dto.HotelReservationsDto, error) {
 
 	if hotelId > 10 {
-		return dto.HotelReservationsDto{}, errors.New("hotel not found")
+		return dto.HotelReservationsDto{}, service.ErrHotelNotFound
 	}
 
 	return dto.HotelReservationsDto{
@@ -92,10 +91,28 @@ func (t TestReservation) GetReservationsByHotel(hotelId int) (dto.HotelReservati
 	}, nil
 }
 
-func (t TestReservation) DeleteReservation(id int) error {
+func (t TestReservation) DeleteReservation(ctx context.Context, id int) error {
 
 	if id > 10 {
-		return errors.New("reservation not found")
+		return service.ErrReservationNotFound
+	}
+
+	return nil
+}
+
+func (t TestReservation) GetDeletedReservations(ctx context.Context) (dto.DeletedReservationsDto, error) {
+	return dto.DeletedReservationsDto{{ReservationDto: dto.ReservationDto{Id: 4, HotelId: 1, UserId: 1}, DeletedAt: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}}, nil
+}
+
+func (t TestReservation) RestoreReservation(ctx context.Context, id int) error {
+
+	if id > 10 {
+		return service.ErrReservationNotFound
+	}
+
+	// The rooms of reservation 8 were booked again since it was cancelled
+	if id == 8 {
+		return service.ErrNoRoomsAvailable
 	}
 
 	return nil
@@ -106,6 +123,7 @@ func TestInsertReservation_Controller_Error(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.POST("/reserve", InsertReservation)
 
 	body := `{
@@ -129,10 +147,22 @@ func TestInsertReservation_Controller_Error(t *testing.T) {
 
 	r.ServeHTTP(w, req)
 
-	expectedResponse := `{"error":"error creating reservation"}`
+	var problem dto.ProblemDto
+	err = json.Unmarshal(w.Body.Bytes(), &problem)
+	if err != nil {
+		log.Fatalf("Failed to unmarshal response: %v", err)
+	}
 
 	a.Equal(http.StatusBadRequest, w.Code)
-	a.Equal(expectedResponse, w.Body.String())
+	a.Equal("application/problem+json", w.Header().Get("Content-Type"))
+	a.Equal("validation_failed", problem.Code)
+	a.Equal(dto.FieldErrorsDto{
+		{Field: "start_date", Code: "required", Message: "is required"},
+		{Field: "end_date", Code: "required", Message: "is required"},
+		{Field: "user_id", Code: "required", Message: "is required"},
+		{Field: "hotel_id", Code: "required", Message: "is required"},
+	}, problem.Errors)
+	a.NotEmpty(problem.RequestId)
 }
 
 func TestInsertReservation_Controller_Success(t *testing.T) {
@@ -140,11 +170,12 @@ func TestInsertReservation_Controller_Success(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.POST("/reserve", InsertReservation)
 
 	body := `{
-       "start_date": "01-01-2024",
-       "end_date": "01-02-2024",
+       "start_date": "10-11-2030 15:00",
+       "end_date": "12-11-2030 11:00",
        "user_id": 1,
        "hotel_id": 1,
        "amount": 123
@@ -171,8 +202,8 @@ func TestInsertReservation_Controller_Success(t *testing.T) {
 
 	expectedResponse := dto.ReservationDto{
 		Id:        1,
-		StartDate: "01-01-2024",
-		EndDate:   "01-02-2024",
+		StartDate: "10-11-2030 15:00",
+		EndDate:   "12-11-2030 11:00",
 		UserId:    1,
 		HotelId:   1,
 		Amount:    123,
@@ -187,6 +218,7 @@ func TestGetReservationById_Controller_NotFound(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/reservation/:id", GetReservationById)
 
 	req, err := http.NewRequest(http.MethodGet, "/reservation/400", nil)
@@ -202,10 +234,17 @@ func TestGetReservationById_Controller_NotFound(t *testing.T) {
 
 	r.ServeHTTP(w, req)
 
-	expectedResponse := `{"error":"reservation not found"}`
+	var problem dto.ProblemDto
+	err = json.Unmarshal(w.Body.Bytes(), &problem)
+	if err != nil {
+		log.Fatalf("Failed to unmarshal response: %v", err)
+	}
 
 	a.Equal(http.StatusNotFound, w.Code)
-	a.Equal(expectedResponse, w.Body.String())
+	a.Equal("application/problem+json", w.Header().Get("Content-Type"))
+	a.Equal("reservation_not_found", problem.Code)
+	a.Equal("reservation not found", problem.Detail)
+	a.NotEmpty(problem.RequestId)
 }
 
 func TestGetReservationById_Controller_Found(t *testing.T) {
@@ -213,6 +252,7 @@ func TestGetReservationById_Controller_Found(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/reservation/:id", GetReservationById)
 
 	req, err := http.NewRequest(http.MethodGet, "/reservation/1", nil)
@@ -247,6 +287,7 @@ func TestGetReservations_Controller(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/reservation", GetReservations)
 
 	req, err := http.NewRequest(http.MethodGet, "/reservation", nil)
@@ -287,6 +328,7 @@ func TestGetReservationsByUser_Controller_NotFound(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/user/reservations/:id", GetReservationsByUser)
 
 	req, err := http.NewRequest(http.MethodGet, "/user/reservations/400", nil)
@@ -302,10 +344,17 @@ func TestGetReservationsByUser_Controller_NotFound(t *testing.T) {
 
 	r.ServeHTTP(w, req)
 
-	expectedResponse := `{"error":"user not found"}`
+	var problem dto.ProblemDto
+	err = json.Unmarshal(w.Body.Bytes(), &problem)
+	if err != nil {
+		log.Fatalf("Failed to unmarshal response: %v", err)
+	}
 
 	a.Equal(http.StatusNotFound, w.Code)
-	a.Equal(expectedResponse, w.Body.String())
+	a.Equal("application/problem+json", w.Header().Get("Content-Type"))
+	a.Equal("user_not_found", problem.Code)
+	a.Equal("user not found", problem.Detail)
+	a.NotEmpty(problem.RequestId)
 }
 
 func TestGetReservationsByUser_Controller_Found(t *testing.T) {
@@ -313,6 +362,7 @@ func TestGetReservationsByUser_Controller_Found(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/user/reservations/:id", GetReservationsByUser)
 
 	req, err := http.NewRequest(http.MethodGet, "/user/reservations/1", nil)
@@ -350,6 +400,7 @@ func TestGetReservationsByUserRange_Controller_Error(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/user/reservations/:id/range", GetReservationsByUserRange)
 
 	req, err := http.NewRequest(http.MethodGet, "/user/reservations/1/range?start_date=01-02-2024+10:00&end_date=01-01-2024+10:00", nil)
@@ -365,10 +416,17 @@ func TestGetReservationsByUserRange_Controller_Error(t *testing.T) {
 
 	r.ServeHTTP(w, req)
 
-	expectedResponse := `{"error":"a reservation cant end before it starts"}`
+	var problem dto.ProblemDto
+	err = json.Unmarshal(w.Body.Bytes(), &problem)
+	if err != nil {
+		log.Fatalf("Failed to unmarshal response: %v", err)
+	}
 
 	a.Equal(http.StatusBadRequest, w.Code)
-	a.Equal(expectedResponse, w.Body.String())
+	a.Equal("application/problem+json", w.Header().Get("Content-Type"))
+	a.Equal("validation_failed", problem.Code)
+	a.Equal(dto.FieldErrorsDto{{Field: "end_date", Code: "after", Message: "must be after start_date"}}, problem.Errors)
+	a.NotEmpty(problem.RequestId)
 }
 
 func TestGetReservationsByUserRange_Controller_Success(t *testing.T) {
@@ -376,6 +434,7 @@ func TestGetReservationsByUserRange_Controller_Success(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/user/reservations/:id/range", GetReservationsByUserRange)
 
 	req, err := http.NewRequest(http.MethodGet, "/user/reservations/1/range?start_date=01-01-2024+10:00&end_date=01-02-2024+10:00", nil)
@@ -408,6 +467,7 @@ func TestGetReservationsByHotel_Controller_NotFound(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/hotel/reservations/:id", GetReservationsByHotel)
 
 	req, err := http.NewRequest(http.MethodGet, "/hotel/reservations/400", nil)
@@ -423,10 +483,17 @@ func TestGetReservationsByHotel_Controller_NotFound(t *testing.T) {
 
 	r.ServeHTTP(w, req)
 
-	expectedResponse := `{"error":"hotel not found"}`
+	var problem dto.ProblemDto
+	err = json.Unmarshal(w.Body.Bytes(), &problem)
+	if err != nil {
+		log.Fatalf("Failed to unmarshal response: %v", err)
+	}
 
 	a.Equal(http.StatusNotFound, w.Code)
-	a.Equal(expectedResponse, w.Body.String())
+	a.Equal("application/problem+json", w.Header().Get("Content-Type"))
+	a.Equal("hotel_not_found", problem.Code)
+	a.Equal("hotel not found", problem.Detail)
+	a.NotEmpty(problem.RequestId)
 }
 
 func TestGetReservationsByHotel_Controller_Found(t *testing.T) {
@@ -434,6 +501,7 @@ func TestGetReservationsByHotel_Controller_Found(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.GET("/hotel/reservations/:id", GetReservationsByHotel)
 
 	req, err := http.NewRequest(http.MethodGet, "/hotel/reservations/1", nil)
@@ -471,6 +539,7 @@ func TestDeleteReservation_Controller_NotFound(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.DELETE("/reservation/:id", DeleteReservation)
 
 	req, err := http.NewRequest(http.MethodDelete, "/reservation/400", nil)
@@ -486,10 +555,17 @@ func TestDeleteReservation_Controller_NotFound(t *testing.T) {
 
 	r.ServeHTTP(w, req)
 
-	expectedResponse := `{"error":"reservation not found"}`
+	var problem dto.ProblemDto
+	err = json.Unmarshal(w.Body.Bytes(), &problem)
+	if err != nil {
+		log.Fatalf("Failed to unmarshal response: %v", err)
+	}
 
-	a.Equal(http.StatusBadRequest, w.Code)
-	a.Equal(expectedResponse, w.Body.String())
+	a.Equal(http.StatusNotFound, w.Code)
+	a.Equal("application/problem+json", w.Header().Get("Content-Type"))
+	a.Equal("reservation_not_found", problem.Code)
+	a.Equal("reservation not found", problem.Detail)
+	a.NotEmpty(problem.RequestId)
 }
 
 func TestDeleteReservation_Controller_Found(t *testing.T) {
@@ -497,6 +573,7 @@ func TestDeleteReservation_Controller_Found(t *testing.T) {
 	a := assert.New(t)
 
 	r := gin.Default()
+	r.Use(RequestId(), ErrorHandler())
 	r.DELETE("/reservation/:id", DeleteReservation)
 
 	req, err := http.NewRequest(http.MethodDelete, "/reservation/1", nil)
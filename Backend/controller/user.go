@@ -9,23 +9,25 @@ import (
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
+)
+
+// JwtSecret signs the login tokens and TokenTtl is how long they last, both are
+// set from the configuration at startup
+var (
+	JwtSecret []byte
+	TokenTtl  = 24 * time.Hour
 )
 
 func InsertUser(c *gin.Context) {
 	var userDto dto.UserDto
-	err := c.BindJSON(&userDto)
-
-	if err != nil {
-		log.Error(err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &userDto) {
 		return
 	}
 
-	userDto, er := service.UserService.InsertUser(userDto)
+	userDto, er := service.UserService.InsertUser(c.Request.Context(), userDto)
 
 	if er != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": er.Error()})
+		c.Error(er)
 		return
 	}
 
@@ -37,10 +39,10 @@ func GetUserById(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var userDto dto.UserDto
 
-	userDto, err := service.UserService.GetUserById(id)
+	userDto, err := service.UserService.GetUserById(c.Request.Context(), id)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, userDto)
@@ -50,61 +52,163 @@ func GetUsers(c *gin.Context) {
 
 	var usersDto dto.UsersDto
 
-	usersDto, err := service.UserService.GetUsers()
+	usersDto, err := service.UserService.GetUsers(c.Request.Context())
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, usersDto)
 }
 
-func UserLogin(c *gin.Context) {
-	var loginDto dto.UserDto
+// PatchUser updates the profile fields present in a merge patch or JSON
+// patch, see bindPatch. The password and role can't be changed here.
+func PatchUser(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	userDto, err := service.UserService.GetUserById(c.Request.Context(), id)
 
-	err := c.BindJSON(&loginDto)
 	if err != nil {
-		log.Error(err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+
+	current := dto.UserProfileDto{
+		Name:     userDto.Name,
+		LastName: userDto.LastName,
+		Dni:      userDto.Dni,
+		Email:    userDto.Email,
+	}
+
+	var profileDto dto.UserProfileDto
+	if !bindPatch(c, current, &profileDto) {
 		return
 	}
 
-	loginDto, er := service.UserService.UserLogin(loginDto)
+	userDto, err = service.UserService.UpdateUser(c.Request.Context(), id, profileDto)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userDto)
+}
+
+// UserLogin answers with the token, or with the challenge to finish the login
+// at VerifyMfaLogin for users with a second factor
+func UserLogin(c *gin.Context) {
+	var loginDto dto.LoginDto
+
+	if !bindJSON(c, &loginDto) {
+		return
+	}
+
+	result, er := service.UserService.UserLogin(c.Request.Context(), dto.UserDto{Email: loginDto.Email, Password: loginDto.Password})
 	if er != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": er.Error()})
+		c.Error(er)
 		return
 	}
 
-	token, err := generateToken(loginDto)
+	loginResponse(c, result)
+}
+
+// loginResponse signs the token of the user logged in, or returns the
+// challenge when the login needs a second factor. Both answer 202, clients
+// tell the challenge apart by mfa_required.
+func loginResponse(c *gin.Context, result dto.LoginResultDto) {
+	if result.Challenge != nil {
+		c.JSON(http.StatusAccepted, result.Challenge)
+		return
+	}
+
+	token, err := generateToken(result.User)
 	if err != nil {
-		log.Error(err.Error())
-		c.JSON(http.StatusInternalServerError, "Failed to generate token")
+		log.Ctx(c.Request.Context()).WithError(err).Error("Failed to sign token")
+		c.Error(err)
 		return
 	}
 
 	response := struct {
-		Token string      `json:"token"`
-		User  dto.UserDto `json:"user"`
+		Token         string      `json:"token"`
+		User          dto.UserDto `json:"user"`
+		RecoveryCodes []string    `json:"recovery_codes,omitempty"`
 	}{
-		Token: token,
-		User:  loginDto,
+		Token:         token,
+		User:          result.User,
+		RecoveryCodes: result.RecoveryCodes,
 	}
 
 	c.JSON(http.StatusAccepted, response)
 }
 
+// ForgotPassword answers the same whether the email is registered or not, so
+// it can't be used to find out
+func ForgotPassword(c *gin.Context) {
+	var forgottenDto dto.PasswordForgottenDto
+	if !bindJSON(c, &forgottenDto) {
+		return
+	}
+
+	err := service.UserService.RequestPasswordReset(c.Request.Context(), forgottenDto.Email)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the email is registered, a link to reset the password was sent to it"})
+}
+
+func ResetPassword(c *gin.Context) {
+	var resetDto dto.PasswordResetDto
+	if !bindJSON(c, &resetDto) {
+		return
+	}
+
+	err := service.UserService.ResetPassword(c.Request.Context(), resetDto)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed, log in again"})
+}
+
 func generateToken(loginDto dto.UserDto) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 	claims := token.Claims.(jwt.MapClaims)
 	claims["id"] = loginDto.Id
 	claims["role"] = loginDto.Role
-	claims["expiration"] = time.Now().Add(time.Hour * 24).Unix()
+	claims["expiration"] = time.Now().Add(TokenTtl).Unix()
+	claims["token_version"] = loginDto.TokenVersion
 
-	tokenString, err := token.SignedString([]byte("your-secret-key"))
+	tokenString, err := token.SignedString(JwtSecret)
 	if err != nil {
 		return "", err
 	}
 
 	return tokenString, nil
 }
+
+// DeleteUser soft deletes the user, ?force=true cancels their reservations
+// that haven't ended instead of refusing the deletion
+func DeleteUser(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var options dto.DeleteOptionsDto
+	if !bindQuery(c, &options) {
+		return
+	}
+
+	err := service.UserService.DeleteUser(c.Request.Context(), id, options.Force)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
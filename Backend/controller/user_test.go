@@ -0,0 +1,344 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"project/auth"
+	"project/dto"
+	"project/service"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestUser struct{}
+
+func init() {
+	service.UserService = &TestUser{}
+}
+
+func (t TestUser) InsertUser(ctx context.Context, userDto dto.UserDto) (dto.UserDto, error) {
+	userDto.Id = 1
+	return userDto, nil
+}
+
+func (t TestUser) GetUserById(ctx context.Context, id int) (dto.UserDto, error) {
+
+	if id > 10 {
+		return dto.UserDto{}, service.ErrUserNotFound
+	}
+
+	return dto.UserDto{Id: id, Name: "John", LastName: "Doe", Dni: "12345678", Email: "john@email.com", Role: "Customer"}, nil
+}
+
+func (t TestUser) GetUsers(ctx context.Context) (dto.UsersDto, error) {
+	return dto.UsersDto{dto.UserDto{Id: 1}, dto.UserDto{Id: 2}}, nil
+}
+
+func (t TestUser) UpdateUser(ctx context.Context, id int, profileDto dto.UserProfileDto) (dto.UserDto, error) {
+
+	if profileDto.Email == "taken@email.com" {
+		return dto.UserDto{}, service.ErrEmailRegistered
+	}
+
+	return dto.UserDto{Id: id, Name: profileDto.Name, LastName: profileDto.LastName, Dni: profileDto.Dni, Email: profileDto.Email, Role: "Customer"}, nil
+}
+
+func (t TestUser) UserLogin(ctx context.Context, loginDto dto.UserDto) (dto.LoginResultDto, error) {
+
+	if loginDto.Email == "admin@email.com" {
+		return dto.LoginResultDto{Challenge: &dto.MfaChallengeDto{MfaRequired: true, MfaToken: "challenge", ExpiresIn: 300}}, nil
+	}
+
+	return dto.LoginResultDto{User: dto.UserDto{Id: 1, Email: loginDto.Email, Role: "Customer"}}, nil
+}
+
+func (t TestUser) UpdateProfile(ctx context.Context, id int, profileDto dto.ProfileDto) (dto.UserDto, error) {
+	return dto.UserDto{Id: id, Name: profileDto.Name, LastName: profileDto.LastName, Dni: profileDto.Dni, Email: "john@email.com", Role: "Customer"}, nil
+}
+
+func (t TestUser) ChangePassword(ctx context.Context, id int, passwordDto dto.PasswordChangeDto) error {
+
+	if passwordDto.CurrentPassword != "password1" {
+		return service.ErrCurrentPasswordIncorrect
+	}
+
+	return nil
+}
+
+func (t TestUser) RequestEmailChange(ctx context.Context, id int, emailDto dto.EmailChangeDto) error {
+
+	if emailDto.Email == "taken@email.com" {
+		return service.ErrEmailRegistered
+	}
+
+	return nil
+}
+
+func (t TestUser) ConfirmEmailChange(ctx context.Context, token string) (dto.UserDto, error) {
+
+	if token != "valid-token" {
+		return dto.UserDto{}, service.ErrTokenInvalid
+	}
+
+	return dto.UserDto{Id: 1, Email: "johnny@email.com", Role: "Customer"}, nil
+}
+
+func (t TestUser) DeleteAccount(ctx context.Context, id int, deletionDto dto.AccountDeletionDto, force bool) error {
+
+	if deletionDto.Password != "password1" && deletionDto.ConfirmationCode != "valid-code" {
+		return service.ErrCurrentPasswordIncorrect
+	}
+
+	// User 7 has reservations that haven't ended
+	if id == 7 && !force {
+		return service.ErrUserHasReservations
+	}
+
+	return nil
+}
+
+func (t TestUser) RequestEmailVerification(ctx context.Context, id int) error {
+
+	// User 7 already verified the email
+	if id == 7 {
+		return service.ErrEmailVerified
+	}
+
+	return nil
+}
+
+func (t TestUser) RequestConfirmation(ctx context.Context, id int) error {
+
+	// User 7 has a password to confirm with
+	if id == 7 {
+		return service.ErrPasswordSet
+	}
+
+	return nil
+}
+
+func (t TestUser) VerifyEmail(ctx context.Context, token string) (dto.UserDto, error) {
+
+	if token != "valid-token" {
+		return dto.UserDto{}, service.ErrTokenInvalid
+	}
+
+	return dto.UserDto{Id: 1, Email: "john@email.com", Role: "Customer", EmailVerified: true}, nil
+}
+
+func (t TestUser) RequestPasswordReset(ctx context.Context, email string) error {
+	return nil
+}
+
+func (t TestUser) ResetPassword(ctx context.Context, resetDto dto.PasswordResetDto) error {
+
+	if resetDto.Token != "valid-token" {
+		return service.ErrTokenInvalid
+	}
+
+	return nil
+}
+
+func (t TestUser) CreateUser(ctx context.Context, newUserDto dto.NewUserDto) (dto.UserDto, error) {
+
+	if newUserDto.Email == "taken@email.com" {
+		return dto.UserDto{}, service.ErrEmailRegistered
+	}
+
+	return dto.UserDto{Id: 9, Name: newUserDto.Name, Email: newUserDto.Email, Role: newUserDto.Role}, nil
+}
+
+func (t TestUser) SetRole(ctx context.Context, id int, role string) (dto.UserDto, error) {
+
+	// User 4 is the admin making the change
+	if id == 4 {
+		return dto.UserDto{}, service.ErrOwnAccount
+	}
+
+	return dto.UserDto{Id: id, Role: role}, nil
+}
+
+func (t TestUser) SetDisabled(ctx context.Context, id int, disabled bool) (dto.UserDto, error) {
+
+	if id > 10 {
+		return dto.UserDto{}, service.ErrUserNotFound
+	}
+
+	return dto.UserDto{Id: id, Role: "Customer", Disabled: disabled}, nil
+}
+
+// Authenticate keeps the role of the token, user 13 is disabled and user 14
+// was deleted
+func (t TestUser) Authenticate(ctx context.Context, identity auth.Identity) (auth.Identity, error) {
+
+	switch identity.UserId {
+	case 13:
+		return identity, service.ErrAccountDisabled
+	case 14:
+		return identity, service.ErrUserNotFound
+	case 15:
+		// Changed their password once
+		if identity.TokenVersion != 1 {
+			return identity, service.ErrTokenRevoked
+		}
+	}
+
+	return identity, nil
+}
+
+func (t TestUser) BootstrapAdmin(ctx context.Context, email string) (dto.UserDto, error) {
+	return dto.UserDto{}, service.ErrAdminExists
+}
+
+func (t TestUser) DeleteUser(ctx context.Context, id int, force bool) error {
+
+	if id > 10 {
+		return service.ErrUserNotFound
+	}
+
+	// User 7 has reservations that haven't ended
+	if id == 7 && !force {
+		return service.ErrUserHasReservations
+	}
+
+	return nil
+}
+
+func (t TestUser) GetDeletedUsers(ctx context.Context) (dto.DeletedUsersDto, error) {
+	return dto.DeletedUsersDto{{UserDto: dto.UserDto{Id: 3, Email: "jim@email.com"}, DeletedAt: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}}, nil
+}
+
+func (t TestUser) RestoreUser(ctx context.Context, id int) error {
+
+	if id > 10 {
+		return service.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func patchUser(contentType string, body string) (*httptest.ResponseRecorder, dto.UserDto, dto.ProblemDto) {
+	r := newErrorTestRouter()
+	r.PATCH("/user/:id", PatchUser)
+
+	req, _ := http.NewRequest(http.MethodPatch, "/user/1", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var userDto dto.UserDto
+	var problem dto.ProblemDto
+
+	if w.Code == http.StatusOK {
+		json.Unmarshal(w.Body.Bytes(), &userDto)
+	} else {
+		json.Unmarshal(w.Body.Bytes(), &problem)
+	}
+
+	return w, userDto, problem
+}
+
+func TestPatchUser_Controller_MergePatch(t *testing.T) {
+	a := assert.New(t)
+
+	w, userDto, _ := patchUser("application/merge-patch+json", `{"name": "Johnny"}`)
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(dto.UserDto{Id: 1, Name: "Johnny", LastName: "Doe", Dni: "12345678", Email: "john@email.com", Role: "Customer"}, userDto)
+
+	// Plain JSON is taken as a merge patch
+	w, userDto, _ = patchUser("application/json", `{"email": "johnny@email.com"}`)
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("johnny@email.com", userDto.Email)
+	a.Equal("John", userDto.Name)
+}
+
+func TestPatchUser_Controller_JSONPatch(t *testing.T) {
+	a := assert.New(t)
+
+	w, userDto, _ := patchUser("application/json-patch+json", `[
+		{"op": "test", "path": "/email", "value": "john@email.com"},
+		{"op": "replace", "path": "/last_name", "value": "Smith"}
+	]`)
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("Smith", userDto.LastName)
+	a.Equal("John", userDto.Name)
+
+	w, _, problem := patchUser("application/json-patch+json", `[{"op": "test", "path": "/email", "value": "other@email.com"}]`)
+
+	a.Equal(http.StatusConflict, w.Code)
+	a.Equal("patch_test_failed", problem.Code)
+
+	w, _, problem = patchUser("application/json-patch+json", `[{"op": "remove", "path": "/nickname"}]`)
+
+	a.Equal(http.StatusUnprocessableEntity, w.Code)
+	a.Equal("patch_not_applicable", problem.Code)
+}
+
+func TestPatchUser_Controller_Invalid(t *testing.T) {
+	a := assert.New(t)
+
+	// The merged profile is validated as a whole
+	w, _, problem := patchUser("application/merge-patch+json", `{"name": null, "dni": "12"}`)
+
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("validation_failed", problem.Code)
+	a.ElementsMatch([]string{"name", "dni"}, []string{problem.Errors[0].Field, problem.Errors[1].Field})
+
+	// The role and password are not part of the profile
+	w, _, problem = patchUser("application/merge-patch+json", `{"role": "Admin"}`)
+
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("invalid_body", problem.Code)
+
+	w, _, problem = patchUser("application/merge-patch+json", `{"name": `)
+
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("invalid_patch", problem.Code)
+
+	w, _, problem = patchUser("text/plain", `name=Johnny`)
+
+	a.Equal(http.StatusUnsupportedMediaType, w.Code)
+	a.Equal("unsupported_media_type", problem.Code)
+
+	w, _, problem = patchUser("application/merge-patch+json", `{"email": "taken@email.com"}`)
+
+	a.Equal(http.StatusConflict, w.Code)
+	a.Equal("email_registered", problem.Code)
+}
+
+func TestDeleteUser_Controller(t *testing.T) {
+	a := assert.New(t)
+
+	r := newErrorTestRouter()
+	r.DELETE("/user/:id", DeleteUser)
+
+	for _, test := range []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/user/1", http.StatusOK, ""},
+		{"/user/12", http.StatusNotFound, "user_not_found"},
+		{"/user/7", http.StatusConflict, "user_has_reservations"},
+		{"/user/7?force=true", http.StatusOK, ""},
+	} {
+		req, _ := http.NewRequest(http.MethodDelete, test.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var problem dto.ProblemDto
+		json.Unmarshal(w.Body.Bytes(), &problem)
+
+		a.Equal(test.status, w.Code, test.path)
+		a.Equal(test.code, problem.Code, test.path)
+	}
+}
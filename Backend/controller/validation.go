@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"project/auth"
+	"project/dto"
+	"project/service"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// Dates travel as strings, see model/reservation.go
+const dateLayout = "02-01-2006 15:04"
+
+var dniPattern = regexp.MustCompile(`^[0-9]{7,8}$`)
+
+// validate checks the `validate` tags of the dtos, field errors are named after their json keys
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+
+	v.RegisterTagNameFunc(fieldName)
+
+	v.RegisterValidation("date", isDate)
+	v.RegisterValidation("future", isFutureDate)
+	v.RegisterValidation("after", isAfterField)
+	v.RegisterValidation("password", isStrongPassword)
+	v.RegisterValidation("dni", isDni)
+	v.RegisterValidation("role", isRole)
+
+	return v
+}
+
+// bindJSON decodes the body into obj and validates it, on failure the error is
+// recorded for the ErrorHandler and false is returned
+func bindJSON(c *gin.Context, obj any) bool {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return false
+	}
+
+	return check(c, validateStruct(obj))
+}
+
+// bindQuery is bindJSON for query parameters
+func bindQuery(c *gin.Context, obj any) bool {
+	if err := c.ShouldBindQuery(obj); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return false
+	}
+
+	return check(c, validateStruct(obj))
+}
+
+func check(c *gin.Context, err error) bool {
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+
+	return true
+}
+
+// validateStruct validates a dto, or every dto of a slice
+func validateStruct(obj any) error {
+	var err error
+
+	if reflect.Indirect(reflect.ValueOf(obj)).Kind() == reflect.Slice {
+		err = validate.Var(obj, "dive")
+	} else {
+		err = validate.Struct(obj)
+	}
+
+	var validationErrors validator.ValidationErrors
+
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	var fields dto.FieldErrorsDto
+
+	for _, fieldError := range validationErrors {
+		fields = append(fields, dto.FieldErrorDto{
+			Field:   fieldPath(fieldError),
+			Code:    fieldError.Tag(),
+			Message: fieldMessage(fieldError),
+		})
+	}
+
+	return service.ErrValidation.WithFields(fields...)
+}
+
+// fieldPath drops the struct name from the namespace, "UserDto.email" becomes "email"
+func fieldPath(fieldError validator.FieldError) string {
+	namespace := fieldError.Namespace()
+
+	if i := strings.Index(namespace, "."); i >= 0 && !strings.HasPrefix(namespace, "[") {
+		return namespace[i+1:]
+	}
+
+	return namespace
+}
+
+func fieldMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required", "required_without":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "password":
+		return "must be 8 to 72 characters long and contain letters and numbers"
+	case "dni":
+		return "must be 7 or 8 digits"
+	case "role":
+		return "must be one of " + strings.Join(auth.Roles, ", ")
+	case "date":
+		return "must be formatted as DD-MM-YYYY hh:mm"
+	case "future":
+		return "must not be in the past"
+	case "after":
+		return "must be after " + fieldError.Param()
+	case "gt":
+		return "must be greater than " + fieldError.Param()
+	case "gte":
+		return "must be greater than or equal to " + fieldError.Param()
+	case "max":
+		if fieldError.Kind() != reflect.String {
+			return "must be at most " + fieldError.Param()
+		}
+		return fmt.Sprintf("must be at most %s characters long", fieldError.Param())
+	default:
+		return "is invalid"
+	}
+}
+
+// fieldName is the json key of a field, or its query key for query dtos
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+
+		if name == "-" {
+			return ""
+		}
+
+		if name != "" {
+			return name
+		}
+	}
+
+	return field.Name
+}
+
+func isDate(fl validator.FieldLevel) bool {
+	_, err := time.Parse(dateLayout, fl.Field().String())
+
+	return err == nil
+}
+
+func isFutureDate(fl validator.FieldLevel) bool {
+	return notBefore(fl.Field().String(), time.Now())
+}
+
+// notBefore tells whether the date isn't before now. Dates carry no zone, they
+// are read as wall clock time where now is.
+func notBefore(value string, now time.Time) bool {
+	date, err := time.ParseInLocation(dateLayout, value, now.Location())
+
+	// Badly formatted dates are reported by the date tag
+	if err != nil {
+		return true
+	}
+
+	return !date.Before(now.Truncate(time.Minute))
+}
+
+// isAfterField checks the date is after the date in the sibling field named by the
+// tag parameter, e.g. `validate:"after=start_date"`
+func isAfterField(fl validator.FieldLevel) bool {
+	parent := fl.Parent()
+
+	for parent.Kind() == reflect.Pointer {
+		parent = parent.Elem()
+	}
+
+	for i := 0; i < parent.NumField(); i++ {
+		if fieldName(parent.Type().Field(i)) != fl.Param() {
+			continue
+		}
+
+		start, startErr := time.Parse(dateLayout, parent.Field(i).String())
+		end, endErr := time.Parse(dateLayout, fl.Field().String())
+
+		if startErr != nil || endErr != nil {
+			return true
+		}
+
+		return end.After(start)
+	}
+
+	return false
+}
+
+// isStrongPassword requires 8 to 72 characters (bcrypt ignores the rest) with at least a letter and a number
+func isStrongPassword(fl validator.FieldLevel) bool {
+	password := fl.Field().String()
+
+	if len(password) < 8 || len(password) > 72 {
+		return false
+	}
+
+	var letter, number bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			number = true
+		}
+	}
+
+	return letter && number
+}
+
+func isDni(fl validator.FieldLevel) bool {
+	return dniPattern.MatchString(fl.Field().String())
+}
+
+func isRole(fl validator.FieldLevel) bool {
+	return auth.ValidRole(fl.Field().String())
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"github.com/stretchr/testify/assert"
+	"project/dto"
+	"project/service"
+	"testing"
+	"time"
+)
+
+func fieldCodes(err error) map[string]string {
+	codes := map[string]string{}
+
+	if serviceError, ok := err.(*service.Error); ok {
+		for _, field := range serviceError.Fields {
+			codes[field.Field] = field.Code
+		}
+	}
+
+	return codes
+}
+
+func TestValidateStruct_User(t *testing.T) {
+	a := assert.New(t)
+
+	valid := dto.UserDto{Name: "John", LastName: "Doe", Dni: "12345678", Email: "johndoe@email.com", Password: "secret123"}
+	a.Nil(validateStruct(&valid))
+
+	tests := []struct {
+		name   string
+		modify func(*dto.UserDto)
+		field  string
+		code   string
+	}{
+		{"empty password", func(u *dto.UserDto) { u.Password = "" }, "password", "required"},
+		{"short password", func(u *dto.UserDto) { u.Password = "abc12" }, "password", "password"},
+		{"password without numbers", func(u *dto.UserDto) { u.Password = "secretsecret" }, "password", "password"},
+		{"malformed email", func(u *dto.UserDto) { u.Email = "johndoe" }, "email", "email"},
+		{"dni with letters", func(u *dto.UserDto) { u.Dni = "12A45678" }, "dni", "dni"},
+		{"short dni", func(u *dto.UserDto) { u.Dni = "12345" }, "dni", "dni"},
+		{"missing name", func(u *dto.UserDto) { u.Name = "" }, "name", "required"},
+	}
+
+	for _, test := range tests {
+		user := valid
+		test.modify(&user)
+
+		err := validateStruct(&user)
+
+		a.ErrorIs(err, service.ErrValidation, test.name)
+		a.Equal(map[string]string{test.field: test.code}, fieldCodes(err), test.name)
+	}
+}
+
+func TestValidateStruct_Reservation(t *testing.T) {
+	a := assert.New(t)
+
+	start := time.Now().Add(72 * time.Hour)
+	valid := dto.ReservationDto{
+		StartDate: start.Format(dateLayout),
+		EndDate:   start.Add(48 * time.Hour).Format(dateLayout),
+		UserId:    1,
+		HotelId:   1,
+	}
+	a.Nil(validateStruct(&valid))
+
+	tests := []struct {
+		name   string
+		modify func(*dto.ReservationDto)
+		field  string
+		code   string
+	}{
+		{"missing hotel", func(r *dto.ReservationDto) { r.HotelId = 0 }, "hotel_id", "required"},
+		{"negative user", func(r *dto.ReservationDto) { r.UserId = -1 }, "user_id", "gt"},
+		{"bad format", func(r *dto.ReservationDto) { r.EndDate = "2030-01-01" }, "end_date", "date"},
+		{"in the past", func(r *dto.ReservationDto) { r.StartDate = "01-01-2020 10:00" }, "start_date", "future"},
+		{"ends before start", func(r *dto.ReservationDto) { r.EndDate = r.StartDate }, "end_date", "after"},
+	}
+
+	for _, test := range tests {
+		reservation := valid
+		test.modify(&reservation)
+
+		err := validateStruct(&reservation)
+
+		a.ErrorIs(err, service.ErrValidation, test.name)
+		a.Equal(map[string]string{test.field: test.code}, fieldCodes(err), test.name)
+	}
+}
+
+func TestNotBefore_Zone(t *testing.T) {
+	a := assert.New(t)
+
+	// 09:30 east of UTC is still the day before in UTC
+	now := time.Date(2030, 6, 1, 9, 30, 0, 0, time.FixedZone("AEST", 10*60*60))
+
+	a.True(notBefore("01-06-2030 09:30", now))
+	a.True(notBefore("01-06-2030 18:00", now))
+	a.False(notBefore("01-06-2030 08:30", now))
+	a.False(notBefore("31-05-2030 23:30", now))
+
+	// And west of it, already the next day in UTC
+	now = time.Date(2030, 6, 1, 20, 0, 0, 0, time.FixedZone("EDT", -4*60*60))
+
+	a.True(notBefore("01-06-2030 21:00", now))
+	a.False(notBefore("01-06-2030 19:00", now))
+}
+
+func TestValidateStruct_Hotel(t *testing.T) {
+	a := assert.New(t)
+
+	hotel := dto.HotelDto{Name: "Hotel", RoomAmount: -1, Description: "Description", StreetName: "Street", StreetNumber: 1, Rate: 0, Amenities: []string{"Pool", ""}}
+
+	err := validateStruct(&hotel)
+
+	a.ErrorIs(err, service.ErrValidation)
+	a.Equal(map[string]string{"room_amount": "gt", "rate": "required", "amenities[1]": "required"}, fieldCodes(err))
+}
+
+func TestValidateStruct_Images(t *testing.T) {
+	a := assert.New(t)
+
+	err := validateStruct(dto.ImagesDto{{Path: "Images/1.jpg", HotelId: 1}, {Path: "Images/2.jpg"}})
+
+	a.ErrorIs(err, service.ErrValidation)
+	a.Equal(map[string]string{"[1].hotel_id": "required"}, fieldCodes(err))
+}
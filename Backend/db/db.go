@@ -1,45 +1,192 @@
 package db
 
 import (
-	"os"
+	"context"
+	"database/sql"
+	"fmt"
 	"project/client"
-	"project/model"
+	"project/config"
+	"time"
 
-	log "github.com/sirupsen/logrus"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+const (
+	MySQL    = "mysql"
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
 var (
-	Db  *gorm.DB
-	err error
+	Db *gorm.DB
 )
 
-func init() {
+// Open opens a connection using the given driver (mysql, postgres or sqlite)
+func Open(driver string, dsn string) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+
+	switch driver {
+	case MySQL, "":
+		dialector = mysql.Open(dsn)
+	case Postgres:
+		dialector = postgres.Open(dsn)
+	case SQLite:
+		dialector = sqlite.Open(dsn)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+
+	return gorm.Open(dialector, &gorm.Config{TranslateError: true})
+}
+
+// Connect opens the configured database and hands it to every client. Failed
+// attempts are retried with exponential backoff until the connect timeout, so
+// the API survives a database that starts after it.
+func Connect(cfg config.DatabaseConfig) error {
+	pool := PoolConfig{
+		MaxOpenConns:    cfg.MaxOpenConns,
+		MaxIdleConns:    cfg.MaxIdleConns,
+		ConnMaxLifetime: cfg.ConnMaxLifetime.Duration,
+		QueryTimeout:    cfg.QueryTimeout.Duration,
+	}
+	deadline := time.Now().Add(cfg.ConnectTimeout.Duration)
+	backoff := 500 * time.Millisecond
+
+	for {
+		conn, err := Open(cfg.Driver, cfg.Dsn)
+
+		if err == nil {
+			err = configure(conn, pool)
+		}
+
+		if err == nil {
+			log.Info("Connection Established")
+			Use(conn)
+			return nil
+		}
+
+		// Open may succeed and the checks after it fail, its pool goes with it
+		if conn != nil {
+			if sqlDb, dbErr := conn.DB(); dbErr == nil {
+				sqlDb.Close()
+			}
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			log.Info("Connection Failed to Open")
+			return err
+		}
+
+		log.Warn("Connection Failed to Open, retrying in ", backoff, ": ", err)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > 10*time.Second {
+			backoff = 10 * time.Second
+		}
+	}
+}
 
-	dsn := os.Getenv("DBCONNSTRING")
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	QueryTimeout    time.Duration
+}
 
-	Db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+func configure(conn *gorm.DB, pool PoolConfig) error {
+	sqlDb, err := conn.DB()
 
 	if err != nil {
-		log.Info("Connection Failed to Open")
-		log.Fatal(err)
-	} else {
-		log.Info("Connection Established")
+		return err
+	}
+
+	sqlDb.SetMaxOpenConns(pool.MaxOpenConns)
+	sqlDb.SetMaxIdleConns(pool.MaxIdleConns)
+	sqlDb.SetConnMaxLifetime(pool.ConnMaxLifetime)
+
+	if err := sqlDb.Ping(); err != nil {
+		return err
+	}
+
+	if err := registerMetrics(conn); err != nil {
+		return err
+	}
+
+	if err := registerTracing(conn); err != nil {
+		return err
+	}
+
+	if pool.QueryTimeout > 0 {
+		return registerQueryTimeout(conn, pool.QueryTimeout)
+	}
+
+	return nil
+}
+
+// Ping checks the database answers before the context is done
+func Ping(ctx context.Context) error {
+	if Db == nil {
+		return fmt.Errorf("database not connected")
+	}
+
+	sqlDb, err := Db.DB()
+
+	if err != nil {
+		return err
+	}
+
+	return sqlDb.PingContext(ctx)
+}
+
+// Stats returns the connection pool statistics
+func Stats() (sql.DBStats, error) {
+	if Db == nil {
+		return sql.DBStats{}, fmt.Errorf("database not connected")
+	}
+
+	sqlDb, err := Db.DB()
+
+	if err != nil {
+		return sql.DBStats{}, err
+	}
+
+	return sqlDb.Stats(), nil
+}
+
+// Close closes the connection pool once the server has stopped
+func Close() error {
+	if Db == nil {
+		return nil
+	}
+
+	sqlDb, err := Db.DB()
+
+	if err != nil {
+		return err
 	}
 
+	return sqlDb.Close()
+}
+
+// Use sets the connection shared by the db and client packages
+func Use(conn *gorm.DB) {
+	Db = conn
+
 	// Add all clients here
 	client.Db = Db
-
 }
 
 func StartDbEngine() {
-	// Migrate all model classes
-	Db.AutoMigrate(&model.Hotel{})
-	Db.AutoMigrate(&model.Reservation{})
-	Db.AutoMigrate(&model.User{})
-	Db.AutoMigrate(&model.Amenity{})
-	Db.AutoMigrate(&model.Image{})
+	// Apply pending migrations, see migrations.go
+	err := MigrateUp()
+
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	log.Info("Finishing Migration Database Tables")
 }
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"project/client"
+	"project/metrics"
+	"project/tracing"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"gorm.io/gorm"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	a := assert.New(t)
+
+	conn, err := Open(SQLite, "file:timeout?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("Connection failed to open: %v", err)
+	}
+	a.Nil(configure(conn, PoolConfig{MaxOpenConns: 1, MaxIdleConns: 1, QueryTimeout: time.Second}))
+	Use(conn)
+
+	// Migrations aren't bounded, not even the lock wait
+	var bounded bool
+	a.Nil(conn.Callback().Raw().After("timeout:before_raw").Register("test:migration_deadline", func(tx *gorm.DB) {
+		_, deadline := tx.Statement.Context.Deadline()
+		bounded = bounded || deadline
+	}))
+
+	a.Nil(MigrateUp())
+	a.False(bounded)
+	a.Nil(conn.Callback().Raw().Remove("test:migration_deadline"))
+
+	// Statements chained on one session keep working after the previous one's timeout is released
+	tx := Db.WithContext(context.Background()).Model(&draftHotel{})
+	a.Nil(tx.Exec("INSERT INTO hotels (name, room_amount, rate) VALUES ('Hotel', 1, 10)").Error)
+	a.Nil(tx.Exec("INSERT INTO hotels (name, room_amount, rate) VALUES ('Hotel', 1, 10)").Error)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var count int64
+	a.NotNil(Db.WithContext(ctx).Table("hotels").Count(&count).Error)
+	a.Nil(Db.WithContext(context.Background()).Table("hotels").Count(&count).Error)
+	a.Equal(int64(2), count)
+
+	// Rows read after the callbacks are bounded too
+	var scanCtx context.Context
+	a.Nil(conn.Callback().Row().After("timeout:before_row").Register("test:row_deadline", func(tx *gorm.DB) {
+		scanCtx = tx.Statement.Context
+	}))
+
+	count = 0
+	tx = Db.Raw("SELECT count(*) FROM hotels")
+	a.Nil(tx.Row().Scan(&count))
+	_, deadline := scanCtx.Deadline()
+	a.True(deadline)
+	a.Nil(scanCtx.Err())
+	a.Equal(int64(2), count)
+
+	// and their timeout is released once the scan is done
+	Release(tx)
+	a.Equal(context.Canceled, scanCtx.Err())
+
+	stats, err := Stats()
+	a.Nil(err)
+	a.Equal(1, stats.MaxOpenConnections)
+}
+
+func TestQueryMetrics(t *testing.T) {
+	a := assert.New(t)
+
+	conn, err := Open(SQLite, "file:metrics?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("Connection failed to open: %v", err)
+	}
+	a.Nil(configure(conn, PoolConfig{MaxOpenConns: 1, MaxIdleConns: 1}))
+	Use(conn)
+
+	a.Nil(MigrateUp())
+
+	queries := testutil.CollectAndCount(metrics.DbQueryDuration)
+	failures := metrics.DbQueryErrors.WithLabelValues("query", "hotels")
+	before := testutil.ToFloat64(failures)
+
+	var hotels []draftHotel
+	a.Nil(Db.Table("hotels").Find(&hotels).Error)
+	a.NotNil(Db.Table("hotels").Where("missing_column = 1").Find(&hotels).Error)
+
+	// A missing record is not an error
+	a.NotNil(Db.Table("hotels").First(&draftHotel{}).Error)
+
+	a.Equal(before+1, testutil.ToFloat64(failures))
+	a.GreaterOrEqual(testutil.CollectAndCount(metrics.DbQueryDuration), queries)
+	a.Equal(1, testutil.CollectAndCount(poolCollector{}, "miranda_db_pool_max_open_connections"))
+}
+
+func TestQueryTracing(t *testing.T) {
+	a := assert.New(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	conn, err := Open(SQLite, "file:tracing?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("Connection failed to open: %v", err)
+	}
+	a.Nil(configure(conn, PoolConfig{MaxOpenConns: 1, MaxIdleConns: 1, QueryTimeout: time.Second}))
+	Use(conn)
+
+	a.Nil(MigrateUp())
+
+	ctx, span := tracing.Start(context.Background(), "HotelService.GetHotels")
+	_, err = client.HotelClient.GetHotels(ctx)
+	span.End()
+	a.Nil(err)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, ended := range recorder.Ended() {
+		spans[ended.Name()] = ended
+	}
+
+	// Queries nest under the client span, which nests under the service span
+	a.Equal(spans["HotelService.GetHotels"].SpanContext().SpanID(), spans["HotelClient.GetHotels"].Parent().SpanID())
+	a.Equal(spans["HotelClient.GetHotels"].SpanContext().SpanID(), spans["db.query"].Parent().SpanID())
+	a.Contains(spans["db.query"].Attributes(), attribute.String("db.sql.table", "hotels"))
+}
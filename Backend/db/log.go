@@ -0,0 +1,5 @@
+package db
+
+import "project/logging"
+
+var log = logging.Package("db")
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"errors"
+	"project/metrics"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+const startKey = "db:query_start"
+
+// registerMetrics times every statement and counts the ones that fail. A
+// missing record is an expected outcome and isn't counted as an error.
+func registerMetrics(conn *gorm.DB) error {
+	callbacks := conn.Callback()
+
+	before := func(tx *gorm.DB) {
+		tx.Statement.Settings.Store(startKey, time.Now())
+	}
+
+	after := func(operation string) func(tx *gorm.DB) {
+		return func(tx *gorm.DB) {
+			value, ok := tx.Statement.Settings.LoadAndDelete(startKey)
+
+			if !ok {
+				return
+			}
+
+			table := tx.Statement.Table
+			if table == "" {
+				table = "none"
+			}
+
+			metrics.DbQueryDuration.WithLabelValues(operation, table).Observe(time.Since(value.(time.Time)).Seconds())
+
+			if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+				metrics.DbQueryErrors.WithLabelValues(operation, table).Inc()
+			}
+		}
+	}
+
+	if err := callbacks.Create().Before("*").Register("metrics:before_create", before); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("*").Register("metrics:after_create", after("create")); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("*").Register("metrics:before_query", before); err != nil {
+		return err
+	}
+	if err := callbacks.Query().After("*").Register("metrics:after_query", after("query")); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("*").Register("metrics:before_update", before); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("*").Register("metrics:after_update", after("update")); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("*").Register("metrics:before_delete", before); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("*").Register("metrics:after_delete", after("delete")); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("*").Register("metrics:before_row", before); err != nil {
+		return err
+	}
+	if err := callbacks.Row().After("*").Register("metrics:after_row", after("row")); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("*").Register("metrics:before_raw", before); err != nil {
+		return err
+	}
+
+	return callbacks.Raw().After("*").Register("metrics:after_raw", after("raw"))
+}
+
+// poolCollector reads the pool statistics of the current connection on every scrape
+type poolCollector struct{}
+
+var (
+	poolMaxOpen = prometheus.NewDesc("miranda_db_pool_max_open_connections",
+		"Maximum number of open connections to the database.", nil, nil)
+	poolOpen = prometheus.NewDesc("miranda_db_pool_open_connections",
+		"Established connections, in use and idle.", nil, nil)
+	poolInUse = prometheus.NewDesc("miranda_db_pool_in_use_connections",
+		"Connections currently in use.", nil, nil)
+	poolIdle = prometheus.NewDesc("miranda_db_pool_idle_connections",
+		"Idle connections.", nil, nil)
+	poolWaitCount = prometheus.NewDesc("miranda_db_pool_wait_count_total",
+		"Connections waited for.", nil, nil)
+	poolWaitDuration = prometheus.NewDesc("miranda_db_pool_wait_duration_seconds_total",
+		"Time blocked waiting for a new connection.", nil, nil)
+	poolMaxIdleClosed = prometheus.NewDesc("miranda_db_pool_max_idle_closed_total",
+		"Connections closed because of the idle limit.", nil, nil)
+	poolMaxLifetimeClosed = prometheus.NewDesc("miranda_db_pool_max_lifetime_closed_total",
+		"Connections closed because of the maximum lifetime.", nil, nil)
+)
+
+func (poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolMaxOpen
+	ch <- poolOpen
+	ch <- poolInUse
+	ch <- poolIdle
+	ch <- poolWaitCount
+	ch <- poolWaitDuration
+	ch <- poolMaxIdleClosed
+	ch <- poolMaxLifetimeClosed
+}
+
+func (poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := Stats()
+
+	if err != nil {
+		// Nothing to report until the database is connected
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(poolMaxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(poolOpen, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(poolInUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(poolIdle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(poolWaitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(poolWaitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(poolMaxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(poolMaxLifetimeClosed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+}
+
+func init() {
+	metrics.Registry.MustRegister(poolCollector{})
+}
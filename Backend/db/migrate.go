@@ -0,0 +1,310 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const migrationLock = "schema_migrations"
+
+// migrating keeps migrations in the same process from running at once, the
+// database lock only tells processes apart on MySQL and PostgreSQL
+var migrating sync.Mutex
+
+// Migration is a single, ordered schema change. Down must undo exactly what Up did.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey; autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(300); not null"`
+	Checksum  string    `gorm:"type:varchar(64); not null; default:''"` //Empty for migrations applied before checksums were kept
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// checksum identifies the migration once applied, so one renumbered or
+// renamed afterwards is noticed instead of silently skipped or applied again
+func (m Migration) checksum() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", m.Version, m.Name)))
+	return hex.EncodeToString(sum[:])
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// MigrateUp applies every pending migration
+func MigrateUp() error {
+	return MigrateTo(latestVersion())
+}
+
+// MigrateDown rolls back the latest applied migration
+func MigrateDown() error {
+	return withMigrationLock(func(conn *gorm.DB) error {
+		applied, err := appliedVersions(conn)
+
+		if err != nil {
+			return err
+		}
+
+		if len(applied) == 0 {
+			log.Info("No migrations to roll back")
+			return nil
+		}
+
+		return migrateTo(conn, applied[len(applied)-1].Version-1)
+	})
+}
+
+// MigrateTo applies or rolls back migrations until the schema is at the given version
+func MigrateTo(version int) error {
+	if version < 0 || version > latestVersion() {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return withMigrationLock(func(conn *gorm.DB) error {
+		return migrateTo(conn, version)
+	})
+}
+
+func GetMigrationStatus() ([]MigrationStatus, error) {
+	var status []MigrationStatus
+
+	if err := Db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return status, err
+	}
+
+	applied, err := appliedVersions(Db)
+
+	if err != nil {
+		return status, err
+	}
+
+	appliedAt := make(map[int]time.Time)
+	for _, migration := range applied {
+		appliedAt[migration.Version] = migration.AppliedAt
+	}
+
+	for _, migration := range sortedMigrations() {
+		entry := MigrationStatus{Version: migration.Version, Name: migration.Name}
+
+		if at, ok := appliedAt[migration.Version]; ok {
+			entry.AppliedAt = &at
+		}
+
+		status = append(status, entry)
+	}
+
+	return status, nil
+}
+
+// SchemaVersion returns the latest applied migration version, ctx bounds the query
+func SchemaVersion(ctx context.Context) (int, error) {
+	applied, err := appliedVersions(Db.WithContext(ctx))
+
+	if err != nil || len(applied) == 0 {
+		return 0, err
+	}
+
+	return applied[len(applied)-1].Version, nil
+}
+
+func LatestSchemaVersion() int {
+	return latestVersion()
+}
+
+func migrateTo(conn *gorm.DB, version int) error {
+	applied, err := appliedVersions(conn)
+
+	if err != nil {
+		return err
+	}
+
+	if err := verifyApplied(applied); err != nil {
+		return err
+	}
+
+	isApplied := make(map[int]bool)
+	for _, migration := range applied {
+		isApplied[migration.Version] = true
+	}
+
+	migrations := sortedMigrations()
+
+	// Roll back newest first
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+
+		if migration.Version <= version || !isApplied[migration.Version] {
+			continue
+		}
+
+		log.Info("Rolling back migration ", migration.Version, " ", migration.Name)
+
+		err := conn.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+
+			return tx.Delete(&SchemaMigration{Version: migration.Version}).Error
+		})
+
+		if err != nil {
+			return fmt.Errorf("rolling back migration %d: %w", migration.Version, err)
+		}
+	}
+
+	for _, migration := range migrations {
+
+		if migration.Version > version || isApplied[migration.Version] {
+			continue
+		}
+
+		log.Info("Applying migration ", migration.Version, " ", migration.Name)
+
+		err := conn.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+
+			return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, Checksum: migration.checksum(), AppliedAt: time.Now()}).Error
+		})
+
+		if err != nil {
+			return fmt.Errorf("applying migration %d: %w", migration.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// verifyApplied checks the applied migrations are the ones this build has.
+// Versions it doesn't know are left alone, a newer build applied them.
+func verifyApplied(applied []SchemaMigration) error {
+	known := make(map[int]Migration)
+	for _, migration := range migrations {
+		known[migration.Version] = migration
+	}
+
+	for _, migration := range applied {
+		registered, ok := known[migration.Version]
+
+		if !ok {
+			log.Warn("Migration ", migration.Version, " ", migration.Name, " is applied but unknown to this build")
+			continue
+		}
+
+		if migration.Checksum != "" && migration.Checksum != registered.checksum() {
+			return fmt.Errorf("migration %d was applied as %q and has changed since to %q", migration.Version, migration.Name, registered.Name)
+		}
+	}
+
+	return nil
+}
+
+// withMigrationLock runs fn on a single connection holding a database wide lock,
+// so only one instance migrates at a time
+func withMigrationLock(fn func(conn *gorm.DB) error) error {
+	migrating.Lock()
+	defer migrating.Unlock()
+
+	// Neither the lock wait nor the DDL is bounded by the query timeout
+	ctx := withoutQueryTimeout(context.Background())
+
+	return Db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		// New session so statements run on conn don't leak into each other
+		conn = conn.Session(&gorm.Session{})
+
+		unlock, err := lockMigrations(conn)
+
+		if err != nil {
+			return err
+		}
+
+		defer unlock()
+
+		if err := conn.AutoMigrate(&SchemaMigration{}); err != nil {
+			return err
+		}
+
+		return fn(conn)
+	})
+}
+
+func lockMigrations(conn *gorm.DB) (func(), error) {
+	switch conn.Dialector.Name() {
+	case MySQL:
+		var acquired int
+
+		err := conn.Raw("SELECT GET_LOCK(?, ?)", migrationLock, 300).Scan(&acquired).Error
+
+		if err != nil {
+			return nil, err
+		}
+
+		if acquired != 1 {
+			return nil, errors.New("timed out waiting for migration lock")
+		}
+
+		return func() { conn.Exec("SELECT RELEASE_LOCK(?)", migrationLock) }, nil
+	case Postgres:
+		err := conn.Exec("SELECT pg_advisory_lock(hashtext(?))", migrationLock).Error
+
+		if err != nil {
+			return nil, err
+		}
+
+		return func() { conn.Exec("SELECT pg_advisory_unlock(hashtext(?))", migrationLock) }, nil
+	default:
+		// SQLite serializes writers on the database file
+		return func() {}, nil
+	}
+}
+
+func appliedVersions(conn *gorm.DB) ([]SchemaMigration, error) {
+	var applied []SchemaMigration
+
+	err := conn.Order("version").Find(&applied).Error
+
+	return applied, err
+}
+
+func sortedMigrations() []Migration {
+	sorted := append([]Migration{}, migrations...)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return sorted
+}
+
+func latestVersion() int {
+	latest := 0
+
+	for _, migration := range migrations {
+		if migration.Version > latest {
+			latest = migration.Version
+		}
+	}
+
+	return latest
+}
@@ -0,0 +1,258 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestMigrate_UpDown(t *testing.T) {
+	a := assert.New(t)
+
+	conn, err := Open(SQLite, "file:migrate?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("Connection failed to open: %v", err)
+	}
+	Use(conn)
+
+	a.Nil(MigrateUp())
+
+	version, err := SchemaVersion(context.Background())
+	a.Nil(err)
+	a.Equal(LatestSchemaVersion(), version)
+	a.True(Db.Migrator().HasColumn(&draftHotel{}, "Draft"))
+	a.True(Db.Migrator().HasTable("idempotency_keys"))
+	a.True(Db.Migrator().HasColumn(&versionedHotel{}, "Version"))
+	a.True(Db.Migrator().HasIndex(&softDeletedReservation{}, "DeletedAt"))
+	a.True(Db.Migrator().HasTable("audit_entries"))
+	a.True(Db.Migrator().HasIndex(&softDeletedUser{}, "DeletedAt"))
+	a.True(Db.Migrator().HasTable("user_tokens"))
+	a.True(Db.Migrator().HasColumn(&verifiedUser{}, "EmailVerified"))
+	a.True(Db.Migrator().HasColumn(&disabledUser{}, "Disabled"))
+	a.True(Db.Migrator().HasTable("hotel_assignments"))
+	a.True(Db.Migrator().HasTable("user_mfas"))
+	a.True(Db.Migrator().HasIndex(&recoveryCode{}, "Hash"))
+	a.True(Db.Migrator().HasIndex(&externalIdentity{}, "idx_external_identity"))
+	a.True(Db.Migrator().HasTable("oidc_logins"))
+	a.True(Db.Migrator().HasColumn(&tokenVersionUser{}, "TokenVersion"))
+
+	a.Nil(MigrateDown())
+	a.False(Db.Migrator().HasColumn(&tokenVersionUser{}, "TokenVersion"))
+	a.True(Db.Migrator().HasTable("external_identities"))
+
+	a.Nil(MigrateTo(11))
+	a.False(Db.Migrator().HasTable("external_identities"))
+	a.False(Db.Migrator().HasTable("oidc_logins"))
+	a.True(Db.Migrator().HasTable("user_mfas"))
+
+	a.Nil(MigrateTo(10))
+	a.False(Db.Migrator().HasTable("user_mfas"))
+	a.False(Db.Migrator().HasTable("recovery_codes"))
+	a.True(Db.Migrator().HasTable("hotel_assignments"))
+
+	a.Nil(MigrateTo(9))
+	a.False(Db.Migrator().HasTable("hotel_assignments"))
+	a.True(Db.Migrator().HasColumn(&disabledUser{}, "Disabled"))
+
+	a.Nil(MigrateTo(8))
+	a.False(Db.Migrator().HasColumn(&disabledUser{}, "Disabled"))
+	a.True(Db.Migrator().HasColumn(&verifiedUser{}, "EmailVerified"))
+
+	a.Nil(MigrateTo(7))
+	a.False(Db.Migrator().HasColumn(&verifiedUser{}, "EmailVerified"))
+	a.True(Db.Migrator().HasIndex(&softDeletedUser{}, "DeletedAt"))
+	a.True(Db.Migrator().HasTable("user_tokens"))
+
+	a.Nil(MigrateTo(6))
+	a.False(Db.Migrator().HasTable("user_tokens"))
+	a.True(Db.Migrator().HasTable("audit_entries"))
+
+	a.Nil(MigrateTo(5))
+	a.False(Db.Migrator().HasTable("audit_entries"))
+	a.True(Db.Migrator().HasIndex(&softDeletedReservation{}, "DeletedAt"))
+
+	a.Nil(MigrateTo(4))
+	a.False(Db.Migrator().HasColumn(&softDeletedReservation{}, "DeletedAt"))
+
+	a.Nil(MigrateTo(3))
+	a.False(Db.Migrator().HasColumn(&versionedHotel{}, "Version"))
+	a.True(Db.Migrator().HasTable("idempotency_keys"))
+
+	a.Nil(MigrateTo(2))
+	a.False(Db.Migrator().HasTable("idempotency_keys"))
+	a.True(Db.Migrator().HasColumn(&draftHotel{}, "Draft"))
+
+	a.Nil(MigrateTo(1))
+	a.False(Db.Migrator().HasColumn(&draftHotel{}, "Draft"))
+
+	a.Nil(MigrateTo(0))
+	a.False(Db.Migrator().HasTable("hotels"))
+
+	status, err := GetMigrationStatus()
+	a.Nil(err)
+	a.Len(status, LatestSchemaVersion())
+	a.Nil(status[0].AppliedAt)
+
+	a.Nil(MigrateUp())
+	a.True(Db.Migrator().HasTable("hotels"))
+
+	a.NotNil(MigrateTo(LatestSchemaVersion() + 1))
+}
+
+// useMigrations runs the test on a database of its own, with the migrations
+// given in place of the ones of the build
+func useMigrations(t *testing.T, name string, replacement []Migration) {
+	conn, err := Open(SQLite, "file:"+name+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("Connection failed to open: %v", err)
+	}
+	Use(conn)
+
+	previous := migrations
+	migrations = replacement
+	t.Cleanup(func() { migrations = previous })
+}
+
+// createTable is a migration creating the table, Up also counts its runs
+func createTable(version int, table string, runs *int32) Migration {
+	return Migration{
+		Version: version,
+		Name:    "create_" + table,
+		Up: func(tx *gorm.DB) error {
+			if runs != nil {
+				atomic.AddInt32(runs, 1)
+			}
+
+			return tx.Exec("CREATE TABLE " + table + " (id integer)").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP TABLE " + table).Error
+		},
+	}
+}
+
+func TestMigrate_Versioning(t *testing.T) {
+	a := assert.New(t)
+
+	failing := createTable(3, "c", nil)
+	up := failing.Up
+	failing.Up = func(tx *gorm.DB) error {
+		if err := up(tx); err != nil {
+			return err
+		}
+
+		return errors.New("backfill failed")
+	}
+
+	// Registered out of order, applied by version
+	useMigrations(t, "versioning", []Migration{createTable(2, "b", nil), failing, createTable(1, "a", nil)})
+
+	a.Nil(MigrateTo(2))
+	a.True(Db.Migrator().HasTable("a"))
+	a.True(Db.Migrator().HasTable("b"))
+
+	status, err := GetMigrationStatus()
+	a.Nil(err)
+	a.Equal([]int{1, 2, 3}, []int{status[0].Version, status[1].Version, status[2].Version})
+	a.NotNil(status[1].AppliedAt)
+	a.Nil(status[2].AppliedAt)
+
+	// A failed migration is rolled back as a whole and not recorded
+	a.ErrorContains(MigrateUp(), "applying migration 3: backfill failed")
+	a.False(Db.Migrator().HasTable("c"))
+
+	version, err := SchemaVersion(context.Background())
+	a.Nil(err)
+	a.Equal(2, version)
+
+	a.Nil(MigrateDown())
+	a.False(Db.Migrator().HasTable("b"))
+	a.True(Db.Migrator().HasTable("a"))
+
+	version, _ = SchemaVersion(context.Background())
+	a.Equal(1, version)
+
+	a.ErrorContains(MigrateTo(-1), "unknown migration version")
+}
+
+func TestMigrate_Checksum(t *testing.T) {
+	a := assert.New(t)
+
+	useMigrations(t, "checksum", []Migration{createTable(1, "a", nil), createTable(2, "b", nil), createTable(3, "c", nil)})
+	a.Nil(MigrateUp())
+
+	var applied SchemaMigration
+	a.Nil(Db.First(&applied, 2).Error)
+	a.Equal(createTable(2, "b", nil).checksum(), applied.Checksum)
+
+	// A migration renamed after it was applied stops the others
+	renamed := createTable(2, "b", nil)
+	renamed.Name = "create_bookings"
+	migrations[1] = renamed
+
+	a.ErrorContains(MigrateUp(), `migration 2 was applied as "create_b"`)
+	a.ErrorContains(MigrateDown(), `migration 2 was applied as "create_b"`)
+
+	// Migrations applied before checksums were kept are trusted
+	a.Nil(Db.Model(&SchemaMigration{}).Where("version = ?", 2).Update("checksum", "").Error)
+	a.Nil(MigrateUp())
+
+	// Versions applied by a newer build are left alone
+	migrations = migrations[:2]
+	a.Nil(MigrateUp())
+
+	version, err := SchemaVersion(context.Background())
+	a.Nil(err)
+	a.Equal(3, version)
+	a.True(Db.Migrator().HasTable("c"))
+}
+
+func TestMigrate_Lock(t *testing.T) {
+	a := assert.New(t)
+
+	var runs int32
+	useMigrations(t, "lock", []Migration{createTable(1, "a", &runs), createTable(2, "b", &runs), createTable(3, "c", &runs)})
+
+	// Instances starting together apply each migration once
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			errs <- MigrateUp()
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		a.Nil(err)
+	}
+
+	a.Equal(int32(3), atomic.LoadInt32(&runs))
+
+	var count int64
+	a.Nil(Db.Model(&SchemaMigration{}).Count(&count).Error)
+	a.Equal(int64(3), count)
+
+	// The lock is released when a migration fails
+	migrations = append(migrations, Migration{
+		Version: 4,
+		Name:    "failing",
+		Up:      func(tx *gorm.DB) error { return errors.New("failed") },
+		Down:    func(tx *gorm.DB) error { return nil },
+	})
+
+	a.NotNil(MigrateUp())
+	a.Nil(MigrateTo(2))
+	a.False(Db.Migrator().HasTable("c"))
+}
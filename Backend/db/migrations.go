@@ -0,0 +1,410 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migrations never import project/model: each one keeps a snapshot of the
+// tables it touches so that later model changes don't rewrite history.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&baselineHotel{}, &baselineReservation{}, &baselineUser{},
+				&baselineAmenity{}, &baselineImage{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("hotel_amenities", "images", "reservations", "hotels", "users", "amenities")
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add_hotel_draft",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&draftHotel{}, "Draft") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&draftHotel{}, "Draft")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&draftHotel{}, "Draft")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add_idempotency_keys",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&idempotencyKey{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&idempotencyKey{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add_hotel_version",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&versionedHotel{}, "Version") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&versionedHotel{}, "Version")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&versionedHotel{}, "Version")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_soft_delete",
+		Up: func(tx *gorm.DB) error {
+			for _, table := range []any{&softDeletedHotel{}, &softDeletedUser{}, &softDeletedReservation{}} {
+				if tx.Migrator().HasColumn(table, "DeletedAt") {
+					continue
+				}
+
+				if err := tx.Migrator().AddColumn(table, "DeletedAt"); err != nil {
+					return err
+				}
+
+				if err := tx.Migrator().CreateIndex(table, "DeletedAt"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, table := range []any{&softDeletedHotel{}, &softDeletedUser{}, &softDeletedReservation{}} {
+				if err := tx.Migrator().DropIndex(table, "DeletedAt"); err != nil {
+					return err
+				}
+
+				if err := tx.Migrator().DropColumn(table, "DeletedAt"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add_audit_entries",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&auditEntry{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&auditEntry{})
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add_user_tokens",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&userToken{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&userToken{})
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add_user_email_verified",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&verifiedUser{}, "EmailVerified") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&verifiedUser{}, "EmailVerified")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropUserColumn(tx, &verifiedUser{}, "EmailVerified")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add_user_disabled",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&disabledUser{}, "Disabled") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&disabledUser{}, "Disabled")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropUserColumn(tx, &disabledUser{}, "Disabled")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add_hotel_assignments",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&hotelAssignment{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&hotelAssignment{})
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add_user_mfa",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&userMfa{}, &recoveryCode{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&recoveryCode{}, &userMfa{})
+		},
+	},
+	{
+		Version: 12,
+		Name:    "add_external_identities",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&externalIdentity{}, &oidcLogin{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&oidcLogin{}, &externalIdentity{})
+		},
+	},
+	{
+		Version: 13,
+		Name:    "add_user_token_version",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&tokenVersionUser{}, "TokenVersion") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&tokenVersionUser{}, "TokenVersion")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropUserColumn(tx, &tokenVersionUser{}, "TokenVersion")
+		},
+	},
+}
+
+// dropUserColumn drops a column of the users table. SQLite drops a column by
+// copying the table, which leaves its indexes behind, so they are created again.
+func dropUserColumn(tx *gorm.DB, value any, field string) error {
+	if err := tx.Migrator().DropColumn(value, field); err != nil {
+		return err
+	}
+
+	if tx.Migrator().HasIndex(&softDeletedUser{}, "DeletedAt") {
+		return nil
+	}
+	return tx.Migrator().CreateIndex(&softDeletedUser{}, "DeletedAt")
+}
+
+// Baseline: the schema as it was created by AutoMigrate
+
+type baselineHotel struct {
+	Id           int               `gorm:"primaryKey"`
+	Name         string            `gorm:"type:varchar(300); not null"`
+	RoomAmount   int               `gorm:"type:int; not null"`
+	Description  string            `gorm:"type:varchar(1000)"`
+	StreetName   string            `gorm:"type:varchar(100)"`
+	StreetNumber int               `gorm:"type:int"`
+	Rate         float64           `gorm:"type:decimal(8,2); not null"`
+	Images       []baselineImage   `gorm:"foreignKey:HotelId"`
+	Amenities    []baselineAmenity `gorm:"many2many:hotel_amenities; joinForeignKey:HotelId; joinReferences:AmenityId"`
+}
+
+func (baselineHotel) TableName() string { return "hotels" }
+
+type baselineReservation struct {
+	Id        int     `gorm:"primaryKey"`
+	StartDate string  `gorm:"type:varchar(16); not null"`
+	EndDate   string  `gorm:"type:varchar(16); not null"`
+	UserId    int     `gorm:"foreignkey:UserId"`
+	HotelId   int     `gorm:"foreignkey:HotelId"`
+	Amount    float64 `gorm:"type:decimal(10,2); not null"`
+}
+
+func (baselineReservation) TableName() string { return "reservations" }
+
+type baselineUser struct {
+	Id       int    `gorm:"primaryKey"`
+	Name     string `gorm:"type:varchar(300); not null"`
+	LastName string `gorm:"type:varchar(300); not null"`
+	Dni      string `gorm:"type:varchar(8); not null"`
+	Email    string `gorm:"type:varchar(300); unique"`
+	Password string `gorm:"type:varchar(300); not null"`
+	Role     string `gorm:"type:varchar(10); not null"`
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselineAmenity struct {
+	Id   int    `gorm:"primaryKey"`
+	Name string `gorm:"type:varchar(300); not null; unique"`
+}
+
+func (baselineAmenity) TableName() string { return "amenities" }
+
+type baselineImage struct {
+	Id      int    `gorm:"primaryKey"`
+	Path    string `gorm:"type:varchar(300); not null"`
+	HotelId int    `gorm:"foreignkey:HotelId"`
+}
+
+func (baselineImage) TableName() string { return "images" }
+
+// Version 2
+
+type draftHotel struct {
+	Draft bool `gorm:"not null; default:false"`
+}
+
+func (draftHotel) TableName() string { return "hotels" }
+
+// Version 3
+
+type idempotencyKey struct {
+	Id          string `gorm:"primaryKey; type:varchar(255)"`
+	Fingerprint string `gorm:"type:varchar(64); not null"`
+	Status      int    `gorm:"type:int; not null"`
+	ContentType string `gorm:"type:varchar(100)"`
+	Body        []byte
+	CreatedAt   time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null; index"`
+}
+
+func (idempotencyKey) TableName() string { return "idempotency_keys" }
+
+// Version 4
+
+type versionedHotel struct {
+	Version int `gorm:"not null; default:1"`
+}
+
+func (versionedHotel) TableName() string { return "hotels" }
+
+// Version 5
+
+type softDeletedHotel struct {
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (softDeletedHotel) TableName() string { return "hotels" }
+
+type softDeletedUser struct {
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (softDeletedUser) TableName() string { return "users" }
+
+type softDeletedReservation struct {
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (softDeletedReservation) TableName() string { return "reservations" }
+
+// Version 6
+
+type auditEntry struct {
+	Id        int       `gorm:"primaryKey"`
+	ActorId   int       `gorm:"type:int; index"`
+	ActorRole string    `gorm:"type:varchar(50)"`
+	Action    string    `gorm:"type:varchar(50); not null; index"`
+	Entity    string    `gorm:"type:varchar(50); not null; index:idx_audit_entity"`
+	EntityId  int       `gorm:"type:int; index:idx_audit_entity"`
+	Changes   string    `gorm:"type:text"`
+	Ip        string    `gorm:"type:varchar(45)"`
+	RequestId string    `gorm:"type:varchar(128)"`
+	CreatedAt time.Time `gorm:"not null; index"`
+	PrevHash  string    `gorm:"type:varchar(64); not null; uniqueIndex"`
+	Hash      string    `gorm:"type:varchar(64); not null"`
+}
+
+func (auditEntry) TableName() string { return "audit_entries" }
+
+// Version 7
+
+type userToken struct {
+	Id        int       `gorm:"primaryKey"`
+	UserId    int       `gorm:"type:int; not null; index"`
+	Purpose   string    `gorm:"type:varchar(20); not null"`
+	Hash      string    `gorm:"type:varchar(64); not null; uniqueIndex"`
+	Email     string    `gorm:"type:varchar(300)"`
+	CreatedAt time.Time `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null; index"`
+}
+
+func (userToken) TableName() string { return "user_tokens" }
+
+// Version 8
+
+type verifiedUser struct {
+	EmailVerified bool `gorm:"not null; default:false"`
+}
+
+func (verifiedUser) TableName() string { return "users" }
+
+// Version 9
+
+type disabledUser struct {
+	Disabled bool `gorm:"not null; default:false"`
+}
+
+func (disabledUser) TableName() string { return "users" }
+
+// Version 10
+
+type hotelAssignment struct {
+	UserId    int       `gorm:"primaryKey; autoIncrement:false"`
+	HotelId   int       `gorm:"primaryKey; autoIncrement:false; index"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+func (hotelAssignment) TableName() string { return "hotel_assignments" }
+
+// Version 11
+
+type userMfa struct {
+	UserId    int       `gorm:"primaryKey; autoIncrement:false"`
+	Secret    string    `gorm:"type:varchar(64); not null"`
+	Enabled   bool      `gorm:"not null; default:false"`
+	LastStep  int64     `gorm:"not null; default:0"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+func (userMfa) TableName() string { return "user_mfas" }
+
+type recoveryCode struct {
+	Id        int       `gorm:"primaryKey"`
+	UserId    int       `gorm:"type:int; not null; index"`
+	Hash      string    `gorm:"type:varchar(64); not null; uniqueIndex"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+func (recoveryCode) TableName() string { return "recovery_codes" }
+
+// Version 12
+
+type externalIdentity struct {
+	Id        int       `gorm:"primaryKey"`
+	UserId    int       `gorm:"type:int; not null; index"`
+	Provider  string    `gorm:"type:varchar(50); not null; uniqueIndex:idx_external_identity"`
+	Subject   string    `gorm:"type:varchar(255); not null; uniqueIndex:idx_external_identity"`
+	Email     string    `gorm:"type:varchar(300)"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+func (externalIdentity) TableName() string { return "external_identities" }
+
+type oidcLogin struct {
+	Id        int       `gorm:"primaryKey"`
+	Provider  string    `gorm:"type:varchar(50); not null"`
+	StateHash string    `gorm:"type:varchar(64); not null; uniqueIndex"`
+	Nonce     string    `gorm:"type:varchar(64); not null"`
+	Verifier  string    `gorm:"type:varchar(128); not null"`
+	CreatedAt time.Time `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null; index"`
+}
+
+func (oidcLogin) TableName() string { return "oidc_logins" }
+
+// Version 13
+
+type tokenVersionUser struct {
+	TokenVersion int `gorm:"not null; default:0"`
+}
+
+func (tokenVersionUser) TableName() string { return "users" }
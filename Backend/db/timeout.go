@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	timeoutKey    = "db:query_timeout"
+	rowTimeoutKey = "db:row_timeout"
+)
+
+type noTimeoutKey struct{}
+
+// withoutQueryTimeout marks ctx so statements run with it aren't bounded,
+// for migrations whose DDL and lock waits can take far longer than a query
+func withoutQueryTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noTimeoutKey{}, true)
+}
+
+type queryTimeout struct {
+	parent context.Context
+	cancel context.CancelFunc
+}
+
+// registerQueryTimeout bounds every statement by timeout. Clients run their queries
+// with the gin request context, so a statement also stops when the request is
+// cancelled or reaches its own deadline.
+func registerQueryTimeout(conn *gorm.DB, timeout time.Duration) error {
+	callbacks := conn.Callback()
+
+	before := func(tx *gorm.DB) {
+		if skip, _ := tx.Statement.Context.Value(noTimeoutKey{}).(bool); skip {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(tx.Statement.Context, timeout)
+
+		tx.Statement.Settings.Store(timeoutKey, queryTimeout{parent: tx.Statement.Context, cancel: cancel})
+		tx.Statement.Context = ctx
+	}
+
+	after := func(tx *gorm.DB) {
+		value, ok := tx.Statement.Settings.LoadAndDelete(timeoutKey)
+
+		if !ok {
+			return
+		}
+
+		// Statements chained on the same session must not inherit the cancelled context
+		timeout := value.(queryTimeout)
+		timeout.cancel()
+		tx.Statement.Context = timeout.parent
+	}
+
+	// Row and Rows are read after the callbacks return, so their timeout is kept
+	// for Release to cancel once the scan is done, bounding the scan as well
+	afterRow := func(tx *gorm.DB) {
+		if value, ok := tx.Statement.Settings.LoadAndDelete(timeoutKey); ok {
+			tx.Statement.Settings.Store(rowTimeoutKey, value)
+			tx.Statement.Context = value.(queryTimeout).parent
+		}
+	}
+
+	if err := callbacks.Create().Before("*").Register("timeout:before_create", before); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("*").Register("timeout:after_create", after); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("*").Register("timeout:before_query", before); err != nil {
+		return err
+	}
+	if err := callbacks.Query().After("*").Register("timeout:after_query", after); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("*").Register("timeout:before_update", before); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("*").Register("timeout:after_update", after); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("*").Register("timeout:before_delete", before); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("*").Register("timeout:after_delete", after); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("*").Register("timeout:before_raw", before); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().After("*").Register("timeout:after_raw", after); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("*").Register("timeout:before_row", before); err != nil {
+		return err
+	}
+
+	return callbacks.Row().After("*").Register("timeout:after_row", afterRow)
+}
+
+// Release frees the timeout of a Row or Rows read on tx, call it once the scan
+// is done. A timeout never released still expires on its own.
+func Release(tx *gorm.DB) {
+	if value, ok := tx.Statement.Settings.LoadAndDelete(rowTimeoutKey); ok {
+		value.(queryTimeout).cancel()
+	}
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"errors"
+	"project/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "db:span"
+
+// registerTracing opens a span for every statement under the span of the
+// request. The statement context is left untouched, the timeout callbacks
+// swap it and restore it in their own order.
+func registerTracing(conn *gorm.DB) error {
+	callbacks := conn.Callback()
+	system := conn.Dialector.Name()
+
+	before := func(operation string) func(tx *gorm.DB) {
+		return func(tx *gorm.DB) {
+			_, span := tracing.Tracer().Start(tx.Statement.Context, "db."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attribute.String("db.system", system), attribute.String("db.operation", operation)))
+
+			tx.Statement.Settings.Store(spanKey, span)
+		}
+	}
+
+	after := func(tx *gorm.DB) {
+		value, ok := tx.Statement.Settings.LoadAndDelete(spanKey)
+
+		if !ok {
+			return
+		}
+
+		span := value.(trace.Span)
+
+		// The statement keeps its placeholders, values are never recorded
+		span.SetAttributes(
+			attribute.String("db.sql.table", tx.Statement.Table),
+			attribute.String("db.statement", tx.Statement.SQL.String()),
+			attribute.Int64("db.rows_affected", tx.RowsAffected),
+		)
+
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			span.RecordError(tx.Error)
+			span.SetStatus(codes.Error, tx.Error.Error())
+		}
+
+		span.End()
+	}
+
+	if err := callbacks.Create().Before("*").Register("tracing:before_create", before("create")); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("*").Register("tracing:after_create", after); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("*").Register("tracing:before_query", before("query")); err != nil {
+		return err
+	}
+	if err := callbacks.Query().After("*").Register("tracing:after_query", after); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("*").Register("tracing:before_update", before("update")); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("*").Register("tracing:after_update", after); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("*").Register("tracing:before_delete", before("delete")); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("*").Register("tracing:after_delete", after); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("*").Register("tracing:before_row", before("row")); err != nil {
+		return err
+	}
+	if err := callbacks.Row().After("*").Register("tracing:after_row", after); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("*").Register("tracing:before_raw", before("raw")); err != nil {
+		return err
+	}
+
+	return callbacks.Raw().After("*").Register("tracing:after_raw", after)
+}
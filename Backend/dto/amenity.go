@@ -2,7 +2,7 @@ package dto
 
 type AmenityDto struct {
 	Id   int    `json:"id"`
-	Name string `json:"name" validate:"required"`
+	Name string `json:"name" validate:"required,max=300"`
 }
 
 type AmenitiesDto []AmenityDto
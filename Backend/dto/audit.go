@@ -0,0 +1,55 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditEntryDto struct {
+	Id        int                       `json:"id"`
+	ActorId   int                       `json:"actor_id,omitempty"`
+	ActorRole string                    `json:"actor_role,omitempty"`
+	Action    string                    `json:"action"`
+	Entity    string                    `json:"entity"`
+	EntityId  int                       `json:"entity_id,omitempty"`
+	Changes   map[string]AuditChangeDto `json:"changes,omitempty"`
+	Ip        string                    `json:"ip,omitempty"`
+	RequestId string                    `json:"request_id,omitempty"`
+	CreatedAt time.Time                 `json:"created_at"`
+	PrevHash  string                    `json:"prev_hash"`
+	Hash      string                    `json:"hash"`
+}
+
+type AuditEntriesDto []AuditEntryDto
+
+// AuditChangeDto is the value of a field before and after a change, a field
+// that was added or removed has no before or after
+type AuditChangeDto struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditFilterDto is the query of the audit log, from and to bound the time of
+// the entries in the date format of the reservations
+type AuditFilterDto struct {
+	ActorId  int    `form:"actor_id" validate:"gte=0"`
+	Action   string `form:"action" validate:"max=50"`
+	Entity   string `form:"entity" validate:"max=50"`
+	EntityId int    `form:"entity_id" validate:"gte=0"`
+	From     string `form:"from" validate:"omitempty,date"`
+	To       string `form:"to" validate:"omitempty,date"`
+	Limit    int    `form:"limit" validate:"gte=0,max=1000"`
+	Offset   int    `form:"offset" validate:"gte=0"`
+}
+
+// AuditVerificationDto is the outcome of checking the hash chain of the audit
+// log. BrokenAt is the first entry that doesn't match the ones before it, and
+// Head the hash of the newest entry: the chain can't tell its newest entries
+// were removed, comparing Head with one noted down before can.
+type AuditVerificationDto struct {
+	Valid    bool   `json:"valid"`
+	Entries  int    `json:"entries"`
+	Head     string `json:"head,omitempty"`
+	BrokenAt int    `json:"broken_at,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
@@ -0,0 +1,33 @@
+package dto
+
+import "time"
+
+// DeletedHotelDto is a deleted hotel that can still be restored
+type DeletedHotelDto struct {
+	HotelDto
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type DeletedHotelsDto []DeletedHotelDto
+
+// DeletedUserDto is a deleted user that can still be restored
+type DeletedUserDto struct {
+	UserDto
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type DeletedUsersDto []DeletedUserDto
+
+// DeletedReservationDto is a deleted reservation that can still be restored
+type DeletedReservationDto struct {
+	ReservationDto
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type DeletedReservationsDto []DeletedReservationDto
+
+// DeleteOptionsDto is the query of the hotel and user deletions, force cancels
+// the reservations that would otherwise keep them from being deleted
+type DeleteOptionsDto struct {
+	Force bool `form:"force"`
+}
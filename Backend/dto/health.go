@@ -0,0 +1,6 @@
+package dto
+
+type HealthDto struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
@@ -2,13 +2,15 @@ package dto
 
 type HotelDto struct {
 	Id           int       `json:"id"`
-	Name         string    `json:"name" validate:"required"`
-	RoomAmount   int       `json:"room_amount" validate:"required"`
-	Description  string    `json:"description" validate:"required"`
-	StreetName   string    `json:"street_name" validate:"required"`
-	StreetNumber int       `json:"street_number" validate:"required"`
-	Rate         float64   `json:"rate" validate:"required"`
-	Amenities    []string  `json:"amenities,omitempty"`
+	Name         string    `json:"name" validate:"required,max=300"`
+	RoomAmount   int       `json:"room_amount" validate:"required,gt=0"`
+	Description  string    `json:"description" validate:"required,max=1000"`
+	StreetName   string    `json:"street_name" validate:"required,max=100"`
+	StreetNumber int       `json:"street_number" validate:"required,gt=0"`
+	Rate         float64   `json:"rate" validate:"required,gt=0"`
+	Draft        bool      `json:"draft"`
+	Version      int       `json:"version,omitempty"`
+	Amenities    []string  `json:"amenities,omitempty" validate:"dive,required"`
 	Images       ImagesDto `json:"images,omitempty"`
 }
 
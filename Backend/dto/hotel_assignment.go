@@ -0,0 +1,13 @@
+package dto
+
+// HotelAssignmentDto assigns a hotel to a manager
+type HotelAssignmentDto struct {
+	UserId  int `json:"user_id"`
+	HotelId int `json:"hotel_id"`
+}
+
+// AssignedHotelsDto lists the hotels assigned to a manager
+type AssignedHotelsDto struct {
+	UserId   int   `json:"user_id"`
+	HotelIds []int `json:"hotel_ids"`
+}
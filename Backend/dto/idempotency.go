@@ -0,0 +1,8 @@
+package dto
+
+// IdempotentResponseDto is the response stored for an idempotency key
+type IdempotentResponseDto struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
@@ -3,7 +3,7 @@ package dto
 type ImageDto struct {
 	Id      int    `json:"id"`
 	Path    string `json:"path" validate:"required"`
-	HotelId int    `json:"hotel_id" validate:"required"`
+	HotelId int    `json:"hotel_id" validate:"required,gt=0"`
 }
 
 type ImagesDto []ImageDto
@@ -0,0 +1,65 @@
+package dto
+
+// LoginResultDto is what a login returns: the user once every factor checked
+// out, or the challenge to answer with a code from their authenticator app.
+// RecoveryCodes are only set by the login that finished enrolling the app.
+type LoginResultDto struct {
+	User          UserDto
+	Challenge     *MfaChallengeDto
+	RecoveryCodes []string
+}
+
+// MfaChallengeDto asks for a second factor. The token is sent back with the
+// code to finish the login, and to enroll an app first when it is required.
+type MfaChallengeDto struct {
+	MfaRequired        bool   `json:"mfa_required"`
+	MfaToken           string `json:"mfa_token"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	ExpiresIn          int    `json:"expires_in"` //Seconds
+}
+
+// MfaLoginDto finishes a login with a code from the app or a recovery code
+type MfaLoginDto struct {
+	MfaToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+type MfaTokenDto struct {
+	MfaToken string `json:"mfa_token" validate:"required"`
+}
+
+// MfaEnrollmentDto is the secret to add to an authenticator app, typed in or
+// scanned as a QR code of the provisioning URI
+type MfaEnrollmentDto struct {
+	Secret          string `json:"secret"`
+	ProvisioningUri string `json:"provisioning_uri"`
+}
+
+type MfaStatusDto struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+type MfaSetupDto struct {
+	Password         string `json:"password" validate:"required_without=ConfirmationCode"`
+	ConfirmationCode string `json:"confirmation_code" validate:"required_without=Password"`
+}
+
+type MfaCodeDto struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// MfaDisableDto confirms turning the second factor off with the password and
+// a code from the app or a recovery code
+type MfaDisableDto struct {
+	Password         string `json:"password" validate:"required_without=ConfirmationCode"`
+	ConfirmationCode string `json:"confirmation_code" validate:"required_without=Password"`
+	Code             string `json:"code" validate:"required"`
+}
+
+// RecoveryCodesDto are shown once, each logs in once in place of a code
+type RecoveryCodesDto struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
@@ -0,0 +1,20 @@
+package dto
+
+// OidcProviderDto is a provider users can log in with, Name goes in the URLs
+type OidcProviderDto struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+type OidcProvidersDto []OidcProviderDto
+
+// OidcAuthorizationDto is where to send the browser to log in at the provider
+type OidcAuthorizationDto struct {
+	AuthorizationUrl string `json:"authorization_url"`
+}
+
+// OidcCallbackDto is what the provider redirected the browser back with
+type OidcCallbackDto struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
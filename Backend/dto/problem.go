@@ -0,0 +1,21 @@
+package dto
+
+// ProblemDto is an RFC 7807 problem details body, extended with a stable error code and the request id
+type ProblemDto struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Status    int            `json:"status"`
+	Detail    string         `json:"detail,omitempty"`
+	Instance  string         `json:"instance,omitempty"`
+	Code      string         `json:"code"`
+	RequestId string         `json:"request_id,omitempty"`
+	Errors    FieldErrorsDto `json:"errors,omitempty"`
+}
+
+type FieldErrorDto struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type FieldErrorsDto []FieldErrorDto
@@ -2,11 +2,17 @@ package dto
 
 type ReservationDto struct {
 	Id        int     `json:"id"`
-	StartDate string  `json:"start_date"`
-	EndDate   string  `json:"end_date"`
-	UserId    int     `json:"user_id"`
-	HotelId   int     `json:"hotel_id"`
-	Amount    float64 `json:"amount"`
+	StartDate string  `json:"start_date" validate:"required,date,future"`
+	EndDate   string  `json:"end_date" validate:"required,date,after=start_date"`
+	UserId    int     `json:"user_id" validate:"required,gt=0"`
+	HotelId   int     `json:"hotel_id" validate:"required,gt=0"`
+	Amount    float64 `json:"amount" validate:"gte=0"`
 }
 
 type ReservationsDto []ReservationDto
+
+// DateRangeDto is the start_date and end_date query of the availability and range searches
+type DateRangeDto struct {
+	StartDate string `form:"start_date" validate:"required,date"`
+	EndDate   string `form:"end_date" validate:"required,date,after=start_date"`
+}
@@ -2,12 +2,87 @@ package dto
 
 type UserDto struct {
 	Id       int    `json:"id"`
-	Name     string `json:"name"`
-	LastName string `json:"last_name"`
-	Dni      string `json:"dni"`
-	Email    string `json:"email"`
-	Password string `json:"password,omitempty"`
+	Name     string `json:"name" validate:"required,max=300"`
+	LastName string `json:"last_name" validate:"required,max=300"`
+	Dni      string `json:"dni" validate:"required,dni"`
+	Email    string `json:"email" validate:"required,email,max=300"`
+	Password string `json:"password,omitempty" validate:"required,password"`
 	Role     string `json:"role"`
+
+	EmailVerified bool `json:"email_verified"`
+	Disabled      bool `json:"disabled"`
+
+	// TokenVersion is signed into the login token, see model.User
+	TokenVersion int `json:"-"`
+}
+
+// NewUserDto is an account created by an admin, with any role
+type NewUserDto struct {
+	Name     string `json:"name" validate:"required,max=300"`
+	LastName string `json:"last_name" validate:"required,max=300"`
+	Dni      string `json:"dni" validate:"required,dni"`
+	Email    string `json:"email" validate:"required,email,max=300"`
+	Password string `json:"password" validate:"required,password"`
+	Role     string `json:"role" validate:"required,role"`
+}
+
+type RoleDto struct {
+	Role string `json:"role" validate:"required,role"`
+}
+
+// UserProfileDto holds the fields users can change about themselves
+type UserProfileDto struct {
+	Name     string `json:"name" validate:"required,max=300"`
+	LastName string `json:"last_name" validate:"required,max=300"`
+	Dni      string `json:"dni" validate:"required,dni"`
+	Email    string `json:"email" validate:"required,email,max=300"`
+}
+
+// ProfileDto holds the fields users can change on their own profile, the email
+// is changed once the new address is confirmed
+type ProfileDto struct {
+	Name     string `json:"name" validate:"required,max=300"`
+	LastName string `json:"last_name" validate:"required,max=300"`
+	Dni      string `json:"dni" validate:"required,dni"`
+}
+
+// PasswordChangeDto confirms the change with the current password, accounts
+// without one send the code mailed by POST /me/confirmation instead. The
+// other DTOs with a ConfirmationCode do the same.
+type PasswordChangeDto struct {
+	CurrentPassword  string `json:"current_password" validate:"required_without=ConfirmationCode"`
+	ConfirmationCode string `json:"confirmation_code" validate:"required_without=CurrentPassword"`
+	NewPassword      string `json:"new_password" validate:"required,password"`
+}
+
+type EmailChangeDto struct {
+	Email            string `json:"email" validate:"required,email,max=300"`
+	Password         string `json:"password" validate:"required_without=ConfirmationCode"`
+	ConfirmationCode string `json:"confirmation_code" validate:"required_without=Password"`
+}
+
+type PasswordForgottenDto struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type PasswordResetDto struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,password"`
+}
+
+type TokenDto struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// AccountDeletionDto confirms the deletion of the account with its password
+type AccountDeletionDto struct {
+	Password         string `json:"password" validate:"required_without=ConfirmationCode"`
+	ConfirmationCode string `json:"confirmation_code" validate:"required_without=Password"`
+}
+
+type LoginDto struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
 }
 
 type UsersDto []UserDto
@@ -0,0 +1,155 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"project/config"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Logger is the logger of one package, its level can be set apart from the
+// rest with log.packages, e.g. ["client=debug"]
+type Logger struct {
+	*logrus.Logger
+	name string
+}
+
+type requestIdKey struct{}
+
+var (
+	mu        sync.Mutex
+	loggers             = map[string]*Logger{}
+	output    io.Writer = os.Stdout
+	formatter logrus.Formatter
+	level     = logrus.InfoLevel
+	levels    = map[string]logrus.Level{}
+)
+
+func init() {
+	formatter = newFormatter("json")
+	apply(logrus.StandardLogger(), "")
+}
+
+// Package returns the logger of the named package, packages keep it in a
+// package level log variable
+func Package(name string) *Logger {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if logger, ok := loggers[name]; ok {
+		return logger
+	}
+
+	logger := &Logger{Logger: logrus.New(), name: name}
+	apply(logger.Logger, name)
+	loggers[name] = logger
+
+	return logger
+}
+
+// Configure sets the format and levels of every logger, including the
+// standard logrus logger used by main and app
+func Configure(cfg config.LogConfig) error {
+	defaultLevel, err := logrus.ParseLevel(cfg.Level)
+
+	if err != nil {
+		return err
+	}
+
+	packageLevels := map[string]logrus.Level{}
+
+	for _, entry := range cfg.Packages {
+		name, value, _ := strings.Cut(entry, "=")
+		packageLevel, err := logrus.ParseLevel(value)
+
+		if err != nil {
+			return fmt.Errorf("log level for %s: %w", name, err)
+		}
+
+		packageLevels[strings.TrimSpace(name)] = packageLevel
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	formatter = newFormatter(cfg.Format)
+	level = defaultLevel
+	levels = packageLevels
+
+	apply(logrus.StandardLogger(), "")
+
+	for name, logger := range loggers {
+		apply(logger.Logger, name)
+	}
+
+	return nil
+}
+
+// SetOutput sends every logger to w, tests use it to capture the lines
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	output = w
+
+	apply(logrus.StandardLogger(), "")
+
+	for name, logger := range loggers {
+		apply(logger.Logger, name)
+	}
+}
+
+func apply(logger *logrus.Logger, name string) {
+	logger.SetOutput(output)
+	logger.SetFormatter(formatter)
+
+	if packageLevel, ok := levels[name]; ok {
+		logger.SetLevel(packageLevel)
+	} else {
+		logger.SetLevel(level)
+	}
+}
+
+func newFormatter(format string) logrus.Formatter {
+	if format == "text" {
+		return redactor{next: &logrus.TextFormatter{FullTimestamp: true}}
+	}
+
+	return redactor{next: &logrus.JSONFormatter{
+		FieldMap: logrus.FieldMap{logrus.FieldKeyMsg: "message"},
+	}}
+}
+
+// WithRequestId returns a context carrying the request id, see Ctx
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// RequestId returns the request id carried by ctx, if any
+func RequestId(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// Ctx returns an entry tagged with the request id and trace of ctx, so every
+// line written while handling a request can be correlated
+func (l *Logger) Ctx(ctx context.Context) *logrus.Entry {
+	fields := logrus.Fields{}
+
+	if id := RequestId(ctx); id != "" {
+		fields["request_id"] = id
+	}
+
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		fields["trace_id"] = span.TraceID().String()
+		fields["span_id"] = span.SpanID().String()
+	}
+
+	return l.WithContext(ctx).WithFields(fields)
+}
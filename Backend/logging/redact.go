@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "[REDACTED]"
+
+// Fields whose name contains one of these are never written
+var sensitiveKeys = []string{"password", "hash", "token", "secret", "authorization", "cookie", "signature", "dni", "email"}
+
+// Values that are redacted wherever they appear in a message or field
+var sensitivePatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// key=value and key: value pairs, as printed by %+v or query strings
+	{regexp.MustCompile(`(?i)\b(password|passwd|token|secret|signature|dni)(["']?\s*[:=]\s*)("[^"]*"|[^\s,;&}]+)`), "${1}${2}" + redacted},
+	// bcrypt hashes
+	{regexp.MustCompile(`\$2[abxy]?\$\d{2}\$[./A-Za-z0-9]{53}`), redacted},
+	// JSON web tokens and bearer credentials
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), redacted},
+	{regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`), "Bearer " + redacted},
+	// email addresses
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), redacted},
+}
+
+// redactor masks secrets and personal data before the entry is formatted, so
+// a careless log line can't leak them
+type redactor struct {
+	next logrus.Formatter
+}
+
+func (r redactor) Format(entry *logrus.Entry) ([]byte, error) {
+	clean := *entry
+	clean.Message = Redact(entry.Message)
+	clean.Data = make(logrus.Fields, len(entry.Data))
+
+	for key, value := range entry.Data {
+		clean.Data[key] = redactField(key, value)
+	}
+
+	return r.next.Format(&clean)
+}
+
+func redactField(key string, value interface{}) interface{} {
+	lower := strings.ToLower(key)
+
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(lower, sensitive) {
+			return redacted
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return Redact(v)
+	case error:
+		return Redact(v.Error())
+	default:
+		return value
+	}
+}
+
+// Redact masks every secret or personal identifier found in text
+func Redact(text string) string {
+	for _, sensitive := range sensitivePatterns {
+		text = sensitive.pattern.ReplaceAllString(text, sensitive.replacement)
+	}
+
+	return text
+}
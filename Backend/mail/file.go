@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// File writes every message to its own .eml file in Dir, so the emails sent
+// while developing can be opened with a mail client instead of being delivered
+type File struct {
+	Dir  string
+	From string
+
+	count atomic.Int64
+}
+
+func (f *File) Send(_ context.Context, message Message) error {
+	now := time.Now()
+	msg, err := compose(message, f.From, now)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%03d.eml", now.Format("20060102-150405.000"), f.count.Add(1)%1000)
+
+	return os.WriteFile(filepath.Join(f.Dir, name), msg, 0o644)
+}
@@ -0,0 +1,69 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"net"
+	"project/config"
+	"strconv"
+	"sync"
+)
+
+// ErrDisabled is returned by Disabled, when no mailer is configured
+var ErrDisabled = errors.New("no mailer is configured")
+
+// Message is an email to a single recipient, with a plain text body and
+// optionally an HTML one
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer sends the emails of the services
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// New returns the mailer chosen in the configuration, which is validated
+func New(cfg config.MailConfig) Mailer {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTP(net.JoinHostPort(cfg.Smtp.Host, strconv.Itoa(cfg.Smtp.Port)), cfg.Smtp.Username, cfg.Smtp.Password, cfg.From)
+	case "file":
+		return &File{Dir: cfg.Dir, From: cfg.From}
+	default:
+		return Disabled{}
+	}
+}
+
+// Disabled refuses to send anything, it stands in until a mailer is configured
+type Disabled struct{}
+
+func (Disabled) Send(context.Context, Message) error {
+	return ErrDisabled
+}
+
+// Memory keeps the messages it is sent instead of delivering them
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *Memory) Send(_ context.Context, message Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, message)
+
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
@@ -0,0 +1,156 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"project/config"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testData struct {
+	Name      string
+	Email     string
+	Link      string
+	Code      string
+	ExpiresIn string
+}
+
+func TestRender(t *testing.T) {
+	a := assert.New(t)
+
+	message, err := Render("password_reset", testData{Name: "<b>Jane</b>", Link: "https://miranda.example.com/reset-password?token=abc", Code: "abc", ExpiresIn: "1 hour"})
+
+	a.Nil(err)
+	a.Equal("Reset your password", message.Subject)
+	a.Contains(message.Text, "Hello <b>Jane</b>,")
+	a.Contains(message.Text, "https://miranda.example.com/reset-password?token=abc")
+	a.Contains(message.Text, "expires in 1 hour")
+
+	// The HTML body is escaped and laid out
+	a.Contains(message.HTML, "Hello &lt;b&gt;Jane&lt;/b&gt;,")
+	a.Contains(message.HTML, `href="https://miranda.example.com/reset-password?token=abc"`)
+	a.Contains(message.HTML, "Miranda Hotels")
+
+	for _, name := range []string{"verify_email", "email_change", "email_changed", "password_changed", "confirm_identity"} {
+		message, err := Render(name, testData{Name: "Jane"})
+		a.Nil(err, name)
+		a.NotEmpty(message.Subject, name)
+		a.NotContains(message.Text, "subject", name)
+	}
+
+	_, err = Render("missing", nil)
+	a.NotNil(err)
+}
+
+// readMessage parses a composed message into its headers and the bodies of its parts by content type
+func readMessage(t *testing.T, raw []byte) (mail.Header, map[string]string) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Message doesn't parse: %v", err)
+	}
+
+	bodies := map[string]string{}
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		body, _ := io.ReadAll(quotedprintable.NewReader(msg.Body))
+		bodies[mediaType] = string(body)
+		return msg.Header, bodies
+	}
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+
+	for {
+		// NextPart decodes the quoted-printable parts
+		part, err := parts.NextPart()
+		if err != nil {
+			break
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(part)
+		bodies[partType] = string(body)
+	}
+
+	return msg.Header, bodies
+}
+
+func TestSMTP_Send(t *testing.T) {
+	a := assert.New(t)
+
+	var sentTo []string
+	var sentFrom string
+	var raw []byte
+
+	mailer := NewSMTP("smtp.example.com:587", "user", "secret", "Miranda <no-reply@example.com>")
+	mailer.send = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		a.Equal("smtp.example.com:587", addr)
+		a.NotNil(auth)
+		sentFrom, sentTo, raw = from, to, msg
+		return nil
+	}
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "Jane Doe <jane@example.com>",
+		Subject: "Confirmá tu email",
+		Text:    "Hello Jane, a line long enough to be wrapped by the quoted-printable encoding, which breaks lines at 76 characters",
+		HTML:    "<p>Hello Jane</p>",
+	})
+
+	a.Nil(err)
+	a.Equal("no-reply@example.com", sentFrom)
+	a.Equal([]string{"jane@example.com"}, sentTo)
+
+	header, bodies := readMessage(t, raw)
+
+	subject, _ := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	a.Equal("Confirmá tu email", subject)
+	a.Equal(`"Jane Doe" <jane@example.com>`, header.Get("To"))
+	a.True(strings.HasSuffix(header.Get("Message-ID"), "@example.com>"))
+	a.Equal("Hello Jane, a line long enough to be wrapped by the quoted-printable encoding, which breaks lines at 76 characters", bodies["text/plain"])
+	a.Equal("<p>Hello Jane</p>", bodies["text/html"])
+
+	a.NotNil(mailer.Send(context.Background(), Message{To: "not an address"}))
+}
+
+func TestFile_Send(t *testing.T) {
+	a := assert.New(t)
+
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := New(config.MailConfig{Driver: "file", Dir: dir, From: "no-reply@example.com"})
+
+	a.Nil(mailer.Send(context.Background(), Message{To: "jane@example.com", Subject: "First", Text: "Only text"}))
+	a.Nil(mailer.Send(context.Background(), Message{To: "jane@example.com", Subject: "Second", Text: "Text", HTML: "<p>HTML</p>"}))
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	a.Len(files, 2)
+
+	raw, _ := os.ReadFile(files[0])
+	header, bodies := readMessage(t, raw)
+
+	a.Equal("First", header.Get("Subject"))
+	a.Equal("Only text", bodies["text/plain"])
+}
+
+func TestNew(t *testing.T) {
+	a := assert.New(t)
+
+	a.IsType(Disabled{}, New(config.MailConfig{Driver: "none"}))
+	a.IsType(&SMTP{}, New(config.MailConfig{Driver: "smtp", Smtp: config.SmtpConfig{Host: "localhost", Port: 25}}))
+
+	// No credentials, no authentication
+	a.Nil(New(config.MailConfig{Driver: "smtp", Smtp: config.SmtpConfig{Host: "localhost", Port: 25}}).(*SMTP).Auth)
+
+	a.ErrorIs(Disabled{}.Send(context.Background(), Message{}), ErrDisabled)
+}
@@ -0,0 +1,107 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// compose writes the message in the Internet Message Format, as a
+// multipart/alternative when it has an HTML body
+func compose(message Message, from string, now time.Time) ([]byte, error) {
+	sender, err := mail.ParseAddress(from)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender: %w", err)
+	}
+
+	recipient, err := mail.ParseAddress(message.To)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	id := make([]byte, 16)
+
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	header := func(name string, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+
+	header("From", sender.String())
+	header("To", recipient.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", message.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", hex.EncodeToString(id), domain(sender.Address)))
+	header("MIME-Version", "1.0")
+
+	if message.HTML == "" {
+		header("Content-Type", `text/plain; charset="utf-8"`)
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+
+		if err := writeQuoted(&buf, message.Text); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+
+	header("Content-Type", `multipart/alternative; boundary="`+parts.Boundary()+`"`)
+	buf.WriteString("\r\n")
+
+	// The last part is the preferred one
+	for _, part := range []struct{ contentType, body string }{
+		{`text/plain; charset="utf-8"`, message.Text},
+		{`text/html; charset="utf-8"`, message.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := writeQuoted(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeQuoted(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+
+	return qp.Close()
+}
+
+func domain(address string) string {
+	return address[strings.LastIndex(address, "@")+1:]
+}
@@ -0,0 +1,48 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTP sends the messages through a mail server. net/smtp upgrades the
+// connection with STARTTLS when the server offers it, and only authenticates
+// over TLS or to localhost.
+type SMTP struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+
+	// send delivers the composed message, smtp.SendMail unless replaced in tests
+	send func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTP returns a mailer for the server at addr ("host:port"), it
+// authenticates when a username is given
+func NewSMTP(addr string, username string, password string, from string) *SMTP {
+	s := &SMTP{Addr: addr, From: from, send: smtp.SendMail}
+
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		s.Auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return s
+}
+
+// Send doesn't follow ctx, net/smtp has no way to cancel a delivery in progress
+func (s *SMTP) Send(ctx context.Context, message Message) error {
+	msg, err := compose(message, s.From, time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	sender, _ := mail.ParseAddress(s.From)
+	recipient, _ := mail.ParseAddress(message.To)
+
+	return s.send(s.Addr, s.Auth, sender.Address, []string{recipient.Address}, msg)
+}
@@ -0,0 +1,67 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var templates embed.FS
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// emails are parsed once, the templates are embedded so a mistake in them
+// shows up in the tests
+var emails = map[string]emailTemplate{}
+
+func init() {
+	names, _ := templates.ReadDir("templates")
+
+	for _, entry := range names {
+		name, found := strings.CutSuffix(entry.Name(), ".txt")
+
+		if !found {
+			continue
+		}
+
+		emails[name] = emailTemplate{
+			text: texttemplate.Must(texttemplate.ParseFS(templates, path.Join("templates", name+".txt"))),
+			html: htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/layout.html", path.Join("templates", name+".html"))),
+		}
+	}
+}
+
+// Render fills the named email with data. <name>.txt holds the subject, in a
+// "subject" block, and the text body; <name>.html holds the HTML body, in a
+// "content" block laid out by layout.html.
+func Render(name string, data any) (Message, error) {
+	email, ok := emails[name]
+
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+
+	if err := email.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+
+	if err := email.text.Execute(&text, data); err != nil {
+		return Message{}, err
+	}
+
+	if err := email.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{Subject: strings.TrimSpace(subject.String()), Text: text.String(), HTML: html.String()}, nil
+}
@@ -1,13 +1,155 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"project/app"
+	"project/config"
 	"project/db"
+	"project/service"
+	"project/tracing"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
 	//Import App directory when created !
 )
 
 func main() {
 
+	cfg, args, err := config.Load(os.Args[1:])
+
+	if len(args) > 0 && args[0] == "config" {
+		printConfig(cfg, args[1:], err)
+		return
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	app.Configure(cfg)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := db.Connect(cfg.Database); err != nil {
+		log.Fatal(err)
+	}
+
+	if len(args) > 0 && args[0] == "migrate" {
+		migrate(args[1:])
+		return
+	}
+
+	if len(args) > 0 && args[0] == "admin" {
+		admin(args[1:])
+		return
+	}
+
 	db.StartDbEngine()
-	app.StartRoute()
+
+	if err := app.StartRoute(cfg); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		log.Error(err)
+	}
+
+	// Flush the spans still buffered
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Error(err)
+	}
+}
+
+// printConfig handles "project [flags] config print", showing the effective
+// configuration with its secrets redacted, followed by any validation error
+func printConfig(cfg config.Config, args []string, err error) {
+	if len(args) == 0 || args[0] != "print" {
+		log.Fatal("usage: config print")
+	}
+
+	if printErr := cfg.Print(os.Stdout); printErr != nil {
+		log.Fatal(printErr)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// migrate handles "project migrate up|down|status|to <version>"
+func migrate(args []string) {
+	if len(args) == 0 {
+		args = []string{"up"}
+	}
+
+	var err error
+
+	switch args[0] {
+	case "up":
+		err = db.MigrateUp()
+	case "down":
+		err = db.MigrateDown()
+	case "to":
+		if len(args) < 2 {
+			log.Fatal("usage: migrate to <version>")
+		}
+
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			log.Fatal("invalid version: ", args[1])
+		}
+
+		err = db.MigrateTo(version)
+	case "status":
+		err = printMigrationStatus()
+	default:
+		log.Fatal("usage: migrate up|down|status|to <version>")
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// admin handles "project admin bootstrap <email>", which makes the registered
+// user with the email the first admin. Once there is one, admins grant the
+// role through the API.
+func admin(args []string) {
+	if len(args) < 2 || args[0] != "bootstrap" {
+		log.Fatal("usage: admin bootstrap <email>")
+	}
+
+	userDto, err := service.UserService.BootstrapAdmin(context.Background(), args[1])
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.WithField("user_id", userDto.Id).Info("User is now an admin")
+}
+
+func printMigrationStatus() error {
+	status, err := db.GetMigrationStatus()
+
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range status {
+		applied := "pending"
+
+		if migration.AppliedAt != nil {
+			applied = migration.AppliedAt.Format("02-01-2006 15:04")
+		}
+
+		fmt.Printf("%4d  %-30s %s\n", migration.Version, migration.Name, applied)
+	}
+
+	return nil
 }
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "miranda"
+
+// Registry holds every collector exposed on /metrics
+var Registry = prometheus.NewRegistry()
+
+// HTTP metrics, recorded by the controller.Metrics middleware
+var (
+	HttpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by route, method and status code.",
+	}, []string{"method", "route", "status"})
+
+	HttpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time spent handling HTTP requests, by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// Database metrics, recorded by the gorm callbacks in db/metrics.go
+var (
+	DbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time spent running database statements, by operation and table.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation", "table"})
+
+	DbQueryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "Database statements that failed, by operation and table.",
+	}, []string{"operation", "table"})
+)
+
+// Business metrics, incremented by the services
+var (
+	ReservationsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reservations_created_total",
+		Help:      "Reservations booked.",
+	})
+
+	ReservationsCancelled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reservations_cancelled_total",
+		Help:      "Reservations cancelled.",
+	})
+
+	AvailabilityChecks = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "availability_checks_total",
+		Help:      "Searches for hotels with rooms available in a date range.",
+	})
+
+	SoldOutRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sold_out_rejections_total",
+		Help:      "Reservations rejected because the hotel had no rooms left.",
+	})
+
+	LoginFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_failures_total",
+		Help:      "Failed logins, by reason.",
+	}, []string{"reason"})
+
+	AuditFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_failures_total",
+		Help:      "Failed attempts to append to the audit log.",
+	})
+
+	AuditPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "audit_pending_entries",
+		Help:      "Audit entries waiting to be appended once the log can be written again.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HttpRequests,
+		HttpRequestDuration,
+		DbQueryDuration,
+		DbQueryErrors,
+		ReservationsCreated,
+		ReservationsCancelled,
+		AvailabilityChecks,
+		SoldOutRejections,
+		LoginFailures,
+		AuditFailures,
+		AuditPending,
+	)
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// AuditEntry records one change made through the services. Entries are only
+// ever appended, each one holds the hash of the one before it so a removed or
+// edited entry breaks the chain.
+type AuditEntry struct {
+	Id        int       `gorm:"primaryKey"`
+	ActorId   int       `gorm:"type:int; index"` //0 when the request carried no token
+	ActorRole string    `gorm:"type:varchar(50)"`
+	Action    string    `gorm:"type:varchar(50); not null; index"`
+	Entity    string    `gorm:"type:varchar(50); not null; index:idx_audit_entity"`
+	EntityId  int       `gorm:"type:int; index:idx_audit_entity"`
+	Changes   string    `gorm:"type:text"` //JSON object of the changed fields with their before and after values
+	Ip        string    `gorm:"type:varchar(45)"`
+	RequestId string    `gorm:"type:varchar(128)"`
+	CreatedAt time.Time `gorm:"not null; index"`
+	PrevHash  string    `gorm:"type:varchar(64); not null; uniqueIndex"` //Empty for the first entry
+	Hash      string    `gorm:"type:varchar(64); not null"`              //SHA-256 of the entry and PrevHash in hex
+}
+
+type AuditEntries []AuditEntry
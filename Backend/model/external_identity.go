@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// ExternalIdentity links a user to their account at an OpenID Connect
+// provider, by the subject the provider identifies them with
+type ExternalIdentity struct {
+	Id        int       `gorm:"primaryKey"`
+	UserId    int       `gorm:"type:int; not null; index"`
+	Provider  string    `gorm:"type:varchar(50); not null; uniqueIndex:idx_external_identity"`  //Name of the provider in the configuration
+	Subject   string    `gorm:"type:varchar(255); not null; uniqueIndex:idx_external_identity"` //The sub claim, stable for the account at the provider
+	Email     string    `gorm:"type:varchar(300)"`                                              //The email the provider verified when it was linked
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// OidcLogin is a login sent to a provider and not back yet. The state the
+// provider returns finds it, only its hash is stored.
+type OidcLogin struct {
+	Id        int       `gorm:"primaryKey"`
+	Provider  string    `gorm:"type:varchar(50); not null"`
+	StateHash string    `gorm:"type:varchar(64); not null; uniqueIndex"` //SHA-256 of the state in hex
+	Nonce     string    `gorm:"type:varchar(64); not null"`              //Must come back in the ID token
+	Verifier  string    `gorm:"type:varchar(128); not null"`             //PKCE code verifier, proves the code is ours
+	CreatedAt time.Time `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null; index"`
+}
@@ -1,14 +1,19 @@
 package model
 
+import "gorm.io/gorm"
+
 type Hotel struct {
-	Id           int       `gorm:"primaryKey"`
-	Name         string    `gorm:"type:varchar(300); not null"`
-	RoomAmount   int       `gorm:"type:int; not null"`
-	Description  string    `gorm:"type:varchar(1000)"`
-	StreetName   string    `gorm:"type:varchar(100)"`
-	StreetNumber int       `gorm:"type:int"`
-	Rate         float64   `gorm:"type:decimal(8,2); not null"`
-	Amenities    Amenities `gorm:"many2many:hotel_amenities;"`
+	Id           int            `gorm:"primaryKey"`
+	Name         string         `gorm:"type:varchar(300); not null"`
+	RoomAmount   int            `gorm:"type:int; not null"`
+	Description  string         `gorm:"type:varchar(1000)"`
+	StreetName   string         `gorm:"type:varchar(100)"`
+	StreetNumber int            `gorm:"type:int"`
+	Rate         float64        `gorm:"type:decimal(8,2); not null"`
+	Draft        bool           `gorm:"not null; default:false"` //Draft hotels are not published yet
+	Version      int            `gorm:"not null; default:1"`     //Incremented on every update, see HotelClient.UpdateHotel
+	DeletedAt    gorm.DeletedAt `gorm:"index"`                   //Deleted hotels are left out of queries until purged
+	Amenities    Amenities      `gorm:"many2many:hotel_amenities;"`
 	Images       Images
 }
 
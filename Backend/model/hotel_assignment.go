@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// HotelAssignment gives a manager the running of a hotel, managers can only
+// edit and see the reservations of the hotels assigned to them
+type HotelAssignment struct {
+	UserId    int       `gorm:"primaryKey; autoIncrement:false"`
+	HotelId   int       `gorm:"primaryKey; autoIncrement:false; index"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+type HotelAssignments []HotelAssignment
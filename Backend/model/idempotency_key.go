@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// IdempotencyKey keeps the response to a request sent with an Idempotency-Key
+// header, so a retry of the same request gets it back instead of running again
+type IdempotencyKey struct {
+	Id          string `gorm:"primaryKey; type:varchar(255)"` //SHA-256 of the owner and Idempotency-Key header in hex
+	Fingerprint string `gorm:"type:varchar(64); not null"`    //SHA-256 of the owner, method, url and body in hex
+	Status      int    `gorm:"type:int; not null"`            //0 while the request is in progress
+	ContentType string `gorm:"type:varchar(100)"`
+	Body        []byte
+	CreatedAt   time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null; index"`
+}
@@ -1,12 +1,15 @@
 package model
 
+import "gorm.io/gorm"
+
 type Reservation struct {
-	Id        int     `gorm:"primaryKey"`
-	StartDate string  `gorm:"type:varchar(16); not null"` //Expected time as "DD-MM-YYYY hh:mm"
-	EndDate   string  `gorm:"type:varchar(16); not null"`
-	UserId    int     `gorm:"foreignkey:UserId"`
-	HotelId   int     `gorm:"foreignkey:HotelId"`
-	Amount    float64 `gorm:"type:decimal(10,2); not null"`
+	Id        int            `gorm:"primaryKey"`
+	StartDate string         `gorm:"type:varchar(16); not null"` //Expected time as "DD-MM-YYYY hh:mm"
+	EndDate   string         `gorm:"type:varchar(16); not null"`
+	UserId    int            `gorm:"foreignkey:UserId"`
+	HotelId   int            `gorm:"foreignkey:HotelId"`
+	Amount    float64        `gorm:"type:decimal(10,2); not null"`
+	DeletedAt gorm.DeletedAt `gorm:"index"` //Cancelled reservations are soft deleted
 }
 
 type Reservations []Reservation
@@ -1,13 +1,19 @@
 package model
 
+import "gorm.io/gorm"
+
 type User struct {
-	Id       int    `gorm:"primaryKey"`
-	Name     string `gorm:"type:varchar(300); not null"`
-	LastName string `gorm:"type:varchar(300); not null"`
-	Dni      string `gorm:"type:varchar(8); not null"`
-	Email    string `gorm:"type:varchar(300); unique"`
-	Password string `gorm:"type:varchar(300); not null"`
-	Role     string `gorm:"type:varchar(10); not null"`
+	Id            int            `gorm:"primaryKey"`
+	Name          string         `gorm:"type:varchar(300); not null"`
+	LastName      string         `gorm:"type:varchar(300); not null"`
+	Dni           string         `gorm:"type:varchar(8); not null"`
+	Email         string         `gorm:"type:varchar(300); unique"`
+	Password      string         `gorm:"type:varchar(300); not null"`
+	Role          string         `gorm:"type:varchar(10); not null"`
+	EmailVerified bool           `gorm:"not null; default:false"` //Set once the user follows a link sent to the email
+	Disabled      bool           `gorm:"not null; default:false"` //Disabled accounts can't log in
+	TokenVersion  int            `gorm:"not null; default:0"`     //Goes up with every new password, the login tokens issued before are rejected
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
 }
 
 type Users []User
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// UserMfa is the authenticator app a user added as a second factor. It is
+// enabled once the user confirms a code from it.
+type UserMfa struct {
+	UserId    int       `gorm:"primaryKey; autoIncrement:false"`
+	Secret    string    `gorm:"type:varchar(64); not null"` //Base32 TOTP secret shared with the app
+	Enabled   bool      `gorm:"not null; default:false"`
+	LastStep  int64     `gorm:"not null; default:0"` //Time step of the last code accepted, so a code can't be used twice
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// RecoveryCode logs in once in place of a code from the app, only its hash is
+// stored
+type RecoveryCode struct {
+	Id        int       `gorm:"primaryKey"`
+	UserId    int       `gorm:"type:int; not null; index"`
+	Hash      string    `gorm:"type:varchar(64); not null; uniqueIndex"` //SHA-256 of the code in hex
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+type RecoveryCodes []RecoveryCode
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// UserToken is a single use token sent to a user by email, only its hash is
+// stored so a copy of the database can't be used to redeem it
+type UserToken struct {
+	Id        int       `gorm:"primaryKey"`
+	UserId    int       `gorm:"type:int; not null; index"`
+	Purpose   string    `gorm:"type:varchar(20); not null"`              //What the token allows, e.g. "email_change"
+	Hash      string    `gorm:"type:varchar(64); not null; uniqueIndex"` //SHA-256 of the token in hex
+	Email     string    `gorm:"type:varchar(300)"`                       //The address the token was sent to
+	CreatedAt time.Time `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null; index"`
+}
@@ -0,0 +1,416 @@
+// Package oidc logs users in with an OpenID Connect provider, e.g. Google or
+// Microsoft, as a relying party: the authorization code flow with PKCE and
+// the ID token signed with RS256 checked against the keys of the provider.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"project/tracing"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ErrInvalidToken is returned when the ID token can't be trusted
+var ErrInvalidToken = errors.New("invalid ID token")
+
+// clockSkew is how far apart the clocks of the provider and ours may be
+const clockSkew = time.Minute
+
+// Provider is an OpenID Connect provider the application is registered with.
+// Its endpoints and keys are discovered from the issuer on first use.
+type Provider struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectUrl  string
+	Scopes       []string
+	Client       *http.Client // tracing.Client when nil
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     map[string]*rsa.PublicKey
+}
+
+// Metadata is the part of the discovery document of the issuer the flow uses
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+// Claims are what the ID token says about the user
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	GivenName     string
+	FamilyName    string
+}
+
+// NewVerifier returns a random PKCE code verifier, kept until the code is
+// exchanged
+func NewVerifier() (string, error) {
+	buf := make([]byte, 32)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Challenge is the S256 PKCE code challenge of the verifier, sent with the
+// authorization request
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeUrl is where the browser goes to log in at the provider, which
+// redirects back to RedirectUrl with the code and the state
+func (p *Provider) AuthCodeUrl(ctx context.Context, state string, nonce string, challenge string) (string, error) {
+	metadata, err := p.discover(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	endpoint, err := url.Parse(metadata.AuthorizationEndpoint)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+
+	query := endpoint.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientId)
+	query.Set("redirect_uri", p.RedirectUrl)
+	query.Set("scope", strings.Join(p.scopes(), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+	endpoint.RawQuery = query.Encode()
+
+	return endpoint.String(), nil
+}
+
+// Exchange trades the code for the ID token at the token endpoint, proving
+// with the verifier that this is the client that asked for it
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string) (string, error) {
+	metadata, err := p.discover(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectUrl)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.ClientId)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	// Public clients have no secret, PKCE alone proves who they are
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientId), url.QueryEscape(p.ClientSecret))
+	}
+
+	var response struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	status, err := p.do(req, &response)
+
+	if err != nil {
+		return "", err
+	}
+
+	if status != http.StatusOK || response.Error != "" {
+		return "", fmt.Errorf("token endpoint answered %d: %s %s", status, response.Error, response.ErrorDescription)
+	}
+
+	if response.IdToken == "" {
+		return "", errors.New("token endpoint returned no id_token")
+	}
+
+	return response.IdToken, nil
+}
+
+// Verify checks the signature, issuer, audience, expiry and nonce of the ID
+// token and returns its claims
+func (p *Provider) Verify(ctx context.Context, rawToken string, nonce string) (Claims, error) {
+	metadata, err := p.discover(ctx)
+
+	if err != nil {
+		return Claims{}, err
+	}
+
+	parser := jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS256.Alg()}, SkipClaimsValidation: true}
+
+	token, err := parser.Parse(rawToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, metadata, kid)
+	})
+
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	now := time.Now()
+
+	if issuer, _ := claims["iss"].(string); issuer != metadata.Issuer {
+		return Claims{}, fmt.Errorf("%w: issued by %q", ErrInvalidToken, issuer)
+	}
+
+	if !audienceContains(claims["aud"], p.ClientId) {
+		return Claims{}, fmt.Errorf("%w: issued to another client", ErrInvalidToken)
+	}
+
+	if !claims.VerifyExpiresAt(now.Add(-clockSkew).Unix(), true) {
+		return Claims{}, fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+
+	if !claims.VerifyIssuedAt(now.Add(clockSkew).Unix(), false) {
+		return Claims{}, fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	}
+
+	if got, _ := claims["nonce"].(string); nonce == "" || got != nonce {
+		return Claims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+
+	result := Claims{
+		EmailVerified: verified(claims["email_verified"]),
+	}
+
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	result.GivenName, _ = claims["given_name"].(string)
+	result.FamilyName, _ = claims["family_name"].(string)
+
+	if result.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+
+	return result, nil
+}
+
+func (p *Provider) scopes() []string {
+	if len(p.Scopes) == 0 {
+		return []string{"openid", "email", "profile"}
+	}
+
+	return p.Scopes
+}
+
+// discover reads the discovery document of the issuer, once it succeeds it
+// is kept
+func (p *Provider) discover(ctx context.Context) (Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return *p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	var metadata Metadata
+
+	status, err := p.do(req, &metadata)
+
+	if err != nil {
+		return Metadata{}, fmt.Errorf("discovery: %w", err)
+	}
+
+	if status != http.StatusOK {
+		return Metadata{}, fmt.Errorf("discovery answered %d", status)
+	}
+
+	// The issuer must be the one configured, or tokens of another would pass
+	if metadata.Issuer != p.Issuer {
+		return Metadata{}, fmt.Errorf("discovery returned issuer %q instead of %q", metadata.Issuer, p.Issuer)
+	}
+
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JwksUri == "" {
+		return Metadata{}, errors.New("discovery document is missing endpoints")
+	}
+
+	p.metadata = &metadata
+
+	return metadata, nil
+}
+
+// key returns the signing key with the id, the key set is fetched again when
+// it isn't known since providers rotate their keys
+func (p *Provider) key(ctx context.Context, metadata Metadata, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+
+	keys, err := p.fetchKeys(ctx, metadata.JwksUri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	// A single key may be used without an id
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, jwksUri string) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksUri, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+
+	status, err := p.do(req, &set)
+
+	if err != nil {
+		return nil, fmt.Errorf("key set: %w", err)
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("key set answered %d", status)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	return keys, nil
+}
+
+// do sends the request and decodes the JSON answer into v, whatever its status
+func (p *Provider) do(req *http.Request, v any) (int, error) {
+	client := p.Client
+
+	if client == nil {
+		client = tracing.Client
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	if err != nil {
+		return resp.StatusCode, err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("invalid response: %w", err)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// audienceContains reads the aud claim, a string or a list of them
+func audienceContains(aud any, clientId string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientId
+	case []any:
+		for _, item := range aud {
+			if item == clientId {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// verified reads email_verified, some providers send it as a string
+func verified(claim any) bool {
+	switch claim := claim.(type) {
+	case bool:
+		return claim
+	case string:
+		return claim == "true"
+	}
+
+	return false
+}
@@ -0,0 +1,139 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"project/oidc"
+	"project/oidc/oidctest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var jane = oidc.Claims{Subject: "1234", Email: "jane@email.com", EmailVerified: true, Name: "Jane Doe", GivenName: "Jane", FamilyName: "Doe"}
+
+func TestChallenge(t *testing.T) {
+	a := assert.New(t)
+
+	// RFC 7636 appendix B
+	a.Equal("E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", oidc.Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+
+	verifier, err := oidc.NewVerifier()
+	a.Nil(err)
+	a.Len(verifier, 43)
+}
+
+func TestProvider_Flow(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	issuer := oidctest.NewIssuer(t)
+	issuer.SetUser(jane)
+	provider := issuer.Provider("test", "https://app.example.com/login/oidc/test")
+
+	verifier, _ := oidc.NewVerifier()
+
+	authorizationUrl, err := provider.AuthCodeUrl(ctx, "state", "nonce", oidc.Challenge(verifier))
+	a.Nil(err)
+
+	parsed, err := url.Parse(authorizationUrl)
+	a.Nil(err)
+	a.Equal(issuer.URL+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+	a.Equal("openid email profile", parsed.Query().Get("scope"))
+	a.Equal("S256", parsed.Query().Get("code_challenge_method"))
+
+	code, state := issuer.Login(t, authorizationUrl)
+	a.Equal("state", state)
+
+	// The code is bound to the verifier
+	wrong, _ := oidc.NewVerifier()
+	_, err = provider.Exchange(ctx, code, wrong)
+	a.ErrorContains(err, "invalid_grant")
+
+	code, _ = issuer.Login(t, authorizationUrl)
+	idToken, err := provider.Exchange(ctx, code, verifier)
+	a.Nil(err)
+
+	_, err = provider.Exchange(ctx, code, verifier)
+	a.ErrorContains(err, "invalid_grant")
+
+	_, err = provider.Verify(ctx, idToken, "other nonce")
+	a.ErrorIs(err, oidc.ErrInvalidToken)
+
+	claims, err := provider.Verify(ctx, idToken, "nonce")
+	a.Nil(err)
+	a.Equal(jane, claims)
+}
+
+func TestProvider_Verify(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	issuer := oidctest.NewIssuer(t)
+	provider := issuer.Provider("test", "https://app.example.com/login/oidc/test")
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            issuer.URL,
+			"aud":            []string{"other", issuer.ClientId},
+			"sub":            "1234",
+			"email":          "jane@email.com",
+			"email_verified": "true",
+			"nonce":          "nonce",
+			"iat":            time.Now().Unix(),
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		}
+	}
+
+	token, _ := issuer.Sign(valid())
+	claims, err := provider.Verify(ctx, token, "nonce")
+	a.Nil(err)
+	a.True(claims.EmailVerified)
+
+	tests := map[string]func(jwt.MapClaims){
+		"issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"audience": func(c jwt.MapClaims) { c["aud"] = "other" },
+		"expired":  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() },
+		"future":   func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() },
+		"subject":  func(c jwt.MapClaims) { delete(c, "sub") },
+	}
+
+	for name, change := range tests {
+		claims := valid()
+		change(claims)
+
+		token, _ := issuer.Sign(claims)
+		_, err := provider.Verify(ctx, token, "nonce")
+		a.ErrorIs(err, oidc.ErrInvalidToken, name)
+	}
+
+	// Tokens signed with another key or not signed at all
+	other := oidctest.NewIssuer(t)
+	forged, _ := other.Sign(valid())
+	_, err = provider.Verify(ctx, forged, "nonce")
+	a.ErrorIs(err, oidc.ErrInvalidToken)
+
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	_, err = provider.Verify(ctx, unsigned, "nonce")
+	a.ErrorIs(err, oidc.ErrInvalidToken)
+}
+
+func TestProvider_Discovery(t *testing.T) {
+	a := assert.New(t)
+	issuer := oidctest.NewIssuer(t)
+
+	// The discovery document must name the issuer configured
+	provider := issuer.Provider("test", "https://app.example.com/login/oidc/test")
+	provider.Issuer = issuer.URL + "/"
+
+	_, err := provider.AuthCodeUrl(context.Background(), "state", "nonce", "challenge")
+	a.ErrorContains(err, "instead of")
+
+	provider = issuer.Provider("test", "https://app.example.com/login/oidc/test")
+	issuer.Close()
+
+	_, err = provider.AuthCodeUrl(context.Background(), "state", "nonce", "challenge")
+	a.NotNil(err)
+	a.False(errors.Is(err, oidc.ErrInvalidToken))
+}
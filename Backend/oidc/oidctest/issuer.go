@@ -0,0 +1,242 @@
+// Package oidctest runs a local OpenID Connect issuer for tests. It logs in
+// the user set with SetUser as soon as the browser reaches the authorization
+// endpoint, and checks the client credentials, redirect URI and PKCE verifier
+// the way a real provider does when the code is exchanged.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"project/oidc"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const keyId = "test-key"
+
+// Issuer is the mock provider, its URL is the issuer identifier
+type Issuer struct {
+	*httptest.Server
+
+	ClientId     string
+	ClientSecret string
+
+	mu     sync.Mutex
+	user   oidc.Claims
+	key    *rsa.PrivateKey
+	grants map[string]grant
+}
+
+// grant is what an authorization code was issued for
+type grant struct {
+	user        oidc.Claims
+	redirectUri string
+	challenge   string
+	nonce       string
+}
+
+// NewIssuer starts an issuer for the client "client" with the secret
+// "secret", it is closed when the test ends
+func NewIssuer(t testing.TB) *Issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := &Issuer{ClientId: "client", ClientSecret: "secret", key: key, grants: map[string]grant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	mux.HandleFunc("/authorize", issuer.authorize)
+	mux.HandleFunc("/token", issuer.token)
+
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+
+	return issuer
+}
+
+// Provider is the relying party side of the issuer, redirecting to the URL
+func (i *Issuer) Provider(name string, redirectUrl string) *oidc.Provider {
+	return &oidc.Provider{
+		Name:         name,
+		DisplayName:  "Test",
+		Issuer:       i.URL,
+		ClientId:     i.ClientId,
+		ClientSecret: i.ClientSecret,
+		RedirectUrl:  redirectUrl,
+		Client:       i.Client(),
+	}
+}
+
+// SetUser sets the user the next logins are for
+func (i *Issuer) SetUser(user oidc.Claims) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.user = user
+}
+
+// Login follows the authorization URL as a browser would, returning the code
+// and the state the issuer redirected back with
+func (i *Issuer) Login(t testing.TB, authorizationUrl string) (string, string) {
+	client := i.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	resp, err := client.Get(authorizationUrl)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization answered %d", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oidc.Metadata{
+		Issuer:                i.URL,
+		AuthorizationEndpoint: i.URL + "/authorize",
+		TokenEndpoint:         i.URL + "/token",
+		JwksUri:               i.URL + "/jwks",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	e := big.NewInt(int64(i.key.E)).Bytes()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": keyId,
+			"n":   base64.RawURLEncoding.EncodeToString(i.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(e),
+		}},
+	})
+}
+
+func (i *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("client_id") != i.ClientId || query.Get("response_type") != "code" ||
+		query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+
+	i.mu.Lock()
+	i.grants[code] = grant{user: i.user, redirectUri: query.Get("redirect_uri"), challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	i.mu.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	clientId, clientSecret, _ := r.BasicAuth()
+
+	if clientId != i.ClientId || clientSecret != i.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostFormValue("code")
+
+	// Codes are single use
+	i.mu.Lock()
+	grant, ok := i.grants[code]
+	delete(i.grants, code)
+	i.mu.Unlock()
+
+	if r.PostFormValue("grant_type") != "authorization_code" || !ok || grant.redirectUri != r.PostFormValue("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	idToken, err := i.Sign(jwt.MapClaims{
+		"iss":            i.URL,
+		"aud":            i.ClientId,
+		"sub":            grant.user.Subject,
+		"email":          grant.user.Email,
+		"email_verified": grant.user.EmailVerified,
+		"name":           grant.user.Name,
+		"given_name":     grant.user.GivenName,
+		"family_name":    grant.user.FamilyName,
+		"nonce":          grant.nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	})
+
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"access_token": randomString(), "token_type": "Bearer", "expires_in": 3600, "id_token": idToken})
+}
+
+// Sign signs the claims with the key of the issuer, to make up tokens
+func (i *Issuer) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyId
+
+	return token.SignedString(i.key)
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,413 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902)
+// documents to JSON values
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Media types of the patch formats
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+var (
+	// ErrInvalid is returned for malformed patch documents
+	ErrInvalid = errors.New("invalid patch")
+
+	// ErrNotApplicable is returned when an operation targets a value that doesn't exist
+	ErrNotApplicable = errors.New("patch does not apply")
+
+	// ErrTestFailed is returned when a test operation doesn't match
+	ErrTestFailed = errors.New("patch test failed")
+)
+
+// Merge applies a JSON Merge Patch to doc: the members of the patch replace
+// those of doc, recursively for objects, and null members are removed
+func Merge(doc []byte, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mergePatch, err := decode(patch)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	return json.Marshal(merge(target, mergePatch))
+}
+
+func merge(target any, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+
+	if !ok {
+		targetObject = map[string]any{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+
+		targetObject[key] = merge(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+// Operation is a step of a JSON Patch
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply applies a JSON Patch to doc. The operations run in order and the
+// patch is applied entirely or not at all.
+func Apply(doc []byte, patch []byte) ([]byte, error) {
+	root, err := decode(doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var operations []Operation
+
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	for i, operation := range operations {
+		root, err = operation.apply(root)
+
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+func (o Operation) apply(root any) (any, error) {
+	path, err := parsePointer(o.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.Op {
+	case "add", "replace", "test":
+		if len(o.Value) == 0 {
+			return nil, fmt.Errorf("%w: %s needs a value", ErrInvalid, o.Op)
+		}
+
+		value, err := decode(o.Value)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+
+		switch o.Op {
+		case "add":
+			return add(root, path, value)
+		case "replace":
+			if root, err = remove(root, path); err != nil {
+				return nil, err
+			}
+			return add(root, path, value)
+		default:
+			current, err := get(root, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if !equal(current, value) {
+				return nil, fmt.Errorf("%w: %s", ErrTestFailed, o.Path)
+			}
+
+			return root, nil
+		}
+	case "remove":
+		return remove(root, path)
+	case "move", "copy":
+		from, err := parsePointer(o.From)
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := get(root, from)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if o.Op == "copy" {
+			return add(root, path, clone(value))
+		}
+
+		if strings.HasPrefix(o.Path+"/", o.From+"/") && o.Path != o.From {
+			return nil, fmt.Errorf("%w: can't move %s into itself", ErrInvalid, o.From)
+		}
+
+		if root, err = remove(root, from); err != nil {
+			return nil, err
+		}
+
+		return add(root, path, value)
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalid, o.Op)
+	}
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: path %q must start with /", ErrInvalid, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+func get(node any, path []string) (any, error) {
+	for _, token := range path {
+		switch container := node.(type) {
+		case map[string]any:
+			value, ok := container[token]
+
+			if !ok {
+				return nil, fmt.Errorf("%w: %q not found", ErrNotApplicable, token)
+			}
+
+			node = value
+		case []any:
+			index, err := arrayIndex(token, len(container)-1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			node = container[index]
+		default:
+			return nil, fmt.Errorf("%w: %q is not in an object or array", ErrNotApplicable, token)
+		}
+	}
+
+	return node, nil
+}
+
+// update runs fn on the parent of the value at path and stores the parent it
+// returns, arrays being values that change when items are added or removed
+func update(node any, path []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+
+	child, err := get(node, path[:1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	child, err = update(child, path[1:], fn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := node.(type) {
+	case map[string]any:
+		container[path[0]] = child
+	case []any:
+		index, _ := arrayIndex(path[0], len(container)-1)
+		container[index] = child
+	}
+
+	return node, nil
+}
+
+func add(root any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(root, path, func(parent any, token string) (any, error) {
+		switch container := parent.(type) {
+		case map[string]any:
+			container[token] = value
+			return container, nil
+		case []any:
+			index := len(container)
+
+			if token != "-" {
+				var err error
+				if index, err = arrayIndex(token, len(container)); err != nil {
+					return nil, err
+				}
+			}
+
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+
+			return container, nil
+		default:
+			return nil, fmt.Errorf("%w: %q is not in an object or array", ErrNotApplicable, token)
+		}
+	})
+}
+
+func remove(root any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: can't remove the whole document", ErrNotApplicable)
+	}
+
+	return update(root, path, func(parent any, token string) (any, error) {
+		switch container := parent.(type) {
+		case map[string]any:
+			if _, ok := container[token]; !ok {
+				return nil, fmt.Errorf("%w: %q not found", ErrNotApplicable, token)
+			}
+
+			delete(container, token)
+			return container, nil
+		case []any:
+			index, err := arrayIndex(token, len(container)-1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return append(container[:index], container[index+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%w: %q is not in an object or array", ErrNotApplicable, token)
+		}
+	})
+}
+
+// arrayIndex parses an array index token, which must be between 0 and max
+func arrayIndex(token string, max int) (int, error) {
+	index, err := strconv.Atoi(token)
+
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: %q is not an array index", ErrNotApplicable, token)
+	}
+
+	if index > max {
+		return 0, fmt.Errorf("%w: index %d out of range", ErrNotApplicable, index)
+	}
+
+	return index, nil
+}
+
+// decode reads a JSON value keeping numbers as written
+func decode(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value any
+
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	if decoder.More() {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+
+	return value, nil
+}
+
+func clone(value any) any {
+	switch typed := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(typed))
+		for key, item := range typed {
+			copied[key] = clone(item)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(typed))
+		for i, item := range typed {
+			copied[i] = clone(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
+// equal compares JSON values, numbers by their value so 1 equals 1.0
+func equal(a any, b any) bool {
+	switch typedA := a.(type) {
+	case map[string]any:
+		typedB, ok := b.(map[string]any)
+
+		if !ok || len(typedA) != len(typedB) {
+			return false
+		}
+
+		for key, item := range typedA {
+			if other, ok := typedB[key]; !ok || !equal(item, other) {
+				return false
+			}
+		}
+
+		return true
+	case []any:
+		typedB, ok := b.([]any)
+
+		if !ok || len(typedA) != len(typedB) {
+			return false
+		}
+
+		for i := range typedA {
+			if !equal(typedA[i], typedB[i]) {
+				return false
+			}
+		}
+
+		return true
+	case json.Number:
+		typedB, ok := b.(json.Number)
+
+		if !ok {
+			return false
+		}
+
+		numberA, errA := typedA.Float64()
+		numberB, errB := typedB.Float64()
+
+		return errA == nil && errB == nil && numberA == numberB
+	default:
+		return a == b
+	}
+}
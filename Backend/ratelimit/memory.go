@@ -0,0 +1,196 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// expires is when the bucket is full again and can be dropped
+	expires time.Time
+}
+
+type failures struct {
+	Failures
+	expires time.Time
+}
+
+// MemoryStore keeps every bucket and counter in this process
+type MemoryStore struct {
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	failures map[string]*failures
+	// marks holds the locks and marks until they expire
+	marks map[string]time.Time
+	now   func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  map[string]*bucket{},
+		failures: map[string]*failures{},
+		marks:    map[string]time.Time{},
+		now:      time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Decision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	interval := limit.interval()
+	b, ok := s.buckets[key]
+
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+
+	// Refill the tokens earned since the last request
+	b.tokens += float64(now.Sub(b.updated)) / float64(interval)
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) * float64(interval))
+		return Decision{Allowed: false, RetryAfter: wait}, nil
+	}
+
+	b.tokens--
+	b.expires = now.Add(time.Duration((float64(limit.Burst) - b.tokens) * float64(interval)))
+
+	return Decision{Allowed: true, Remaining: int(b.tokens)}, nil
+}
+
+func (s *MemoryStore) Fail(_ context.Context, key string, window time.Duration) (Failures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	f, ok := s.failures[key]
+
+	if !ok || now.After(f.expires) {
+		f = &failures{}
+		s.failures[key] = f
+	}
+
+	f.Count++
+	f.Last = now
+	f.expires = now.Add(window)
+
+	return f.Failures, nil
+}
+
+func (s *MemoryStore) Failures(_ context.Context, key string) (Failures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.failures[key]
+
+	if !ok || s.now().After(f.expires) {
+		return Failures{}, nil
+	}
+
+	return f.Failures, nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+
+	return nil
+}
+
+func (s *MemoryStore) Lock(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	if expires, ok := s.marks[key]; ok && now.Before(expires) {
+		return false, nil
+	}
+
+	s.marks[key] = now.Add(ttl)
+
+	return true, nil
+}
+
+func (s *MemoryStore) Unlock(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.marks, key)
+
+	return nil
+}
+
+func (s *MemoryStore) Mark(_ context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.marks[key] = s.now().Add(ttl)
+
+	return nil
+}
+
+func (s *MemoryStore) Marked(_ context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expires, ok := s.marks[key]
+
+	return ok && s.now().Before(expires), nil
+}
+
+// Sweep drops the full buckets and expired counters and marks, so keys of clients that
+// went away don't accumulate
+func (s *MemoryStore) Sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	for key, b := range s.buckets {
+		if now.After(b.expires) {
+			delete(s.buckets, key)
+		}
+	}
+
+	for key, f := range s.failures {
+		if now.After(f.expires) {
+			delete(s.failures, key)
+		}
+	}
+
+	for key, expires := range s.marks {
+		if !now.Before(expires) {
+			delete(s.marks, key)
+		}
+	}
+}
+
+// Run sweeps the store every interval until ctx is done
+func (s *MemoryStore) Run(interval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.Sweep()
+			}
+		}
+	}
+}
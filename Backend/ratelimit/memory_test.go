@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestStore() (*MemoryStore, *clock) {
+	c := &clock{now: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	store.now = func() time.Time { return c.now }
+
+	return store, c
+}
+
+func TestParseLimit(t *testing.T) {
+	a := assert.New(t)
+
+	limit, err := ParseLimit("10/1m")
+	a.Nil(err)
+	a.Equal(Limit{Burst: 10, Period: time.Minute}, limit)
+	a.Equal("10/1m0s", limit.String())
+
+	for _, text := range []string{"10", "0/1m", "ten/1m", "10/soon", "10/-1m"} {
+		_, err := ParseLimit(text)
+		a.NotNil(err, text)
+	}
+}
+
+func TestMemoryStore_Take(t *testing.T) {
+	a := assert.New(t)
+	store, clock := newTestStore()
+	ctx := context.Background()
+	limit := Limit{Burst: 2, Period: time.Minute}
+
+	first, _ := store.Take(ctx, "ip", limit)
+	second, _ := store.Take(ctx, "ip", limit)
+	third, _ := store.Take(ctx, "ip", limit)
+
+	a.True(first.Allowed)
+	a.Equal(1, first.Remaining)
+	a.True(second.Allowed)
+	a.False(third.Allowed)
+	a.Equal(30*time.Second, third.RetryAfter)
+
+	// Other keys have their own bucket
+	other, _ := store.Take(ctx, "other", limit)
+	a.True(other.Allowed)
+
+	// One token is back after half the period
+	clock.advance(30 * time.Second)
+	fourth, _ := store.Take(ctx, "ip", limit)
+	a.True(fourth.Allowed)
+}
+
+func TestMemoryStore_Failures(t *testing.T) {
+	a := assert.New(t)
+	store, clock := newTestStore()
+	ctx := context.Background()
+
+	store.Fail(ctx, "login:ana", time.Minute)
+	failures, _ := store.Fail(ctx, "login:ana", time.Minute)
+	a.Equal(2, failures.Count)
+	a.Equal(clock.now, failures.Last)
+
+	// The count starts over once the window passes without failures
+	clock.advance(2 * time.Minute)
+	failures, _ = store.Failures(ctx, "login:ana")
+	a.Equal(0, failures.Count)
+
+	store.Fail(ctx, "login:ana", time.Minute)
+	a.Nil(store.Reset(ctx, "login:ana"))
+	failures, _ = store.Failures(ctx, "login:ana")
+	a.Equal(0, failures.Count)
+}
+
+func TestMemoryStore_Lock(t *testing.T) {
+	a := assert.New(t)
+	store, clock := newTestStore()
+	ctx := context.Background()
+
+	taken, _ := store.Lock(ctx, "login:ana:attempt", time.Minute)
+	a.True(taken)
+	taken, _ = store.Lock(ctx, "login:ana:attempt", time.Minute)
+	a.False(taken)
+
+	a.Nil(store.Unlock(ctx, "login:ana:attempt"))
+	taken, _ = store.Lock(ctx, "login:ana:attempt", time.Minute)
+	a.True(taken)
+
+	// A lock never let go expires
+	clock.advance(time.Minute)
+	taken, _ = store.Lock(ctx, "login:ana:attempt", time.Minute)
+	a.True(taken)
+}
+
+func TestMemoryStore_Mark(t *testing.T) {
+	a := assert.New(t)
+	store, clock := newTestStore()
+	ctx := context.Background()
+
+	marked, _ := store.Marked(ctx, "login:ana:known:10.0.0.1")
+	a.False(marked)
+
+	a.Nil(store.Mark(ctx, "login:ana:known:10.0.0.1", time.Hour))
+	marked, _ = store.Marked(ctx, "login:ana:known:10.0.0.1")
+	a.True(marked)
+
+	// Marking again pushes the expiry back
+	clock.advance(30 * time.Minute)
+	a.Nil(store.Mark(ctx, "login:ana:known:10.0.0.1", time.Hour))
+	clock.advance(45 * time.Minute)
+	marked, _ = store.Marked(ctx, "login:ana:known:10.0.0.1")
+	a.True(marked)
+
+	clock.advance(time.Hour)
+	marked, _ = store.Marked(ctx, "login:ana:known:10.0.0.1")
+	a.False(marked)
+}
+
+func TestMemoryStore_Sweep(t *testing.T) {
+	a := assert.New(t)
+	store, clock := newTestStore()
+	ctx := context.Background()
+
+	store.Take(ctx, "ip", Limit{Burst: 1, Period: time.Minute})
+	store.Fail(ctx, "login:ana", time.Hour)
+	store.Lock(ctx, "login:ana:attempt", time.Minute)
+	store.Mark(ctx, "login:ana:known:10.0.0.1", time.Hour)
+
+	clock.advance(2 * time.Minute)
+	store.Sweep()
+
+	a.Len(store.buckets, 0)
+	a.Len(store.failures, 1)
+	a.Len(store.marks, 1)
+}
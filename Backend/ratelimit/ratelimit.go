@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket holding up to Burst tokens, refilled with Burst
+// tokens every Period
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ParseLimit reads a limit written as "<requests>/<period>", e.g. "10/1m"
+func ParseLimit(text string) (Limit, error) {
+	count, period, found := strings.Cut(text, "/")
+
+	if !found {
+		return Limit{}, fmt.Errorf("limit %q must be <requests>/<period>", text)
+	}
+
+	burst, err := strconv.Atoi(count)
+
+	if err != nil || burst <= 0 {
+		return Limit{}, fmt.Errorf("limit %q must allow a positive number of requests", text)
+	}
+
+	duration, err := time.ParseDuration(period)
+
+	if err != nil || duration <= 0 {
+		return Limit{}, fmt.Errorf("limit %q must have a positive period", text)
+	}
+
+	return Limit{Burst: burst, Period: duration}, nil
+}
+
+func (l Limit) String() string {
+	return strconv.Itoa(l.Burst) + "/" + l.Period.String()
+}
+
+// interval is the time it takes to refill one token
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Burst)
+}
+
+// Decision is the outcome of taking a token
+type Decision struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Failures counts the recent failures recorded at a key
+type Failures struct {
+	Count int
+	Last  time.Time
+}
+
+// Store keeps the buckets, failure counters and marks. MemoryStore serves a
+// single instance, replicas behind a load balancer need a shared implementation
+// (e.g. on Redis) so a client can't spread its attempts across them.
+type Store interface {
+	// Take removes a token from the bucket at key
+	Take(ctx context.Context, key string, limit Limit) (Decision, error)
+	// Fail records a failure at key, the count starts over once window has
+	// passed since the last failure
+	Fail(ctx context.Context, key string, window time.Duration) (Failures, error)
+	// Failures returns the failures recorded at key within their window
+	Failures(ctx context.Context, key string) (Failures, error)
+	// Reset forgets the failures recorded at key
+	Reset(ctx context.Context, key string) error
+	// Lock holds key for ttl unless it is held already, reporting whether it
+	// was taken. Unlock lets it go before ttl.
+	Lock(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	Unlock(ctx context.Context, key string) error
+	// Mark remembers key for ttl, Marked tells whether it still is
+	Mark(ctx context.Context, key string, ttl time.Duration) error
+	Marked(ctx context.Context, key string) (bool, error)
+}
+
+// RetryAfterSeconds rounds a wait up to whole seconds for the Retry-After header
+func RetryAfterSeconds(wait time.Duration) int {
+	return int(math.Max(1, math.Ceil(wait.Seconds())))
+}
@@ -1,17 +1,20 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"project/auth"
 	"project/client"
 	"project/dto"
 	"project/model"
+	"project/tracing"
 )
 
 type amenityService struct{}
 
 type amenityServiceInterface interface {
-	InsertAmenity(amenityDto dto.AmenityDto) (dto.AmenityDto, error)
-	GetAmenities() (dto.AmenitiesDto, error)
+	InsertAmenity(ctx context.Context, amenityDto dto.AmenityDto) (dto.AmenityDto, error)
+	GetAmenities(ctx context.Context) (dto.AmenitiesDto, error)
 }
 
 var AmenityService amenityServiceInterface
@@ -20,26 +23,47 @@ func init() {
 	AmenityService = &amenityService{}
 }
 
-func (s *amenityService) InsertAmenity(amenityDto dto.AmenityDto) (dto.AmenityDto, error) {
+func (s *amenityService) InsertAmenity(ctx context.Context, amenityDto dto.AmenityDto) (dto.AmenityDto, error) {
+	ctx, span := tracing.Start(ctx, "AmenityService.InsertAmenity")
+	defer span.End()
+
+	if _, err := authorize(ctx, auth.CreateHotels); err != nil {
+		return amenityDto, err
+	}
+
 	var amenity model.Amenity
 
 	amenity.Name = amenityDto.Name
 
-	amenity = client.AmenityClient.InsertAmenity(amenity)
+	amenity, err := client.AmenityClient.InsertAmenity(ctx, amenity)
+
+	if errors.Is(err, client.ErrConflict) {
+		return amenityDto, ErrAmenityExists
+	}
 
-	if amenity.Id == 0 {
-		return amenityDto, errors.New("error creating amenity")
+	if err != nil {
+		return amenityDto, err
 	}
 
 	amenityDto.Id = amenity.Id
 
+	AuditService.Record(ctx, AuditCreate, "amenity", amenity.Id, nil, amenityDto)
+
 	return amenityDto, nil
 }
 
-func (s *amenityService) GetAmenities() (dto.AmenitiesDto, error) {
-	var amenities model.Amenities = client.AmenityClient.GetAmenities()
+func (s *amenityService) GetAmenities(ctx context.Context) (dto.AmenitiesDto, error) {
+	ctx, span := tracing.Start(ctx, "AmenityService.GetAmenities")
+	defer span.End()
+
 	var amenitiesDto dto.AmenitiesDto
 
+	amenities, err := client.AmenityClient.GetAmenities(ctx)
+
+	if err != nil {
+		return amenitiesDto, err
+	}
+
 	for _, amenity := range amenities {
 		var amenityDto dto.AmenityDto
 		amenityDto.Id = amenity.Id
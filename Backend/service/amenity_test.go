@@ -1,6 +1,8 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"project/client"
 	"project/dto"
@@ -14,36 +16,44 @@ func init() {
 	client.AmenityClient = &TestAmenity{}
 }
 
-func (t TestAmenity) InsertAmenity(amenity model.Amenity) model.Amenity {
+func (t TestAmenity) InsertAmenity(ctx context.Context, amenity model.Amenity) (model.Amenity, error) {
 	if amenity.Name == "" {
-		amenity.Id = 0
-	} else {
-		amenity.Id = 1
+		return amenity, errors.New("error creating amenity")
 	}
 
-	return amenity
+	if amenity.Name == "Pool" {
+		return amenity, client.ErrConflict
+	}
+
+	amenity.Id = 1
+
+	return amenity, nil
 }
 
-func (t TestAmenity) GetAmenityById(id int) model.Amenity {
+func (t TestAmenity) GetAmenityById(ctx context.Context, id int) (model.Amenity, error) {
 	var amenity model.Amenity
 
 	if id > 10 {
-		amenity.Id = 0
-	} else {
-		amenity.Id = id
+		return amenity, client.ErrNotFound
 	}
 
-	return amenity
+	amenity.Id = id
+
+	return amenity, nil
 }
 
-func (t TestAmenity) GetAmenityByName(name string) model.Amenity {
+func (t TestAmenity) GetAmenityByName(ctx context.Context, name string) (model.Amenity, error) {
+	if name == "Unknown" {
+		return model.Amenity{}, client.ErrNotFound
+	}
+
 	return model.Amenity{
 		Id:   1,
 		Name: name,
-	}
+	}, nil
 }
 
-func (t TestAmenity) GetAmenities() model.Amenities {
+func (t TestAmenity) GetAmenities(ctx context.Context) (model.Amenities, error) {
 	return model.Amenities{
 		model.Amenity{
 			Id:   1,
@@ -54,7 +64,7 @@ func (t TestAmenity) GetAmenities() model.Amenities {
 			Id:   2,
 			Name: "Pool",
 		},
-	}
+	}, nil
 }
 
 func TestInsertAmenity_Service_Error(t *testing.T) {
@@ -62,7 +72,7 @@ func TestInsertAmenity_Service_Error(t *testing.T) {
 	a := assert.New(t)
 	var amenity dto.AmenityDto
 
-	_, err := AmenityService.InsertAmenity(amenity)
+	_, err := AmenityService.InsertAmenity(adminCtx, amenity)
 
 	expectedResult := "error creating amenity"
 
@@ -70,12 +80,26 @@ func TestInsertAmenity_Service_Error(t *testing.T) {
 	a.Equal(expectedResult, err.Error())
 }
 
+func TestInsertAmenity_Service_Conflict(t *testing.T) {
+
+	a := assert.New(t)
+	amenity := dto.AmenityDto{Name: "Pool"}
+
+	_, err := AmenityService.InsertAmenity(adminCtx, amenity)
+
+	expectedResult := "amenity already exists"
+
+	a.NotNil(err)
+	a.ErrorIs(err, ErrConflict)
+	a.Equal(expectedResult, err.Error())
+}
+
 func TestInsertAmenity_Service_Success(t *testing.T) {
 
 	a := assert.New(t)
 	amenity := dto.AmenityDto{Name: "Example"}
 
-	result, err := AmenityService.InsertAmenity(amenity)
+	result, err := AmenityService.InsertAmenity(adminCtx, amenity)
 
 	expectedResult := dto.AmenityDto{
 		Id:   1,
@@ -102,7 +126,7 @@ func TestGetAmenities_Service(t *testing.T) {
 		},
 	}
 
-	result, err := AmenityService.GetAmenities()
+	result, err := AmenityService.GetAmenities(context.Background())
 
 	a.Nil(err)
 	a.Equal(expectedResult, result)
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"project/auth"
+	"project/client"
+	"project/dto"
+	"project/model"
+	"project/tracing"
+	"time"
+)
+
+type assignmentService struct{}
+
+type assignmentServiceInterface interface {
+	GetAssignedHotels(ctx context.Context, userId int) (dto.AssignedHotelsDto, error)
+	AssignHotel(ctx context.Context, userId int, hotelId int) (dto.AssignedHotelsDto, error)
+	UnassignHotel(ctx context.Context, userId int, hotelId int) (dto.AssignedHotelsDto, error)
+}
+
+var AssignmentService assignmentServiceInterface
+
+func init() {
+	AssignmentService = &assignmentService{}
+}
+
+// GetAssignedHotels lists the hotels assigned to the user, managers can see
+// their own
+func (s *assignmentService) GetAssignedHotels(ctx context.Context, userId int) (dto.AssignedHotelsDto, error) {
+	ctx, span := tracing.Start(ctx, "AssignmentService.GetAssignedHotels")
+	defer span.End()
+
+	if err := authorizeUser(ctx, userId, auth.ViewUsers); err != nil {
+		return dto.AssignedHotelsDto{}, err
+	}
+
+	_, err := client.UserClient.GetUserById(ctx, userId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return dto.AssignedHotelsDto{}, ErrUserNotFound
+	}
+
+	if err != nil {
+		return dto.AssignedHotelsDto{}, err
+	}
+
+	return assignedHotels(ctx, userId)
+}
+
+// AssignHotel lets the manager run the hotel, assigning it again changes nothing
+func (s *assignmentService) AssignHotel(ctx context.Context, userId int, hotelId int) (dto.AssignedHotelsDto, error) {
+	ctx, span := tracing.Start(ctx, "AssignmentService.AssignHotel")
+	defer span.End()
+
+	if _, err := authorize(ctx, auth.ManageUsers); err != nil {
+		return dto.AssignedHotelsDto{}, err
+	}
+
+	user, err := client.UserClient.GetUserById(ctx, userId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return dto.AssignedHotelsDto{}, ErrUserNotFound
+	}
+
+	if err != nil {
+		return dto.AssignedHotelsDto{}, err
+	}
+
+	if user.Role != auth.RoleManager {
+		return dto.AssignedHotelsDto{}, ErrUserNotManager
+	}
+
+	_, err = client.HotelClient.GetHotelById(ctx, hotelId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return dto.AssignedHotelsDto{}, ErrHotelNotFound
+	}
+
+	if err != nil {
+		return dto.AssignedHotelsDto{}, err
+	}
+
+	assigned, err := assignedHotels(ctx, userId)
+
+	if err != nil || containsId(assigned.HotelIds, hotelId) {
+		return assigned, err
+	}
+
+	err = client.AssignmentClient.AssignHotel(ctx, model.HotelAssignment{UserId: userId, HotelId: hotelId, CreatedAt: time.Now().UTC()})
+
+	if err != nil {
+		return dto.AssignedHotelsDto{}, err
+	}
+
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": userId, "hotel_id": hotelId}).Info("Hotel assigned")
+	AuditService.Record(ctx, AuditCreate, "hotel_assignment", hotelId, nil, dto.HotelAssignmentDto{UserId: userId, HotelId: hotelId})
+
+	return assignedHotels(ctx, userId)
+}
+
+// UnassignHotel takes the hotel away from the user
+func (s *assignmentService) UnassignHotel(ctx context.Context, userId int, hotelId int) (dto.AssignedHotelsDto, error) {
+	ctx, span := tracing.Start(ctx, "AssignmentService.UnassignHotel")
+	defer span.End()
+
+	if _, err := authorize(ctx, auth.ManageUsers); err != nil {
+		return dto.AssignedHotelsDto{}, err
+	}
+
+	err := client.AssignmentClient.UnassignHotel(ctx, userId, hotelId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return dto.AssignedHotelsDto{}, ErrAssignmentNotFound
+	}
+
+	if err != nil {
+		return dto.AssignedHotelsDto{}, err
+	}
+
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": userId, "hotel_id": hotelId}).Info("Hotel unassigned")
+	AuditService.Record(ctx, AuditDelete, "hotel_assignment", hotelId, dto.HotelAssignmentDto{UserId: userId, HotelId: hotelId}, nil)
+
+	return assignedHotels(ctx, userId)
+}
+
+func assignedHotels(ctx context.Context, userId int) (dto.AssignedHotelsDto, error) {
+	hotelIds, err := client.AssignmentClient.GetAssignedHotelIds(ctx, userId)
+
+	if err != nil {
+		return dto.AssignedHotelsDto{}, err
+	}
+
+	if hotelIds == nil {
+		hotelIds = []int{}
+	}
+
+	return dto.AssignedHotelsDto{UserId: userId, HotelIds: hotelIds}, nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"project/auth"
+	"project/client"
+	"project/model"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAssignment keeps the hotels assigned to each user
+type TestAssignment struct {
+	hotels map[int][]int
+}
+
+func init() {
+	client.AssignmentClient = &TestAssignment{hotels: map[int][]int{}}
+}
+
+// newTestAssignments assigns hotel 1 to user 5, a manager
+func newTestAssignments(t *testing.T) *TestAssignment {
+	previous := client.AssignmentClient
+	mock := &TestAssignment{hotels: map[int][]int{5: {1}}}
+
+	client.AssignmentClient = mock
+	t.Cleanup(func() { client.AssignmentClient = previous })
+
+	return mock
+}
+
+// managerCtx acts as user 5, a manager
+var managerCtx = asUser(5, auth.RoleManager)
+
+func (t *TestAssignment) AssignHotel(ctx context.Context, assignment model.HotelAssignment) error {
+	if !containsId(t.hotels[assignment.UserId], assignment.HotelId) {
+		t.hotels[assignment.UserId] = append(t.hotels[assignment.UserId], assignment.HotelId)
+		sort.Ints(t.hotels[assignment.UserId])
+	}
+
+	return nil
+}
+
+func (t *TestAssignment) UnassignHotel(ctx context.Context, userId int, hotelId int) error {
+	for i, assigned := range t.hotels[userId] {
+		if assigned == hotelId {
+			t.hotels[userId] = append(t.hotels[userId][:i], t.hotels[userId][i+1:]...)
+			return nil
+		}
+	}
+
+	return client.ErrNotFound
+}
+
+func (t *TestAssignment) GetAssignedHotelIds(ctx context.Context, userId int) ([]int, error) {
+	return t.hotels[userId], nil
+}
+
+func TestAssignHotel_Service(t *testing.T) {
+
+	a := assert.New(t)
+	accounts := newTestAccounts(t)
+	mock := newTestAssignments(t)
+	audit := newTestAudit(t)
+
+	user := accounts.users[7]
+	user.Role = auth.RoleManager
+	accounts.users[7] = user
+
+	result, err := AssignmentService.AssignHotel(adminCtx, 7, 3)
+	a.Nil(err)
+	a.Equal(7, result.UserId)
+	a.Equal([]int{3}, result.HotelIds)
+
+	result, err = AssignmentService.AssignHotel(adminCtx, 7, 2)
+	a.Nil(err)
+	a.Equal([]int{2, 3}, result.HotelIds)
+	a.Len(audit.entries, 2)
+	a.Equal("hotel_assignment", audit.entries[1].Entity)
+	a.Equal(2, audit.entries[1].EntityId)
+
+	// Assigning it again changes nothing
+	result, err = AssignmentService.AssignHotel(adminCtx, 7, 2)
+	a.Nil(err)
+	a.Equal([]int{2, 3}, result.HotelIds)
+	a.Len(audit.entries, 2)
+
+	_, err = AssignmentService.AssignHotel(adminCtx, 7, 12)
+	a.ErrorIs(err, ErrHotelNotFound)
+
+	_, err = AssignmentService.AssignHotel(adminCtx, 12, 2)
+	a.ErrorIs(err, ErrUserNotFound)
+
+	// Only managers run hotels
+	_, err = AssignmentService.AssignHotel(adminCtx, 1, 2)
+	a.ErrorIs(err, ErrUserNotManager)
+
+	_, err = AssignmentService.AssignHotel(asUser(7, auth.RoleManager), 7, 4)
+	a.ErrorIs(err, ErrPermissionDenied)
+	a.Equal([]int{2, 3}, mock.hotels[7])
+}
+
+func TestUnassignHotel_Service(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAssignments(t)
+	audit := newTestAudit(t)
+
+	_, err := AssignmentService.UnassignHotel(managerCtx, 5, 1)
+	a.ErrorIs(err, ErrPermissionDenied)
+
+	result, err := AssignmentService.UnassignHotel(adminCtx, 5, 1)
+	a.Nil(err)
+	a.Equal([]int{}, result.HotelIds)
+	a.Empty(mock.hotels[5])
+	a.Len(audit.entries, 1)
+
+	_, err = AssignmentService.UnassignHotel(adminCtx, 5, 1)
+	a.ErrorIs(err, ErrAssignmentNotFound)
+}
+
+func TestGetAssignedHotels_Service(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAssignments(t)
+
+	// Managers see their own hotels
+	result, err := AssignmentService.GetAssignedHotels(managerCtx, 5)
+	a.Nil(err)
+	a.Equal([]int{1}, result.HotelIds)
+
+	_, err = AssignmentService.GetAssignedHotels(managerCtx, 6)
+	a.ErrorIs(err, ErrPermissionDenied)
+
+	result, err = AssignmentService.GetAssignedHotels(adminCtx, 6)
+	a.Nil(err)
+	a.Equal([]int{}, result.HotelIds)
+
+	_, err = AssignmentService.GetAssignedHotels(adminCtx, 12)
+	a.ErrorIs(err, ErrUserNotFound)
+}
@@ -0,0 +1,481 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"project/auth"
+	"project/client"
+	"project/dto"
+	"project/logging"
+	"project/metrics"
+	"project/model"
+	"project/tracing"
+	"sync"
+	"time"
+)
+
+// The actions recorded in the audit log
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditCancel  = "cancel"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+	// AuditAnonymize records an account deleted by its user, without the
+	// personal data it held
+	AuditAnonymize = "anonymize"
+)
+
+// DefaultAuditPageSize is the number of audit entries listed when no limit is given
+const DefaultAuditPageSize = 100
+
+// redactedAuditFields are recorded as changed, without their values
+var redactedAuditFields = map[string]bool{"password": true}
+
+// personalAuditFields are redacted as well for their entity. The log can't be
+// rewritten, so the personal data of users would outlive their account.
+var personalAuditFields = map[string]map[string]bool{
+	"user": {"name": true, "last_name": true, "dni": true, "email": true},
+}
+
+var redactedAuditValue = json.RawMessage(`"[REDACTED]"`)
+
+var errAuditChainBroken = errors.New("audit chain broken")
+
+// AuditKey keys the hash of every audit entry, it is set from the configuration
+var AuditKey []byte
+
+type auditService struct {
+	// mu orders the entries appended by this instance, so they don't race
+	// each other for the head of the chain
+	mu sync.Mutex
+	// pending holds the entries that couldn't be appended yet, oldest first
+	pending []model.AuditEntry
+}
+
+type auditServiceInterface interface {
+	Record(ctx context.Context, action string, entity string, entityId int, before any, after any)
+	RetryPending(ctx context.Context) (int, error)
+	GetAuditEntries(ctx context.Context, filterDto dto.AuditFilterDto) (dto.AuditEntriesDto, error)
+	ExportAuditEntries(ctx context.Context, filterDto dto.AuditFilterDto, fn func(entryDto dto.AuditEntryDto) error) error
+	VerifyAuditLog(ctx context.Context) (dto.AuditVerificationDto, error)
+}
+
+var AuditService auditServiceInterface
+
+func init() {
+	AuditService = &auditService{}
+}
+
+// Record appends a change to the audit log, with the fields that differ
+// between before and after. Either is nil when the entity was created or
+// removed. The change was already made, so an entry that can't be appended
+// is kept and appended again, ahead of the entries recorded after it, by the
+// next Record or RetryPending.
+func (s *auditService) Record(ctx context.Context, action string, entity string, entityId int, before any, after any) {
+	ctx, span := tracing.Start(ctx, "AuditService.Record")
+	defer span.End()
+
+	fields := logrus.Fields{"action": action, "entity": entity, "entity_id": entityId}
+
+	changes, err := auditDiff(entity, before, after)
+
+	if err != nil {
+		metrics.AuditFailures.Inc()
+		log.Ctx(ctx).WithError(err).WithFields(fields).Error("Failed to record audit entry")
+		return
+	}
+
+	entry := model.AuditEntry{
+		Action:    action,
+		Entity:    entity,
+		EntityId:  entityId,
+		Changes:   changes,
+		Ip:        auth.ClientIp(ctx),
+		RequestId: logging.RequestId(ctx),
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+
+	if identity, ok := auth.IdentityFrom(ctx); ok {
+		entry.ActorId = identity.UserId
+		entry.ActorRole = identity.Role
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = append(s.pending, entry)
+
+	if err := s.flush(ctx); err != nil {
+		// Logged in full, so the entry can still be told if the instance stops before it is appended
+		fields["changes"] = changes
+		fields["created_at"] = entry.CreatedAt
+		log.Ctx(ctx).WithError(err).WithFields(fields).WithField("pending", len(s.pending)).Error("Failed to append audit entry, it is kept to be retried")
+	}
+}
+
+// RetryPending appends the entries Record couldn't, returning how many are
+// still waiting
+func (s *auditService) RetryPending(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.RetryPending")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.flush(ctx)
+
+	return len(s.pending), err
+}
+
+// flush appends the pending entries in order, stopping at the first failure.
+// s.mu must be held.
+func (s *auditService) flush(ctx context.Context) error {
+	defer func() { metrics.AuditPending.Set(float64(len(s.pending))) }()
+
+	for len(s.pending) > 0 {
+		if err := s.append(ctx, s.pending[0]); err != nil {
+			metrics.AuditFailures.Inc()
+			return err
+		}
+
+		s.pending = s.pending[1:]
+	}
+
+	return nil
+}
+
+// append links the entry to the head of the chain. The previous hash is
+// unique, so when another instance appends first the insert is rejected and
+// the entry is linked to the new head.
+func (s *auditService) append(ctx context.Context, entry model.AuditEntry) error {
+	for attempt := 1; ; attempt++ {
+		head, err := client.AuditClient.GetLastAuditEntry(ctx)
+
+		if err != nil && !errors.Is(err, client.ErrNotFound) {
+			return err
+		}
+
+		entry.PrevHash = head.Hash
+		entry.Hash = auditHash(entry)
+
+		_, err = client.AuditClient.InsertAuditEntry(ctx, entry)
+
+		if errors.Is(err, client.ErrConflict) && attempt < 3 {
+			continue
+		}
+
+		return err
+	}
+}
+
+func (s *auditService) GetAuditEntries(ctx context.Context, filterDto dto.AuditFilterDto) (dto.AuditEntriesDto, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.GetAuditEntries")
+	defer span.End()
+
+	if _, err := authorize(ctx, auth.ViewAudit); err != nil {
+		return nil, err
+	}
+
+	if filterDto.Limit == 0 {
+		filterDto.Limit = DefaultAuditPageSize
+	}
+
+	return getAuditEntries(ctx, filterDto)
+}
+
+// ExportAuditEntries passes every entry matching the filter to fn oldest
+// first, a batch at a time so the log is never loaded whole. Its limit and
+// offset are ignored.
+func (s *auditService) ExportAuditEntries(ctx context.Context, filterDto dto.AuditFilterDto, fn func(entryDto dto.AuditEntryDto) error) error {
+	ctx, span := tracing.Start(ctx, "AuditService.ExportAuditEntries")
+	defer span.End()
+
+	if _, err := authorize(ctx, auth.ViewAudit); err != nil {
+		return err
+	}
+
+	return client.AuditClient.EachAuditEntry(ctx, auditFilter(filterDto), func(entry model.AuditEntry) error {
+		entryDto, err := auditEntryDto(entry)
+
+		if err != nil {
+			return err
+		}
+
+		return fn(entryDto)
+	})
+}
+
+// VerifyAuditLog walks the chain checking every entry links to the one before
+// it and still matches its hash
+func (s *auditService) VerifyAuditLog(ctx context.Context) (dto.AuditVerificationDto, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.VerifyAuditLog")
+	defer span.End()
+
+	var verification dto.AuditVerificationDto
+
+	if _, err := authorize(ctx, auth.ViewAudit); err != nil {
+		return verification, err
+	}
+	prevHash := ""
+
+	err := client.AuditClient.EachAuditEntry(ctx, client.AuditFilter{}, func(entry model.AuditEntry) error {
+		verification.Entries++
+
+		switch {
+		case entry.PrevHash != prevHash:
+			verification.Detail = "the entry doesn't follow the one before it"
+		case auditHash(entry) != entry.Hash:
+			verification.Detail = "the entry doesn't match its hash"
+		default:
+			prevHash = entry.Hash
+			return nil
+		}
+
+		verification.BrokenAt = entry.Id
+		return errAuditChainBroken
+	})
+
+	if errors.Is(err, errAuditChainBroken) {
+		log.Ctx(ctx).WithField("audit_entry_id", verification.BrokenAt).Error("Audit log chain broken: ", verification.Detail)
+		return verification, nil
+	}
+
+	if err != nil {
+		return verification, err
+	}
+
+	verification.Valid = true
+	verification.Head = prevHash
+
+	return verification, nil
+}
+
+func getAuditEntries(ctx context.Context, filterDto dto.AuditFilterDto) (dto.AuditEntriesDto, error) {
+	var entriesDto dto.AuditEntriesDto
+
+	entries, err := client.AuditClient.GetAuditEntries(ctx, auditFilter(filterDto))
+
+	if err != nil {
+		return entriesDto, err
+	}
+
+	for _, entry := range entries {
+		entryDto, err := auditEntryDto(entry)
+
+		if err != nil {
+			return entriesDto, err
+		}
+
+		entriesDto = append(entriesDto, entryDto)
+	}
+
+	return entriesDto, nil
+}
+
+func auditFilter(filterDto dto.AuditFilterDto) client.AuditFilter {
+	filter := client.AuditFilter{
+		ActorId:  filterDto.ActorId,
+		Action:   filterDto.Action,
+		Entity:   filterDto.Entity,
+		EntityId: filterDto.EntityId,
+		Limit:    filterDto.Limit,
+		Offset:   filterDto.Offset,
+	}
+
+	// The controller validated the dates
+	if filterDto.From != "" {
+		filter.From, _ = time.Parse("02-01-2006 15:04", filterDto.From)
+	}
+
+	if filterDto.To != "" {
+		filter.To, _ = time.Parse("02-01-2006 15:04", filterDto.To)
+	}
+
+	return filter
+}
+
+func auditEntryDto(entry model.AuditEntry) (dto.AuditEntryDto, error) {
+	var entryDto dto.AuditEntryDto
+	entryDto.Id = entry.Id
+	entryDto.ActorId = entry.ActorId
+	entryDto.ActorRole = entry.ActorRole
+	entryDto.Action = entry.Action
+	entryDto.Entity = entry.Entity
+	entryDto.EntityId = entry.EntityId
+	entryDto.Ip = entry.Ip
+	entryDto.RequestId = entry.RequestId
+	entryDto.CreatedAt = entry.CreatedAt.UTC()
+	entryDto.PrevHash = entry.PrevHash
+	entryDto.Hash = entry.Hash
+
+	if entry.Changes != "" {
+		if err := json.Unmarshal([]byte(entry.Changes), &entryDto.Changes); err != nil {
+			return entryDto, err
+		}
+	}
+
+	return entryDto, nil
+}
+
+// auditHash is the HMAC-SHA256 under AuditKey of the entry content and the
+// hash before it, so the chain can't be recomputed without the key. The
+// database id is left out as it is only known once the entry is inserted
+func auditHash(entry model.AuditEntry) string {
+	content, _ := json.Marshal(struct {
+		PrevHash  string `json:"prev_hash"`
+		ActorId   int    `json:"actor_id"`
+		ActorRole string `json:"actor_role"`
+		Action    string `json:"action"`
+		Entity    string `json:"entity"`
+		EntityId  int    `json:"entity_id"`
+		Changes   string `json:"changes"`
+		Ip        string `json:"ip"`
+		RequestId string `json:"request_id"`
+		CreatedAt string `json:"created_at"`
+	}{
+		PrevHash:  entry.PrevHash,
+		ActorId:   entry.ActorId,
+		ActorRole: entry.ActorRole,
+		Action:    entry.Action,
+		Entity:    entry.Entity,
+		EntityId:  entry.EntityId,
+		Changes:   entry.Changes,
+		Ip:        entry.Ip,
+		RequestId: entry.RequestId,
+		CreatedAt: entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+
+	mac := hmac.New(sha256.New, AuditKey)
+	mac.Write(content)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// auditDiff returns the JSON object of the fields of the entity that differ
+// between the json encodings of before and after, or "" when nothing changed
+func auditDiff(entity string, before any, after any) (string, error) {
+	beforeFields, err := auditFields(before)
+
+	if err != nil {
+		return "", err
+	}
+
+	afterFields, err := auditFields(after)
+
+	if err != nil {
+		return "", err
+	}
+
+	changes := map[string]dto.AuditChangeDto{}
+
+	for name, value := range beforeFields {
+		if other, ok := afterFields[name]; !ok || !bytes.Equal(value, other) {
+			changes[name] = dto.AuditChangeDto{Before: value, After: afterFields[name]}
+		}
+	}
+
+	for name, value := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			changes[name] = dto.AuditChangeDto{After: value}
+		}
+	}
+
+	if len(changes) == 0 {
+		return "", nil
+	}
+
+	for name, change := range changes {
+		if !redactedAuditFields[name] && !personalAuditFields[entity][name] {
+			continue
+		}
+
+		if change.Before != nil {
+			change.Before = redactedAuditValue
+		}
+
+		if change.After != nil {
+			change.After = redactedAuditValue
+		}
+
+		changes[name] = change
+	}
+
+	// Map keys are encoded in order, so the same change always reads the same
+	content, err := json.Marshal(changes)
+
+	return string(content), err
+}
+
+func auditFields(value any) (map[string]json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	content, err := json.Marshal(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(content, &fields)
+
+	return fields, err
+}
+
+// The snapshots recorded in the audit log are the dtos of the entities, so the
+// changes read with the names of the API
+
+func auditHotel(hotel model.Hotel) dto.HotelDto {
+	hotelDto := dto.HotelDto{
+		Id:           hotel.Id,
+		Name:         hotel.Name,
+		RoomAmount:   hotel.RoomAmount,
+		Description:  hotel.Description,
+		StreetName:   hotel.StreetName,
+		StreetNumber: hotel.StreetNumber,
+		Rate:         hotel.Rate,
+		Draft:        hotel.Draft,
+		Version:      hotel.Version,
+	}
+
+	for _, amenity := range hotel.Amenities {
+		hotelDto.Amenities = append(hotelDto.Amenities, amenity.Name)
+	}
+
+	return hotelDto
+}
+
+func auditUser(user model.User) dto.UserDto {
+	return dto.UserDto{
+		Id:       user.Id,
+		Name:     user.Name,
+		LastName: user.LastName,
+		Dni:      user.Dni,
+		Email:    user.Email,
+		Password: user.Password,
+		Role:     user.Role,
+
+		EmailVerified: user.EmailVerified,
+		Disabled:      user.Disabled,
+	}
+}
+
+func auditReservation(reservation model.Reservation) dto.ReservationDto {
+	return dto.ReservationDto{
+		Id:        reservation.Id,
+		StartDate: reservation.StartDate,
+		EndDate:   reservation.EndDate,
+		UserId:    reservation.UserId,
+		HotelId:   reservation.HotelId,
+		Amount:    reservation.Amount,
+	}
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"project/auth"
+	"project/client"
+	"project/dto"
+	"project/logging"
+	"project/model"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAudit keeps the chain in memory, the other service tests record into
+// the one set up by init
+type TestAudit struct {
+	mu      sync.Mutex
+	entries model.AuditEntries
+	filter  client.AuditFilter
+	// conflicts is the number of inserts rejected as if another instance
+	// appended first
+	conflicts int
+	// failures is the number of inserts that fail as if the database were down
+	failures int
+}
+
+func init() {
+	client.AuditClient = &TestAudit{}
+}
+
+func newTestAudit(t *testing.T) *TestAudit {
+	previous := client.AuditClient
+	mock := &TestAudit{}
+
+	client.AuditClient = mock
+	t.Cleanup(func() { client.AuditClient = previous })
+
+	return mock
+}
+
+func (t *TestAudit) InsertAuditEntry(ctx context.Context, entry model.AuditEntry) (model.AuditEntry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.failures > 0 {
+		t.failures--
+		return entry, errors.New("connection refused")
+	}
+
+	if t.conflicts > 0 {
+		t.conflicts--
+		t.entries = append(t.entries, model.AuditEntry{Id: len(t.entries) + 1, Action: "raced", PrevHash: entry.PrevHash, Hash: "raced-" + entry.PrevHash})
+		return entry, client.ErrConflict
+	}
+
+	for _, other := range t.entries {
+		if other.PrevHash == entry.PrevHash {
+			return entry, client.ErrConflict
+		}
+	}
+
+	entry.Id = len(t.entries) + 1
+	t.entries = append(t.entries, entry)
+
+	return entry, nil
+}
+
+func (t *TestAudit) GetLastAuditEntry(ctx context.Context) (model.AuditEntry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.entries) == 0 {
+		return model.AuditEntry{}, client.ErrNotFound
+	}
+
+	return t.entries[len(t.entries)-1], nil
+}
+
+func (t *TestAudit) GetAuditEntries(ctx context.Context, filter client.AuditFilter) (model.AuditEntries, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.filter = filter
+
+	var entries model.AuditEntries
+
+	for i := len(t.entries) - 1; i >= 0; i-- {
+		if filter.Entity == "" || t.entries[i].Entity == filter.Entity {
+			entries = append(entries, t.entries[i])
+		}
+	}
+
+	return entries, nil
+}
+
+func (t *TestAudit) EachAuditEntry(ctx context.Context, filter client.AuditFilter, fn func(entry model.AuditEntry) error) error {
+	t.filter = filter
+
+	for _, entry := range t.entries {
+		if filter.Entity != "" && entry.Entity != filter.Entity {
+			continue
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func auditContext() context.Context {
+	ctx := auth.WithIdentity(context.Background(), auth.Identity{UserId: 4, Role: "Admin"})
+	ctx = auth.WithClientIp(ctx, "10.0.0.1")
+
+	return logging.WithRequestId(ctx, "req-1")
+}
+
+func TestRecord_Service(t *testing.T) {
+	a := assert.New(t)
+	mock := newTestAudit(t)
+
+	hotel := dto.HotelDto{Id: 1, Name: "Hotel 1", Rate: 1000, Version: 3}
+	updated := hotel
+	updated.Rate = 1200
+	updated.Version = 4
+
+	AuditService.Record(auditContext(), AuditUpdate, "hotel", 1, hotel, updated)
+
+	a.Len(mock.entries, 1)
+	entry := mock.entries[0]
+
+	a.Equal(4, entry.ActorId)
+	a.Equal("Admin", entry.ActorRole)
+	a.Equal("update", entry.Action)
+	a.Equal("hotel", entry.Entity)
+	a.Equal(1, entry.EntityId)
+	a.Equal("10.0.0.1", entry.Ip)
+	a.Equal("req-1", entry.RequestId)
+	a.Equal(`{"rate":{"before":1000,"after":1200},"version":{"before":3,"after":4}}`, entry.Changes)
+	a.Empty(entry.PrevHash)
+	a.Len(entry.Hash, 64)
+
+	// Anonymous requests are recorded without an actor, linked to the last entry
+	AuditService.Record(context.Background(), AuditCreate, "user", 2, nil, dto.UserDto{Id: 2, Email: "jane@email.com", Password: "$2a$10$hash"})
+
+	entry = mock.entries[1]
+	a.Zero(entry.ActorId)
+	a.Equal(mock.entries[0].Hash, entry.PrevHash)
+	a.Contains(entry.Changes, `"password":{"after":"[REDACTED]"}`)
+	a.NotContains(entry.Changes, "$2a$10$hash")
+}
+
+func TestRecord_Service_Conflict(t *testing.T) {
+	a := assert.New(t)
+	mock := newTestAudit(t)
+
+	// Another instance appends between the read of the head and the insert
+	mock.conflicts = 1
+
+	AuditService.Record(context.Background(), AuditCreate, "amenity", 1, nil, dto.AmenityDto{Id: 1, Name: "Pool"})
+
+	a.Len(mock.entries, 2)
+	a.Equal("create", mock.entries[1].Action)
+	a.Equal(mock.entries[0].Hash, mock.entries[1].PrevHash)
+}
+
+func TestRecord_Service_Pending(t *testing.T) {
+	a := assert.New(t)
+	mock := newTestAudit(t)
+	service := &auditService{}
+
+	mock.failures = 2
+
+	service.Record(context.Background(), AuditCreate, "amenity", 1, nil, dto.AmenityDto{Id: 1, Name: "Pool"})
+	a.Empty(mock.entries)
+
+	// Kept behind the first, so the chain stays in the order of the changes
+	service.Record(context.Background(), AuditCreate, "amenity", 2, nil, dto.AmenityDto{Id: 2, Name: "Gym"})
+	a.Empty(mock.entries)
+
+	pending, err := service.RetryPending(context.Background())
+	a.Nil(err)
+	a.Equal(0, pending)
+
+	a.Len(mock.entries, 2)
+	a.Equal(1, mock.entries[0].EntityId)
+	a.Equal(2, mock.entries[1].EntityId)
+	a.Equal(mock.entries[0].Hash, mock.entries[1].PrevHash)
+
+	mock.failures = 1
+
+	pending, err = service.RetryPending(context.Background())
+	a.Nil(err)
+	a.Equal(0, pending)
+}
+
+func TestUpdateHotel_Service_Audit(t *testing.T) {
+	a := assert.New(t)
+	mock := newTestAudit(t)
+	ctx := auditContext()
+
+	_, err := HotelService.UpdateHotel(ctx, dto.HotelDto{Id: 1, Name: "Hotel 1", RoomAmount: 2, Description: "Hotel 1 Description", StreetName: "Hotel 1 Street", StreetNumber: 10, Rate: 12000, Version: 3})
+	a.Nil(err)
+
+	a.Nil(HotelService.DeleteHotel(ctx, 7, true))
+
+	a.Len(mock.entries, 3)
+
+	var changes map[string]dto.AuditChangeDto
+	a.Nil(json.Unmarshal([]byte(mock.entries[0].Changes), &changes))
+	a.Equal("10000", string(changes["rate"].Before))
+	a.Equal("12000", string(changes["rate"].After))
+
+	// The reservation cancelled along with the hotel is recorded too
+	a.Equal([]string{"update hotel", "cancel reservation", "delete hotel"}, []string{
+		mock.entries[0].Action + " " + mock.entries[0].Entity,
+		mock.entries[1].Action + " " + mock.entries[1].Entity,
+		mock.entries[2].Action + " " + mock.entries[2].Entity,
+	})
+}
+
+func TestGetAuditEntries_Service(t *testing.T) {
+	a := assert.New(t)
+	mock := newTestAudit(t)
+
+	AuditService.Record(context.Background(), AuditCreate, "amenity", 1, nil, dto.AmenityDto{Id: 1, Name: "Pool"})
+	AuditService.Record(context.Background(), AuditCreate, "hotel", 1, nil, dto.HotelDto{Id: 1, Name: "Hotel 1"})
+
+	result, err := AuditService.GetAuditEntries(adminCtx, dto.AuditFilterDto{Entity: "hotel", From: "01-01-2024 10:00"})
+
+	a.Nil(err)
+	a.Len(result, 1)
+	a.Equal("hotel", result[0].Entity)
+	a.Equal(`"Hotel 1"`, string(result[0].Changes["name"].After))
+	a.Equal(DefaultAuditPageSize, mock.filter.Limit)
+	a.Equal(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), mock.filter.From)
+
+	var exported []string
+
+	err = AuditService.ExportAuditEntries(adminCtx, dto.AuditFilterDto{Entity: "hotel"}, func(entryDto dto.AuditEntryDto) error {
+		exported = append(exported, entryDto.Entity)
+		return nil
+	})
+
+	a.Nil(err)
+	a.Equal([]string{"hotel"}, exported)
+	a.Equal("hotel", mock.filter.Entity)
+
+	err = AuditService.ExportAuditEntries(context.Background(), dto.AuditFilterDto{}, func(entryDto dto.AuditEntryDto) error {
+		return nil
+	})
+
+	a.ErrorIs(err, ErrAuthenticationRequired)
+}
+
+func TestVerifyAuditLog_Service(t *testing.T) {
+	a := assert.New(t)
+	mock := newTestAudit(t)
+
+	for id := 1; id <= 3; id++ {
+		AuditService.Record(context.Background(), AuditCreate, "amenity", id, nil, dto.AmenityDto{Id: id})
+	}
+
+	verification, err := AuditService.VerifyAuditLog(adminCtx)
+
+	a.Nil(err)
+	a.True(verification.Valid)
+	a.Equal(3, verification.Entries)
+	a.Equal(mock.entries[2].Hash, verification.Head)
+
+	// An edited entry no longer matches its hash
+	mock.entries[1].Changes = `{"name":{"after":"Spa"}}`
+
+	verification, err = AuditService.VerifyAuditLog(adminCtx)
+
+	a.Nil(err)
+	a.False(verification.Valid)
+	a.Equal(2, verification.BrokenAt)
+	a.Equal("the entry doesn't match its hash", verification.Detail)
+
+	// A removed entry leaves the next one without its predecessor
+	mock.entries = model.AuditEntries{mock.entries[0], mock.entries[2]}
+
+	verification, err = AuditService.VerifyAuditLog(adminCtx)
+
+	a.Nil(err)
+	a.False(verification.Valid)
+	a.Equal(3, verification.BrokenAt)
+	a.Equal("the entry doesn't follow the one before it", verification.Detail)
+}
+
+func TestVerifyAuditLog_Service_Key(t *testing.T) {
+	a := assert.New(t)
+	mock := newTestAudit(t)
+
+	AuditKey = []byte("audit-key")
+	t.Cleanup(func() { AuditKey = nil })
+
+	AuditService.Record(context.Background(), AuditCreate, "amenity", 1, nil, dto.AmenityDto{Id: 1})
+
+	// An entry edited and hashed again without the key doesn't verify
+	mock.entries[0].Changes = `{"name":{"after":"Spa"}}`
+	content := mock.entries[0]
+	AuditKey = nil
+	mock.entries[0].Hash = auditHash(content)
+	AuditKey = []byte("audit-key")
+
+	verification, err := AuditService.VerifyAuditLog(adminCtx)
+
+	a.Nil(err)
+	a.False(verification.Valid)
+	a.Equal("the entry doesn't match its hash", verification.Detail)
+}
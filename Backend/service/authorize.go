@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"project/auth"
+	"project/client"
+	"project/model"
+)
+
+// authorize returns the identity of the request when its role grants the
+// permission. Requests without an identity must log in first.
+func authorize(ctx context.Context, permission auth.Permission) (auth.Identity, error) {
+	identity, ok := auth.IdentityFrom(ctx)
+
+	if !ok {
+		return identity, ErrAuthenticationRequired
+	}
+
+	if !identity.Can(permission) {
+		log.Ctx(ctx).WithFields(logrus.Fields{"user_id": identity.UserId, "role": identity.Role, "permission": permission}).Warn("Permission denied")
+		return identity, ErrPermissionDenied
+	}
+
+	return identity, nil
+}
+
+// authorizeUser lets users act on their own account, and anyone else whose
+// role grants the permission
+func authorizeUser(ctx context.Context, userId int, permission auth.Permission) error {
+	if identity, ok := auth.IdentityFrom(ctx); ok && identity.UserId == userId {
+		return nil
+	}
+
+	_, err := authorize(ctx, permission)
+
+	return err
+}
+
+// authorizeHotel is authorize for one hotel, identities scoped to hotels also
+// need to have it assigned
+func authorizeHotel(ctx context.Context, hotelId int, permission auth.Permission) error {
+	identity, err := authorize(ctx, permission)
+
+	if err != nil || !identity.HotelScoped() {
+		return err
+	}
+
+	hotelIds, err := client.AssignmentClient.GetAssignedHotelIds(ctx, identity.UserId)
+
+	if err != nil {
+		return err
+	}
+
+	if !containsId(hotelIds, hotelId) {
+		log.Ctx(ctx).WithFields(logrus.Fields{"user_id": identity.UserId, "hotel_id": hotelId, "permission": permission}).Warn("Hotel not assigned")
+		return ErrHotelNotAssigned
+	}
+
+	return nil
+}
+
+// authorizeReservation lets users act on their own reservations, and anyone
+// else allowed to on the hotel of the reservation
+func authorizeReservation(ctx context.Context, reservation model.Reservation, permission auth.Permission) error {
+	if identity, ok := auth.IdentityFrom(ctx); ok && identity.UserId == reservation.UserId {
+		return nil
+	}
+
+	return authorizeHotel(ctx, reservation.HotelId, permission)
+}
+
+// visibleReservations drops the reservations an identity scoped to hotels
+// can't see: the ones of hotels not assigned to it that aren't its own
+func visibleReservations(ctx context.Context, reservations model.Reservations) (model.Reservations, error) {
+	identity, _ := auth.IdentityFrom(ctx)
+
+	if !identity.HotelScoped() {
+		return reservations, nil
+	}
+
+	hotelIds, err := client.AssignmentClient.GetAssignedHotelIds(ctx, identity.UserId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var visible model.Reservations
+
+	for _, reservation := range reservations {
+		if reservation.UserId == identity.UserId || containsId(hotelIds, reservation.HotelId) {
+			visible = append(visible, reservation)
+		}
+	}
+
+	return visible, nil
+}
+
+// visibleHotels drops the drafts the identity can't see. Published hotels are
+// public, drafts are for those who can manage them, on hotels assigned to
+// them when they are scoped to hotels.
+func visibleHotels(ctx context.Context, hotels model.Hotels) (model.Hotels, error) {
+	identity, ok := auth.IdentityFrom(ctx)
+	canManage := ok && identity.Can(auth.ManageHotels)
+
+	var hotelIds []int
+
+	if canManage && identity.HotelScoped() {
+		var err error
+
+		if hotelIds, err = client.AssignmentClient.GetAssignedHotelIds(ctx, identity.UserId); err != nil {
+			return nil, err
+		}
+	}
+
+	var visible model.Hotels
+
+	for _, hotel := range hotels {
+		if !hotel.Draft || canManage && (!identity.HotelScoped() || containsId(hotelIds, hotel.Id)) {
+			visible = append(visible, hotel)
+		}
+	}
+
+	return visible, nil
+}
+
+func containsId(ids []int, id int) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+
+	return false
+}
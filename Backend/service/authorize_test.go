@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"project/auth"
+	"project/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// asUser acts as the user with the role
+func asUser(id int, role string) context.Context {
+	return auth.WithIdentity(context.Background(), auth.Identity{UserId: id, Role: role})
+}
+
+// adminCtx acts as user 4, an admin
+var adminCtx = asUser(4, auth.RoleAdmin)
+
+func TestAuthorize(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := authorize(context.Background(), auth.ViewUsers)
+	a.ErrorIs(err, ErrAuthenticationRequired)
+
+	_, err = authorize(asUser(1, auth.RoleCustomer), auth.ViewUsers)
+	a.ErrorIs(err, ErrPermissionDenied)
+
+	identity, err := authorize(asUser(2, auth.RoleFrontDesk), auth.ViewUsers)
+	a.Nil(err)
+	a.Equal(2, identity.UserId)
+
+	_, err = authorize(asUser(2, auth.RoleFrontDesk), auth.ManageUsers)
+	a.ErrorIs(err, ErrPermissionDenied)
+
+	// A role that was removed grants nothing
+	_, err = authorize(asUser(2, "Owner"), auth.ViewUsers)
+	a.ErrorIs(err, ErrPermissionDenied)
+}
+
+func TestAuthorizeUser(t *testing.T) {
+	a := assert.New(t)
+
+	a.Nil(authorizeUser(asUser(1, auth.RoleCustomer), 1, auth.ViewUsers))
+	a.ErrorIs(authorizeUser(asUser(1, auth.RoleCustomer), 2, auth.ViewUsers), ErrPermissionDenied)
+	a.ErrorIs(authorizeUser(context.Background(), 1, auth.ViewUsers), ErrAuthenticationRequired)
+	a.Nil(authorizeUser(adminCtx, 2, auth.ViewUsers))
+}
+
+func TestAuthorizeHotel(t *testing.T) {
+	a := assert.New(t)
+	newTestAssignments(t)
+
+	a.Nil(authorizeHotel(managerCtx, 1, auth.ManageHotels))
+	a.ErrorIs(authorizeHotel(managerCtx, 2, auth.ManageHotels), ErrHotelNotAssigned)
+	a.ErrorIs(authorizeHotel(managerCtx, 1, auth.ManageUsers), ErrPermissionDenied)
+
+	// Admins and the front desk aren't limited to hotels
+	a.Nil(authorizeHotel(adminCtx, 2, auth.ManageHotels))
+	a.Nil(authorizeHotel(asUser(6, auth.RoleFrontDesk), 2, auth.ManageReservations))
+
+	// Anyone acts on their own reservations
+	a.Nil(authorizeReservation(managerCtx, model.Reservation{UserId: 5, HotelId: 2}, auth.ManageReservations))
+	a.Nil(authorizeReservation(managerCtx, model.Reservation{UserId: 1, HotelId: 1}, auth.ManageReservations))
+	a.ErrorIs(authorizeReservation(managerCtx, model.Reservation{UserId: 1, HotelId: 2}, auth.ManageReservations), ErrHotelNotAssigned)
+}
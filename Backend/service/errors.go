@@ -0,0 +1,170 @@
+package service
+
+import (
+	"errors"
+	"project/client"
+	"project/dto"
+	"time"
+)
+
+// Kinds of service errors, controllers map them to status codes
+var (
+	ErrNotFound             = errors.New("not found")
+	ErrConflict             = errors.New("conflict")
+	ErrInvalid              = errors.New("invalid")
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrForbidden            = errors.New("forbidden")
+	ErrTooManyRequests      = errors.New("too many requests")
+	ErrUnprocessable        = errors.New("unprocessable")
+	ErrPrecondition         = errors.New("precondition failed")
+	ErrPreconditionRequired = errors.New("precondition required")
+	ErrUnavailable          = client.ErrUnavailable
+)
+
+// Errors returned by the services, their codes are part of the API and must not change
+var (
+	ErrHotelNotFound        = NotFound("hotel_not_found", "hotel not found")
+	ErrUserNotFound         = NotFound("user_not_found", "user not found")
+	ErrAssignmentNotFound   = NotFound("assignment_not_found", "the hotel isn't assigned to the user")
+	ErrReservationNotFound  = NotFound("reservation_not_found", "reservation not found")
+	ErrImageNotFound        = NotFound("image_not_found", "image not found")
+	ErrOidcProviderNotFound = NotFound("oidc_provider_not_found", "the login provider doesn't exist")
+
+	ErrValidation = Invalid("validation_failed", "the request has invalid fields")
+
+	ErrUnknownAmenity = Invalid("unknown_amenity", "amenity not found")
+	ErrUnknownUser    = Invalid("unknown_user", "user not found")
+	ErrUnknownHotel   = Invalid("unknown_hotel", "hotel not found")
+
+	ErrAmenityExists        = Conflict("amenity_exists", "amenity already exists")
+	ErrEmailRegistered      = Conflict("email_registered", "email already registered")
+	ErrEmailVerified        = Conflict("email_verified", "the email is already verified")
+	ErrNoRoomsAvailable     = Conflict("no_rooms_available", "there are no rooms available")
+	ErrHotelHasReservations = Conflict("hotel_has_reservations", "the hotel has reservations that haven't ended, force the deletion to cancel them")
+	ErrUserHasReservations  = Conflict("user_has_reservations", "the user has reservations that haven't ended, force the deletion to cancel them")
+	ErrHotelModified        = PreconditionFailed("hotel_modified", "the hotel was modified since it was read, reload it and try again")
+	ErrHotelVersionRequired = PreconditionRequired("hotel_version_required", "send the version of the hotel being replaced in If-Match or in the body")
+	ErrInvalidDateRange     = Invalid("invalid_date_range", "a reservation cant end before it starts")
+	ErrCancellationClosed   = Invalid("cancellation_closed", "can't delete a reservation 48hs before it starts")
+	ErrEmailUnchanged       = Invalid("email_unchanged", "the new email is the current one")
+	ErrUnknownRole          = Invalid("unknown_role", "the role doesn't exist")
+	ErrUserNotManager       = Invalid("user_not_manager", "only managers can have hotels assigned")
+	ErrTokenInvalid         = Invalid("token_invalid", "the link is invalid or has expired, request a new one")
+	ErrMfaNotEnrolled       = Invalid("mfa_not_enrolled", "set up an authenticator app first")
+
+	ErrUserNotRegistered      = Unauthorized("user_not_registered", "user not registered")
+	ErrIncorrectPassword      = Unauthorized("incorrect_password", "incorrect password")
+	ErrAuthenticationRequired = Unauthorized("authentication_required", "log in to continue")
+	ErrMfaChallengeInvalid    = Unauthorized("mfa_challenge_invalid", "the login has expired, log in again")
+	ErrMfaCodeIncorrect       = Unauthorized("mfa_code_incorrect", "the code is incorrect or was already used")
+	ErrOidcStateInvalid       = Unauthorized("oidc_state_invalid", "the login has expired, start again")
+	ErrOidcLoginFailed        = Unauthorized("oidc_login_failed", "the provider didn't confirm the login, try again")
+	ErrTokenRevoked           = Unauthorized("token_revoked", "the password changed since this login, log in again")
+	ErrLoginThrottled         = TooManyRequests("login_throttled", "too many failed logins, try again later")
+	ErrAccountLocked          = TooManyRequests("account_locked", "account locked after repeated failed logins, try again later")
+
+	ErrPermissionDenied = Forbidden("permission_denied", "you don't have permission to do this")
+	ErrHotelNotAssigned = Forbidden("hotel_not_assigned", "the hotel isn't assigned to you")
+	ErrAccountDisabled  = Forbidden("account_disabled", "the account is disabled, contact an administrator")
+	ErrOwnAccount       = Forbidden("own_account", "admins can't change the role of their own account, disable it, delete it or reset its second factor")
+	ErrMfaRequired      = Forbidden("mfa_required", "your role requires two-factor authentication")
+	ErrEmailUnconfirmed = Forbidden("email_unconfirmed", "change your email from your profile, the new address has to be confirmed")
+	ErrMfaEnabled       = Conflict("mfa_enabled", "two-factor authentication is already on")
+	ErrAdminExists      = Conflict("admin_exists", "there is an admin already, they can grant the role")
+
+	ErrOidcEmailNotVerified  = Forbidden("oidc_email_not_verified", "the provider hasn't verified your email")
+	ErrOidcAccountUnverified = Conflict("oidc_account_unverified", "an account with this email exists, log in with its password and verify the email to link it")
+
+	ErrCurrentPasswordIncorrect = Forbidden("current_password_incorrect", "the current password is incorrect")
+	ErrConfirmationRequired     = Forbidden("confirmation_required", "the account has no password, request a confirmation code by email and send it instead")
+	ErrPasswordSet              = Conflict("password_set", "confirm with the password of the account")
+	ErrMailUnavailable          = Unavailable("mail_unavailable", "the email could not be sent, try again later")
+	ErrOidcProviderUnavailable  = Unavailable("oidc_provider_unavailable", "the login provider can't be reached, try again later")
+
+	ErrIdempotencyKeyReused     = Unprocessable("idempotency_key_reused", "the idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress = Conflict("idempotency_key_in_progress", "a request with this idempotency key is in progress")
+
+	ErrImageSigningDisabled   = Invalid("image_signing_disabled", "image signing is not configured")
+	ErrImageSignatureRequired = Forbidden("image_signature_required", "image requires a signed url")
+	ErrImageSignatureInvalid  = Forbidden("image_signature_invalid", "invalid image signature")
+	ErrImageSignatureExpired  = Forbidden("image_signature_expired", "image signature expired")
+)
+
+// Error is a service error with a stable code, a message for the user and the kind it belongs to
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Fields  dto.FieldErrorsDto
+	// RetryAfter tells the client when to try again, it is sent as Retry-After
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is matches the kind of the error, or another error with the same code
+func (e *Error) Is(target error) bool {
+	if other, ok := target.(*Error); ok {
+		return e.Code == other.Code
+	}
+
+	return e.Kind == target
+}
+
+// WithFields returns a copy of the error carrying field level details
+func (e *Error) WithFields(fields ...dto.FieldErrorDto) *Error {
+	copied := *e
+	copied.Fields = append(append(dto.FieldErrorsDto{}, e.Fields...), fields...)
+
+	return &copied
+}
+
+// WithRetryAfter returns a copy of the error telling the client to wait before retrying
+func (e *Error) WithRetryAfter(wait time.Duration) *Error {
+	copied := *e
+	copied.RetryAfter = wait
+
+	return &copied
+}
+
+func NotFound(code string, message string) *Error {
+	return &Error{Kind: ErrNotFound, Code: code, Message: message}
+}
+
+func Conflict(code string, message string) *Error {
+	return &Error{Kind: ErrConflict, Code: code, Message: message}
+}
+
+func Invalid(code string, message string) *Error {
+	return &Error{Kind: ErrInvalid, Code: code, Message: message}
+}
+
+func Unauthorized(code string, message string) *Error {
+	return &Error{Kind: ErrUnauthorized, Code: code, Message: message}
+}
+
+func Forbidden(code string, message string) *Error {
+	return &Error{Kind: ErrForbidden, Code: code, Message: message}
+}
+
+func TooManyRequests(code string, message string) *Error {
+	return &Error{Kind: ErrTooManyRequests, Code: code, Message: message}
+}
+
+func Unprocessable(code string, message string) *Error {
+	return &Error{Kind: ErrUnprocessable, Code: code, Message: message}
+}
+
+func PreconditionFailed(code string, message string) *Error {
+	return &Error{Kind: ErrPrecondition, Code: code, Message: message}
+}
+
+func PreconditionRequired(code string, message string) *Error {
+	return &Error{Kind: ErrPreconditionRequired, Code: code, Message: message}
+}
+
+func Unavailable(code string, message string) *Error {
+	return &Error{Kind: ErrUnavailable, Code: code, Message: message}
+}
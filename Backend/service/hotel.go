@@ -1,23 +1,31 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"project/auth"
 	"project/client"
 	"project/dto"
+	"project/metrics"
 	"project/model"
+	"project/tracing"
 	"time"
 )
 
 type hotelService struct{}
 
 type hotelServiceInterface interface {
-	GetHotelById(id int) (dto.HotelDto, error)
-	GetHotels() (dto.HotelsDto, error)
-	InsertHotel(hotelDto dto.HotelDto) (dto.HotelDto, error)
-	CheckAvailability(hotelId int, startDate time.Time, endDate time.Time) bool
-	CheckAllAvailability(startDate string, endDate string) (dto.HotelsDto, error)
-	DeleteHotel(id int) error
-	UpdateHotel(hotelDto dto.HotelDto) (dto.HotelDto, error)
+	GetHotelById(ctx context.Context, id int) (dto.HotelDto, error)
+	GetHotels(ctx context.Context) (dto.HotelsDto, error)
+	InsertHotel(ctx context.Context, hotelDto dto.HotelDto) (dto.HotelDto, error)
+	CheckAvailability(ctx context.Context, hotelId int, startDate time.Time, endDate time.Time) (bool, error)
+	CheckAllAvailability(ctx context.Context, startDate string, endDate string) (dto.HotelsDto, error)
+	DeleteHotel(ctx context.Context, id int, force bool) error
+	UpdateHotel(ctx context.Context, hotelDto dto.HotelDto) (dto.HotelDto, error)
+	GetDeletedHotels(ctx context.Context) (dto.DeletedHotelsDto, error)
+	RestoreHotel(ctx context.Context, id int) error
 }
 
 var HotelService hotelServiceInterface
@@ -26,7 +34,14 @@ func init() {
 	HotelService = &hotelService{}
 }
 
-func (s *hotelService) InsertHotel(hotelDto dto.HotelDto) (dto.HotelDto, error) {
+func (s *hotelService) InsertHotel(ctx context.Context, hotelDto dto.HotelDto) (dto.HotelDto, error) {
+	ctx, span := tracing.Start(ctx, "HotelService.InsertHotel")
+	defer span.End()
+
+	if _, err := authorize(ctx, auth.CreateHotels); err != nil {
+		return hotelDto, err
+	}
+
 	var hotel model.Hotel
 
 	hotel.Name = hotelDto.Name
@@ -35,34 +50,46 @@ func (s *hotelService) InsertHotel(hotelDto dto.HotelDto) (dto.HotelDto, error)
 	hotel.StreetName = hotelDto.StreetName
 	hotel.StreetNumber = hotelDto.StreetNumber
 	hotel.Rate = hotelDto.Rate
+	hotel.Draft = hotelDto.Draft
 
-	for _, amenityName := range hotelDto.Amenities {
-		amenity := client.AmenityClient.GetAmenityByName(amenityName)
+	amenities, err := getAmenitiesByName(ctx, hotelDto.Amenities)
 
-		if amenity.Id == 0 {
-			return hotelDto, errors.New("amenity not found")
-		}
+	if err != nil {
+		return hotelDto, err
+	}
 
-		hotel.Amenities = append(hotel.Amenities, amenity)
+	hotel.Amenities = amenities
 
-	}
+	hotel, err = client.HotelClient.InsertHotel(ctx, hotel)
 
-	hotel = client.HotelClient.InsertHotel(hotel)
+	if err != nil {
+		return hotelDto, err
+	}
 
 	hotelDto.Id = hotel.Id
+	hotelDto.Version = hotel.Version
 
-	if hotel.Id == 0 {
-		return hotelDto, errors.New("error creating hotel")
-	}
+	AuditService.Record(ctx, AuditCreate, "hotel", hotel.Id, nil, auditHotel(hotel))
 
 	return hotelDto, nil
 }
 
-func (s *hotelService) GetHotels() (dto.HotelsDto, error) {
+func (s *hotelService) GetHotels(ctx context.Context) (dto.HotelsDto, error) {
+	ctx, span := tracing.Start(ctx, "HotelService.GetHotels")
+	defer span.End()
 
-	var hotels model.Hotels = client.HotelClient.GetHotels()
 	var hotelsDto dto.HotelsDto
 
+	hotels, err := client.HotelClient.GetHotels(ctx)
+
+	if err == nil {
+		hotels, err = visibleHotels(ctx, hotels)
+	}
+
+	if err != nil {
+		return hotelsDto, err
+	}
+
 	for _, hotel := range hotels {
 		var hotelDto dto.HotelDto
 		hotelDto.Id = hotel.Id
@@ -72,6 +99,8 @@ func (s *hotelService) GetHotels() (dto.HotelsDto, error) {
 		hotelDto.StreetName = hotel.StreetName
 		hotelDto.StreetNumber = hotel.StreetNumber
 		hotelDto.Rate = hotel.Rate
+		hotelDto.Draft = hotel.Draft
+		hotelDto.Version = hotel.Version
 
 		if len(hotel.Images) > 0 {
 			var imageDto dto.ImageDto
@@ -88,14 +117,33 @@ func (s *hotelService) GetHotels() (dto.HotelsDto, error) {
 	return hotelsDto, nil
 }
 
-func (s *hotelService) GetHotelById(id int) (dto.HotelDto, error) {
+func (s *hotelService) GetHotelById(ctx context.Context, id int) (dto.HotelDto, error) {
+	ctx, span := tracing.Start(ctx, "HotelService.GetHotelById")
+	defer span.End()
 
-	var hotel model.Hotel = client.HotelClient.GetHotelById(id)
 	var hotelDto dto.HotelDto
 
-	if hotel.Id == 0 {
-		return hotelDto, errors.New("hotel not found")
+	hotel, err := client.HotelClient.GetHotelById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return hotelDto, ErrHotelNotFound
 	}
+
+	if err != nil {
+		return hotelDto, err
+	}
+
+	visible, err := visibleHotels(ctx, model.Hotels{hotel})
+
+	if err != nil {
+		return hotelDto, err
+	}
+
+	// Drafts don't exist for those who can't see them
+	if len(visible) == 0 {
+		return hotelDto, ErrHotelNotFound
+	}
+
 	hotelDto.Id = hotel.Id
 	hotelDto.Name = hotel.Name
 	hotelDto.RoomAmount = hotel.RoomAmount
@@ -103,6 +151,8 @@ func (s *hotelService) GetHotelById(id int) (dto.HotelDto, error) {
 	hotelDto.StreetName = hotel.StreetName
 	hotelDto.StreetNumber = hotel.StreetNumber
 	hotelDto.Rate = hotel.Rate
+	hotelDto.Draft = hotel.Draft
+	hotelDto.Version = hotel.Version
 
 	for _, amenity := range hotel.Amenities {
 		hotelDto.Amenities = append(hotelDto.Amenities, amenity.Name)
@@ -120,10 +170,25 @@ func (s *hotelService) GetHotelById(id int) (dto.HotelDto, error) {
 	return hotelDto, nil
 }
 
-func (s *hotelService) CheckAvailability(hotelId int, startDate time.Time, endDate time.Time) bool {
+func (s *hotelService) CheckAvailability(ctx context.Context, hotelId int, startDate time.Time, endDate time.Time) (bool, error) {
+	ctx, span := tracing.Start(ctx, "HotelService.CheckAvailability", attribute.Int("hotel.id", hotelId))
+	defer span.End()
+
+	hotel, err := client.HotelClient.GetHotelById(ctx, hotelId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return false, ErrHotelNotFound
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	reservations, err := client.ReservationClient.GetReservationsByHotel(ctx, hotelId)
 
-	hotel := client.HotelClient.GetHotelById(hotelId)
-	reservations := client.ReservationClient.GetReservationsByHotel(hotelId)
+	if err != nil {
+		return false, err
+	}
 
 	roomsAvailable := hotel.RoomAmount
 
@@ -140,14 +205,16 @@ func (s *hotelService) CheckAvailability(hotelId int, startDate time.Time, endDa
 			roomsAvailable--
 		}
 		if roomsAvailable == 0 {
-			return false
+			return false, nil
 		}
 	}
 
-	return true
+	return true, nil
 }
 
-func (s *hotelService) CheckAllAvailability(startDate string, endDate string) (dto.HotelsDto, error) {
+func (s *hotelService) CheckAllAvailability(ctx context.Context, startDate string, endDate string) (dto.HotelsDto, error) {
+	ctx, span := tracing.Start(ctx, "HotelService.CheckAllAvailability")
+	defer span.End()
 
 	var hotelsAvailable dto.HotelsDto
 
@@ -155,13 +222,30 @@ func (s *hotelService) CheckAllAvailability(startDate string, endDate string) (d
 	reservationEnd, _ := time.Parse("02-01-2006 15:04", endDate)
 
 	if reservationStart.After(reservationEnd) {
-		return hotelsAvailable, errors.New("a reservation cant end before it starts")
+		return hotelsAvailable, ErrInvalidDateRange
 	}
 
-	hotels := client.HotelClient.GetHotels()
+	metrics.AvailabilityChecks.Inc()
+
+	hotels, err := client.HotelClient.GetHotels(ctx)
+
+	if err != nil {
+		return hotelsAvailable, err
+	}
 
 	for _, hotel := range hotels {
-		if s.CheckAvailability(hotel.Id, reservationStart, reservationEnd) {
+		// Drafts can't be booked yet
+		if hotel.Draft {
+			continue
+		}
+
+		available, err := s.CheckAvailability(ctx, hotel.Id, reservationStart, reservationEnd)
+
+		if err != nil {
+			return hotelsAvailable, err
+		}
+
+		if available {
 			var hotelDto dto.HotelDto
 			hotelDto.Id = hotel.Id
 			hotelDto.Name = hotel.Name
@@ -187,59 +271,194 @@ func (s *hotelService) CheckAllAvailability(startDate string, endDate string) (d
 	return hotelsAvailable, nil
 }
 
-func (s *hotelService) DeleteHotel(id int) error {
+// DeleteHotel soft deletes the hotel. Its reservations that haven't ended yet
+// keep it from being deleted unless force is set, then they are cancelled too.
+func (s *hotelService) DeleteHotel(ctx context.Context, id int, force bool) error {
+	ctx, span := tracing.Start(ctx, "HotelService.DeleteHotel")
+	defer span.End()
 
-	hotel := client.HotelClient.GetHotelById(id)
+	if err := authorizeHotel(ctx, id, auth.ManageHotels); err != nil {
+		return err
+	}
 
-	if hotel.Id == 0 {
-		return errors.New("hotel not found")
+	hotel, err := client.HotelClient.GetHotelById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrHotelNotFound
 	}
 
-	for _, image := range hotel.Images {
-		err := client.ImageClient.DeleteImage(image)
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			return err
-		}
+	reservations, err := client.ReservationClient.GetReservationsByHotel(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	active := activeReservations(reservations, time.Now())
+
+	if len(active) > 0 && !force {
+		return ErrHotelHasReservations
+	}
+
+	err = client.HotelClient.DeleteHotel(ctx, hotel, active)
+
+	if err != nil {
+		return err
+	}
+
+	metrics.ReservationsCancelled.Add(float64(len(active)))
+	log.Ctx(ctx).WithFields(logrus.Fields{"hotel_id": hotel.Id, "cancelled": len(active)}).Info("Hotel deleted")
+
+	for _, reservation := range active {
+		AuditService.Record(ctx, AuditCancel, "reservation", reservation.Id, auditReservation(reservation), nil)
+	}
+	AuditService.Record(ctx, AuditDelete, "hotel", hotel.Id, auditHotel(hotel), nil)
+
+	return nil
+}
+
+func (s *hotelService) GetDeletedHotels(ctx context.Context) (dto.DeletedHotelsDto, error) {
+	ctx, span := tracing.Start(ctx, "HotelService.GetDeletedHotels")
+	defer span.End()
+
+	var hotelsDto dto.DeletedHotelsDto
+
+	if _, err := authorize(ctx, auth.ManageDeleted); err != nil {
+		return hotelsDto, err
+	}
+
+	hotels, err := client.HotelClient.GetDeletedHotels(ctx)
+
+	if err != nil {
+		return hotelsDto, err
+	}
+
+	for _, hotel := range hotels {
+		var hotelDto dto.DeletedHotelDto
+		hotelDto.Id = hotel.Id
+		hotelDto.Name = hotel.Name
+		hotelDto.RoomAmount = hotel.RoomAmount
+		hotelDto.Description = hotel.Description
+		hotelDto.StreetName = hotel.StreetName
+		hotelDto.StreetNumber = hotel.StreetNumber
+		hotelDto.Rate = hotel.Rate
+		hotelDto.Draft = hotel.Draft
+		hotelDto.Version = hotel.Version
+		hotelDto.DeletedAt = hotel.DeletedAt.Time
+
+		hotelsDto = append(hotelsDto, hotelDto)
+	}
+
+	return hotelsDto, nil
+}
+
+// RestoreHotel undeletes the hotel. The reservations cancelled along with it
+// stay cancelled, they are restored one by one.
+func (s *hotelService) RestoreHotel(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "HotelService.RestoreHotel")
+	defer span.End()
+
+	if _, err := authorize(ctx, auth.ManageDeleted); err != nil {
+		return err
+	}
+
+	err := client.HotelClient.RestoreHotel(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrHotelNotFound
 	}
 
-	err := client.HotelClient.DeleteHotel(hotel)
+	if err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).WithField("hotel_id", id).Info("Hotel restored")
+	AuditService.Record(ctx, AuditRestore, "hotel", id, nil, nil)
 
-	return err
+	return nil
 }
 
-func (s *hotelService) UpdateHotel(hotelDto dto.HotelDto) (dto.HotelDto, error) {
+func (s *hotelService) UpdateHotel(ctx context.Context, hotelDto dto.HotelDto) (dto.HotelDto, error) {
+	ctx, span := tracing.Start(ctx, "HotelService.UpdateHotel")
+	defer span.End()
+
+	if err := authorizeHotel(ctx, hotelDto.Id, auth.ManageHotels); err != nil {
+		return hotelDto, err
+	}
+
+	hotel, err := client.HotelClient.GetHotelById(ctx, hotelDto.Id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return hotelDto, ErrHotelNotFound
+	}
+
+	if err != nil {
+		return hotelDto, err
+	}
 
-	hotel := client.HotelClient.GetHotelById(hotelDto.Id)
+	// Replacing a hotel without saying which version would lose changes made
+	// since the client read it
+	if hotelDto.Version == 0 {
+		return hotelDto, ErrHotelVersionRequired
+	}
 
-	if hotel.Id == 0 {
-		return hotelDto, errors.New("hotel not found")
+	if hotelDto.Version != hotel.Version {
+		return hotelDto, ErrHotelModified
 	}
 
+	before := auditHotel(hotel)
+
 	hotel.Name = hotelDto.Name
 	hotel.StreetName = hotelDto.StreetName
 	hotel.StreetNumber = hotelDto.StreetNumber
 	hotel.Rate = hotelDto.Rate
 	hotel.Description = hotelDto.Description
 	hotel.RoomAmount = hotelDto.RoomAmount
-	hotel.Amenities = model.Amenities{}
+	hotel.Draft = hotelDto.Draft
 
-	for _, amenityName := range hotelDto.Amenities {
-		amenity := client.AmenityClient.GetAmenityByName(amenityName)
+	hotel.Amenities, err = getAmenitiesByName(ctx, hotelDto.Amenities)
 
-		if amenity.Id == 0 {
-			return hotelDto, errors.New("amenity not found")
-		}
-
-		hotel.Amenities = append(hotel.Amenities, amenity)
+	if err != nil {
+		return hotelDto, err
 	}
 
-	hotel = client.HotelClient.UpdateHotel(hotel)
+	hotel, err = client.HotelClient.UpdateHotel(ctx, hotel)
+
+	if errors.Is(err, client.ErrVersionConflict) {
+		return hotelDto, ErrHotelModified
+	}
 
-	if hotel.Id == 0 {
-		return hotelDto, errors.New("error updating hotel")
+	if err != nil {
+		return hotelDto, err
 	}
 
+	hotelDto.Version = hotel.Version
+
+	AuditService.Record(ctx, AuditUpdate, "hotel", hotel.Id, before, auditHotel(hotel))
+
 	return hotelDto, nil
 
 }
+
+func getAmenitiesByName(ctx context.Context, names []string) (model.Amenities, error) {
+	amenities := model.Amenities{}
+
+	for _, amenityName := range names {
+		amenity, err := client.AmenityClient.GetAmenityByName(ctx, amenityName)
+
+		if errors.Is(err, client.ErrNotFound) {
+			return amenities, ErrUnknownAmenity
+		}
+
+		if err != nil {
+			return amenities, err
+		}
+
+		amenities = append(amenities, amenity)
+	}
+
+	return amenities, nil
+}
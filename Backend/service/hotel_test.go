@@ -1,12 +1,18 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"project/auth"
 	"project/client"
 	"project/dto"
+	"project/metrics"
 	"project/model"
 	"testing"
+	"time"
 )
 
 type TestHotel struct{}
@@ -15,21 +21,21 @@ func init() {
 	client.HotelClient = &TestHotel{}
 }
 
-func (t TestHotel) InsertHotel(hotel model.Hotel) model.Hotel {
+func (t TestHotel) InsertHotel(ctx context.Context, hotel model.Hotel) (model.Hotel, error) {
 	if hotel.Name == "" {
-		hotel.Id = 0
-	} else {
-		hotel.Id = 1
+		return hotel, errors.New("error creating hotel")
 	}
 
-	return hotel
+	hotel.Id = 1
+
+	return hotel, nil
 }
 
-func (t TestHotel) GetHotelById(id int) model.Hotel {
+func (t TestHotel) GetHotelById(ctx context.Context, id int) (model.Hotel, error) {
 	var hotel model.Hotel
 
 	if id > 10 {
-		hotel.Id = 0
+		return hotel, client.ErrNotFound
 	} else {
 		hotel.Id = 1
 		hotel.Name = "Hotel 1"
@@ -38,14 +44,16 @@ func (t TestHotel) GetHotelById(id int) model.Hotel {
 		hotel.StreetName = "Hotel 1 Street"
 		hotel.StreetNumber = 10
 		hotel.Rate = 10000
+		hotel.Draft = id == 10
+		hotel.Version = 3
 		hotel.Amenities = nil
 		hotel.Images = nil
 	}
 
-	return hotel
+	return hotel, nil
 }
 
-func (t TestHotel) GetHotels() model.Hotels {
+func (t TestHotel) GetHotels(ctx context.Context) (model.Hotels, error) {
 
 	return model.Hotels{
 		model.Hotel{
@@ -71,11 +79,18 @@ func (t TestHotel) GetHotels() model.Hotels {
 			Amenities:    nil,
 			Images:       nil,
 		},
-	}
+
+		model.Hotel{
+			Id:         3,
+			Name:       "Hotel 3",
+			RoomAmount: 10,
+			Draft:      true,
+		},
+	}, nil
 
 }
 
-func (t TestHotel) DeleteHotel(hotel model.Hotel) error {
+func (t TestHotel) DeleteHotel(ctx context.Context, hotel model.Hotel, cancelled model.Reservations) error {
 	if hotel.Id > 10 {
 		return errors.New("failed to delete hotel")
 	}
@@ -83,9 +98,40 @@ func (t TestHotel) DeleteHotel(hotel model.Hotel) error {
 	return nil
 }
 
-func (t TestHotel) UpdateHotel(hotel model.Hotel) model.Hotel {
+func (t TestHotel) GetDeletedHotels(ctx context.Context) (model.Hotels, error) {
 
-	return hotel
+	return model.Hotels{
+		model.Hotel{
+			Id:        3,
+			Name:      "Hotel 3",
+			Version:   2,
+			DeletedAt: gorm.DeletedAt{Time: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), Valid: true},
+		},
+	}, nil
+}
+
+func (t TestHotel) RestoreHotel(ctx context.Context, id int) error {
+	if id > 10 {
+		return client.ErrNotFound
+	}
+
+	return nil
+}
+
+func (t TestHotel) PurgeHotels(ctx context.Context, before time.Time) (int64, error) {
+	return 1, nil
+}
+
+func (t TestHotel) UpdateHotel(ctx context.Context, hotel model.Hotel) (model.Hotel, error) {
+
+	// Someone else updates this one between the read and the write
+	if hotel.Name == "Hotel Raced" {
+		return model.Hotel{}, client.ErrVersionConflict
+	}
+
+	hotel.Version++
+
+	return hotel, nil
 }
 
 func TestInsertHotel_Service_Error(t *testing.T) {
@@ -93,7 +139,7 @@ func TestInsertHotel_Service_Error(t *testing.T) {
 	a := assert.New(t)
 	var hotelDto dto.HotelDto
 
-	_, err := HotelService.InsertHotel(hotelDto)
+	_, err := HotelService.InsertHotel(adminCtx, hotelDto)
 
 	expectedResponse := "error creating hotel"
 
@@ -109,7 +155,7 @@ func TestInsertHotel_Service_Success(t *testing.T) {
 		Name: "Hotel",
 	}
 
-	result, err := HotelService.InsertHotel(hotelDto)
+	result, err := HotelService.InsertHotel(adminCtx, hotelDto)
 
 	hotelDto.Id = 1
 
@@ -118,20 +164,37 @@ func TestInsertHotel_Service_Success(t *testing.T) {
 
 }
 
+func TestInsertHotel_Service_AmenityNotFound(t *testing.T) {
+
+	a := assert.New(t)
+	hotelDto := dto.HotelDto{
+		Name:      "Hotel",
+		Amenities: []string{"Unknown"},
+	}
+
+	_, err := HotelService.InsertHotel(adminCtx, hotelDto)
+
+	expectedResponse := "amenity not found"
+
+	a.ErrorIs(err, ErrInvalid)
+	a.Equal(expectedResponse, err.Error())
+}
+
 func TestGetHotelById_Service_Found(t *testing.T) {
 
 	a := assert.New(t)
 
-	_, err := HotelService.GetHotelById(1)
+	result, err := HotelService.GetHotelById(context.Background(), 1)
 
 	a.Nil(err)
+	a.Equal(3, result.Version)
 }
 
 func TestGetHotelById_Service_NotFound(t *testing.T) {
 
 	a := assert.New(t)
 
-	_, err := HotelService.GetHotelById(20)
+	_, err := HotelService.GetHotelById(context.Background(), 20)
 
 	expectedResponse := "hotel not found"
 
@@ -143,7 +206,7 @@ func TestGetHotels_Service(t *testing.T) {
 
 	a := assert.New(t)
 
-	result, err := HotelService.GetHotels()
+	result, err := HotelService.GetHotels(context.Background())
 
 	expectedResult := dto.HotelsDto{
 		dto.HotelDto{
@@ -175,13 +238,62 @@ func TestGetHotels_Service(t *testing.T) {
 	a.Equal(expectedResult, result)
 }
 
+func TestGetHotels_Service_Drafts(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAssignments(t)
+
+	names := func(ctx context.Context) []string {
+		hotels, err := HotelService.GetHotels(ctx)
+		a.Nil(err)
+
+		var names []string
+		for _, hotel := range hotels {
+			names = append(names, hotel.Name)
+		}
+
+		return names
+	}
+
+	// Drafts are for those who can manage them
+	a.Equal([]string{"Hotel 1", "Hotel 2"}, names(context.Background()))
+	a.Equal([]string{"Hotel 1", "Hotel 2"}, names(asUser(1, auth.RoleCustomer)))
+	a.Equal([]string{"Hotel 1", "Hotel 2", "Hotel 3"}, names(adminCtx))
+	a.Equal([]string{"Hotel 1", "Hotel 2"}, names(managerCtx))
+
+	mock.hotels[5] = []int{1, 3}
+	a.Equal([]string{"Hotel 1", "Hotel 2", "Hotel 3"}, names(managerCtx))
+
+	// Nor are they open for booking
+	hotels, err := HotelService.CheckAllAvailability(adminCtx, "01-02-2030 10:00", "03-02-2030 10:00")
+	a.Nil(err)
+	a.Len(hotels, 2)
+}
+
+func TestGetHotelById_Service_Draft(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAssignments(t)
+
+	// Hotel 10 is a draft
+	_, err := HotelService.GetHotelById(context.Background(), 10)
+	a.ErrorIs(err, ErrHotelNotFound)
+
+	_, err = HotelService.GetHotelById(asUser(1, auth.RoleCustomer), 10)
+	a.ErrorIs(err, ErrHotelNotFound)
+
+	result, err := HotelService.GetHotelById(adminCtx, 10)
+	a.Nil(err)
+	a.True(result.Draft)
+}
+
 func TestDeleteHotel_Service_NotFound(t *testing.T) {
 
 	a := assert.New(t)
 
 	hotelId := 12
 
-	err := HotelService.DeleteHotel(hotelId)
+	err := HotelService.DeleteHotel(adminCtx, hotelId, false)
 
 	expectedResponse := "hotel not found"
 
@@ -195,11 +307,50 @@ func TestDeleteHotel_Service_Found(t *testing.T) {
 
 	hotelId := 1
 
-	err := HotelService.DeleteHotel(hotelId)
+	// Its reservations are over, so they don't keep it from being deleted
+	err := HotelService.DeleteHotel(adminCtx, hotelId, false)
 
 	a.Nil(err)
 }
 
+func TestDeleteHotel_Service_HasReservations(t *testing.T) {
+
+	a := assert.New(t)
+
+	// Hotel 7 has a reservation that hasn't ended
+	err := HotelService.DeleteHotel(adminCtx, 7, false)
+
+	a.ErrorIs(err, ErrHotelHasReservations)
+
+	cancelled := testutil.ToFloat64(metrics.ReservationsCancelled)
+
+	err = HotelService.DeleteHotel(adminCtx, 7, true)
+
+	a.Nil(err)
+	a.Equal(cancelled+1, testutil.ToFloat64(metrics.ReservationsCancelled))
+}
+
+func TestGetDeletedHotels_Service(t *testing.T) {
+
+	a := assert.New(t)
+
+	result, err := HotelService.GetDeletedHotels(adminCtx)
+
+	a.Nil(err)
+	a.Len(result, 1)
+	a.Equal(3, result[0].Id)
+	a.Equal(2, result[0].Version)
+	a.Equal(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), result[0].DeletedAt)
+}
+
+func TestRestoreHotel_Service(t *testing.T) {
+
+	a := assert.New(t)
+
+	a.Nil(HotelService.RestoreHotel(adminCtx, 3))
+	a.ErrorIs(HotelService.RestoreHotel(adminCtx, 12), ErrHotelNotFound)
+}
+
 func TestUpdateHotel_Service_NotFound(t *testing.T) {
 
 	a := assert.New(t)
@@ -216,7 +367,7 @@ func TestUpdateHotel_Service_NotFound(t *testing.T) {
 		Images:       nil,
 	}
 
-	_, err := HotelService.UpdateHotel(hotel)
+	_, err := HotelService.UpdateHotel(adminCtx, hotel)
 
 	expectedResult := "hotel not found"
 
@@ -239,10 +390,71 @@ func TestUpdateHotel_Service_Found(t *testing.T) {
 		Rate:         10000,
 		Amenities:    nil,
 		Images:       nil,
+		Version:      3,
 	}
 
-	result, err := HotelService.UpdateHotel(hotel)
+	result, err := HotelService.UpdateHotel(adminCtx, hotel)
 
 	a.Nil(err)
+
+	hotel.Version = 4
 	a.Equal(hotel, result)
 }
+
+func TestUpdateHotel_Service_Modified(t *testing.T) {
+	a := assert.New(t)
+
+	hotel := dto.HotelDto{Id: 1, Name: "Hotel 1", RoomAmount: 10, Rate: 10000, Version: 2}
+
+	// The client read version 2, the hotel is at version 3
+	_, err := HotelService.UpdateHotel(adminCtx, hotel)
+	a.ErrorIs(err, ErrHotelModified)
+
+	hotel.Version = 3
+	result, err := HotelService.UpdateHotel(adminCtx, hotel)
+	a.Nil(err)
+	a.Equal(4, result.Version)
+
+	// A hotel is only replaced knowing which version
+	hotel.Version = 0
+	_, err = HotelService.UpdateHotel(adminCtx, hotel)
+	a.ErrorIs(err, ErrHotelVersionRequired)
+	a.ErrorIs(err, ErrPreconditionRequired)
+
+	// Changed after the service loaded it
+	hotel.Version = 3
+	hotel.Name = "Hotel Raced"
+	_, err = HotelService.UpdateHotel(adminCtx, hotel)
+	a.ErrorIs(err, ErrHotelModified)
+	a.ErrorIs(err, ErrPrecondition)
+}
+
+func TestInsertHotel_Service_Unauthorized(t *testing.T) {
+
+	a := assert.New(t)
+
+	_, err := HotelService.InsertHotel(context.Background(), dto.HotelDto{Name: "Hotel"})
+	a.ErrorIs(err, ErrAuthenticationRequired)
+
+	// Managers run the hotels they are given, admins add them
+	_, err = HotelService.InsertHotel(asUser(5, auth.RoleManager), dto.HotelDto{Name: "Hotel"})
+	a.ErrorIs(err, ErrPermissionDenied)
+
+	_, err = HotelService.UpdateHotel(asUser(1, auth.RoleCustomer), dto.HotelDto{Id: 1, Name: "Hotel"})
+	a.ErrorIs(err, ErrPermissionDenied)
+
+	// Until the hotel is assigned to them
+	a.ErrorIs(HotelService.DeleteHotel(asUser(5, auth.RoleManager), 1, false), ErrHotelNotAssigned)
+}
+
+func TestHotel_Service_Manager(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAssignments(t)
+
+	_, err := HotelService.UpdateHotel(managerCtx, dto.HotelDto{Id: 2, Name: "Hotel 2"})
+	a.ErrorIs(err, ErrHotelNotAssigned)
+	a.ErrorIs(HotelService.DeleteHotel(managerCtx, 2, false), ErrHotelNotAssigned)
+
+	a.Nil(HotelService.DeleteHotel(managerCtx, 1, false))
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"project/client"
+	"project/dto"
+	"project/model"
+	"project/tracing"
+	"time"
+)
+
+type idempotencyService struct{}
+
+type idempotencyServiceInterface interface {
+	Begin(ctx context.Context, key string, fingerprint string) (dto.IdempotentResponseDto, bool, error)
+	Complete(ctx context.Context, key string, response dto.IdempotentResponseDto) error
+	Release(ctx context.Context, key string) error
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+var IdempotencyService idempotencyServiceInterface
+
+// IdempotencyRetention is how long a response is replayed for its key, after
+// it the key may be used again. A request holding its key for longer than
+// IdempotencyLockTimeout is taken as abandoned, e.g. by a crashed instance.
+var (
+	IdempotencyRetention   = 24 * time.Hour
+	IdempotencyLockTimeout = time.Minute
+)
+
+func init() {
+	IdempotencyService = &idempotencyService{}
+}
+
+// Begin claims key for the request with the given fingerprint. When the key
+// was already used by the same request its stored response is returned to be
+// replayed, otherwise the caller runs the request and then calls Complete, or
+// Release if the outcome must not be kept.
+func (s *idempotencyService) Begin(ctx context.Context, key string, fingerprint string) (dto.IdempotentResponseDto, bool, error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Begin")
+	defer span.End()
+
+	now := time.Now()
+	record := model.IdempotencyKey{
+		Id:          key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(IdempotencyRetention),
+	}
+
+	// A stale key is deleted and claimed again once
+	for attempt := 0; ; attempt++ {
+		_, err := client.IdempotencyClient.InsertIdempotencyKey(ctx, record)
+
+		if err == nil {
+			return dto.IdempotentResponseDto{}, false, nil
+		}
+
+		if !errors.Is(err, client.ErrConflict) {
+			return dto.IdempotentResponseDto{}, false, err
+		}
+
+		stored, err := client.IdempotencyClient.GetIdempotencyKey(ctx, key)
+
+		if errors.Is(err, client.ErrNotFound) {
+			// Released by the request holding it, or purged
+			if attempt == 0 {
+				continue
+			}
+
+			return dto.IdempotentResponseDto{}, false, ErrIdempotencyKeyInProgress.WithRetryAfter(time.Second)
+		}
+
+		if err != nil {
+			return dto.IdempotentResponseDto{}, false, err
+		}
+
+		abandoned := stored.Status == 0 && now.Sub(stored.CreatedAt) > IdempotencyLockTimeout
+
+		if attempt == 0 && (!now.Before(stored.ExpiresAt) || abandoned) {
+			if err := client.IdempotencyClient.DeleteIdempotencyKey(ctx, key); err != nil {
+				return dto.IdempotentResponseDto{}, false, err
+			}
+
+			continue
+		}
+
+		if stored.Fingerprint != fingerprint {
+			return dto.IdempotentResponseDto{}, false, ErrIdempotencyKeyReused
+		}
+
+		if stored.Status == 0 {
+			return dto.IdempotentResponseDto{}, false, ErrIdempotencyKeyInProgress.WithRetryAfter(time.Second)
+		}
+
+		log.Ctx(ctx).WithField("status", stored.Status).Info("Replaying idempotent response")
+
+		return dto.IdempotentResponseDto{
+			Status:      stored.Status,
+			ContentType: stored.ContentType,
+			Body:        stored.Body,
+		}, true, nil
+	}
+}
+
+// Complete stores the response of the request holding key
+func (s *idempotencyService) Complete(ctx context.Context, key string, response dto.IdempotentResponseDto) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Complete")
+	defer span.End()
+
+	return client.IdempotencyClient.UpdateIdempotencyKey(ctx, model.IdempotencyKey{
+		Id:          key,
+		Status:      response.Status,
+		ContentType: response.ContentType,
+		Body:        response.Body,
+	})
+}
+
+// Release frees key so a retry runs the request again
+func (s *idempotencyService) Release(ctx context.Context, key string) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Release")
+	defer span.End()
+
+	return client.IdempotencyClient.DeleteIdempotencyKey(ctx, key)
+}
+
+// PurgeExpired deletes the keys past their retention
+func (s *idempotencyService) PurgeExpired(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.PurgeExpired")
+	defer span.End()
+
+	return client.IdempotencyClient.DeleteExpiredIdempotencyKeys(ctx, time.Now())
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"project/client"
+	"project/dto"
+	"project/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestIdempotency keeps the keys in memory
+type TestIdempotency struct {
+	keys map[string]model.IdempotencyKey
+}
+
+func newTestIdempotency(t *testing.T) *TestIdempotency {
+	previous := client.IdempotencyClient
+	mock := &TestIdempotency{keys: map[string]model.IdempotencyKey{}}
+
+	client.IdempotencyClient = mock
+	t.Cleanup(func() { client.IdempotencyClient = previous })
+
+	return mock
+}
+
+func (t *TestIdempotency) InsertIdempotencyKey(ctx context.Context, key model.IdempotencyKey) (model.IdempotencyKey, error) {
+	if _, ok := t.keys[key.Id]; ok {
+		return key, client.ErrConflict
+	}
+
+	t.keys[key.Id] = key
+
+	return key, nil
+}
+
+func (t *TestIdempotency) GetIdempotencyKey(ctx context.Context, key string) (model.IdempotencyKey, error) {
+	stored, ok := t.keys[key]
+
+	if !ok {
+		return stored, client.ErrNotFound
+	}
+
+	return stored, nil
+}
+
+func (t *TestIdempotency) UpdateIdempotencyKey(ctx context.Context, key model.IdempotencyKey) error {
+	stored := t.keys[key.Id]
+	stored.Status, stored.ContentType, stored.Body = key.Status, key.ContentType, key.Body
+	t.keys[key.Id] = stored
+
+	return nil
+}
+
+func (t *TestIdempotency) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	delete(t.keys, key)
+
+	return nil
+}
+
+func (t *TestIdempotency) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	var count int64
+
+	for id, key := range t.keys {
+		if !now.Before(key.ExpiresAt) {
+			delete(t.keys, id)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func TestIdempotency_Service(t *testing.T) {
+	a := assert.New(t)
+	newTestIdempotency(t)
+	ctx := context.Background()
+
+	_, replay, err := IdempotencyService.Begin(ctx, "key-1", "fingerprint")
+	a.Nil(err)
+	a.False(replay)
+
+	// A retry while the first request runs
+	_, _, err = IdempotencyService.Begin(ctx, "key-1", "fingerprint")
+	a.ErrorIs(err, ErrIdempotencyKeyInProgress)
+	a.Equal(time.Second, err.(*Error).RetryAfter)
+
+	a.Nil(IdempotencyService.Complete(ctx, "key-1", dto.IdempotentResponseDto{Status: 201, ContentType: "application/json", Body: []byte(`{"id":1}`)}))
+
+	response, replay, err := IdempotencyService.Begin(ctx, "key-1", "fingerprint")
+	a.Nil(err)
+	a.True(replay)
+	a.Equal(201, response.Status)
+	a.Equal(`{"id":1}`, string(response.Body))
+
+	_, _, err = IdempotencyService.Begin(ctx, "key-1", "other")
+	a.ErrorIs(err, ErrIdempotencyKeyReused)
+	a.ErrorIs(err, ErrUnprocessable)
+
+	// Released keys run again
+	a.Nil(IdempotencyService.Release(ctx, "key-1"))
+
+	_, replay, err = IdempotencyService.Begin(ctx, "key-1", "other")
+	a.Nil(err)
+	a.False(replay)
+}
+
+func TestIdempotency_Service_StaleKeys(t *testing.T) {
+	a := assert.New(t)
+	mock := newTestIdempotency(t)
+	ctx := context.Background()
+
+	mock.keys["expired"] = model.IdempotencyKey{Id: "expired", Fingerprint: "old", Status: 201, CreatedAt: time.Now().Add(-25 * time.Hour), ExpiresAt: time.Now().Add(-time.Hour)}
+	mock.keys["abandoned"] = model.IdempotencyKey{Id: "abandoned", Fingerprint: "fingerprint", CreatedAt: time.Now().Add(-time.Hour), ExpiresAt: time.Now().Add(time.Hour)}
+
+	// Both keys can be claimed again, whatever request used them before
+	_, replay, err := IdempotencyService.Begin(ctx, "expired", "new")
+	a.Nil(err)
+	a.False(replay)
+	a.Equal("new", mock.keys["expired"].Fingerprint)
+
+	_, replay, err = IdempotencyService.Begin(ctx, "abandoned", "fingerprint")
+	a.Nil(err)
+	a.False(replay)
+
+	count, err := IdempotencyService.PurgeExpired(ctx)
+	a.Nil(err)
+	a.Zero(count)
+}
@@ -1,30 +1,71 @@
 package service
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"project/auth"
 	"project/client"
 	"project/dto"
 	"project/model"
+	"project/tracing"
+	"strconv"
+	"time"
 )
 
 type imageService struct{}
 
 type imageServiceInterface interface {
-	InsertImages(imagesDto dto.ImagesDto) (dto.ImagesDto, error)
-	GetImageById(id int) (dto.ImageDto, error)
+	CheckImageUpload(ctx context.Context, hotelId int) error
+	InsertImages(ctx context.Context, imagesDto dto.ImagesDto) (dto.ImagesDto, error)
+	GetImageById(ctx context.Context, id int) (dto.ImageDto, error)
+	SignImageUrl(ctx context.Context, id int, ttl time.Duration) (string, error)
+	CheckImageAccess(ctx context.Context, imageDto dto.ImageDto, expires string, signature string) error
 }
 
 var ImageService imageServiceInterface
 
+// ImageSigningKey signs expiring URLs for images of draft hotels, it is set from
+// the configuration at startup. Signed URLs are disabled when it is empty.
+var ImageSigningKey []byte
+
 func init() {
 	ImageService = &imageService{}
 }
 
-func (s *imageService) InsertImages(imagesDto dto.ImagesDto) (dto.ImagesDto, error) {
+// CheckImageUpload tells whether images can be added to the hotel, before
+// their files are saved
+func (s *imageService) CheckImageUpload(ctx context.Context, hotelId int) error {
+	ctx, span := tracing.Start(ctx, "ImageService.CheckImageUpload")
+	defer span.End()
+
+	if err := authorizeHotel(ctx, hotelId, auth.ManageHotels); err != nil {
+		return err
+	}
+
+	_, err := client.HotelClient.GetHotelById(ctx, hotelId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrHotelNotFound
+	}
+
+	return err
+}
+
+func (s *imageService) InsertImages(ctx context.Context, imagesDto dto.ImagesDto) (dto.ImagesDto, error) {
+	ctx, span := tracing.Start(ctx, "ImageService.InsertImages")
+	defer span.End()
 
 	var images model.Images
 
 	for _, imageDto := range imagesDto {
+		if err := authorizeHotel(ctx, imageDto.HotelId, auth.ManageHotels); err != nil {
+			return imagesDto, err
+		}
+
 		var image model.Image
 
 		image.Path = imageDto.Path
@@ -33,31 +74,39 @@ func (s *imageService) InsertImages(imagesDto dto.ImagesDto) (dto.ImagesDto, err
 		images = append(images, image)
 	}
 
-	images = client.ImageClient.InsertImages(images)
+	images, err := client.ImageClient.InsertImages(ctx, images)
+
+	if err != nil {
+		return imagesDto, err
+	}
 
 	if len(images) != len(imagesDto) {
 		return imagesDto, errors.New("failed to insert images")
 	}
 
 	for i, image := range images {
-		if image.Id == 0 {
-			return imagesDto, errors.New("failed to insert images")
-		}
-
 		imagesDto[i].Id = image.Id
+
+		AuditService.Record(ctx, AuditCreate, "image", image.Id, nil, imagesDto[i])
 	}
 
 	return imagesDto, nil
 }
 
-func (s *imageService) GetImageById(id int) (dto.ImageDto, error) {
-	var image model.Image
+func (s *imageService) GetImageById(ctx context.Context, id int) (dto.ImageDto, error) {
+	ctx, span := tracing.Start(ctx, "ImageService.GetImageById")
+	defer span.End()
+
 	var imageDto dto.ImageDto
 
-	image = client.ImageClient.GetImageById(id)
+	image, err := client.ImageClient.GetImageById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return imageDto, ErrImageNotFound
+	}
 
-	if image.Id == 0 {
-		return imageDto, errors.New("image not found")
+	if err != nil {
+		return imageDto, err
 	}
 
 	imageDto.Id = image.Id
@@ -66,3 +115,72 @@ func (s *imageService) GetImageById(id int) (dto.ImageDto, error) {
 
 	return imageDto, nil
 }
+
+// SignImageUrl returns an expiring URL to the image, for those who can manage
+// its hotel
+func (s *imageService) SignImageUrl(ctx context.Context, id int, ttl time.Duration) (string, error) {
+	ctx, span := tracing.Start(ctx, "ImageService.SignImageUrl")
+	defer span.End()
+
+	if len(ImageSigningKey) == 0 {
+		return "", ErrImageSigningDisabled
+	}
+
+	image, err := client.ImageClient.GetImageById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return "", ErrImageNotFound
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	// A signed URL opens the image of a draft hotel to whoever holds it
+	if err := authorizeHotel(ctx, image.HotelId, auth.ManageHotels); err != nil {
+		return "", err
+	}
+
+	expires := time.Now().Add(ttl).Unix()
+
+	return fmt.Sprintf("/image/%d?expires=%d&signature=%s", image.Id, expires, imageSignature(image.Id, expires)), nil
+}
+
+func (s *imageService) CheckImageAccess(ctx context.Context, imageDto dto.ImageDto, expires string, signature string) error {
+	ctx, span := tracing.Start(ctx, "ImageService.CheckImageAccess")
+	defer span.End()
+
+	hotel, err := client.HotelClient.GetHotelById(ctx, imageDto.HotelId)
+
+	if err != nil && !errors.Is(err, client.ErrNotFound) {
+		return err
+	}
+
+	// Images of published hotels, and every image when signing is disabled, are public
+	if !hotel.Draft || len(ImageSigningKey) == 0 {
+		return nil
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+
+	if err != nil || signature == "" {
+		return ErrImageSignatureRequired
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(imageSignature(imageDto.Id, expiresAt))) {
+		return ErrImageSignatureInvalid
+	}
+
+	if time.Now().Unix() > expiresAt {
+		return ErrImageSignatureExpired
+	}
+
+	return nil
+}
+
+func imageSignature(id int, expires int64) string {
+	mac := hmac.New(sha256.New, ImageSigningKey)
+	mac.Write([]byte(fmt.Sprintf("%d:%d", id, expires)))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
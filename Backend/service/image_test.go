@@ -1,11 +1,16 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"project/client"
 	"project/dto"
 	"project/model"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 type TestImage struct{}
@@ -14,18 +19,18 @@ func init() {
 	client.ImageClient = &TestImage{}
 }
 
-func (t TestImage) InsertImage(image model.Image) model.Image {
+func (t TestImage) InsertImage(ctx context.Context, image model.Image) (model.Image, error) {
 
 	if image.Path == "" {
-		image.Id = 0
-	} else {
-		image.Id = 1
+		return image, errors.New("failed to insert image")
 	}
 
-	return image
+	image.Id = 1
+
+	return image, nil
 }
 
-func (t TestImage) InsertImages(images model.Images) model.Images {
+func (t TestImage) InsertImages(ctx context.Context, images model.Images) (model.Images, error) {
 
 	if len(images) == 0 {
 		images = append(images, model.Image{
@@ -39,37 +44,37 @@ func (t TestImage) InsertImages(images model.Images) model.Images {
 		}
 	}
 
-	return images
+	return images, nil
 }
 
-func (t TestImage) GetImageById(id int) model.Image {
+func (t TestImage) GetImageById(ctx context.Context, id int) (model.Image, error) {
 	var image model.Image
 
 	if id > 10 {
-		image.Id = 0
-	} else {
-		image.Id = id
+		return image, client.ErrNotFound
 	}
 
-	return image
+	image.Id = id
+
+	return image, nil
 }
 
-func (t TestImage) GetImages() model.Images {
-	return model.Images{}
+func (t TestImage) GetImages(ctx context.Context) (model.Images, error) {
+	return model.Images{{Id: 1, Path: "Images/used.jpg", HotelId: 1}}, nil
 }
 
-func (t TestImage) GetImagesByHotelId(hotelId int) model.Images {
-	return model.Images{}
+func (t TestImage) GetImagesByHotelId(ctx context.Context, hotelId int) (model.Images, error) {
+	return model.Images{}, nil
 }
 
-func (t TestImage) DeleteImage(image model.Image) error { return nil }
+func (t TestImage) DeleteImage(ctx context.Context, image model.Image) error { return nil }
 
 func TestInsertImages_Service_Error(t *testing.T) {
 
 	a := assert.New(t)
 	var images dto.ImagesDto
 
-	_, err := ImageService.InsertImages(images)
+	_, err := ImageService.InsertImages(adminCtx, images)
 
 	expectedResponse := "failed to insert images"
 
@@ -84,7 +89,7 @@ func TestInsertImages_Service_Success(t *testing.T) {
 		dto.ImageDto{Path: "image1.jpg"},
 	}
 
-	result, err := ImageService.InsertImages(images)
+	result, err := ImageService.InsertImages(adminCtx, images)
 
 	images[0].Id = 1
 
@@ -92,11 +97,23 @@ func TestInsertImages_Service_Success(t *testing.T) {
 	a.Equal(images, result)
 }
 
+func TestInsertImages_Service_Manager(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAssignments(t)
+
+	_, err := ImageService.InsertImages(managerCtx, dto.ImagesDto{{Path: "image1.jpg", HotelId: 1}})
+	a.Nil(err)
+
+	_, err = ImageService.InsertImages(managerCtx, dto.ImagesDto{{Path: "image1.jpg", HotelId: 1}, {Path: "image2.jpg", HotelId: 2}})
+	a.ErrorIs(err, ErrHotelNotAssigned)
+}
+
 func TestGetImageById_Service_Found(t *testing.T) {
 
 	a := assert.New(t)
 
-	result, err := ImageService.GetImageById(1)
+	result, err := ImageService.GetImageById(context.Background(), 1)
 
 	expectedResult := dto.ImageDto{Id: 1}
 
@@ -108,10 +125,103 @@ func TestGetImageById_Service_NotFound(t *testing.T) {
 
 	a := assert.New(t)
 
-	_, err := ImageService.GetImageById(12)
+	_, err := ImageService.GetImageById(context.Background(), 12)
 
 	expectedResult := "image not found"
 
 	a.NotNil(err)
 	a.Equal(expectedResult, err.Error())
 }
+
+func TestSignImageUrl_Service_NotConfigured(t *testing.T) {
+
+	a := assert.New(t)
+	ImageSigningKey = nil
+
+	_, err := ImageService.SignImageUrl(context.Background(), 1, time.Hour)
+
+	expectedResult := "image signing is not configured"
+
+	a.NotNil(err)
+	a.Equal(expectedResult, err.Error())
+}
+
+func TestSignImageUrl_Service_Unauthorized(t *testing.T) {
+
+	a := assert.New(t)
+	ImageSigningKey = []byte("test-key")
+
+	_, err := ImageService.SignImageUrl(context.Background(), 1, time.Hour)
+	a.ErrorIs(err, ErrAuthenticationRequired)
+
+	_, err = ImageService.SignImageUrl(asUser(1, "Customer"), 1, time.Hour)
+	a.ErrorIs(err, ErrPermissionDenied)
+}
+
+func TestCheckImageAccess_Service_Published(t *testing.T) {
+
+	a := assert.New(t)
+	ImageSigningKey = []byte("test-key")
+
+	err := ImageService.CheckImageAccess(context.Background(), dto.ImageDto{Id: 1, HotelId: 1}, "", "")
+
+	a.Nil(err)
+}
+
+func TestCheckImageAccess_Service_Unsigned(t *testing.T) {
+
+	a := assert.New(t)
+	ImageSigningKey = []byte("test-key")
+
+	err := ImageService.CheckImageAccess(context.Background(), dto.ImageDto{Id: 1, HotelId: 10}, "", "")
+
+	expectedResult := "image requires a signed url"
+
+	a.NotNil(err)
+	a.Equal(expectedResult, err.Error())
+}
+
+func TestCheckImageAccess_Service_Signed(t *testing.T) {
+
+	a := assert.New(t)
+	ImageSigningKey = []byte("test-key")
+
+	url, err := ImageService.SignImageUrl(asUser(4, "Admin"), 1, time.Hour)
+	a.Nil(err)
+
+	query := url[strings.Index(url, "?")+1:]
+	params := strings.Split(query, "&")
+	expires := strings.TrimPrefix(params[0], "expires=")
+	signature := strings.TrimPrefix(params[1], "signature=")
+
+	err = ImageService.CheckImageAccess(context.Background(), dto.ImageDto{Id: 1, HotelId: 10}, expires, signature)
+	a.Nil(err)
+
+	err = ImageService.CheckImageAccess(context.Background(), dto.ImageDto{Id: 2, HotelId: 10}, expires, signature)
+	a.NotNil(err)
+	a.Equal("invalid image signature", err.Error())
+}
+
+func TestCheckImageAccess_Service_Expired(t *testing.T) {
+
+	a := assert.New(t)
+	ImageSigningKey = []byte("test-key")
+
+	expires := time.Now().Add(-time.Minute).Unix()
+
+	err := ImageService.CheckImageAccess(context.Background(), dto.ImageDto{Id: 1, HotelId: 10}, strconv.FormatInt(expires, 10), imageSignature(1, expires))
+
+	expectedResult := "image signature expired"
+
+	a.NotNil(err)
+	a.Equal(expectedResult, err.Error())
+}
+
+func TestCheckImageUpload_Service(t *testing.T) {
+	a := assert.New(t)
+
+	a.ErrorIs(ImageService.CheckImageUpload(context.Background(), 1), ErrAuthenticationRequired)
+	a.ErrorIs(ImageService.CheckImageUpload(asUser(1, "Customer"), 1), ErrPermissionDenied)
+	a.ErrorIs(ImageService.CheckImageUpload(adminCtx, 20), ErrHotelNotFound)
+	a.Nil(ImageService.CheckImageUpload(adminCtx, 1))
+}
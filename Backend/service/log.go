@@ -0,0 +1,5 @@
+package service
+
+import "project/logging"
+
+var log = logging.Package("service")
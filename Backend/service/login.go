@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"golang.org/x/crypto/bcrypt"
+	"project/auth"
+	"project/metrics"
+	"project/model"
+	"project/ratelimit"
+	"strings"
+	"time"
+)
+
+// LockoutPolicy throttles logins to an account after failed attempts. Each
+// failure doubles the wait before the next attempt, starting at Delay and
+// capped at MaxDelay, and MaxFailures failures within Window lock the account
+// for Lockout. Clients from an address the account logged in from within
+// KnownClientTtl count their failures apart, so others can't lock them out.
+type LockoutPolicy struct {
+	MaxFailures    int
+	Window         time.Duration
+	Lockout        time.Duration
+	Delay          time.Duration
+	MaxDelay       time.Duration
+	KnownClientTtl time.Duration
+}
+
+// loginAttemptTtl bounds how long an attempt holds the account, in case it
+// never lets go
+const loginAttemptTtl = 30 * time.Second
+
+// LoginAttempts records the failed logins, it is shared with the rate limiter
+// and replaced at startup. LoginLockout is set from the configuration.
+var (
+	LoginAttempts ratelimit.Store = ratelimit.NewMemoryStore()
+	LoginLockout                  = LockoutPolicy{
+		MaxFailures:    5,
+		Window:         15 * time.Minute,
+		Lockout:        15 * time.Minute,
+		Delay:          time.Second,
+		MaxDelay:       30 * time.Second,
+		KnownClientTtl: 30 * 24 * time.Hour,
+	}
+)
+
+func accountLoginKey(email string) string {
+	return "login:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginKey is where the failed logins of the client to the account count
+func loginKey(ctx context.Context, email string) string {
+	key := accountLoginKey(email)
+	ip := auth.ClientIp(ctx)
+
+	if ip == "" {
+		return key
+	}
+
+	known, err := LoginAttempts.Marked(ctx, key+":known:"+ip)
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to read the known login clients")
+		return key
+	}
+
+	if known {
+		return key + ":" + ip
+	}
+
+	return key
+}
+
+// delay is the wait imposed after the given number of failures
+func (p LockoutPolicy) delay(failures int) time.Duration {
+	delay := p.Delay
+
+	for i := 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+
+	return delay
+}
+
+// beginLogin starts an attempt at key, rejecting it while the account is
+// locked or before its delay has passed. Attempts at a key are taken one at a
+// time, so concurrent guesses can't all pass the check before any of them
+// fails. The returned func ends the attempt. The store failing doesn't block
+// logins.
+func beginLogin(ctx context.Context, key string) (func(), error) {
+	taken, err := LoginAttempts.Lock(ctx, key+":attempt", loginAttemptTtl)
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to hold the login attempt")
+		return func() {}, checkLogin(ctx, key)
+	}
+
+	if !taken {
+		metrics.LoginFailures.WithLabelValues("login_throttled").Inc()
+		return nil, ErrLoginThrottled.WithRetryAfter(time.Second)
+	}
+
+	end := func() {
+		if err := LoginAttempts.Unlock(ctx, key+":attempt"); err != nil {
+			log.Ctx(ctx).WithError(err).Warn("Failed to end the login attempt")
+		}
+	}
+
+	if err := checkLogin(ctx, key); err != nil {
+		end()
+		return nil, err
+	}
+
+	return end, nil
+}
+
+// checkLogin rejects an attempt made while the account is locked or before
+// its delay has passed
+func checkLogin(ctx context.Context, key string) error {
+	failures, err := LoginAttempts.Failures(ctx, key)
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to read login attempts")
+		return nil
+	}
+
+	if failures.Count == 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	if failures.Count >= LoginLockout.MaxFailures {
+		if until := failures.Last.Add(LoginLockout.Lockout); now.Before(until) {
+			metrics.LoginFailures.WithLabelValues("account_locked").Inc()
+			return ErrAccountLocked.WithRetryAfter(until.Sub(now))
+		}
+
+		return nil
+	}
+
+	if until := failures.Last.Add(LoginLockout.delay(failures.Count)); now.Before(until) {
+		metrics.LoginFailures.WithLabelValues("login_throttled").Inc()
+		return ErrLoginThrottled.WithRetryAfter(until.Sub(now))
+	}
+
+	return nil
+}
+
+// loginFailed counts a failed attempt, unknown emails count as well so
+// locking doesn't reveal which accounts exist
+func loginFailed(ctx context.Context, key string) {
+	failures, err := LoginAttempts.Fail(ctx, key, LoginLockout.Window)
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to record login attempt")
+		return
+	}
+
+	if failures.Count == LoginLockout.MaxFailures {
+		log.Ctx(ctx).Warn("Account locked after repeated failed logins")
+	}
+}
+
+// loginSucceeded forgets the failures of the client and remembers its address,
+// so failures from elsewhere don't lock it out afterwards
+func loginSucceeded(ctx context.Context, email string) {
+	if err := LoginAttempts.Reset(ctx, loginKey(ctx, email)); err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to reset login attempts")
+	}
+
+	ip := auth.ClientIp(ctx)
+
+	if ip == "" || LoginLockout.KnownClientTtl <= 0 {
+		return
+	}
+
+	if err := LoginAttempts.Mark(ctx, accountLoginKey(email)+":known:"+ip, LoginLockout.KnownClientTtl); err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to remember the login client")
+	}
+}
+
+// confirmUser checks the user acting on their account is its owner: by their
+// password, or for accounts without one, as those created through a login
+// provider, by the code mailed by RequestConfirmation
+func confirmUser(ctx context.Context, user model.User, password string, code string) error {
+	if user.Password != "" {
+		return checkPassword(ctx, user, password)
+	}
+
+	if code == "" {
+		return ErrConfirmationRequired
+	}
+
+	userToken, err := redeemToken(ctx, TokenConfirmation, code)
+
+	if err != nil {
+		return err
+	}
+
+	// The code was mailed to this account, at the email it has now
+	if userToken.UserId != user.Id || userToken.Email != user.Email {
+		log.Ctx(ctx).WithField("user_id", user.Id).Warn("Confirmation code of another account used")
+		return ErrTokenInvalid
+	}
+
+	return nil
+}
+
+// checkPassword confirms the password of a signed in user before a sensitive
+// change, the failures count towards the login lockout of the account
+func checkPassword(ctx context.Context, user model.User, password string) error {
+	key := loginKey(ctx, user.Email)
+	end, err := beginLogin(ctx, key)
+
+	if err != nil {
+		return err
+	}
+
+	defer end()
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		log.Ctx(ctx).WithField("user_id", user.Id).Warn("Password confirmation failed")
+		loginFailed(ctx, key)
+		return ErrCurrentPasswordIncorrect
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"project/auth"
+	"project/dto"
+	"project/ratelimit"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withLockout(t *testing.T, policy LockoutPolicy) {
+	previous := LoginLockout
+
+	LoginLockout = policy
+	LoginAttempts = ratelimit.NewMemoryStore()
+
+	t.Cleanup(func() { LoginLockout = previous })
+}
+
+func TestUserLogin_Service_Lockout(t *testing.T) {
+	a := assert.New(t)
+	withLockout(t, LockoutPolicy{MaxFailures: 3, Window: time.Hour, Lockout: time.Hour})
+
+	wrong := dto.UserDto{Email: "email@email.com", Password: "password"}
+	right := dto.UserDto{Email: "EMAIL@email.com", Password: "password1"}
+
+	for i := 0; i < 3; i++ {
+		_, err := UserService.UserLogin(context.Background(), wrong)
+		a.True(errors.Is(err, ErrIncorrectPassword))
+	}
+
+	// The right password is refused too until the lockout ends
+	_, err := UserService.UserLogin(context.Background(), right)
+
+	var serviceError *Error
+	a.True(errors.As(err, &serviceError))
+	a.Equal("account_locked", serviceError.Code)
+	a.True(errors.Is(err, ErrTooManyRequests))
+	a.InDelta(time.Hour.Seconds(), serviceError.RetryAfter.Seconds(), 5)
+}
+
+func TestUserLogin_Service_ProgressiveDelay(t *testing.T) {
+	a := assert.New(t)
+	withLockout(t, LockoutPolicy{MaxFailures: 5, Window: time.Hour, Lockout: time.Hour, Delay: time.Minute, MaxDelay: time.Hour})
+
+	_, err := UserService.UserLogin(context.Background(), dto.UserDto{Email: "email@email.com", Password: "password"})
+	a.True(errors.Is(err, ErrIncorrectPassword))
+
+	_, err = UserService.UserLogin(context.Background(), dto.UserDto{Email: "email@email.com", Password: "password1"})
+	a.True(errors.Is(err, ErrLoginThrottled))
+
+	// Unknown accounts are throttled like existing ones
+	_, err = UserService.UserLogin(context.Background(), dto.UserDto{Password: "password"})
+	a.True(errors.Is(err, ErrUserNotRegistered))
+
+	_, err = UserService.UserLogin(context.Background(), dto.UserDto{Password: "password"})
+	a.True(errors.Is(err, ErrLoginThrottled))
+}
+
+func TestUserLogin_Service_SuccessResetsFailures(t *testing.T) {
+	a := assert.New(t)
+	withLockout(t, LockoutPolicy{MaxFailures: 2, Window: time.Hour, Lockout: time.Hour})
+
+	_, err := UserService.UserLogin(context.Background(), dto.UserDto{Email: "email@email.com", Password: "password"})
+	a.True(errors.Is(err, ErrIncorrectPassword))
+
+	_, err = UserService.UserLogin(context.Background(), dto.UserDto{Email: "email@email.com", Password: "password1"})
+	a.Nil(err)
+
+	// A single failure after the reset doesn't lock the account
+	_, err = UserService.UserLogin(context.Background(), dto.UserDto{Email: "email@email.com", Password: "password"})
+	a.True(errors.Is(err, ErrIncorrectPassword))
+}
+
+func TestUserLogin_Service_OneAttemptAtATime(t *testing.T) {
+	a := assert.New(t)
+	withLockout(t, LockoutPolicy{MaxFailures: 5, Window: time.Hour, Lockout: time.Hour})
+	ctx := context.Background()
+
+	// Another attempt at the account is still checking its password
+	taken, err := LoginAttempts.Lock(ctx, "login:email@email.com:attempt", time.Minute)
+	a.True(taken)
+	a.Nil(err)
+
+	_, err = UserService.UserLogin(ctx, dto.UserDto{Email: "email@email.com", Password: "password"})
+	a.ErrorIs(err, ErrLoginThrottled)
+
+	a.Nil(LoginAttempts.Unlock(ctx, "login:email@email.com:attempt"))
+
+	// Attempts let go of the account once they end
+	_, err = UserService.UserLogin(ctx, dto.UserDto{Email: "email@email.com", Password: "password"})
+	a.ErrorIs(err, ErrIncorrectPassword)
+	_, err = UserService.UserLogin(ctx, dto.UserDto{Email: "email@email.com", Password: "password1"})
+	a.Nil(err)
+}
+
+func TestUserLogin_Service_KnownClient(t *testing.T) {
+	a := assert.New(t)
+	withLockout(t, LockoutPolicy{MaxFailures: 2, Window: time.Hour, Lockout: time.Hour, KnownClientTtl: time.Hour})
+
+	home := auth.WithClientIp(context.Background(), "192.0.2.1")
+	elsewhere := auth.WithClientIp(context.Background(), "198.51.100.7")
+
+	_, err := UserService.UserLogin(home, dto.UserDto{Email: "email@email.com", Password: "password1"})
+	a.Nil(err)
+
+	// Someone else locks the account out
+	for i := 0; i < 2; i++ {
+		_, err = UserService.UserLogin(elsewhere, dto.UserDto{Email: "email@email.com", Password: "password"})
+		a.ErrorIs(err, ErrIncorrectPassword)
+	}
+
+	_, err = UserService.UserLogin(elsewhere, dto.UserDto{Email: "email@email.com", Password: "password1"})
+	a.ErrorIs(err, ErrAccountLocked)
+
+	// but not from where the account logged in before, which counts its own failures
+	_, err = UserService.UserLogin(home, dto.UserDto{Email: "email@email.com", Password: "password1"})
+	a.Nil(err)
+
+	for i := 0; i < 2; i++ {
+		_, err = UserService.UserLogin(home, dto.UserDto{Email: "email@email.com", Password: "password"})
+		a.ErrorIs(err, ErrIncorrectPassword)
+	}
+
+	_, err = UserService.UserLogin(home, dto.UserDto{Email: "email@email.com", Password: "password1"})
+	a.ErrorIs(err, ErrAccountLocked)
+}
+
+func TestLockoutPolicy_Delay(t *testing.T) {
+	a := assert.New(t)
+
+	policy := LockoutPolicy{Delay: time.Second, MaxDelay: 5 * time.Second}
+
+	a.Equal(time.Second, policy.delay(1))
+	a.Equal(2*time.Second, policy.delay(2))
+	a.Equal(4*time.Second, policy.delay(3))
+	a.Equal(5*time.Second, policy.delay(4))
+}
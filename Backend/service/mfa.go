@@ -0,0 +1,588 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"project/auth"
+	"project/client"
+	"project/dto"
+	"project/metrics"
+	"project/model"
+	"project/totp"
+	"project/tracing"
+	"strings"
+	"time"
+)
+
+type mfaService struct{}
+
+type mfaServiceInterface interface {
+	GetMfaStatus(ctx context.Context, userId int) (dto.MfaStatusDto, error)
+	StartMfaEnrollment(ctx context.Context, userId int, setupDto dto.MfaSetupDto) (dto.MfaEnrollmentDto, error)
+	ConfirmMfaEnrollment(ctx context.Context, userId int, codeDto dto.MfaCodeDto) (dto.RecoveryCodesDto, error)
+	DisableMfa(ctx context.Context, userId int, disableDto dto.MfaDisableDto) error
+	RegenerateRecoveryCodes(ctx context.Context, userId int, codeDto dto.MfaCodeDto) (dto.RecoveryCodesDto, error)
+	ResetMfa(ctx context.Context, userId int) error
+	EnrollMfaAtLogin(ctx context.Context, tokenDto dto.MfaTokenDto) (dto.MfaEnrollmentDto, error)
+	CompleteMfaLogin(ctx context.Context, loginDto dto.MfaLoginDto) (dto.LoginResultDto, error)
+}
+
+var MfaService mfaServiceInterface
+
+// MfaIssuer names the service in authenticator apps and MfaRequiredRoles are
+// the roles that can't log in without a second factor. MfaChallengeTtl is how
+// long the second step of a login can wait. They are set from the configuration.
+var (
+	MfaIssuer        = "Miranda"
+	MfaRequiredRoles []string
+	MfaChallengeTtl  = 5 * time.Minute
+)
+
+// recoveryCodeCount is how many recovery codes a user is given at a time
+const recoveryCodeCount = 10
+
+func init() {
+	MfaService = &mfaService{}
+}
+
+// GetMfaStatus tells whether the user has a second factor and how many
+// recovery codes they have left
+func (s *mfaService) GetMfaStatus(ctx context.Context, userId int) (dto.MfaStatusDto, error) {
+	ctx, span := tracing.Start(ctx, "MfaService.GetMfaStatus")
+	defer span.End()
+
+	if err := authorizeUser(ctx, userId, auth.ViewUsers); err != nil {
+		return dto.MfaStatusDto{}, err
+	}
+
+	user, err := mfaUser(ctx, userId)
+
+	if err != nil {
+		return dto.MfaStatusDto{}, err
+	}
+
+	status := dto.MfaStatusDto{Required: mfaRequired(user.Role)}
+
+	mfa, err := client.MfaClient.GetMfa(ctx, userId)
+
+	if errors.Is(err, client.ErrNotFound) || err == nil && !mfa.Enabled {
+		return status, nil
+	}
+
+	if err != nil {
+		return status, err
+	}
+
+	count, err := client.MfaClient.CountRecoveryCodes(ctx, userId)
+
+	if err != nil {
+		return status, err
+	}
+
+	status.Enabled = true
+	status.RecoveryCodesLeft = int(count)
+
+	return status, nil
+}
+
+// StartMfaEnrollment creates the secret to add to an authenticator app, the
+// second factor is on once a code from the app is confirmed
+func (s *mfaService) StartMfaEnrollment(ctx context.Context, userId int, setupDto dto.MfaSetupDto) (dto.MfaEnrollmentDto, error) {
+	ctx, span := tracing.Start(ctx, "MfaService.StartMfaEnrollment")
+	defer span.End()
+
+	user, err := mfaUser(ctx, userId)
+
+	if err != nil {
+		return dto.MfaEnrollmentDto{}, err
+	}
+
+	if err := confirmUser(ctx, user, setupDto.Password, setupDto.ConfirmationCode); err != nil {
+		return dto.MfaEnrollmentDto{}, err
+	}
+
+	return startEnrollment(ctx, user)
+}
+
+// ConfirmMfaEnrollment turns the second factor on with a code from the app,
+// the recovery codes returned are only shown this once
+func (s *mfaService) ConfirmMfaEnrollment(ctx context.Context, userId int, codeDto dto.MfaCodeDto) (dto.RecoveryCodesDto, error) {
+	ctx, span := tracing.Start(ctx, "MfaService.ConfirmMfaEnrollment")
+	defer span.End()
+
+	user, err := mfaUser(ctx, userId)
+
+	if err != nil {
+		return dto.RecoveryCodesDto{}, err
+	}
+
+	mfa, err := userMfa(ctx, userId)
+
+	if err != nil {
+		return dto.RecoveryCodesDto{}, err
+	}
+
+	if mfa.Enabled {
+		return dto.RecoveryCodesDto{}, ErrMfaEnabled
+	}
+
+	step, err := checkSecondFactor(ctx, user, mfa, codeDto.Code, "")
+
+	if err != nil {
+		return dto.RecoveryCodesDto{}, err
+	}
+
+	codes, err := enableMfa(ctx, user, step)
+
+	return dto.RecoveryCodesDto{RecoveryCodes: codes}, err
+}
+
+// DisableMfa turns the second factor off, unless the role of the user
+// requires one
+func (s *mfaService) DisableMfa(ctx context.Context, userId int, disableDto dto.MfaDisableDto) error {
+	ctx, span := tracing.Start(ctx, "MfaService.DisableMfa")
+	defer span.End()
+
+	user, err := mfaUser(ctx, userId)
+
+	if err != nil {
+		return err
+	}
+
+	if mfaRequired(user.Role) {
+		return ErrMfaRequired
+	}
+
+	mfa, err := userMfa(ctx, userId)
+
+	if err != nil {
+		return err
+	}
+
+	if !mfa.Enabled {
+		return ErrMfaNotEnrolled
+	}
+
+	if err := confirmUser(ctx, user, disableDto.Password, disableDto.ConfirmationCode); err != nil {
+		return err
+	}
+
+	code, recoveryCode := splitCode(disableDto.Code)
+
+	if _, err := checkSecondFactor(ctx, user, mfa, code, recoveryCode); err != nil {
+		return err
+	}
+
+	if err := client.MfaClient.DeleteMfa(ctx, userId); err != nil && !errors.Is(err, client.ErrNotFound) {
+		return err
+	}
+
+	log.Ctx(ctx).WithField("user_id", userId).Info("Second factor disabled")
+	AuditService.Record(ctx, AuditDelete, "user_mfa", userId, dto.MfaStatusDto{Enabled: true}, nil)
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user with new
+// ones, shown only this once
+func (s *mfaService) RegenerateRecoveryCodes(ctx context.Context, userId int, codeDto dto.MfaCodeDto) (dto.RecoveryCodesDto, error) {
+	ctx, span := tracing.Start(ctx, "MfaService.RegenerateRecoveryCodes")
+	defer span.End()
+
+	user, err := mfaUser(ctx, userId)
+
+	if err != nil {
+		return dto.RecoveryCodesDto{}, err
+	}
+
+	mfa, err := userMfa(ctx, userId)
+
+	if err != nil {
+		return dto.RecoveryCodesDto{}, err
+	}
+
+	if !mfa.Enabled {
+		return dto.RecoveryCodesDto{}, ErrMfaNotEnrolled
+	}
+
+	code, recoveryCode := splitCode(codeDto.Code)
+
+	if _, err := checkSecondFactor(ctx, user, mfa, code, recoveryCode); err != nil {
+		return dto.RecoveryCodesDto{}, err
+	}
+
+	codes, records, err := newRecoveryCodes(userId)
+
+	if err != nil {
+		return dto.RecoveryCodesDto{}, err
+	}
+
+	if err := client.MfaClient.ReplaceRecoveryCodes(ctx, userId, records); err != nil {
+		return dto.RecoveryCodesDto{}, err
+	}
+
+	log.Ctx(ctx).WithField("user_id", userId).Info("Recovery codes regenerated")
+	AuditService.Record(ctx, AuditUpdate, "user_mfa", userId, nil, dto.MfaStatusDto{Enabled: true, RecoveryCodesLeft: len(codes)})
+
+	return dto.RecoveryCodesDto{RecoveryCodes: codes}, nil
+}
+
+// ResetMfa removes the second factor of a user who lost their app and their
+// recovery codes. They log in with their password again, and enroll a new app
+// if their role requires one.
+func (s *mfaService) ResetMfa(ctx context.Context, userId int) error {
+	ctx, span := tracing.Start(ctx, "MfaService.ResetMfa")
+	defer span.End()
+
+	identity, err := authorize(ctx, auth.ManageUsers)
+
+	if err != nil {
+		return err
+	}
+
+	if identity.UserId == userId {
+		return ErrOwnAccount
+	}
+
+	if _, err := mfaUser(ctx, userId); err != nil {
+		return err
+	}
+
+	err = client.MfaClient.DeleteMfa(ctx, userId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrMfaNotEnrolled
+	}
+
+	if err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": userId, "admin_id": identity.UserId}).Warn("Second factor reset")
+	AuditService.Record(ctx, AuditDelete, "user_mfa", userId, dto.MfaStatusDto{Enabled: true}, nil)
+
+	return nil
+}
+
+// EnrollMfaAtLogin creates the secret for a user whose role requires a second
+// factor they don't have yet, in the middle of their login
+func (s *mfaService) EnrollMfaAtLogin(ctx context.Context, tokenDto dto.MfaTokenDto) (dto.MfaEnrollmentDto, error) {
+	ctx, span := tracing.Start(ctx, "MfaService.EnrollMfaAtLogin")
+	defer span.End()
+
+	_, user, err := challengeUser(ctx, tokenDto.MfaToken)
+
+	if err != nil {
+		return dto.MfaEnrollmentDto{}, err
+	}
+
+	return startEnrollment(ctx, user)
+}
+
+// CompleteMfaLogin finishes the login started by UserLogin with a code from
+// the app or a recovery code. A code from an app being enrolled turns the
+// second factor on, and the recovery codes are returned with the user.
+func (s *mfaService) CompleteMfaLogin(ctx context.Context, loginDto dto.MfaLoginDto) (dto.LoginResultDto, error) {
+	ctx, span := tracing.Start(ctx, "MfaService.CompleteMfaLogin")
+	defer span.End()
+
+	userToken, user, err := challengeUser(ctx, loginDto.MfaToken)
+
+	if err != nil {
+		return dto.LoginResultDto{}, err
+	}
+
+	mfa, err := userMfa(ctx, user.Id)
+
+	if err != nil {
+		return dto.LoginResultDto{}, err
+	}
+
+	step, err := checkSecondFactor(ctx, user, mfa, loginDto.Code, loginDto.RecoveryCode)
+
+	if err != nil {
+		return dto.LoginResultDto{}, err
+	}
+
+	// Deleting it makes sure a challenge finishes a single login
+	err = client.TokenClient.DeleteToken(ctx, userToken.Id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return dto.LoginResultDto{}, ErrMfaChallengeInvalid
+	}
+
+	if err != nil {
+		return dto.LoginResultDto{}, err
+	}
+
+	result := dto.LoginResultDto{User: loginUser(user)}
+
+	if !mfa.Enabled {
+		result.RecoveryCodes, err = enableMfa(ctx, user, step)
+
+		if err != nil {
+			return dto.LoginResultDto{}, err
+		}
+	}
+
+	loginSucceeded(ctx, user.Email)
+
+	return result, nil
+}
+
+// mfaRequired tells whether users with the role must have a second factor
+func mfaRequired(role string) bool {
+	for _, required := range MfaRequiredRoles {
+		if required == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mfaChallenge starts the second step of the login of a user who has a second
+// factor or whose role requires one, it is nil for the others
+func mfaChallenge(ctx context.Context, user model.User) (*dto.MfaChallengeDto, error) {
+	mfa, err := client.MfaClient.GetMfa(ctx, user.Id)
+
+	if err != nil && !errors.Is(err, client.ErrNotFound) {
+		return nil, err
+	}
+
+	enabled := err == nil && mfa.Enabled
+
+	if !enabled && !mfaRequired(user.Role) {
+		return nil, nil
+	}
+
+	token, err := issueToken(ctx, user.Id, TokenMfaChallenge, user.Email, MfaChallengeTtl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.MfaChallengeDto{
+		MfaRequired:        true,
+		MfaToken:           token,
+		EnrollmentRequired: !enabled,
+		ExpiresIn:          int(MfaChallengeTtl.Seconds()),
+	}, nil
+}
+
+// challengeUser returns the user of a login waiting for its second factor.
+// The challenge is only used up once the login finishes, so a mistyped code
+// can be tried again until it expires.
+func challengeUser(ctx context.Context, token string) (model.UserToken, model.User, error) {
+	userToken, err := client.TokenClient.GetToken(ctx, TokenMfaChallenge, hashToken(token))
+
+	if errors.Is(err, client.ErrNotFound) {
+		return userToken, model.User{}, ErrMfaChallengeInvalid
+	}
+
+	if err != nil {
+		return userToken, model.User{}, err
+	}
+
+	if !time.Now().Before(userToken.ExpiresAt) {
+		return userToken, model.User{}, ErrMfaChallengeInvalid
+	}
+
+	user, err := client.UserClient.GetUserById(ctx, userToken.UserId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return userToken, user, ErrMfaChallengeInvalid
+	}
+
+	if err != nil {
+		return userToken, user, err
+	}
+
+	if user.Disabled {
+		return userToken, user, ErrAccountDisabled
+	}
+
+	return userToken, user, nil
+}
+
+func mfaUser(ctx context.Context, userId int) (model.User, error) {
+	user, err := client.UserClient.GetUserById(ctx, userId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return user, ErrUserNotFound
+	}
+
+	return user, err
+}
+
+func userMfa(ctx context.Context, userId int) (model.UserMfa, error) {
+	mfa, err := client.MfaClient.GetMfa(ctx, userId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return mfa, ErrMfaNotEnrolled
+	}
+
+	return mfa, err
+}
+
+// startEnrollment stores a new secret for the user in place of one they
+// didn't confirm
+func startEnrollment(ctx context.Context, user model.User) (dto.MfaEnrollmentDto, error) {
+	mfa, err := client.MfaClient.GetMfa(ctx, user.Id)
+
+	if err == nil && mfa.Enabled {
+		return dto.MfaEnrollmentDto{}, ErrMfaEnabled
+	}
+
+	if err != nil && !errors.Is(err, client.ErrNotFound) {
+		return dto.MfaEnrollmentDto{}, err
+	}
+
+	secret, err := totp.NewSecret()
+
+	if err != nil {
+		return dto.MfaEnrollmentDto{}, err
+	}
+
+	err = client.MfaClient.SaveMfa(ctx, model.UserMfa{UserId: user.Id, Secret: secret, CreatedAt: time.Now().UTC()})
+
+	if err != nil {
+		return dto.MfaEnrollmentDto{}, err
+	}
+
+	log.Ctx(ctx).WithField("user_id", user.Id).Info("Second factor enrollment started")
+
+	return dto.MfaEnrollmentDto{Secret: secret, ProvisioningUri: totp.Uri(MfaIssuer, user.Email, secret)}, nil
+}
+
+// enableMfa turns on the second factor being enrolled, the code of the step
+// confirmed it
+func enableMfa(ctx context.Context, user model.User, step int64) ([]string, error) {
+	codes, records, err := newRecoveryCodes(user.Id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.MfaClient.EnableMfa(ctx, user.Id, step, records)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return nil, ErrMfaEnabled
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Ctx(ctx).WithField("user_id", user.Id).Info("Second factor enabled")
+	AuditService.Record(ctx, AuditCreate, "user_mfa", user.Id, nil, dto.MfaStatusDto{Enabled: true, Required: mfaRequired(user.Role), RecoveryCodesLeft: len(codes)})
+
+	return codes, nil
+}
+
+// checkSecondFactor uses up a code from the app or a recovery code of the
+// user, returning the step of the code. The failures count towards the login
+// lockout of the account.
+func checkSecondFactor(ctx context.Context, user model.User, mfa model.UserMfa, code string, recoveryCode string) (int64, error) {
+	key := loginKey(ctx, user.Email)
+	end, err := beginLogin(ctx, key)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer end()
+
+	step, err := useSecondFactor(ctx, mfa, code, recoveryCode)
+
+	if errors.Is(err, ErrMfaCodeIncorrect) {
+		metrics.LoginFailures.WithLabelValues("mfa_code_incorrect").Inc()
+		log.Ctx(ctx).WithField("user_id", user.Id).Warn("Second factor failed")
+		loginFailed(ctx, key)
+	}
+
+	return step, err
+}
+
+func useSecondFactor(ctx context.Context, mfa model.UserMfa, code string, recoveryCode string) (int64, error) {
+	if recoveryCode != "" {
+		// Recovery codes only stand in for an app that was confirmed
+		if !mfa.Enabled {
+			return 0, ErrMfaCodeIncorrect
+		}
+
+		err := client.MfaClient.UseRecoveryCode(ctx, mfa.UserId, hashToken(normalizeRecoveryCode(recoveryCode)))
+
+		if errors.Is(err, client.ErrNotFound) {
+			return 0, ErrMfaCodeIncorrect
+		}
+
+		if err == nil {
+			log.Ctx(ctx).WithField("user_id", mfa.UserId).Info("Recovery code used")
+		}
+
+		return 0, err
+	}
+
+	step, ok := totp.Verify(mfa.Secret, code, time.Now(), 1)
+
+	if !ok {
+		return 0, ErrMfaCodeIncorrect
+	}
+
+	// The step of the code confirming an app is recorded as it is enabled
+	if !mfa.Enabled {
+		return step, nil
+	}
+
+	err := client.MfaClient.UseStep(ctx, mfa.UserId, step)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return 0, ErrMfaCodeIncorrect
+	}
+
+	return step, err
+}
+
+// splitCode tells a code from the app apart from a recovery code, where
+// either one is accepted
+func splitCode(code string) (string, string) {
+	if len(strings.ReplaceAll(code, " ", "")) == totp.Digits {
+		return code, ""
+	}
+
+	return "", code
+}
+
+// newRecoveryCodes returns random codes written as "xxxx-xxxx-xxxx-xxxx" to
+// show the user, and their hashes to store
+func newRecoveryCodes(userId int) ([]string, model.RecoveryCodes, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make(model.RecoveryCodes, 0, recoveryCodeCount)
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	now := time.Now().UTC()
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 10)
+
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(buf))
+		code = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+
+		codes = append(codes, code)
+		records = append(records, model.RecoveryCode{UserId: userId, Hash: hashToken(normalizeRecoveryCode(code)), CreatedAt: now})
+	}
+
+	return codes, records, nil
+}
+
+// normalizeRecoveryCode ignores the case and the separators a code is typed with
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
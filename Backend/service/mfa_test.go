@@ -0,0 +1,427 @@
+package service
+
+import (
+	"context"
+	"project/auth"
+	"project/client"
+	"project/dto"
+	"project/model"
+	"project/totp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMfa keeps the second factor and the recovery code hashes of each user
+type TestMfa struct {
+	mfas  map[int]model.UserMfa
+	codes map[int][]string
+}
+
+func init() {
+	client.MfaClient = &TestMfa{mfas: map[int]model.UserMfa{}, codes: map[int][]string{}}
+}
+
+func newTestMfa(t *testing.T) *TestMfa {
+	previous := client.MfaClient
+	mock := &TestMfa{mfas: map[int]model.UserMfa{}, codes: map[int][]string{}}
+
+	client.MfaClient = mock
+	t.Cleanup(func() { client.MfaClient = previous })
+
+	return mock
+}
+
+// enroll gives the user an enabled second factor, returning its secret
+func (t *TestMfa) enroll(userId int) string {
+	secret, _ := totp.NewSecret()
+	t.mfas[userId] = model.UserMfa{UserId: userId, Secret: secret, Enabled: true}
+
+	return secret
+}
+
+func (t *TestMfa) GetMfa(ctx context.Context, userId int) (model.UserMfa, error) {
+	mfa, ok := t.mfas[userId]
+
+	if !ok {
+		return mfa, client.ErrNotFound
+	}
+
+	return mfa, nil
+}
+
+func (t *TestMfa) SaveMfa(ctx context.Context, mfa model.UserMfa) error {
+	t.mfas[mfa.UserId] = mfa
+	return nil
+}
+
+func (t *TestMfa) EnableMfa(ctx context.Context, userId int, step int64, codes model.RecoveryCodes) error {
+	mfa, ok := t.mfas[userId]
+
+	if !ok || mfa.Enabled {
+		return client.ErrNotFound
+	}
+
+	mfa.Enabled = true
+	mfa.LastStep = step
+	t.mfas[userId] = mfa
+
+	return t.ReplaceRecoveryCodes(ctx, userId, codes)
+}
+
+func (t *TestMfa) UseStep(ctx context.Context, userId int, step int64) error {
+	mfa, ok := t.mfas[userId]
+
+	if !ok || !mfa.Enabled || mfa.LastStep >= step {
+		return client.ErrNotFound
+	}
+
+	mfa.LastStep = step
+	t.mfas[userId] = mfa
+
+	return nil
+}
+
+func (t *TestMfa) DeleteMfa(ctx context.Context, userId int) error {
+	if _, ok := t.mfas[userId]; !ok {
+		return client.ErrNotFound
+	}
+
+	delete(t.mfas, userId)
+	delete(t.codes, userId)
+
+	return nil
+}
+
+func (t *TestMfa) ReplaceRecoveryCodes(ctx context.Context, userId int, codes model.RecoveryCodes) error {
+	t.codes[userId] = nil
+
+	for _, code := range codes {
+		t.codes[userId] = append(t.codes[userId], code.Hash)
+	}
+
+	return nil
+}
+
+func (t *TestMfa) UseRecoveryCode(ctx context.Context, userId int, hash string) error {
+	for i, stored := range t.codes[userId] {
+		if stored == hash {
+			t.codes[userId] = append(t.codes[userId][:i], t.codes[userId][i+1:]...)
+			return nil
+		}
+	}
+
+	return client.ErrNotFound
+}
+
+func (t *TestMfa) CountRecoveryCodes(ctx context.Context, userId int) (int64, error) {
+	return int64(len(t.codes[userId])), nil
+}
+
+// currentCode is the code the app shows now, or the one of the next period
+func currentCode(secret string, next int64) string {
+	code, _ := totp.Code(secret, totp.Step(time.Now())+next)
+	return code
+}
+
+func TestUserLogin_Service_Mfa(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAccounts(t)
+	newTestToken(t)
+	newTestAudit(t)
+	mock := newTestMfa(t)
+	withLockout(t, LockoutPolicy{MaxFailures: 5, Window: time.Hour, Lockout: time.Hour})
+	secret := mock.enroll(7)
+	login := dto.UserDto{Email: "jane@email.com", Password: "password1"}
+
+	// The password alone only returns the challenge
+	result, err := UserService.UserLogin(context.Background(), login)
+	a.Nil(err)
+	a.Zero(result.User.Id)
+	a.NotNil(result.Challenge)
+	a.True(result.Challenge.MfaRequired)
+	a.False(result.Challenge.EnrollmentRequired)
+	a.Equal(300, result.Challenge.ExpiresIn)
+	token := result.Challenge.MfaToken
+
+	_, err = MfaService.CompleteMfaLogin(context.Background(), dto.MfaLoginDto{MfaToken: "wrong", Code: currentCode(secret, 0)})
+	a.ErrorIs(err, ErrMfaChallengeInvalid)
+
+	// A mistyped code can be tried again
+	_, err = MfaService.CompleteMfaLogin(context.Background(), dto.MfaLoginDto{MfaToken: token, Code: "000000"})
+	a.ErrorIs(err, ErrMfaCodeIncorrect)
+
+	code := currentCode(secret, 0)
+	result, err = MfaService.CompleteMfaLogin(context.Background(), dto.MfaLoginDto{MfaToken: token, Code: code})
+	a.Nil(err)
+	a.Equal(7, result.User.Id)
+	a.Nil(result.RecoveryCodes)
+
+	// The challenge finishes a single login
+	_, err = MfaService.CompleteMfaLogin(context.Background(), dto.MfaLoginDto{MfaToken: token, Code: currentCode(secret, 1)})
+	a.ErrorIs(err, ErrMfaChallengeInvalid)
+
+	// A code can't be used twice
+	result, err = UserService.UserLogin(context.Background(), login)
+	a.Nil(err)
+	_, err = MfaService.CompleteMfaLogin(context.Background(), dto.MfaLoginDto{MfaToken: result.Challenge.MfaToken, Code: code})
+	a.ErrorIs(err, ErrMfaCodeIncorrect)
+
+	// Users without a second factor log in with their password
+	result, err = UserService.UserLogin(context.Background(), dto.UserDto{Email: "john@email.com", Password: "password1"})
+	a.Nil(err)
+	a.Equal(1, result.User.Id)
+	a.Nil(result.Challenge)
+}
+
+func TestUserLogin_Service_MfaRecoveryCode(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAccounts(t)
+	newTestToken(t)
+	newTestAudit(t)
+	mock := newTestMfa(t)
+	withLockout(t, LockoutPolicy{MaxFailures: 5, Window: time.Hour, Lockout: time.Hour})
+	mock.enroll(7)
+
+	codes, records, err := newRecoveryCodes(7)
+	a.Nil(err)
+	a.Len(codes, recoveryCodeCount)
+	a.Regexp("^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$", codes[0])
+	a.Nil(mock.ReplaceRecoveryCodes(context.Background(), 7, records))
+
+	login := func(code string) error {
+		result, err := UserService.UserLogin(context.Background(), dto.UserDto{Email: "jane@email.com", Password: "password1"})
+		a.Nil(err)
+
+		_, err = MfaService.CompleteMfaLogin(context.Background(), dto.MfaLoginDto{MfaToken: result.Challenge.MfaToken, RecoveryCode: code})
+		return err
+	}
+
+	// Typed without the separators and in upper case
+	typed := strings.ToUpper(normalizeRecoveryCode(codes[0]))
+	a.Nil(login(typed[:8] + " " + typed[8:]))
+	a.ErrorIs(login(codes[0]), ErrMfaCodeIncorrect)
+	a.Nil(login(codes[1]))
+	a.Len(mock.codes[7], recoveryCodeCount-2)
+}
+
+func TestUserLogin_Service_MfaLockout(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAccounts(t)
+	newTestToken(t)
+	mock := newTestMfa(t)
+	secret := mock.enroll(7)
+	withLockout(t, LockoutPolicy{MaxFailures: 3, Window: time.Hour, Lockout: time.Hour})
+
+	result, err := UserService.UserLogin(context.Background(), dto.UserDto{Email: "jane@email.com", Password: "password1"})
+	a.Nil(err)
+
+	// The wrong codes count towards the lockout of the account
+	for i := 0; i < 3; i++ {
+		_, err = MfaService.CompleteMfaLogin(context.Background(), dto.MfaLoginDto{MfaToken: result.Challenge.MfaToken, Code: "000000"})
+		a.ErrorIs(err, ErrMfaCodeIncorrect)
+	}
+
+	_, err = MfaService.CompleteMfaLogin(context.Background(), dto.MfaLoginDto{MfaToken: result.Challenge.MfaToken, Code: currentCode(secret, 0)})
+	a.ErrorIs(err, ErrAccountLocked)
+}
+
+func TestUserLogin_Service_MfaChallengeExpired(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAccounts(t)
+	tokens := newTestToken(t)
+	mock := newTestMfa(t)
+	secret := mock.enroll(7)
+
+	result, err := UserService.UserLogin(context.Background(), dto.UserDto{Email: "jane@email.com", Password: "password1"})
+	a.Nil(err)
+
+	for hash, token := range tokens.tokens {
+		token.ExpiresAt = time.Now().Add(-time.Second)
+		tokens.tokens[hash] = token
+	}
+
+	_, err = MfaService.CompleteMfaLogin(context.Background(), dto.MfaLoginDto{MfaToken: result.Challenge.MfaToken, Code: currentCode(secret, 0)})
+	a.ErrorIs(err, ErrMfaChallengeInvalid)
+}
+
+func TestUserLogin_Service_MfaRequired(t *testing.T) {
+
+	a := assert.New(t)
+	accounts := newTestAccounts(t)
+	newTestToken(t)
+	audit := newTestAudit(t)
+	mock := newTestMfa(t)
+	withLockout(t, LockoutPolicy{MaxFailures: 5, Window: time.Hour, Lockout: time.Hour})
+
+	previous := MfaRequiredRoles
+	MfaRequiredRoles = []string{auth.RoleAdmin}
+	t.Cleanup(func() { MfaRequiredRoles = previous })
+
+	user := accounts.users[1]
+	user.Role = auth.RoleAdmin
+	accounts.users[1] = user
+
+	result, err := UserService.UserLogin(context.Background(), dto.UserDto{Email: "john@email.com", Password: "password1"})
+	a.Nil(err)
+	a.True(result.Challenge.EnrollmentRequired)
+	token := result.Challenge.MfaToken
+
+	// Nothing to check a code against before enrolling
+	_, err = MfaService.CompleteMfaLogin(context.Background(), dto.MfaLoginDto{MfaToken: token, Code: "000000"})
+	a.ErrorIs(err, ErrMfaNotEnrolled)
+
+	enrollment, err := MfaService.EnrollMfaAtLogin(context.Background(), dto.MfaTokenDto{MfaToken: token})
+	a.Nil(err)
+	a.Contains(enrollment.ProvisioningUri, "otpauth://totp/Miranda:john@email.com?")
+	a.Contains(enrollment.ProvisioningUri, "secret="+enrollment.Secret)
+
+	// Recovery codes don't stand in for an app being enrolled
+	_, err = MfaService.CompleteMfaLogin(context.Background(), dto.MfaLoginDto{MfaToken: token, RecoveryCode: "aaaa-bbbb-cccc-dddd"})
+	a.ErrorIs(err, ErrMfaCodeIncorrect)
+
+	result, err = MfaService.CompleteMfaLogin(context.Background(), dto.MfaLoginDto{MfaToken: token, Code: currentCode(enrollment.Secret, 0)})
+	a.Nil(err)
+	a.Equal(1, result.User.Id)
+	a.Len(result.RecoveryCodes, recoveryCodeCount)
+	a.True(mock.mfas[1].Enabled)
+	a.Len(mock.codes[1], recoveryCodeCount)
+	a.Len(audit.entries, 1)
+	a.Equal("user_mfa", audit.entries[0].Entity)
+
+	// The role can't do without it
+	err = MfaService.DisableMfa(context.Background(), 1, dto.MfaDisableDto{Password: "password1", Code: currentCode(enrollment.Secret, 1)})
+	a.ErrorIs(err, ErrMfaRequired)
+}
+
+func TestMfaEnrollment_Service(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAccounts(t)
+	audit := newTestAudit(t)
+	mock := newTestMfa(t)
+	withLockout(t, LockoutPolicy{MaxFailures: 5, Window: time.Hour, Lockout: time.Hour})
+	ctx := asUser(7, auth.RoleCustomer)
+
+	status, err := MfaService.GetMfaStatus(ctx, 7)
+	a.Nil(err)
+	a.Equal(dto.MfaStatusDto{}, status)
+
+	_, err = MfaService.GetMfaStatus(ctx, 1)
+	a.ErrorIs(err, ErrPermissionDenied)
+
+	_, err = MfaService.StartMfaEnrollment(ctx, 7, dto.MfaSetupDto{Password: "wrong"})
+	a.ErrorIs(err, ErrCurrentPasswordIncorrect)
+
+	_, err = MfaService.ConfirmMfaEnrollment(ctx, 7, dto.MfaCodeDto{Code: "000000"})
+	a.ErrorIs(err, ErrMfaNotEnrolled)
+
+	enrollment, err := MfaService.StartMfaEnrollment(ctx, 7, dto.MfaSetupDto{Password: "password1"})
+	a.Nil(err)
+	a.Equal(enrollment.Secret, mock.mfas[7].Secret)
+	a.False(mock.mfas[7].Enabled)
+
+	_, err = MfaService.ConfirmMfaEnrollment(ctx, 7, dto.MfaCodeDto{Code: "000000"})
+	a.ErrorIs(err, ErrMfaCodeIncorrect)
+
+	codes, err := MfaService.ConfirmMfaEnrollment(ctx, 7, dto.MfaCodeDto{Code: currentCode(enrollment.Secret, 0)})
+	a.Nil(err)
+	a.Len(codes.RecoveryCodes, recoveryCodeCount)
+	a.True(mock.mfas[7].Enabled)
+
+	_, err = MfaService.StartMfaEnrollment(ctx, 7, dto.MfaSetupDto{Password: "password1"})
+	a.ErrorIs(err, ErrMfaEnabled)
+
+	// A recovery code stands in for the app
+	regenerated, err := MfaService.RegenerateRecoveryCodes(ctx, 7, dto.MfaCodeDto{Code: codes.RecoveryCodes[0]})
+	a.Nil(err)
+	a.Len(regenerated.RecoveryCodes, recoveryCodeCount)
+
+	_, err = MfaService.RegenerateRecoveryCodes(ctx, 7, dto.MfaCodeDto{Code: codes.RecoveryCodes[1]})
+	a.ErrorIs(err, ErrMfaCodeIncorrect)
+
+	status, err = MfaService.GetMfaStatus(ctx, 7)
+	a.Nil(err)
+	a.Equal(dto.MfaStatusDto{Enabled: true, RecoveryCodesLeft: recoveryCodeCount}, status)
+
+	err = MfaService.DisableMfa(ctx, 7, dto.MfaDisableDto{Password: "wrong", Code: currentCode(enrollment.Secret, 1)})
+	a.ErrorIs(err, ErrCurrentPasswordIncorrect)
+
+	err = MfaService.DisableMfa(ctx, 7, dto.MfaDisableDto{Password: "password1", Code: currentCode(enrollment.Secret, 1)})
+	a.Nil(err)
+	a.Empty(mock.mfas)
+	a.Empty(mock.codes[7])
+	a.Len(audit.entries, 3)
+
+	err = MfaService.DisableMfa(ctx, 7, dto.MfaDisableDto{Password: "password1", Code: currentCode(enrollment.Secret, 1)})
+	a.ErrorIs(err, ErrMfaNotEnrolled)
+}
+
+func TestMfaEnrollment_Service_Passwordless(t *testing.T) {
+
+	a := assert.New(t)
+	accounts := newTestAccounts(t)
+	newTestAudit(t)
+	mock := newTestMfa(t)
+	newTestToken(t)
+	mailer := newTestMailer(t)
+	ctx := asUser(7, auth.RoleCustomer)
+
+	user := accounts.users[7]
+	user.Password = ""
+	accounts.users[7] = user
+
+	// No password matches an account without one
+	_, err := MfaService.StartMfaEnrollment(ctx, 7, dto.MfaSetupDto{Password: ""})
+	a.ErrorIs(err, ErrConfirmationRequired)
+
+	a.Nil(UserService.RequestConfirmation(ctx, 7))
+
+	enrollment, err := MfaService.StartMfaEnrollment(ctx, 7, dto.MfaSetupDto{ConfirmationCode: mailedCode(t, mailer.Messages()[0])})
+	a.Nil(err)
+	a.Equal(enrollment.Secret, mock.mfas[7].Secret)
+
+	_, err = MfaService.ConfirmMfaEnrollment(ctx, 7, dto.MfaCodeDto{Code: currentCode(enrollment.Secret, 0)})
+	a.Nil(err)
+
+	a.Nil(UserService.RequestConfirmation(ctx, 7))
+
+	err = MfaService.DisableMfa(ctx, 7, dto.MfaDisableDto{ConfirmationCode: mailedCode(t, mailer.Messages()[1]), Code: currentCode(enrollment.Secret, 1)})
+	a.Nil(err)
+	a.Empty(mock.mfas)
+}
+
+func TestResetMfa_Service(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAccounts(t)
+	audit := newTestAudit(t)
+	mock := newTestMfa(t)
+	mock.enroll(7)
+	mock.enroll(4)
+
+	err := MfaService.ResetMfa(asUser(1, auth.RoleCustomer), 7)
+	a.ErrorIs(err, ErrPermissionDenied)
+
+	// Admins don't reset their own, it would skip the second factor
+	err = MfaService.ResetMfa(adminCtx, 4)
+	a.ErrorIs(err, ErrOwnAccount)
+
+	err = MfaService.ResetMfa(adminCtx, 12)
+	a.ErrorIs(err, ErrUserNotFound)
+
+	err = MfaService.ResetMfa(adminCtx, 7)
+	a.Nil(err)
+	a.NotContains(mock.mfas, 7)
+	a.Len(audit.entries, 1)
+	a.Equal(7, audit.entries[0].EntityId)
+
+	err = MfaService.ResetMfa(adminCtx, 7)
+	a.ErrorIs(err, ErrMfaNotEnrolled)
+}
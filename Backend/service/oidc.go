@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"project/auth"
+	"project/client"
+	"project/dto"
+	"project/metrics"
+	"project/model"
+	"project/oidc"
+	"project/tracing"
+	"time"
+)
+
+type oidcService struct{}
+
+type oidcServiceInterface interface {
+	GetProviders(ctx context.Context) dto.OidcProvidersDto
+	StartLogin(ctx context.Context, provider string) (dto.OidcAuthorizationDto, error)
+	CompleteLogin(ctx context.Context, provider string, callbackDto dto.OidcCallbackDto) (dto.LoginResultDto, error)
+}
+
+var OidcService oidcServiceInterface
+
+// OidcProviders are the OpenID Connect providers users can log in with and
+// OidcStateTtl how long they can take to come back from one. They are set from
+// the configuration.
+var (
+	OidcProviders []*oidc.Provider
+	OidcStateTtl  = 10 * time.Minute
+)
+
+func init() {
+	OidcService = &oidcService{}
+}
+
+// GetProviders lists the providers in the order they are configured
+func (s *oidcService) GetProviders(ctx context.Context) dto.OidcProvidersDto {
+	providersDto := dto.OidcProvidersDto{}
+
+	for _, provider := range OidcProviders {
+		providersDto = append(providersDto, dto.OidcProviderDto{Name: provider.Name, DisplayName: provider.DisplayName})
+	}
+
+	return providersDto
+}
+
+// StartLogin returns where to send the browser to log in at the provider. The
+// state, nonce and PKCE verifier are kept until it comes back with the code.
+func (s *oidcService) StartLogin(ctx context.Context, name string) (dto.OidcAuthorizationDto, error) {
+	ctx, span := tracing.Start(ctx, "OidcService.StartLogin")
+	defer span.End()
+
+	provider := oidcProvider(name)
+
+	if provider == nil {
+		return dto.OidcAuthorizationDto{}, ErrOidcProviderNotFound
+	}
+
+	state, stateHash, err := newToken()
+
+	if err != nil {
+		return dto.OidcAuthorizationDto{}, err
+	}
+
+	nonce, _, err := newToken()
+
+	if err != nil {
+		return dto.OidcAuthorizationDto{}, err
+	}
+
+	verifier, err := oidc.NewVerifier()
+
+	if err != nil {
+		return dto.OidcAuthorizationDto{}, err
+	}
+
+	authorizationUrl, err := provider.AuthCodeUrl(ctx, state, nonce, oidc.Challenge(verifier))
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).WithField("provider", name).Error("Failed to discover the provider")
+		return dto.OidcAuthorizationDto{}, ErrOidcProviderUnavailable
+	}
+
+	now := time.Now()
+
+	err = client.IdentityClient.InsertOidcLogin(ctx, model.OidcLogin{
+		Provider:  name,
+		StateHash: stateHash,
+		Nonce:     nonce,
+		Verifier:  verifier,
+		CreatedAt: now,
+		ExpiresAt: now.Add(OidcStateTtl),
+	})
+
+	if err != nil {
+		return dto.OidcAuthorizationDto{}, err
+	}
+
+	return dto.OidcAuthorizationDto{AuthorizationUrl: authorizationUrl}, nil
+}
+
+// CompleteLogin exchanges the code the provider redirected back with and logs
+// in the user the identity is linked to. An identity seen for the first time
+// is linked to the user with its email, or a new user, as long as the provider
+// verified the email.
+func (s *oidcService) CompleteLogin(ctx context.Context, name string, callbackDto dto.OidcCallbackDto) (dto.LoginResultDto, error) {
+	ctx, span := tracing.Start(ctx, "OidcService.CompleteLogin")
+	defer span.End()
+
+	provider := oidcProvider(name)
+
+	if provider == nil {
+		return dto.LoginResultDto{}, ErrOidcProviderNotFound
+	}
+
+	// The state is used once, whatever happens next
+	login, err := client.IdentityClient.TakeOidcLogin(ctx, name, hashToken(callbackDto.State))
+
+	if errors.Is(err, client.ErrNotFound) || (err == nil && !login.ExpiresAt.After(time.Now())) {
+		metrics.LoginFailures.WithLabelValues("oidc_state_invalid").Inc()
+		log.Ctx(ctx).WithField("provider", name).Warn("Login failed, unknown or expired state")
+		return dto.LoginResultDto{}, ErrOidcStateInvalid
+	}
+
+	if err != nil {
+		return dto.LoginResultDto{}, err
+	}
+
+	idToken, err := provider.Exchange(ctx, callbackDto.Code, login.Verifier)
+
+	if err == nil {
+		var claims oidc.Claims
+
+		claims, err = provider.Verify(ctx, idToken, login.Nonce)
+
+		if err == nil {
+			return completeOidcLogin(ctx, name, claims)
+		}
+	}
+
+	metrics.LoginFailures.WithLabelValues("oidc_failed").Inc()
+	log.Ctx(ctx).WithError(err).WithField("provider", name).Warn("Login failed, the provider didn't confirm it")
+
+	return dto.LoginResultDto{}, ErrOidcLoginFailed
+}
+
+func completeOidcLogin(ctx context.Context, provider string, claims oidc.Claims) (dto.LoginResultDto, error) {
+	user, err := oidcUser(ctx, provider, claims)
+
+	if err != nil {
+		return dto.LoginResultDto{}, err
+	}
+
+	if user.Disabled {
+		metrics.LoginFailures.WithLabelValues("account_disabled").Inc()
+		log.Ctx(ctx).WithField("user_id", user.Id).Warn("Login failed, account disabled")
+		return dto.LoginResultDto{}, ErrAccountDisabled
+	}
+
+	// The provider stands in for the password, not for the second factor
+	challenge, err := mfaChallenge(ctx, user)
+
+	if err != nil {
+		return dto.LoginResultDto{}, err
+	}
+
+	if challenge != nil {
+		log.Ctx(ctx).WithFields(logrus.Fields{"user_id": user.Id, "provider": provider}).Info("Login waiting for the second factor")
+		return dto.LoginResultDto{Challenge: challenge}, nil
+	}
+
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": user.Id, "provider": provider}).Info("User logged in with provider")
+
+	return dto.LoginResultDto{User: loginUser(user)}, nil
+}
+
+// oidcUser returns the user the identity is linked to, linking it first if
+// needed. A user whose email isn't verified isn't linked, or whoever
+// registered the address before its owner would share the account.
+func oidcUser(ctx context.Context, provider string, claims oidc.Claims) (model.User, error) {
+	identity, err := client.IdentityClient.GetIdentity(ctx, provider, claims.Subject)
+
+	if err == nil {
+		user, err := client.UserClient.GetUserById(ctx, identity.UserId)
+
+		if errors.Is(err, client.ErrNotFound) {
+			return user, ErrUserNotFound
+		}
+
+		return user, err
+	}
+
+	if !errors.Is(err, client.ErrNotFound) {
+		return model.User{}, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		metrics.LoginFailures.WithLabelValues("oidc_email_not_verified").Inc()
+		log.Ctx(ctx).WithField("provider", provider).Warn("Login failed, the provider didn't verify the email")
+		return model.User{}, ErrOidcEmailNotVerified
+	}
+
+	identity = model.ExternalIdentity{Provider: provider, Subject: claims.Subject, Email: claims.Email, CreatedAt: time.Now()}
+
+	user, err := client.UserClient.GetUserByEmail(ctx, claims.Email)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return insertOidcUser(ctx, claims, identity)
+	}
+
+	if err != nil {
+		return user, err
+	}
+
+	if !user.EmailVerified {
+		log.Ctx(ctx).WithFields(logrus.Fields{"user_id": user.Id, "provider": provider}).Warn("Identity not linked, the email of the user isn't verified")
+		return user, ErrOidcAccountUnverified
+	}
+
+	identity.UserId = user.Id
+	identity, err = client.IdentityClient.InsertIdentity(ctx, identity)
+
+	if err != nil {
+		return user, err
+	}
+
+	AuditService.Record(ctx, AuditCreate, "external_identity", identity.Id, nil, map[string]any{"user_id": user.Id, "provider": provider})
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": user.Id, "provider": provider}).Info("Identity linked")
+
+	return user, nil
+}
+
+// insertOidcUser creates a customer for the identity, the provider verified
+// the email and there is no password to log in with
+func insertOidcUser(ctx context.Context, claims oidc.Claims, identity model.ExternalIdentity) (model.User, error) {
+	user := model.User{
+		Name:          claims.GivenName,
+		LastName:      claims.FamilyName,
+		Email:         claims.Email,
+		Role:          auth.RoleCustomer,
+		EmailVerified: true,
+	}
+
+	if user.Name == "" {
+		user.Name = claims.Name
+	}
+
+	user, err := client.IdentityClient.InsertUserWithIdentity(ctx, user, identity)
+
+	if errors.Is(err, client.ErrConflict) {
+		return user, ErrEmailRegistered
+	}
+
+	if err != nil {
+		return user, err
+	}
+
+	AuditService.Record(ctx, AuditCreate, "user", user.Id, nil, auditUser(user))
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": user.Id, "provider": identity.Provider}).Info("User created from identity")
+
+	return user, nil
+}
+
+func oidcProvider(name string) *oidc.Provider {
+	for _, provider := range OidcProviders {
+		if provider.Name == name {
+			return provider
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"project/auth"
+	"project/client"
+	"project/dto"
+	"project/model"
+	"project/oidc"
+	"project/oidc/oidctest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestIdentity keeps the linked identities and the logins sent to providers,
+// the users it creates go to accounts
+type TestIdentity struct {
+	accounts   *TestAccounts
+	identities []model.ExternalIdentity
+	logins     map[string]model.OidcLogin
+}
+
+func init() {
+	client.IdentityClient = &TestIdentity{logins: map[string]model.OidcLogin{}}
+}
+
+func newTestIdentity(t *testing.T, accounts *TestAccounts) *TestIdentity {
+	previous := client.IdentityClient
+	mock := &TestIdentity{accounts: accounts, logins: map[string]model.OidcLogin{}}
+
+	client.IdentityClient = mock
+	t.Cleanup(func() { client.IdentityClient = previous })
+
+	return mock
+}
+
+func (t *TestIdentity) GetIdentity(ctx context.Context, provider string, subject string) (model.ExternalIdentity, error) {
+	for _, identity := range t.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+
+	return model.ExternalIdentity{}, client.ErrNotFound
+}
+
+func (t *TestIdentity) InsertIdentity(ctx context.Context, identity model.ExternalIdentity) (model.ExternalIdentity, error) {
+	if _, err := t.GetIdentity(ctx, identity.Provider, identity.Subject); err == nil {
+		return identity, client.ErrConflict
+	}
+
+	identity.Id = len(t.identities) + 1
+	t.identities = append(t.identities, identity)
+
+	return identity, nil
+}
+
+func (t *TestIdentity) InsertUserWithIdentity(ctx context.Context, user model.User, identity model.ExternalIdentity) (model.User, error) {
+	if _, err := t.accounts.GetUserByEmail(ctx, user.Email); err == nil {
+		return user, client.ErrConflict
+	}
+
+	user.Id = 100 + len(t.accounts.users)
+	t.accounts.users[user.Id] = user
+
+	identity.UserId = user.Id
+	_, err := t.InsertIdentity(ctx, identity)
+
+	return user, err
+}
+
+func (t *TestIdentity) InsertOidcLogin(ctx context.Context, login model.OidcLogin) error {
+	t.logins[login.StateHash] = login
+	return nil
+}
+
+func (t *TestIdentity) TakeOidcLogin(ctx context.Context, provider string, stateHash string) (model.OidcLogin, error) {
+	login, ok := t.logins[stateHash]
+
+	if !ok || login.Provider != provider {
+		return model.OidcLogin{}, client.ErrNotFound
+	}
+
+	delete(t.logins, stateHash)
+
+	return login, nil
+}
+
+func (t *TestIdentity) DeleteExpiredOidcLogins(ctx context.Context, now time.Time) (int64, error) {
+	var count int64
+
+	for hash, login := range t.logins {
+		if !login.ExpiresAt.After(now) {
+			delete(t.logins, hash)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// newTestOidc logs in with the provider "test" at a local issuer, against
+// the users of newTestAccounts
+func newTestOidc(t *testing.T) (*oidctest.Issuer, *TestAccounts, *TestIdentity) {
+	issuer := oidctest.NewIssuer(t)
+	accounts := newTestAccounts(t)
+	identities := newTestIdentity(t, accounts)
+	newTestMfa(t)
+	newTestToken(t)
+	newTestAudit(t)
+
+	previous := OidcProviders
+	OidcProviders = []*oidc.Provider{issuer.Provider("test", "https://app.example.com/login/oidc/test")}
+	t.Cleanup(func() { OidcProviders = previous })
+
+	return issuer, accounts, identities
+}
+
+// oidcLogin goes through the whole flow as the user at the issuer
+func oidcLogin(t *testing.T, issuer *oidctest.Issuer, user oidc.Claims) (dto.LoginResultDto, error) {
+	issuer.SetUser(user)
+
+	authorization, err := OidcService.StartLogin(context.Background(), "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := issuer.Login(t, authorization.AuthorizationUrl)
+
+	return OidcService.CompleteLogin(context.Background(), "test", dto.OidcCallbackDto{Code: code, State: state})
+}
+
+func TestOidcLogin_Service_NewUser(t *testing.T) {
+
+	a := assert.New(t)
+	issuer, accounts, identities := newTestOidc(t)
+	ann := oidc.Claims{Subject: "ann-1", Email: "ann@email.com", EmailVerified: true, Name: "Ann Smith", GivenName: "Ann", FamilyName: "Smith"}
+
+	result, err := oidcLogin(t, issuer, ann)
+	a.Nil(err)
+	a.Nil(result.Challenge)
+	a.Equal("ann@email.com", result.User.Email)
+	a.Equal("Ann", result.User.Name)
+	a.Equal("Smith", result.User.LastName)
+	a.Equal(auth.RoleCustomer, result.User.Role)
+	a.True(result.User.EmailVerified)
+
+	user := accounts.users[result.User.Id]
+	a.Empty(user.Password)
+	a.Equal([]model.ExternalIdentity{{Id: 1, UserId: user.Id, Provider: "test", Subject: "ann-1", Email: "ann@email.com", CreatedAt: identities.identities[0].CreatedAt}}, identities.identities)
+
+	// The identity finds the user again, even once the email changed
+	ann.Email = "ann.smith@email.com"
+
+	result, err = oidcLogin(t, issuer, ann)
+	a.Nil(err)
+	a.Equal(user.Id, result.User.Id)
+	a.Len(identities.identities, 1)
+	a.Len(accounts.users, 3)
+}
+
+func TestOidcLogin_Service_Link(t *testing.T) {
+
+	a := assert.New(t)
+	issuer, accounts, identities := newTestOidc(t)
+
+	// Jane verified her email, so the identity is linked to her account
+	result, err := oidcLogin(t, issuer, oidc.Claims{Subject: "jane-1", Email: "jane@email.com", EmailVerified: true})
+	a.Nil(err)
+	a.Equal(7, result.User.Id)
+	a.Equal("Jane", result.User.Name)
+	a.Len(accounts.users, 2)
+	a.Len(identities.identities, 1)
+	a.Equal(7, identities.identities[0].UserId)
+
+	// John didn't, whoever registered his address could be someone else
+	_, err = oidcLogin(t, issuer, oidc.Claims{Subject: "john-1", Email: "john@email.com", EmailVerified: true})
+	a.ErrorIs(err, ErrOidcAccountUnverified)
+	a.Len(identities.identities, 1)
+
+	// Nor is an email the provider didn't verify trusted
+	_, err = oidcLogin(t, issuer, oidc.Claims{Subject: "jane-2", Email: "jane@email.com"})
+	a.ErrorIs(err, ErrOidcEmailNotVerified)
+
+	_, err = oidcLogin(t, issuer, oidc.Claims{Subject: "nobody", EmailVerified: true})
+	a.ErrorIs(err, ErrOidcEmailNotVerified)
+	a.Len(identities.identities, 1)
+	a.Len(accounts.users, 2)
+}
+
+func TestOidcLogin_Service_Errors(t *testing.T) {
+
+	a := assert.New(t)
+	issuer, accounts, _ := newTestOidc(t)
+	jane := oidc.Claims{Subject: "jane-1", Email: "jane@email.com", EmailVerified: true}
+	ctx := context.Background()
+
+	_, err := OidcService.StartLogin(ctx, "other")
+	a.ErrorIs(err, ErrOidcProviderNotFound)
+
+	_, err = OidcService.CompleteLogin(ctx, "other", dto.OidcCallbackDto{Code: "code", State: "state"})
+	a.ErrorIs(err, ErrOidcProviderNotFound)
+
+	issuer.SetUser(jane)
+	authorization, err := OidcService.StartLogin(ctx, "test")
+	a.Nil(err)
+	code, state := issuer.Login(t, authorization.AuthorizationUrl)
+
+	_, err = OidcService.CompleteLogin(ctx, "test", dto.OidcCallbackDto{Code: code, State: "forged"})
+	a.ErrorIs(err, ErrOidcStateInvalid)
+
+	// A code the issuer didn't give uses the state up
+	_, err = OidcService.CompleteLogin(ctx, "test", dto.OidcCallbackDto{Code: "forged", State: state})
+	a.ErrorIs(err, ErrOidcLoginFailed)
+
+	_, err = OidcService.CompleteLogin(ctx, "test", dto.OidcCallbackDto{Code: code, State: state})
+	a.ErrorIs(err, ErrOidcStateInvalid)
+
+	// The state expires
+	OidcStateTtl = -time.Minute
+	t.Cleanup(func() { OidcStateTtl = 10 * time.Minute })
+
+	_, err = oidcLogin(t, issuer, jane)
+	a.ErrorIs(err, ErrOidcStateInvalid)
+
+	OidcStateTtl = 10 * time.Minute
+
+	user := accounts.users[7]
+	user.Disabled = true
+	accounts.users[7] = user
+
+	_, err = oidcLogin(t, issuer, jane)
+	a.ErrorIs(err, ErrAccountDisabled)
+
+	// The issuer can't be reached
+	OidcProviders = []*oidc.Provider{{Name: "test", Issuer: "http://127.0.0.1:1", Client: issuer.Client()}}
+
+	_, err = OidcService.StartLogin(ctx, "test")
+	a.ErrorIs(err, ErrOidcProviderUnavailable)
+}
+
+func TestOidcLogin_Service_Mfa(t *testing.T) {
+
+	a := assert.New(t)
+	issuer, _, _ := newTestOidc(t)
+	mock := newTestMfa(t)
+	mock.enroll(7)
+
+	// The provider stands in for the password only
+	result, err := oidcLogin(t, issuer, oidc.Claims{Subject: "jane-1", Email: "jane@email.com", EmailVerified: true})
+	a.Nil(err)
+	a.Zero(result.User.Id)
+	a.NotNil(result.Challenge)
+	a.False(result.Challenge.EnrollmentRequired)
+
+	previous := MfaRequiredRoles
+	MfaRequiredRoles = []string{auth.RoleCustomer}
+	t.Cleanup(func() { MfaRequiredRoles = previous })
+
+	result, err = oidcLogin(t, issuer, oidc.Claims{Subject: "ann-1", Email: "ann@email.com", EmailVerified: true, GivenName: "Ann"})
+	a.Nil(err)
+	a.NotNil(result.Challenge)
+	a.True(result.Challenge.EnrollmentRequired)
+}
+
+func TestGetProviders_Service(t *testing.T) {
+
+	a := assert.New(t)
+	newTestOidc(t)
+
+	a.Equal(dto.OidcProvidersDto{{Name: "test", DisplayName: "Test"}}, OidcService.GetProviders(context.Background()))
+
+	OidcProviders = nil
+	a.Equal(dto.OidcProvidersDto{}, OidcService.GetProviders(context.Background()))
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"project/client"
+	"project/tracing"
+	"strings"
+	"time"
+)
+
+type purgeService struct{}
+
+type purgeServiceInterface interface {
+	PurgeDeleted(ctx context.Context) (int64, error)
+	PurgeExpiredTokens(ctx context.Context) (int64, error)
+	PurgeImageFiles(ctx context.Context, dir string, minAge time.Duration) (int64, error)
+}
+
+var PurgeService purgeServiceInterface
+
+// DeletedRetention is how long deleted hotels, users and reservations can be
+// restored before PurgeDeleted removes them for good
+var DeletedRetention = 30 * 24 * time.Hour
+
+func init() {
+	PurgeService = &purgeService{}
+}
+
+// PurgeDeleted removes the records deleted longer than DeletedRetention ago.
+// Reservations go first, so the hotels and users they referenced can follow.
+func (s *purgeService) PurgeDeleted(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "PurgeService.PurgeDeleted")
+	defer span.End()
+
+	before := time.Now().Add(-DeletedRetention)
+
+	reservations, err := client.ReservationClient.PurgeReservations(ctx, before)
+
+	if err != nil {
+		return 0, err
+	}
+
+	hotels, err := client.HotelClient.PurgeHotels(ctx, before)
+
+	if err != nil {
+		return reservations, err
+	}
+
+	users, err := client.UserClient.PurgeUsers(ctx, before)
+
+	if err != nil {
+		return reservations + hotels, err
+	}
+
+	if total := reservations + hotels + users; total > 0 {
+		log.Ctx(ctx).WithFields(logrus.Fields{"reservations": reservations, "hotels": hotels, "users": users}).Info("Deleted records purged")
+
+		AuditService.Record(ctx, AuditPurge, "deleted_records", 0, nil, map[string]int64{"reservations": reservations, "hotels": hotels, "users": users})
+	}
+
+	return reservations + hotels + users, nil
+}
+
+// PurgeExpiredTokens removes the tokens mailed to users and the logins sent to
+// OpenID Connect providers that can't be used anymore
+func (s *purgeService) PurgeExpiredTokens(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "PurgeService.PurgeExpiredTokens")
+	defer span.End()
+
+	now := time.Now()
+
+	tokens, err := client.TokenClient.DeleteExpiredTokens(ctx, now)
+
+	if err != nil {
+		return 0, err
+	}
+
+	logins, err := client.IdentityClient.DeleteExpiredOidcLogins(ctx, now)
+
+	if err != nil {
+		return tokens, err
+	}
+
+	return tokens + logins, nil
+}
+
+// PurgeImageFiles removes the files in dir no image refers to anymore, those
+// of purged hotels and of uploads that failed. Files changed in the last
+// minAge are kept, their upload may not have inserted the image yet.
+func (s *purgeService) PurgeImageFiles(ctx context.Context, dir string, minAge time.Duration) (int64, error) {
+	ctx, span := tracing.Start(ctx, "PurgeService.PurgeImageFiles")
+	defer span.End()
+
+	images, err := client.ImageClient.GetImages(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	used := make(map[string]bool, len(images))
+
+	for _, image := range images {
+		used[filepath.Base(image.Path)] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	cutoff := time.Now().Add(-minAge)
+
+	for _, entry := range entries {
+		// Hidden files aren't images, see the readiness check
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || used[entry.Name()] {
+			continue
+		}
+
+		info, err := entry.Info()
+
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			log.Ctx(ctx).WithError(err).WithField("file", entry.Name()).Warn("Failed to remove unused image file")
+			continue
+		}
+
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"project/model"
+	"testing"
+	"time"
+)
+
+func TestPurgeDeleted_Service(t *testing.T) {
+
+	a := assert.New(t)
+
+	// The client mocks purge 3 reservations, 1 hotel and 2 users
+	count, err := PurgeService.PurgeDeleted(context.Background())
+
+	a.Nil(err)
+	a.Equal(int64(6), count)
+}
+
+func TestPurgeExpiredTokens_Service(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestToken(t)
+	identities := newTestIdentity(t, nil)
+
+	_, _ = issueToken(context.Background(), 1, TokenPasswordReset, "john@email.com", -time.Minute)
+	_, _ = issueToken(context.Background(), 1, TokenEmailVerification, "john@email.com", time.Hour)
+	_ = identities.InsertOidcLogin(context.Background(), model.OidcLogin{Provider: "google", StateHash: "expired", ExpiresAt: time.Now().Add(-time.Minute)})
+	_ = identities.InsertOidcLogin(context.Background(), model.OidcLogin{Provider: "google", StateHash: "pending", ExpiresAt: time.Now().Add(time.Minute)})
+
+	count, err := PurgeService.PurgeExpiredTokens(context.Background())
+
+	a.Nil(err)
+	a.Equal(int64(2), count)
+	a.Len(mock.tokens, 1)
+	a.Len(identities.logins, 1)
+}
+
+func TestPurgeImageFiles_Service(t *testing.T) {
+
+	a := assert.New(t)
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+
+	// The client mock has an image at used.jpg
+	for _, name := range []string{"used.jpg", "unused.jpg", "uploading.jpg", ".readyz-1"} {
+		a.Nil(os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+
+		if name != "uploading.jpg" {
+			a.Nil(os.Chtimes(filepath.Join(dir, name), old, old))
+		}
+	}
+
+	count, err := PurgeService.PurgeImageFiles(context.Background(), dir, time.Hour)
+
+	a.Nil(err)
+	a.Equal(int64(1), count)
+
+	entries, _ := os.ReadDir(dir)
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	a.Equal([]string{".readyz-1", "uploading.jpg", "used.jpg"}, names)
+}
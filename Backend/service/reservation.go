@@ -1,24 +1,31 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"github.com/sirupsen/logrus"
 	"math"
+	"project/auth"
 	"project/client"
 	"project/dto"
+	"project/metrics"
 	"project/model"
+	"project/tracing"
 	"time"
 )
 
 type reservationService struct{}
 
 type reservationServiceInterface interface {
-	InsertReservation(reservationDto dto.ReservationDto) (dto.ReservationDto, error)
-	GetReservationById(id int) (dto.ReservationDto, error)
-	GetReservations() (dto.ReservationsDto, error)
-	GetReservationsByUser(userId int) (dto.UserReservationsDto, error)
-	GetReservationsByUserRange(userId int, startDate string, endDate string) (dto.ReservationsDto, error)
-	GetReservationsByHotel(hotelId int) (dto.HotelReservationsDto, error)
-	DeleteReservation(id int) error
+	InsertReservation(ctx context.Context, reservationDto dto.ReservationDto) (dto.ReservationDto, error)
+	GetReservationById(ctx context.Context, id int) (dto.ReservationDto, error)
+	GetReservations(ctx context.Context) (dto.ReservationsDto, error)
+	GetReservationsByUser(ctx context.Context, userId int) (dto.UserReservationsDto, error)
+	GetReservationsByUserRange(ctx context.Context, userId int, startDate string, endDate string) (dto.ReservationsDto, error)
+	GetReservationsByHotel(ctx context.Context, hotelId int) (dto.HotelReservationsDto, error)
+	DeleteReservation(ctx context.Context, id int) error
+	GetDeletedReservations(ctx context.Context) (dto.DeletedReservationsDto, error)
+	RestoreReservation(ctx context.Context, id int) error
 }
 
 var ReservationService reservationServiceInterface
@@ -27,27 +34,49 @@ func init() {
 	ReservationService = &reservationService{}
 }
 
-func (s *reservationService) InsertReservation(reservationDto dto.ReservationDto) (dto.ReservationDto, error) {
+func (s *reservationService) InsertReservation(ctx context.Context, reservationDto dto.ReservationDto) (dto.ReservationDto, error) {
+	ctx, span := tracing.Start(ctx, "ReservationService.InsertReservation")
+	defer span.End()
 
-	userDto := client.UserClient.GetUserById(reservationDto.UserId)
-	hotelDto := client.HotelClient.GetHotelById(reservationDto.HotelId)
+	if err := authorizeReservation(ctx, model.Reservation{UserId: reservationDto.UserId, HotelId: reservationDto.HotelId}, auth.ManageReservations); err != nil {
+		return reservationDto, err
+	}
+
+	_, err := client.UserClient.GetUserById(ctx, reservationDto.UserId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return reservationDto, ErrUnknownUser
+	}
 
-	if userDto.Id == 0 {
-		return reservationDto, errors.New("user not found")
+	if err != nil {
+		return reservationDto, err
 	}
 
-	if hotelDto.Id == 0 {
-		return reservationDto, errors.New("hotel not found")
+	hotelDto, err := client.HotelClient.GetHotelById(ctx, reservationDto.HotelId)
+
+	// Drafts aren't open for booking yet
+	if errors.Is(err, client.ErrNotFound) || err == nil && hotelDto.Draft {
+		return reservationDto, ErrUnknownHotel
+	}
+
+	if err != nil {
+		return reservationDto, err
 	}
 
 	timeStart, _ := time.Parse("02-01-2006 15:04", reservationDto.StartDate)
 	timeEnd, _ := time.Parse("02-01-2006 15:04", reservationDto.EndDate)
 
 	if timeStart.After(timeEnd) {
-		return reservationDto, errors.New("a reservation cant end before it starts")
+		return reservationDto, ErrInvalidDateRange
+	}
+
+	available, err := HotelService.CheckAvailability(ctx, reservationDto.HotelId, timeStart, timeEnd)
+
+	if err != nil {
+		return reservationDto, err
 	}
 
-	if HotelService.CheckAvailability(reservationDto.HotelId, timeStart, timeEnd) {
+	if available {
 		var reservation model.Reservation
 
 		reservation.StartDate = reservationDto.StartDate
@@ -61,25 +90,46 @@ func (s *reservationService) InsertReservation(reservationDto dto.ReservationDto
 
 		reservation.Amount = rate * nightsAmount
 
-		reservation = client.ReservationClient.InsertReservation(reservation)
+		reservation, err = client.ReservationClient.InsertReservation(ctx, reservation)
+
+		if err != nil {
+			return reservationDto, err
+		}
 
 		reservationDto.Id = reservation.Id
 		reservationDto.Amount = reservation.Amount
 
+		metrics.ReservationsCreated.Inc()
+		log.Ctx(ctx).WithFields(logrus.Fields{"reservation_id": reservation.Id, "hotel_id": reservation.HotelId}).Info("Reservation created")
+		AuditService.Record(ctx, AuditCreate, "reservation", reservation.Id, nil, auditReservation(reservation))
+
 		return reservationDto, nil
 	}
 
-	return reservationDto, errors.New("there are no rooms available")
+	metrics.SoldOutRejections.Inc()
+	log.Ctx(ctx).WithField("hotel_id", reservationDto.HotelId).Info("Reservation rejected, no rooms available")
+
+	return reservationDto, ErrNoRoomsAvailable
 }
 
-func (s *reservationService) GetReservationById(id int) (dto.ReservationDto, error) {
-	var reservation model.Reservation
+func (s *reservationService) GetReservationById(ctx context.Context, id int) (dto.ReservationDto, error) {
+	ctx, span := tracing.Start(ctx, "ReservationService.GetReservationById")
+	defer span.End()
+
 	var reservationDto dto.ReservationDto
 
-	reservation = client.ReservationClient.GetReservationById(id)
+	reservation, err := client.ReservationClient.GetReservationById(ctx, id)
 
-	if reservation.Id == 0 {
-		return reservationDto, errors.New("reservation not found")
+	if errors.Is(err, client.ErrNotFound) {
+		return reservationDto, ErrReservationNotFound
+	}
+
+	if err != nil {
+		return reservationDto, err
+	}
+
+	if err := authorizeReservation(ctx, reservation, auth.ViewReservations); err != nil {
+		return reservationDto, err
 	}
 
 	reservationDto.Id = reservation.Id
@@ -92,11 +142,36 @@ func (s *reservationService) GetReservationById(id int) (dto.ReservationDto, err
 	return reservationDto, nil
 }
 
-func (s *reservationService) GetReservations() (dto.ReservationsDto, error) {
+func (s *reservationService) GetReservations(ctx context.Context) (dto.ReservationsDto, error) {
+	ctx, span := tracing.Start(ctx, "ReservationService.GetReservations")
+	defer span.End()
 
-	var reservations model.Reservations = client.ReservationClient.GetReservations()
 	var reservationsDto dto.ReservationsDto
 
+	identity, err := authorize(ctx, auth.ViewReservations)
+
+	if err != nil {
+		return reservationsDto, err
+	}
+
+	var reservations model.Reservations
+
+	// Managers only see the reservations of the hotels assigned to them
+	if identity.HotelScoped() {
+		var hotelIds []int
+		hotelIds, err = client.AssignmentClient.GetAssignedHotelIds(ctx, identity.UserId)
+
+		if err == nil {
+			reservations, err = client.ReservationClient.GetReservationsByHotels(ctx, hotelIds)
+		}
+	} else {
+		reservations, err = client.ReservationClient.GetReservations(ctx)
+	}
+
+	if err != nil {
+		return reservationsDto, err
+	}
+
 	for _, reservation := range reservations {
 		var reservationDto dto.ReservationDto
 
@@ -113,15 +188,38 @@ func (s *reservationService) GetReservations() (dto.ReservationsDto, error) {
 	return reservationsDto, nil
 }
 
-func (s *reservationService) GetReservationsByUser(userId int) (dto.UserReservationsDto, error) {
-	var user model.User = client.UserClient.GetUserById(userId)
+func (s *reservationService) GetReservationsByUser(ctx context.Context, userId int) (dto.UserReservationsDto, error) {
+	ctx, span := tracing.Start(ctx, "ReservationService.GetReservationsByUser")
+	defer span.End()
+
 	var userReservationsDto dto.UserReservationsDto
 	var reservationsDto dto.ReservationsDto
 
-	if user.Id == 0 {
-		return userReservationsDto, errors.New("user not found")
+	if err := authorizeUser(ctx, userId, auth.ViewReservations); err != nil {
+		return userReservationsDto, err
+	}
+
+	user, err := client.UserClient.GetUserById(ctx, userId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return userReservationsDto, ErrUserNotFound
+	}
+
+	if err != nil {
+		return userReservationsDto, err
+	}
+
+	reservations, err := client.ReservationClient.GetReservationsByUser(ctx, userId)
+
+	if err != nil {
+		return userReservationsDto, err
+	}
+
+	reservations, err = visibleReservations(ctx, reservations)
+
+	if err != nil {
+		return userReservationsDto, err
 	}
-	var reservations model.Reservations = client.ReservationClient.GetReservationsByUser(userId)
 
 	userReservationsDto.UserId = user.Id
 	userReservationsDto.UserName = user.Name
@@ -148,18 +246,34 @@ func (s *reservationService) GetReservationsByUser(userId int) (dto.UserReservat
 	return userReservationsDto, nil
 }
 
-func (s *reservationService) GetReservationsByUserRange(userId int, startDate string, endDate string) (dto.ReservationsDto, error) {
+func (s *reservationService) GetReservationsByUserRange(ctx context.Context, userId int, startDate string, endDate string) (dto.ReservationsDto, error) {
+	ctx, span := tracing.Start(ctx, "ReservationService.GetReservationsByUserRange")
+	defer span.End()
 
 	var reservationsInRange dto.ReservationsDto
 
+	if err := authorizeUser(ctx, userId, auth.ViewReservations); err != nil {
+		return reservationsInRange, err
+	}
+
 	rangeStart, _ := time.Parse("02-01-2006 15:04", startDate)
 	rangeEnd, _ := time.Parse("02-01-2006 15:04", endDate)
 
 	if rangeStart.After(rangeEnd) {
-		return reservationsInRange, errors.New("a reservation cant end before it starts")
+		return reservationsInRange, ErrInvalidDateRange
+	}
+
+	reservations, err := client.ReservationClient.GetReservationsByUser(ctx, userId)
+
+	if err != nil {
+		return reservationsInRange, err
 	}
 
-	reservations := client.ReservationClient.GetReservationsByUser(userId)
+	reservations, err = visibleReservations(ctx, reservations)
+
+	if err != nil {
+		return reservationsInRange, err
+	}
 
 	for _, reservation := range reservations {
 
@@ -188,16 +302,32 @@ func (s *reservationService) GetReservationsByUserRange(userId int, startDate st
 	return reservationsInRange, nil
 }
 
-func (s *reservationService) GetReservationsByHotel(hotelId int) (dto.HotelReservationsDto, error) {
-	var hotel model.Hotel = client.HotelClient.GetHotelById(hotelId)
+func (s *reservationService) GetReservationsByHotel(ctx context.Context, hotelId int) (dto.HotelReservationsDto, error) {
+	ctx, span := tracing.Start(ctx, "ReservationService.GetReservationsByHotel")
+	defer span.End()
+
 	var hotelReservations dto.HotelReservationsDto
 	var reservationsDto dto.ReservationsDto
 
-	if hotel.Id == 0 {
-		return hotelReservations, errors.New("hotel not found")
+	if err := authorizeHotel(ctx, hotelId, auth.ViewReservations); err != nil {
+		return hotelReservations, err
+	}
+
+	hotel, err := client.HotelClient.GetHotelById(ctx, hotelId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return hotelReservations, ErrHotelNotFound
+	}
+
+	if err != nil {
+		return hotelReservations, err
 	}
 
-	var reservations model.Reservations = client.ReservationClient.GetReservationsByHotel(hotelId)
+	reservations, err := client.ReservationClient.GetReservationsByHotel(ctx, hotelId)
+
+	if err != nil {
+		return hotelReservations, err
+	}
 
 	hotelReservations.HotelId = hotel.Id
 	hotelReservations.HotelName = hotel.Name
@@ -224,22 +354,149 @@ func (s *reservationService) GetReservationsByHotel(hotelId int) (dto.HotelReser
 	return hotelReservations, nil
 }
 
-func (s *reservationService) DeleteReservation(id int) error {
+func (s *reservationService) DeleteReservation(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "ReservationService.DeleteReservation")
+	defer span.End()
 
-	reservation := client.ReservationClient.GetReservationById(id)
+	reservation, err := client.ReservationClient.GetReservationById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrReservationNotFound
+	}
 
-	if reservation.Id == 0 {
-		return errors.New("reservation not found")
+	if err != nil {
+		return err
+	}
+
+	if err := authorizeReservation(ctx, reservation, auth.ManageReservations); err != nil {
+		return err
 	}
 
 	reservationStart, _ := time.Parse("02-01-2006 15:04", reservation.StartDate)
 
 	if reservationStart.Before(time.Now().Add(48 * time.Hour)) {
-		return errors.New("can't delete a reservation 48hs before it starts")
+		return ErrCancellationClosed
 	}
 
-	err := client.ReservationClient.DeleteReservation(reservation)
+	err = client.ReservationClient.DeleteReservation(ctx, reservation)
 
-	return err
+	if err != nil {
+		return err
+	}
+
+	metrics.ReservationsCancelled.Inc()
+	log.Ctx(ctx).WithField("reservation_id", reservation.Id).Info("Reservation cancelled")
+	AuditService.Record(ctx, AuditCancel, "reservation", reservation.Id, auditReservation(reservation), nil)
+
+	return nil
+}
+
+func (s *reservationService) GetDeletedReservations(ctx context.Context) (dto.DeletedReservationsDto, error) {
+	ctx, span := tracing.Start(ctx, "ReservationService.GetDeletedReservations")
+	defer span.End()
+
+	var reservationsDto dto.DeletedReservationsDto
+
+	if _, err := authorize(ctx, auth.ManageDeleted); err != nil {
+		return reservationsDto, err
+	}
+
+	reservations, err := client.ReservationClient.GetDeletedReservations(ctx)
+
+	if err != nil {
+		return reservationsDto, err
+	}
+
+	for _, reservation := range reservations {
+		var reservationDto dto.DeletedReservationDto
+		reservationDto.Id = reservation.Id
+		reservationDto.StartDate = reservation.StartDate
+		reservationDto.EndDate = reservation.EndDate
+		reservationDto.HotelId = reservation.HotelId
+		reservationDto.UserId = reservation.UserId
+		reservationDto.Amount = reservation.Amount
+		reservationDto.DeletedAt = reservation.DeletedAt.Time
+
+		reservationsDto = append(reservationsDto, reservationDto)
+	}
+
+	return reservationsDto, nil
+}
+
+// RestoreReservation undeletes the reservation as long as its user and hotel
+// are still there and the hotel has a room left for it
+func (s *reservationService) RestoreReservation(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "ReservationService.RestoreReservation")
+	defer span.End()
+
+	if _, err := authorize(ctx, auth.ManageDeleted); err != nil {
+		return err
+	}
+
+	reservation, err := client.ReservationClient.GetDeletedReservationById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrReservationNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UserClient.GetUserById(ctx, reservation.UserId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrUnknownUser
+	}
+
+	if err != nil {
+		return err
+	}
+
+	timeStart, _ := time.Parse("02-01-2006 15:04", reservation.StartDate)
+	timeEnd, _ := time.Parse("02-01-2006 15:04", reservation.EndDate)
+
+	available, err := HotelService.CheckAvailability(ctx, reservation.HotelId, timeStart, timeEnd)
+
+	if errors.Is(err, ErrHotelNotFound) {
+		return ErrUnknownHotel
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !available {
+		return ErrNoRoomsAvailable
+	}
+
+	err = client.ReservationClient.RestoreReservation(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrReservationNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).WithField("reservation_id", id).Info("Reservation restored")
+	AuditService.Record(ctx, AuditRestore, "reservation", id, nil, nil)
+
+	return nil
+}
+
+// activeReservations keeps the reservations that haven't ended by now
+func activeReservations(reservations model.Reservations, now time.Time) model.Reservations {
+	var active model.Reservations
+
+	for _, reservation := range reservations {
+		reservationEnd, _ := time.Parse("02-01-2006 15:04", reservation.EndDate)
+
+		if reservationEnd.After(now) {
+			active = append(active, reservation)
+		}
+	}
 
+	return active
 }
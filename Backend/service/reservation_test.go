@@ -1,10 +1,15 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"project/auth"
 	"project/client"
 	"project/dto"
+	"project/metrics"
 	"project/model"
 	"testing"
 	"time"
@@ -18,23 +23,23 @@ func init() {
 	client.UserClient = &TestUser{}
 }
 
-func (t TestReservation) InsertReservation(reservation model.Reservation) model.Reservation {
+func (t TestReservation) InsertReservation(ctx context.Context, reservation model.Reservation) (model.Reservation, error) {
 
 	if reservation.StartDate == "" {
-		reservation.Id = 0
-	} else {
-		reservation.Id = 1
+		return reservation, errors.New("error creating reservation")
 	}
 
-	return reservation
+	reservation.Id = 1
+
+	return reservation, nil
 }
 
-func (t TestReservation) GetReservationById(id int) model.Reservation {
+func (t TestReservation) GetReservationById(ctx context.Context, id int) (model.Reservation, error) {
 
 	var reservation model.Reservation
 
-	if id > 10 {
-		reservation.Id = 0
+	if id > 10 || id == 0 {
+		return reservation, client.ErrNotFound
 	} else {
 		reservation.Id = id
 
@@ -45,10 +50,10 @@ func (t TestReservation) GetReservationById(id int) model.Reservation {
 		}
 	}
 
-	return reservation
+	return reservation, nil
 }
 
-func (t TestReservation) GetReservations() model.Reservations {
+func (t TestReservation) GetReservations(ctx context.Context) (model.Reservations, error) {
 
 	return model.Reservations{
 		model.Reservation{
@@ -68,13 +73,29 @@ func (t TestReservation) GetReservations() model.Reservations {
 			HotelId:   1,
 			Amount:    45000,
 		},
+	}, nil
+}
+
+// futureReservation hasn't ended yet, hotel and user 7 hold one
+func futureReservation() model.Reservation {
+	return model.Reservation{
+		Id:        7,
+		StartDate: time.Now().Add(24 * time.Hour).Format("02-01-2006 15:04"),
+		EndDate:   time.Now().Add(72 * time.Hour).Format("02-01-2006 15:04"),
+		UserId:    7,
+		HotelId:   7,
+		Amount:    20000,
 	}
 }
 
-func (t TestReservation) GetReservationsByUser(userId int) model.Reservations {
+func (t TestReservation) GetReservationsByUser(ctx context.Context, userId int) (model.Reservations, error) {
+
+	if userId == 7 {
+		return model.Reservations{futureReservation()}, nil
+	}
 
 	if userId > 10 {
-		return model.Reservations{}
+		return model.Reservations{}, nil
 	} else {
 		return model.Reservations{
 			model.Reservation{
@@ -94,14 +115,18 @@ func (t TestReservation) GetReservationsByUser(userId int) model.Reservations {
 				HotelId:   1,
 				Amount:    10000,
 			},
-		}
+		}, nil
 	}
 }
 
-func (t TestReservation) GetReservationsByHotel(hotelId int) model.Reservations {
+func (t TestReservation) GetReservationsByHotel(ctx context.Context, hotelId int) (model.Reservations, error) {
+
+	if hotelId == 7 {
+		return model.Reservations{futureReservation()}, nil
+	}
 
 	if hotelId > 10 {
-		return model.Reservations{}
+		return model.Reservations{}, nil
 	} else {
 		return model.Reservations{
 			model.Reservation{
@@ -121,11 +146,22 @@ func (t TestReservation) GetReservationsByHotel(hotelId int) model.Reservations
 				HotelId:   hotelId,
 				Amount:    10000,
 			},
-		}
+		}, nil
 	}
 }
 
-func (t TestReservation) DeleteReservation(reservation model.Reservation) error {
+func (t TestReservation) GetReservationsByHotels(ctx context.Context, hotelIds []int) (model.Reservations, error) {
+	var reservations model.Reservations
+
+	for _, hotelId := range hotelIds {
+		hotelReservations, _ := t.GetReservationsByHotel(ctx, hotelId)
+		reservations = append(reservations, hotelReservations...)
+	}
+
+	return reservations, nil
+}
+
+func (t TestReservation) DeleteReservation(ctx context.Context, reservation model.Reservation) error {
 
 	if reservation.Id > 10 {
 		return errors.New("failed to delete reservation")
@@ -134,6 +170,52 @@ func (t TestReservation) DeleteReservation(reservation model.Reservation) error
 	return nil
 }
 
+func (t TestReservation) GetDeletedReservations(ctx context.Context) (model.Reservations, error) {
+
+	return model.Reservations{
+		model.Reservation{
+			Id:        4,
+			StartDate: "01-01-2030 10:00",
+			EndDate:   "05-01-2030 10:00",
+			UserId:    1,
+			HotelId:   1,
+			Amount:    40000,
+			DeletedAt: gorm.DeletedAt{Time: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), Valid: true},
+		},
+	}, nil
+}
+
+// GetDeletedReservationById returns reservations of a deleted user (5), of a
+// deleted hotel (6) and for dates that are sold out (8)
+func (t TestReservation) GetDeletedReservationById(ctx context.Context, id int) (model.Reservation, error) {
+
+	reservation := model.Reservation{Id: id, StartDate: "01-01-2030 10:00", EndDate: "05-01-2030 10:00", UserId: 1, HotelId: 1}
+
+	switch id {
+	case 5:
+		reservation.UserId = 12
+	case 6:
+		reservation.HotelId = 12
+	case 8:
+		reservation.StartDate = "01-01-2024 10:00"
+		reservation.EndDate = "01-02-2024 10:00"
+	}
+
+	if id > 10 {
+		return model.Reservation{}, client.ErrNotFound
+	}
+
+	return reservation, nil
+}
+
+func (t TestReservation) RestoreReservation(ctx context.Context, id int) error {
+	return nil
+}
+
+func (t TestReservation) PurgeReservations(ctx context.Context, before time.Time) (int64, error) {
+	return 3, nil
+}
+
 func TestInsertReservation_Service_UserNotFound(t *testing.T) {
 
 	a := assert.New(t)
@@ -145,7 +227,7 @@ func TestInsertReservation_Service_UserNotFound(t *testing.T) {
 		HotelId:   1,
 	}
 
-	_, err := ReservationService.InsertReservation(reservation)
+	_, err := ReservationService.InsertReservation(adminCtx, reservation)
 
 	expectedResult := "user not found"
 
@@ -164,7 +246,7 @@ func TestInsertReservation_Service_HotelNotFound(t *testing.T) {
 		HotelId:   15,
 	}
 
-	_, err := ReservationService.InsertReservation(reservation)
+	_, err := ReservationService.InsertReservation(adminCtx, reservation)
 
 	expectedResult := "hotel not found"
 
@@ -172,6 +254,15 @@ func TestInsertReservation_Service_HotelNotFound(t *testing.T) {
 	a.Equal(expectedResult, err.Error())
 }
 
+func TestInsertReservation_Service_Draft(t *testing.T) {
+
+	a := assert.New(t)
+
+	// Hotel 10 is a draft
+	_, err := ReservationService.InsertReservation(adminCtx, dto.ReservationDto{StartDate: "01-02-2030 10:00", EndDate: "03-02-2030 10:00", UserId: 1, HotelId: 10})
+	a.ErrorIs(err, ErrUnknownHotel)
+}
+
 func TestInsertReservation_Service_Error(t *testing.T) {
 
 	a := assert.New(t)
@@ -183,7 +274,7 @@ func TestInsertReservation_Service_Error(t *testing.T) {
 		HotelId:   1,
 	}
 
-	_, err := ReservationService.InsertReservation(reservation)
+	_, err := ReservationService.InsertReservation(adminCtx, reservation)
 
 	expectedResult := "a reservation cant end before it starts"
 
@@ -202,12 +293,15 @@ func TestInsertReservation_Service_NotAvailable(t *testing.T) {
 		HotelId:   1,
 	}
 
-	_, err := ReservationService.InsertReservation(reservation)
+	rejections := testutil.ToFloat64(metrics.SoldOutRejections)
+
+	_, err := ReservationService.InsertReservation(adminCtx, reservation)
 
 	expectedResult := "there are no rooms available"
 
 	a.NotNil(err)
 	a.Equal(expectedResult, err.Error())
+	a.Equal(rejections+1, testutil.ToFloat64(metrics.SoldOutRejections))
 }
 
 func TestInsertReservation_Service_Success(t *testing.T) {
@@ -221,20 +315,23 @@ func TestInsertReservation_Service_Success(t *testing.T) {
 		HotelId:   1,
 	}
 
-	result, err := ReservationService.InsertReservation(reservation)
+	created := testutil.ToFloat64(metrics.ReservationsCreated)
+
+	result, err := ReservationService.InsertReservation(adminCtx, reservation)
 
 	reservation.Id = 1
 	reservation.Amount = 100000
 
 	a.Nil(err)
 	a.Equal(reservation, result)
+	a.Equal(created+1, testutil.ToFloat64(metrics.ReservationsCreated))
 }
 
 func TestGetReservationById_Service_NotFound(t *testing.T) {
 
 	a := assert.New(t)
 
-	_, err := ReservationService.GetReservationById(12)
+	_, err := ReservationService.GetReservationById(adminCtx, 12)
 
 	expectedResult := "reservation not found"
 
@@ -246,7 +343,7 @@ func TestGetReservationById_Service_Found(t *testing.T) {
 
 	a := assert.New(t)
 
-	result, err := ReservationService.GetReservationById(1)
+	result, err := ReservationService.GetReservationById(adminCtx, 1)
 
 	expectedResult := dto.ReservationDto{Id: 1}
 
@@ -258,7 +355,7 @@ func TestGetReservations_Service(t *testing.T) {
 
 	a := assert.New(t)
 
-	result, err := ReservationService.GetReservations()
+	result, err := ReservationService.GetReservations(adminCtx)
 
 	expectedResult := dto.ReservationsDto{
 		dto.ReservationDto{
@@ -288,7 +385,7 @@ func TestGetReservationsByUser_Service_UserNotFound(t *testing.T) {
 
 	a := assert.New(t)
 
-	_, err := ReservationService.GetReservationsByUser(12)
+	_, err := ReservationService.GetReservationsByUser(adminCtx, 12)
 
 	expectedResult := "user not found"
 
@@ -301,7 +398,7 @@ func TestGetReservationsByUser_Service_Success(t *testing.T) {
 	a := assert.New(t)
 
 	userId := 1
-	result, err := ReservationService.GetReservationsByUser(userId)
+	result, err := ReservationService.GetReservationsByUser(adminCtx, userId)
 
 	reservations := dto.ReservationsDto{
 		dto.ReservationDto{
@@ -340,7 +437,7 @@ func TestGetReservationsByUserRange_Service_Error(t *testing.T) {
 	startDate := "02-01-2024 10:00"
 	endDate := "01-01-2024 10:00"
 
-	_, err := ReservationService.GetReservationsByUserRange(userId, startDate, endDate)
+	_, err := ReservationService.GetReservationsByUserRange(adminCtx, userId, startDate, endDate)
 
 	expectedResponse := "a reservation cant end before it starts"
 
@@ -356,7 +453,7 @@ func TestGetReservationsByUserRange_Service_NoReservations(t *testing.T) {
 	startDate := "02-11-2024 10:00"
 	endDate := "03-11-2024 10:00"
 
-	result, err := ReservationService.GetReservationsByUserRange(userId, startDate, endDate)
+	result, err := ReservationService.GetReservationsByUserRange(adminCtx, userId, startDate, endDate)
 
 	var expectedResponse dto.ReservationsDto
 
@@ -372,7 +469,7 @@ func TestGetReservationsByUserRange_Service_Success(t *testing.T) {
 	startDate := "01-01-2024 00:00"
 	endDate := "31-12-2024 23:59"
 
-	result, err := ReservationService.GetReservationsByUserRange(userId, startDate, endDate)
+	result, err := ReservationService.GetReservationsByUserRange(adminCtx, userId, startDate, endDate)
 
 	expectedResponse := dto.ReservationsDto{
 		dto.ReservationDto{
@@ -402,7 +499,7 @@ func TestGetReservationsByHotel_Service_HotelNotFound(t *testing.T) {
 
 	a := assert.New(t)
 
-	_, err := ReservationService.GetReservationsByHotel(12)
+	_, err := ReservationService.GetReservationsByHotel(adminCtx, 12)
 
 	expectedResult := "hotel not found"
 
@@ -415,7 +512,7 @@ func TestGetReservationsByHotel_Service_Success(t *testing.T) {
 	a := assert.New(t)
 
 	hotelId := 1
-	result, err := ReservationService.GetReservationsByHotel(hotelId)
+	result, err := ReservationService.GetReservationsByHotel(adminCtx, hotelId)
 
 	reservations := dto.ReservationsDto{
 		dto.ReservationDto{
@@ -456,7 +553,7 @@ func TestDeleteReservation_Service_NotFound(t *testing.T) {
 
 	a := assert.New(t)
 
-	err := ReservationService.DeleteReservation(0)
+	err := ReservationService.DeleteReservation(adminCtx, 0)
 
 	expectedResponse := "reservation not found"
 
@@ -468,7 +565,7 @@ func TestDeleteReservation_Service_Error(t *testing.T) {
 
 	a := assert.New(t)
 
-	err := ReservationService.DeleteReservation(3)
+	err := ReservationService.DeleteReservation(adminCtx, 3)
 
 	expectedResponse := "can't delete a reservation 48hs before it starts"
 
@@ -480,7 +577,113 @@ func TestDeleteReservation_Service_Success(t *testing.T) {
 
 	a := assert.New(t)
 
-	err := ReservationService.DeleteReservation(2)
+	cancelled := testutil.ToFloat64(metrics.ReservationsCancelled)
+
+	err := ReservationService.DeleteReservation(adminCtx, 2)
+
+	a.Nil(err)
+	a.Equal(cancelled+1, testutil.ToFloat64(metrics.ReservationsCancelled))
+}
+
+func TestGetDeletedReservations_Service(t *testing.T) {
+
+	a := assert.New(t)
+
+	result, err := ReservationService.GetDeletedReservations(adminCtx)
+
+	a.Nil(err)
+	a.Len(result, 1)
+	a.Equal(4, result[0].Id)
+	a.Equal(40000.0, result[0].Amount)
+	a.Equal(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), result[0].DeletedAt)
+}
+
+func TestRestoreReservation_Service(t *testing.T) {
+
+	a := assert.New(t)
+
+	a.Nil(ReservationService.RestoreReservation(adminCtx, 4))
+	a.ErrorIs(ReservationService.RestoreReservation(adminCtx, 12), ErrReservationNotFound)
+	a.ErrorIs(ReservationService.RestoreReservation(adminCtx, 5), ErrUnknownUser)
+	a.ErrorIs(ReservationService.RestoreReservation(adminCtx, 6), ErrUnknownHotel)
+	a.ErrorIs(ReservationService.RestoreReservation(adminCtx, 8), ErrNoRoomsAvailable)
+}
+
+func TestReservation_Service_Unauthorized(t *testing.T) {
+
+	a := assert.New(t)
+	customer := asUser(5, auth.RoleCustomer)
+
+	_, err := ReservationService.GetReservations(customer)
+	a.ErrorIs(err, ErrPermissionDenied)
+
+	_, err = ReservationService.GetReservationsByUser(customer, 1)
+	a.ErrorIs(err, ErrPermissionDenied)
+
+	_, err = ReservationService.GetReservationsByUser(customer, 5)
+	a.Nil(err)
+
+	// Reservation 2 belongs to someone else
+	_, err = ReservationService.GetReservationById(customer, 2)
+	a.ErrorIs(err, ErrPermissionDenied)
+	a.ErrorIs(ReservationService.DeleteReservation(customer, 2), ErrPermissionDenied)
+
+	_, err = ReservationService.InsertReservation(customer, dto.ReservationDto{UserId: 1, HotelId: 1})
+	a.ErrorIs(err, ErrPermissionDenied)
+
+	// The front desk books for guests
+	_, err = ReservationService.GetReservations(asUser(6, auth.RoleFrontDesk))
+	a.Nil(err)
+
+	_, err = ReservationService.GetDeletedReservations(asUser(6, auth.RoleFrontDesk))
+	a.ErrorIs(err, ErrPermissionDenied)
+}
+
+func TestReservation_Service_Manager(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAssignments(t)
+
+	// Managers only see the reservations of the hotels assigned to them
+	reservations, err := ReservationService.GetReservations(managerCtx)
+	a.Nil(err)
+	a.Len(reservations, 2)
+	for _, reservation := range reservations {
+		a.Equal(1, reservation.HotelId)
+	}
+
+	reservations, err = ReservationService.GetReservations(asUser(6, auth.RoleManager))
+	a.Nil(err)
+	a.Empty(reservations)
+
+	_, err = ReservationService.GetReservationsByHotel(managerCtx, 1)
+	a.Nil(err)
+
+	_, err = ReservationService.GetReservationsByHotel(managerCtx, 2)
+	a.ErrorIs(err, ErrHotelNotAssigned)
+
+	// User 7 only holds a reservation at hotel 7
+	userReservations, err := ReservationService.GetReservationsByUser(managerCtx, 7)
+	a.Nil(err)
+	a.Empty(userReservations.Reservations)
+
+	userReservations, err = ReservationService.GetReservationsByUser(managerCtx, 1)
+	a.Nil(err)
+	a.Len(userReservations.Reservations, 2)
+
+	reservations, err = ReservationService.GetReservationsByUserRange(managerCtx, 7, time.Now().Format("02-01-2006 15:04"), time.Now().Add(96*time.Hour).Format("02-01-2006 15:04"))
+	a.Nil(err)
+	a.Empty(reservations)
+
+	// Reservation 2 is at hotel 0
+	_, err = ReservationService.GetReservationById(managerCtx, 2)
+	a.ErrorIs(err, ErrHotelNotAssigned)
+	a.ErrorIs(ReservationService.DeleteReservation(managerCtx, 2), ErrHotelNotAssigned)
+
+	_, err = ReservationService.InsertReservation(managerCtx, dto.ReservationDto{UserId: 1, HotelId: 2})
+	a.ErrorIs(err, ErrHotelNotAssigned)
 
+	// Managers book for themselves anywhere
+	_, err = ReservationService.InsertReservation(managerCtx, dto.ReservationDto{UserId: 5, HotelId: 2, StartDate: "10-11-2030 15:00", EndDate: "12-11-2030 11:00"})
 	a.Nil(err)
 }
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"project/client"
+	"project/mail"
+	"project/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The purposes of the tokens sent to users
+const (
+	TokenConfirmation      = "confirmation"
+	TokenEmailChange       = "email_change"
+	TokenEmailVerification = "email_verification"
+	TokenMfaChallenge      = "mfa_challenge"
+	TokenPasswordReset     = "password_reset"
+)
+
+// Mailer delivers the emails sent to users and AppUrl is the frontend their
+// links point to, both are replaced at startup. EmailVerificationTtl is how
+// long the links confirming an email last, PasswordResetTtl the ones
+// resetting a password and ConfirmationTtl the codes standing in for the
+// password of accounts without one.
+var (
+	Mailer               mail.Mailer = mail.Disabled{}
+	AppUrl                           = "http://localhost:5173"
+	EmailVerificationTtl             = 48 * time.Hour
+	PasswordResetTtl                 = time.Hour
+	ConfirmationTtl                  = 15 * time.Minute
+)
+
+// emailData fills the email templates, see mail.Render
+type emailData struct {
+	Name      string
+	Email     string
+	Link      string
+	Code      string
+	ExpiresIn string
+}
+
+// tokenEmail is the data of an email carrying a token, the link opens the
+// frontend page at path with the token in its query
+func tokenEmail(user model.User, email string, path string, token string, ttl time.Duration) emailData {
+	return emailData{
+		Name:      user.Name,
+		Email:     email,
+		Link:      strings.TrimSuffix(AppUrl, "/") + path + "?token=" + url.QueryEscape(token),
+		Code:      token,
+		ExpiresIn: readableDuration(ttl),
+	}
+}
+
+// readableDuration writes a duration the way it is read in an email, in whole
+// hours or minutes, e.g. "48 hours"
+func readableDuration(d time.Duration) string {
+	count, unit := int(d.Minutes()), "minute"
+
+	if d >= time.Hour && d%time.Hour == 0 {
+		count, unit = int(d.Hours()), "hour"
+	}
+
+	if count == 1 {
+		return "1 " + unit
+	}
+
+	return strconv.Itoa(count) + " " + unit + "s"
+}
+
+// newToken returns a random token to send and the hash to store in its place
+func newToken() (string, string, error) {
+	buf := make([]byte, 32)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueToken stores a new token for the user and returns it, the tokens sent
+// before for the same purpose stop working
+func issueToken(ctx context.Context, userId int, purpose string, email string, ttl time.Duration) (string, error) {
+	token, hash, err := newToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	_, err = client.TokenClient.InsertToken(ctx, model.UserToken{
+		UserId:    userId,
+		Purpose:   purpose,
+		Hash:      hash,
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+
+	return token, err
+}
+
+// redeemToken uses up a token sent for the purpose, ErrTokenInvalid is
+// returned when it is unknown, expired or already used
+func redeemToken(ctx context.Context, purpose string, token string) (model.UserToken, error) {
+	userToken, err := client.TokenClient.GetToken(ctx, purpose, hashToken(token))
+
+	if errors.Is(err, client.ErrNotFound) {
+		return userToken, ErrTokenInvalid
+	}
+
+	if err != nil {
+		return userToken, err
+	}
+
+	if !time.Now().Before(userToken.ExpiresAt) {
+		log.Ctx(ctx).WithFields(logrus.Fields{"user_id": userToken.UserId, "purpose": purpose}).Info("Expired token used")
+		return userToken, ErrTokenInvalid
+	}
+
+	// Deleting it first makes sure two requests can't both use it
+	err = client.TokenClient.DeleteToken(ctx, userToken.Id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return userToken, ErrTokenInvalid
+	}
+
+	return userToken, err
+}
+
+// sendMail renders the named email and delivers it to the address given,
+// ErrMailUnavailable is returned when it can't be sent
+func sendMail(ctx context.Context, name string, to string, data emailData) error {
+	message, err := mail.Render(name, data)
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).WithField("email", name).Error("Failed to render email")
+		return ErrMailUnavailable
+	}
+
+	message.To = to
+
+	if err := Mailer.Send(ctx, message); err != nil {
+		log.Ctx(ctx).WithError(err).WithField("email", name).Error("Failed to send email")
+		return ErrMailUnavailable
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"project/client"
+	"project/mail"
+	"project/model"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestToken struct {
+	tokens map[string]model.UserToken
+}
+
+func init() {
+	client.TokenClient = &TestToken{tokens: map[string]model.UserToken{}}
+}
+
+func newTestToken(t *testing.T) *TestToken {
+	previous := client.TokenClient
+	mock := &TestToken{tokens: map[string]model.UserToken{}}
+
+	client.TokenClient = mock
+	t.Cleanup(func() { client.TokenClient = previous })
+
+	return mock
+}
+
+func (t *TestToken) InsertToken(ctx context.Context, token model.UserToken) (model.UserToken, error) {
+	for hash, stored := range t.tokens {
+		if stored.UserId == token.UserId && stored.Purpose == token.Purpose {
+			delete(t.tokens, hash)
+		}
+	}
+
+	token.Id = len(t.tokens) + 1
+	t.tokens[token.Hash] = token
+
+	return token, nil
+}
+
+func (t *TestToken) GetToken(ctx context.Context, purpose string, hash string) (model.UserToken, error) {
+	token, ok := t.tokens[hash]
+
+	if !ok || token.Purpose != purpose {
+		return model.UserToken{}, client.ErrNotFound
+	}
+
+	return token, nil
+}
+
+func (t *TestToken) DeleteToken(ctx context.Context, id int) error {
+	for hash, token := range t.tokens {
+		if token.Id == id {
+			delete(t.tokens, hash)
+			return nil
+		}
+	}
+
+	return client.ErrNotFound
+}
+
+func (t *TestToken) DeleteExpiredTokens(ctx context.Context, now time.Time) (int64, error) {
+	var count int64
+
+	for hash, token := range t.tokens {
+		if !now.Before(token.ExpiresAt) {
+			delete(t.tokens, hash)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func newTestMailer(t *testing.T) *mail.Memory {
+	mailer := &mail.Memory{}
+
+	Mailer = mailer
+	t.Cleanup(func() { Mailer = mail.Disabled{} })
+
+	return mailer
+}
+
+var mailedTokenPattern = regexp.MustCompile(`\?token=([A-Za-z0-9_-]+)`)
+
+var mailedCodePattern = regexp.MustCompile(`(?m)^([A-Za-z0-9_-]{43})$`)
+
+// mailedToken reads the token from the link in the message
+func mailedToken(t *testing.T, message mail.Message) string {
+	match := mailedTokenPattern.FindStringSubmatch(message.Text)
+
+	if match == nil {
+		t.Fatalf("No link in the message: %s", message.Text)
+	}
+
+	return match[1]
+}
+
+// mailedCode returns the code of an email carrying one without a link
+func mailedCode(t *testing.T, message mail.Message) string {
+	match := mailedCodePattern.FindStringSubmatch(message.Text)
+
+	if match == nil {
+		t.Fatalf("No code in the message: %s", message.Text)
+	}
+
+	return match[1]
+}
+
+func TestIssueToken(t *testing.T) {
+	a := assert.New(t)
+	mock := newTestToken(t)
+	ctx := context.Background()
+
+	first, err := issueToken(ctx, 1, TokenEmailChange, "new@email.com", time.Hour)
+	a.Nil(err)
+	second, err := issueToken(ctx, 1, TokenEmailChange, "new@email.com", time.Hour)
+	a.Nil(err)
+
+	a.NotEqual(first, second)
+	a.Len(mock.tokens, 1)
+
+	// Only the hash is stored
+	_, stored := mock.tokens[second]
+	a.False(stored)
+
+	// The last token sent replaces the ones before
+	_, err = redeemToken(ctx, TokenEmailChange, first)
+	a.ErrorIs(err, ErrTokenInvalid)
+
+	token, err := redeemToken(ctx, TokenEmailChange, second)
+	a.Nil(err)
+	a.Equal(1, token.UserId)
+	a.Equal("new@email.com", token.Email)
+
+	// Tokens are used once
+	_, err = redeemToken(ctx, TokenEmailChange, second)
+	a.ErrorIs(err, ErrTokenInvalid)
+}
+
+func TestRedeemToken_Expired(t *testing.T) {
+	a := assert.New(t)
+	newTestToken(t)
+	ctx := context.Background()
+
+	token, err := issueToken(ctx, 1, TokenEmailChange, "new@email.com", -time.Minute)
+	a.Nil(err)
+
+	_, err = redeemToken(ctx, TokenEmailChange, token)
+	a.ErrorIs(err, ErrTokenInvalid)
+
+	_, err = redeemToken(ctx, "other", token)
+	a.ErrorIs(err, ErrTokenInvalid)
+}
+
+func TestTokenEmail(t *testing.T) {
+	a := assert.New(t)
+
+	AppUrl = "https://miranda.example.com/"
+	t.Cleanup(func() { AppUrl = "http://localhost:5173" })
+
+	data := tokenEmail(model.User{Name: "Jane"}, "jane@email.com", "/verify-email", "a-b_c", 48*time.Hour)
+
+	a.Equal("https://miranda.example.com/verify-email?token=a-b_c", data.Link)
+	a.Equal("a-b_c", data.Code)
+	a.Equal("48 hours", data.ExpiresIn)
+
+	a.Equal("1 hour", readableDuration(time.Hour))
+	a.Equal("90 minutes", readableDuration(90*time.Minute))
+	a.Equal("1 minute", readableDuration(time.Minute))
+}
@@ -1,20 +1,47 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
+	"project/auth"
 	"project/client"
 	"project/dto"
+	"project/metrics"
 	"project/model"
+	"project/tracing"
+	"strings"
+	"time"
 )
 
 type userService struct{}
 
 type userServiceInterface interface {
-	InsertUser(userDto dto.UserDto) (dto.UserDto, error)
-	GetUserById(id int) (dto.UserDto, error)
-	GetUsers() (dto.UsersDto, error)
-	UserLogin(loginDto dto.UserDto) (dto.UserDto, error)
+	InsertUser(ctx context.Context, userDto dto.UserDto) (dto.UserDto, error)
+	GetUserById(ctx context.Context, id int) (dto.UserDto, error)
+	GetUsers(ctx context.Context) (dto.UsersDto, error)
+	UpdateUser(ctx context.Context, id int, profileDto dto.UserProfileDto) (dto.UserDto, error)
+	UserLogin(ctx context.Context, loginDto dto.UserDto) (dto.LoginResultDto, error)
+	UpdateProfile(ctx context.Context, id int, profileDto dto.ProfileDto) (dto.UserDto, error)
+	ChangePassword(ctx context.Context, id int, passwordDto dto.PasswordChangeDto) error
+	RequestEmailChange(ctx context.Context, id int, emailDto dto.EmailChangeDto) error
+	ConfirmEmailChange(ctx context.Context, token string) (dto.UserDto, error)
+	RequestEmailVerification(ctx context.Context, id int) error
+	RequestConfirmation(ctx context.Context, id int) error
+	VerifyEmail(ctx context.Context, token string) (dto.UserDto, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, resetDto dto.PasswordResetDto) error
+	DeleteAccount(ctx context.Context, id int, deletionDto dto.AccountDeletionDto, force bool) error
+	DeleteUser(ctx context.Context, id int, force bool) error
+	GetDeletedUsers(ctx context.Context) (dto.DeletedUsersDto, error)
+	RestoreUser(ctx context.Context, id int) error
+	CreateUser(ctx context.Context, newUserDto dto.NewUserDto) (dto.UserDto, error)
+	SetRole(ctx context.Context, id int, role string) (dto.UserDto, error)
+	SetDisabled(ctx context.Context, id int, disabled bool) (dto.UserDto, error)
+	Authenticate(ctx context.Context, identity auth.Identity) (auth.Identity, error)
+	BootstrapAdmin(ctx context.Context, email string) (dto.UserDto, error)
 }
 
 var UserService userServiceInterface
@@ -23,43 +50,121 @@ func init() {
 	UserService = &userService{}
 }
 
-func (s *userService) InsertUser(userDto dto.UserDto) (dto.UserDto, error) {
-	var user model.User
-
-	encryptedPassword, err := bcrypt.GenerateFromPassword([]byte(userDto.Password), bcrypt.DefaultCost)
+func (s *userService) InsertUser(ctx context.Context, userDto dto.UserDto) (dto.UserDto, error) {
+	ctx, span := tracing.Start(ctx, "UserService.InsertUser")
+	defer span.End()
 
-	if err != nil {
-		return userDto, err
-	}
+	var user model.User
 
 	user.Name = userDto.Name
 	user.LastName = userDto.LastName
 	user.Dni = userDto.Dni
 	user.Email = userDto.Email
-	user.Password = string(encryptedPassword)
-	user.Role = "Customer"
+	user.Role = auth.RoleCustomer
 
-	user = client.UserClient.InsertUser(user)
+	user, err := insertUser(ctx, user, userDto.Password)
+
+	if err != nil {
+		return userDto, err
+	}
 
 	userDto.Id = user.Id
 	userDto.Role = user.Role
+	userDto.EmailVerified = user.EmailVerified
+	userDto.Disabled = user.Disabled
 	userDto.Password = user.Password
 
-	if user.Id == 0 {
-		return userDto, errors.New("error creating user")
+	return userDto, nil
+}
+
+// CreateUser adds an account with any role, for staff who can't sign up as
+// customers do
+func (s *userService) CreateUser(ctx context.Context, newUserDto dto.NewUserDto) (dto.UserDto, error) {
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser")
+	defer span.End()
+
+	if _, err := authorize(ctx, auth.ManageUsers); err != nil {
+		return dto.UserDto{}, err
 	}
 
-	return userDto, nil
+	if !auth.ValidRole(newUserDto.Role) {
+		return dto.UserDto{}, ErrUnknownRole
+	}
+
+	user, err := insertUser(ctx, model.User{
+		Name:     newUserDto.Name,
+		LastName: newUserDto.LastName,
+		Dni:      newUserDto.Dni,
+		Email:    newUserDto.Email,
+		Role:     newUserDto.Role,
+	}, newUserDto.Password)
+
+	if err != nil {
+		return dto.UserDto{}, err
+	}
+
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": user.Id, "role": user.Role}).Info("User created")
+
+	return dto.UserDto{
+		Id:       user.Id,
+		Name:     user.Name,
+		LastName: user.LastName,
+		Dni:      user.Dni,
+		Email:    user.Email,
+		Role:     user.Role,
+
+		EmailVerified: user.EmailVerified,
+		Disabled:      user.Disabled,
+	}, nil
 }
 
-func (s *userService) GetUserById(id int) (dto.UserDto, error) {
+// insertUser saves a new user with the password hashed, then sends them the
+// link to verify their email
+func insertUser(ctx context.Context, user model.User, password string) (model.User, error) {
+	encryptedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 
-	var user model.User = client.UserClient.GetUserById(id)
+	if err != nil {
+		return user, err
+	}
+
+	user.Password = string(encryptedPassword)
+
+	user, err = client.UserClient.InsertUser(ctx, user)
+
+	if errors.Is(err, client.ErrConflict) {
+		return user, ErrEmailRegistered
+	}
+
+	if err != nil {
+		return user, err
+	}
+
+	AuditService.Record(ctx, AuditCreate, "user", user.Id, nil, auditUser(user))
+
+	// The account works without a verified email, it can be sent again later
+	_ = sendVerification(ctx, user)
+
+	return user, nil
+}
+
+func (s *userService) GetUserById(ctx context.Context, id int) (dto.UserDto, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserById")
+	defer span.End()
 
 	var userDto dto.UserDto
 
-	if user.Id == 0 {
-		return userDto, errors.New("user not found")
+	if err := authorizeUser(ctx, id, auth.ViewUsers); err != nil {
+		return userDto, err
+	}
+
+	user, err := client.UserClient.GetUserById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return userDto, ErrUserNotFound
+	}
+
+	if err != nil {
+		return userDto, err
 	}
 
 	userDto.Id = user.Id
@@ -68,14 +173,28 @@ func (s *userService) GetUserById(id int) (dto.UserDto, error) {
 	userDto.Dni = user.Dni
 	userDto.Email = user.Email
 	userDto.Role = user.Role
+	userDto.EmailVerified = user.EmailVerified
+	userDto.Disabled = user.Disabled
 
 	return userDto, nil
 }
 
-func (s *userService) GetUsers() (dto.UsersDto, error) {
-	var users model.Users = client.UserClient.GetUsers()
+func (s *userService) GetUsers(ctx context.Context) (dto.UsersDto, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUsers")
+	defer span.End()
+
 	var usersDto dto.UsersDto
 
+	if _, err := authorize(ctx, auth.ViewUsers); err != nil {
+		return usersDto, err
+	}
+
+	users, err := client.UserClient.GetUsers(ctx)
+
+	if err != nil {
+		return usersDto, err
+	}
+
 	for _, user := range users {
 		var userDto dto.UserDto
 		userDto.Id = user.Id
@@ -84,6 +203,8 @@ func (s *userService) GetUsers() (dto.UsersDto, error) {
 		userDto.Dni = user.Dni
 		userDto.Email = user.Email
 		userDto.Role = user.Role
+		userDto.EmailVerified = user.EmailVerified
+		userDto.Disabled = user.Disabled
 
 		usersDto = append(usersDto, userDto)
 	}
@@ -91,27 +212,872 @@ func (s *userService) GetUsers() (dto.UsersDto, error) {
 	return usersDto, nil
 }
 
-func (s *userService) UserLogin(loginDto dto.UserDto) (dto.UserDto, error) {
+// UpdateUser saves the profile of the user. Users can change their own, but
+// not the email, which only changes here for those who manage users: a stolen
+// session could move the account to another address otherwise, see
+// RequestEmailChange.
+func (s *userService) UpdateUser(ctx context.Context, id int, profileDto dto.UserProfileDto) (dto.UserDto, error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateUser")
+	defer span.End()
+
+	if err := authorizeUser(ctx, id, auth.ManageUsers); err != nil {
+		return dto.UserDto{}, err
+	}
 
-	var user = client.UserClient.GetUserByEmail(loginDto.Email)
+	if identity, _ := auth.IdentityFrom(ctx); !identity.Can(auth.ManageUsers) {
+		user, err := client.UserClient.GetUserById(ctx, id)
 
-	if user.Id == 0 {
-		return loginDto, errors.New("user not registered")
+		if errors.Is(err, client.ErrNotFound) {
+			return dto.UserDto{}, ErrUserNotFound
+		}
+
+		if err != nil {
+			return dto.UserDto{}, err
+		}
+
+		if !strings.EqualFold(user.Email, profileDto.Email) {
+			log.Ctx(ctx).WithField("user_id", id).Warn("Email change without confirmation denied")
+			return dto.UserDto{}, ErrEmailUnconfirmed
+		}
 	}
 
-	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginDto.Password))
+	return updateProfile(ctx, id, profileDto)
+}
+
+// updateProfile saves the profile of the user, a new email has to be verified again
+func updateProfile(ctx context.Context, id int, profileDto dto.UserProfileDto) (dto.UserDto, error) {
+	var userDto dto.UserDto
+
+	user, err := client.UserClient.GetUserById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return userDto, ErrUserNotFound
+	}
+
+	if err != nil {
+		return userDto, err
+	}
+
+	before := auditUser(user)
+	emailChanged := !strings.EqualFold(user.Email, profileDto.Email)
+
+	user.Name = profileDto.Name
+	user.LastName = profileDto.LastName
+	user.Dni = profileDto.Dni
+	user.Email = profileDto.Email
+
+	if emailChanged {
+		user.EmailVerified = false
+	}
+
+	user, err = client.UserClient.UpdateUser(ctx, user)
+
+	if errors.Is(err, client.ErrConflict) {
+		return userDto, ErrEmailRegistered
+	}
+
+	if err != nil {
+		return userDto, err
+	}
+
+	userDto.Id = user.Id
+	userDto.Name = user.Name
+	userDto.LastName = user.LastName
+	userDto.Dni = user.Dni
+	userDto.Email = user.Email
+	userDto.Role = user.Role
+	userDto.EmailVerified = user.EmailVerified
+	userDto.Disabled = user.Disabled
+
+	AuditService.Record(ctx, AuditUpdate, "user", user.Id, before, auditUser(user))
+
+	if emailChanged {
+		_ = sendVerification(ctx, user)
+	}
+
+	return userDto, nil
+}
+
+func (s *userService) UserLogin(ctx context.Context, loginDto dto.UserDto) (dto.LoginResultDto, error) {
+	ctx, span := tracing.Start(ctx, "UserService.UserLogin")
+	defer span.End()
+
+	key := loginKey(ctx, loginDto.Email)
+	end, err := beginLogin(ctx, key)
+
+	if err != nil {
+		return dto.LoginResultDto{}, err
+	}
+
+	defer end()
+
+	user, err := client.UserClient.GetUserByEmail(ctx, loginDto.Email)
+
+	if errors.Is(err, client.ErrNotFound) {
+		metrics.LoginFailures.WithLabelValues("user_not_registered").Inc()
+		log.Ctx(ctx).Warn("Login failed, user not registered")
+		loginFailed(ctx, key)
+		return dto.LoginResultDto{}, ErrUserNotRegistered
+	}
+
+	if err != nil {
+		return dto.LoginResultDto{}, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginDto.Password))
 	if err != nil {
 		// Passwords don't match
-		return loginDto, errors.New("incorrect password")
+		metrics.LoginFailures.WithLabelValues("incorrect_password").Inc()
+		log.Ctx(ctx).WithField("user_id", user.Id).Warn("Login failed, incorrect password")
+		loginFailed(ctx, key)
+		return dto.LoginResultDto{}, ErrIncorrectPassword
+	}
+
+	// Only told once the password matched, so it doesn't reveal the account
+	if user.Disabled {
+		metrics.LoginFailures.WithLabelValues("account_disabled").Inc()
+		log.Ctx(ctx).WithField("user_id", user.Id).Warn("Login failed, account disabled")
+		return dto.LoginResultDto{}, ErrAccountDisabled
+	}
+
+	challenge, err := mfaChallenge(ctx, user)
+
+	if err != nil {
+		return dto.LoginResultDto{}, err
+	}
+
+	// The attempts are only reset once the second factor checks out too
+	if challenge != nil {
+		log.Ctx(ctx).WithField("user_id", user.Id).Info("Login waiting for the second factor")
+		return dto.LoginResultDto{Challenge: challenge}, nil
+	}
+
+	loginSucceeded(ctx, user.Email)
+
+	return dto.LoginResultDto{User: loginUser(user)}, nil
+}
+
+// loginUser is the user returned by a successful login
+func loginUser(user model.User) dto.UserDto {
+	var userDto dto.UserDto
+
+	userDto.Id = user.Id
+	userDto.Name = user.Name
+	userDto.LastName = user.LastName
+	userDto.Dni = user.Dni
+	userDto.Email = user.Email
+	userDto.Role = user.Role
+	userDto.EmailVerified = user.EmailVerified
+	userDto.Disabled = user.Disabled
+	userDto.TokenVersion = user.TokenVersion
+	return userDto
+}
+
+// UpdateProfile changes the profile of a user on their own, the email is left
+// as it is, see RequestEmailChange
+func (s *userService) UpdateProfile(ctx context.Context, id int, profileDto dto.ProfileDto) (dto.UserDto, error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateProfile")
+	defer span.End()
+
+	user, err := client.UserClient.GetUserById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return dto.UserDto{}, ErrUserNotFound
+	}
+
+	if err != nil {
+		return dto.UserDto{}, err
+	}
+
+	return updateProfile(ctx, id, dto.UserProfileDto{
+		Name:     profileDto.Name,
+		LastName: profileDto.LastName,
+		Dni:      profileDto.Dni,
+		Email:    user.Email,
+	})
+}
+
+// ChangePassword replaces the password of the user once the current one is
+// confirmed, accounts without one set their first with the code mailed by
+// RequestConfirmation. The login tokens issued before, the one used to change
+// it too, stop working.
+func (s *userService) ChangePassword(ctx context.Context, id int, passwordDto dto.PasswordChangeDto) error {
+	ctx, span := tracing.Start(ctx, "UserService.ChangePassword")
+	defer span.End()
+
+	user, err := client.UserClient.GetUserById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := confirmUser(ctx, user, passwordDto.CurrentPassword, passwordDto.ConfirmationCode); err != nil {
+		return err
+	}
+
+	encryptedPassword, err := bcrypt.GenerateFromPassword([]byte(passwordDto.NewPassword), bcrypt.DefaultCost)
+
+	if err != nil {
+		return err
+	}
+
+	before := auditUser(user)
+	user.Password = string(encryptedPassword)
+
+	if err := client.UserClient.UpdatePassword(ctx, user.Id, user.Password); err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).WithField("user_id", user.Id).Info("Password changed")
+	AuditService.Record(ctx, AuditUpdate, "user", user.Id, before, auditUser(user))
+
+	// The change is done, the notice failing is only logged
+	_ = sendMail(ctx, "password_changed", user.Email, emailData{Name: user.Name})
+
+	return nil
+}
+
+// RequestEmailChange sends a link to the new email, the email of the user
+// changes once it is followed, see ConfirmEmailChange
+func (s *userService) RequestEmailChange(ctx context.Context, id int, emailDto dto.EmailChangeDto) error {
+	ctx, span := tracing.Start(ctx, "UserService.RequestEmailChange")
+	defer span.End()
+
+	user, err := client.UserClient.GetUserById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := confirmUser(ctx, user, emailDto.Password, emailDto.ConfirmationCode); err != nil {
+		return err
+	}
+
+	if strings.EqualFold(emailDto.Email, user.Email) {
+		return ErrEmailUnchanged
+	}
+
+	_, err = client.UserClient.GetUserByEmail(ctx, emailDto.Email)
+
+	if err == nil {
+		return ErrEmailRegistered
+	}
+
+	if !errors.Is(err, client.ErrNotFound) {
+		return err
+	}
+
+	token, err := issueToken(ctx, user.Id, TokenEmailChange, emailDto.Email, EmailVerificationTtl)
+
+	if err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).WithField("user_id", user.Id).Info("Email change requested")
+
+	return sendMail(ctx, "email_change", emailDto.Email, tokenEmail(user, emailDto.Email, "/confirm-email", token, EmailVerificationTtl))
+}
+
+// ConfirmEmailChange changes the email of the user the token was sent to, to
+// the address it was sent to. The previous address is told about the change.
+func (s *userService) ConfirmEmailChange(ctx context.Context, token string) (dto.UserDto, error) {
+	ctx, span := tracing.Start(ctx, "UserService.ConfirmEmailChange")
+	defer span.End()
+
+	var userDto dto.UserDto
+
+	userToken, err := redeemToken(ctx, TokenEmailChange, token)
+
+	if err != nil {
+		return userDto, err
+	}
+
+	user, err := client.UserClient.GetUserById(ctx, userToken.UserId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return userDto, ErrTokenInvalid
+	}
+
+	if err != nil {
+		return userDto, err
+	}
+
+	before := auditUser(user)
+	previousEmail := user.Email
+	user.Email = userToken.Email
+	user.EmailVerified = true
+
+	user, err = client.UserClient.UpdateUser(ctx, user)
+
+	if errors.Is(err, client.ErrConflict) {
+		return userDto, ErrEmailRegistered
+	}
+
+	if err != nil {
+		return userDto, err
+	}
+
+	log.Ctx(ctx).WithField("user_id", user.Id).Info("Email changed")
+	AuditService.Record(ctx, AuditUpdate, "user", user.Id, before, auditUser(user))
+
+	// The change is done, the notice failing is only logged
+	_ = sendMail(ctx, "email_changed", previousEmail, emailData{Name: user.Name, Email: user.Email})
+
+	userDto.Id = user.Id
+	userDto.Name = user.Name
+	userDto.LastName = user.LastName
+	userDto.Dni = user.Dni
+	userDto.Email = user.Email
+	userDto.Role = user.Role
+	userDto.EmailVerified = user.EmailVerified
+	userDto.Disabled = user.Disabled
+
+	return userDto, nil
+}
+
+// sendVerification mails the user a link confirming their email
+func sendVerification(ctx context.Context, user model.User) error {
+	token, err := issueToken(ctx, user.Id, TokenEmailVerification, user.Email, EmailVerificationTtl)
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).WithField("user_id", user.Id).Error("Failed to issue verification token")
+		return err
+	}
+
+	return sendMail(ctx, "verify_email", user.Email, tokenEmail(user, user.Email, "/verify-email", token, EmailVerificationTtl))
+}
+
+// RequestEmailVerification sends the link confirming the email of the user again
+func (s *userService) RequestEmailVerification(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "UserService.RequestEmailVerification")
+	defer span.End()
+
+	user, err := client.UserClient.GetUserById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if user.EmailVerified {
+		return ErrEmailVerified
+	}
+
+	return sendVerification(ctx, user)
+}
+
+// RequestConfirmation mails a code to users whose account has no password, as
+// those created through a login provider. It stands in for the password when
+// they change their account, see confirmUser.
+func (s *userService) RequestConfirmation(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "UserService.RequestConfirmation")
+	defer span.End()
+
+	user, err := client.UserClient.GetUserById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if user.Password != "" {
+		return ErrPasswordSet
 	}
 
+	token, err := issueToken(ctx, user.Id, TokenConfirmation, user.Email, ConfirmationTtl)
+
+	if err != nil {
+		log.Ctx(ctx).WithError(err).WithField("user_id", user.Id).Error("Failed to issue confirmation code")
+		return err
+	}
+
+	log.Ctx(ctx).WithField("user_id", user.Id).Info("Confirmation code requested")
+
+	return sendMail(ctx, "confirm_identity", user.Email, emailData{Name: user.Name, Code: token, ExpiresIn: readableDuration(ConfirmationTtl)})
+}
+
+// VerifyEmail marks the email the token was sent to as verified, as long as
+// it is still the email of the user
+func (s *userService) VerifyEmail(ctx context.Context, token string) (dto.UserDto, error) {
+	ctx, span := tracing.Start(ctx, "UserService.VerifyEmail")
+	defer span.End()
+
 	var userDto dto.UserDto
 
+	userToken, err := redeemToken(ctx, TokenEmailVerification, token)
+
+	if err != nil {
+		return userDto, err
+	}
+
+	user, err := client.UserClient.GetUserById(ctx, userToken.UserId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return userDto, ErrTokenInvalid
+	}
+
+	if err != nil {
+		return userDto, err
+	}
+
+	// The email changed since the link was sent
+	if user.Email != userToken.Email {
+		return userDto, ErrTokenInvalid
+	}
+
+	if !user.EmailVerified {
+		before := auditUser(user)
+		user.EmailVerified = true
+
+		user, err = client.UserClient.UpdateUser(ctx, user)
+
+		if err != nil {
+			return userDto, err
+		}
+
+		log.Ctx(ctx).WithField("user_id", user.Id).Info("Email verified")
+		AuditService.Record(ctx, AuditUpdate, "user", user.Id, before, auditUser(user))
+	}
+
 	userDto.Id = user.Id
 	userDto.Name = user.Name
 	userDto.LastName = user.LastName
 	userDto.Dni = user.Dni
 	userDto.Email = user.Email
 	userDto.Role = user.Role
+	userDto.EmailVerified = user.EmailVerified
+	userDto.Disabled = user.Disabled
+
 	return userDto, nil
 }
+
+// RequestPasswordReset mails a link to reset the password of the account with
+// the email given. Nothing tells whether there is one: unknown emails and
+// emails that couldn't be sent only show in the logs.
+func (s *userService) RequestPasswordReset(ctx context.Context, email string) error {
+	ctx, span := tracing.Start(ctx, "UserService.RequestPasswordReset")
+	defer span.End()
+
+	user, err := client.UserClient.GetUserByEmail(ctx, email)
+
+	if errors.Is(err, client.ErrNotFound) {
+		log.Ctx(ctx).Info("Password reset requested for an unknown email")
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// An admin has to enable the account first
+	if user.Disabled {
+		log.Ctx(ctx).WithField("user_id", user.Id).Info("Password reset requested for a disabled account")
+		return nil
+	}
+
+	token, err := issueToken(ctx, user.Id, TokenPasswordReset, user.Email, PasswordResetTtl)
+
+	if err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).WithField("user_id", user.Id).Info("Password reset requested")
+
+	_ = sendMail(ctx, "password_reset", user.Email, tokenEmail(user, user.Email, "/reset-password", token, PasswordResetTtl))
+
+	return nil
+}
+
+// ResetPassword replaces the password of the user the token was sent to. The
+// email it was sent to is verified by then, and the failed logins are forgotten.
+func (s *userService) ResetPassword(ctx context.Context, resetDto dto.PasswordResetDto) error {
+	ctx, span := tracing.Start(ctx, "UserService.ResetPassword")
+	defer span.End()
+
+	userToken, err := redeemToken(ctx, TokenPasswordReset, resetDto.Token)
+
+	if err != nil {
+		return err
+	}
+
+	user, err := client.UserClient.GetUserById(ctx, userToken.UserId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrTokenInvalid
+	}
+
+	if err != nil {
+		return err
+	}
+
+	encryptedPassword, err := bcrypt.GenerateFromPassword([]byte(resetDto.NewPassword), bcrypt.DefaultCost)
+
+	if err != nil {
+		return err
+	}
+
+	before := auditUser(user)
+	user.Password = string(encryptedPassword)
+
+	if err := client.UserClient.UpdatePassword(ctx, user.Id, user.Password); err != nil {
+		return err
+	}
+
+	if !user.EmailVerified && user.Email == userToken.Email {
+		user.EmailVerified = true
+
+		if _, err := client.UserClient.UpdateUser(ctx, user); err != nil {
+			log.Ctx(ctx).WithError(err).WithField("user_id", user.Id).Warn("Failed to verify email on password reset")
+			user.EmailVerified = false
+		}
+	}
+
+	if err := LoginAttempts.Reset(ctx, accountLoginKey(user.Email)); err != nil {
+		log.Ctx(ctx).WithError(err).Warn("Failed to reset login attempts")
+	}
+
+	log.Ctx(ctx).WithField("user_id", user.Id).Info("Password reset")
+	AuditService.Record(ctx, AuditUpdate, "user", user.Id, before, auditUser(user))
+
+	_ = sendMail(ctx, "password_changed", user.Email, emailData{Name: user.Name})
+
+	return nil
+}
+
+// DeleteAccount closes the account of a user once they confirm their password,
+// or the code mailed by RequestConfirmation when the account has none.
+// Their personal data is erased and their reservations are kept, the ones that
+// haven't ended keep the account from being deleted unless force is set, then
+// they are cancelled.
+func (s *userService) DeleteAccount(ctx context.Context, id int, deletionDto dto.AccountDeletionDto, force bool) error {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteAccount")
+	defer span.End()
+
+	user, err := client.UserClient.GetUserById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := confirmUser(ctx, user, deletionDto.Password, deletionDto.ConfirmationCode); err != nil {
+		return err
+	}
+
+	reservations, err := client.ReservationClient.GetReservationsByUser(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	active := activeReservations(reservations, time.Now())
+
+	if len(active) > 0 && !force {
+		return ErrUserHasReservations
+	}
+
+	// The email stays unique and can't receive mail, the empty password
+	// matches no login
+	user.Name = "Deleted"
+	user.LastName = "User"
+	user.Dni = ""
+	user.Email = fmt.Sprintf("deleted-%d@invalid", user.Id)
+	user.Password = ""
+
+	err = client.UserClient.AnonymizeUser(ctx, user, active)
+
+	if err != nil {
+		return err
+	}
+
+	metrics.ReservationsCancelled.Add(float64(len(active)))
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": user.Id, "cancelled": len(active)}).Info("Account deleted")
+
+	for _, reservation := range active {
+		AuditService.Record(ctx, AuditCancel, "reservation", reservation.Id, auditReservation(reservation), nil)
+	}
+	AuditService.Record(ctx, AuditAnonymize, "user", user.Id, nil, nil)
+
+	return nil
+}
+
+// DeleteUser soft deletes the user. Their reservations that haven't ended yet
+// keep them from being deleted unless force is set, then they are cancelled too.
+func (s *userService) DeleteUser(ctx context.Context, id int, force bool) error {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteUser")
+	defer span.End()
+
+	identity, err := authorize(ctx, auth.ManageUsers)
+
+	if err != nil {
+		return err
+	}
+
+	if identity.UserId == id {
+		return ErrOwnAccount
+	}
+
+	user, err := client.UserClient.GetUserById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	reservations, err := client.ReservationClient.GetReservationsByUser(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	active := activeReservations(reservations, time.Now())
+
+	if len(active) > 0 && !force {
+		return ErrUserHasReservations
+	}
+
+	err = client.UserClient.DeleteUser(ctx, user, active)
+
+	if err != nil {
+		return err
+	}
+
+	metrics.ReservationsCancelled.Add(float64(len(active)))
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": user.Id, "cancelled": len(active)}).Info("User deleted")
+
+	for _, reservation := range active {
+		AuditService.Record(ctx, AuditCancel, "reservation", reservation.Id, auditReservation(reservation), nil)
+	}
+	AuditService.Record(ctx, AuditDelete, "user", user.Id, auditUser(user), nil)
+
+	return nil
+}
+
+func (s *userService) GetDeletedUsers(ctx context.Context) (dto.DeletedUsersDto, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetDeletedUsers")
+	defer span.End()
+
+	var usersDto dto.DeletedUsersDto
+
+	if _, err := authorize(ctx, auth.ManageDeleted); err != nil {
+		return usersDto, err
+	}
+
+	users, err := client.UserClient.GetDeletedUsers(ctx)
+
+	if err != nil {
+		return usersDto, err
+	}
+
+	for _, user := range users {
+		var userDto dto.DeletedUserDto
+		userDto.Id = user.Id
+		userDto.Name = user.Name
+		userDto.LastName = user.LastName
+		userDto.Dni = user.Dni
+		userDto.Email = user.Email
+		userDto.Role = user.Role
+		userDto.EmailVerified = user.EmailVerified
+		userDto.Disabled = user.Disabled
+		userDto.DeletedAt = user.DeletedAt.Time
+
+		usersDto = append(usersDto, userDto)
+	}
+
+	return usersDto, nil
+}
+
+func (s *userService) RestoreUser(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "UserService.RestoreUser")
+	defer span.End()
+
+	if _, err := authorize(ctx, auth.ManageDeleted); err != nil {
+		return err
+	}
+
+	err := client.UserClient.RestoreUser(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).WithField("user_id", id).Info("User restored")
+	AuditService.Record(ctx, AuditRestore, "user", id, nil, nil)
+
+	return nil
+}
+
+// SetRole changes the role of another user, admins can't change their own so
+// there is always one left
+func (s *userService) SetRole(ctx context.Context, id int, role string) (dto.UserDto, error) {
+	ctx, span := tracing.Start(ctx, "UserService.SetRole")
+	defer span.End()
+
+	identity, err := authorize(ctx, auth.ManageUsers)
+
+	if err != nil {
+		return dto.UserDto{}, err
+	}
+
+	if !auth.ValidRole(role) {
+		return dto.UserDto{}, ErrUnknownRole
+	}
+
+	if identity.UserId == id {
+		return dto.UserDto{}, ErrOwnAccount
+	}
+
+	return updateUser(ctx, id, func(user *model.User) error {
+		user.Role = role
+		return client.UserClient.UpdateRole(ctx, id, role)
+	})
+}
+
+// SetDisabled disables another user, who can't log in until they are enabled
+// again, or enables them
+func (s *userService) SetDisabled(ctx context.Context, id int, disabled bool) (dto.UserDto, error) {
+	ctx, span := tracing.Start(ctx, "UserService.SetDisabled")
+	defer span.End()
+
+	identity, err := authorize(ctx, auth.ManageUsers)
+
+	if err != nil {
+		return dto.UserDto{}, err
+	}
+
+	if identity.UserId == id {
+		return dto.UserDto{}, ErrOwnAccount
+	}
+
+	return updateUser(ctx, id, func(user *model.User) error {
+		user.Disabled = disabled
+		return client.UserClient.UpdateDisabled(ctx, id, disabled)
+	})
+}
+
+// BootstrapAdmin makes the registered user with the email an admin, as long as
+// there is no admin yet. It runs from the command line, without an identity.
+func (s *userService) BootstrapAdmin(ctx context.Context, email string) (dto.UserDto, error) {
+	ctx, span := tracing.Start(ctx, "UserService.BootstrapAdmin")
+	defer span.End()
+
+	admins, err := client.UserClient.CountActiveUsersByRole(ctx, auth.RoleAdmin)
+
+	if err != nil {
+		return dto.UserDto{}, err
+	}
+
+	if admins > 0 {
+		return dto.UserDto{}, ErrAdminExists
+	}
+
+	user, err := client.UserClient.GetUserByEmail(ctx, email)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return dto.UserDto{}, ErrUserNotFound
+	}
+
+	if err != nil {
+		return dto.UserDto{}, err
+	}
+
+	return updateUser(ctx, user.Id, func(user *model.User) error {
+		if err := client.UserClient.UpdateRole(ctx, user.Id, auth.RoleAdmin); err != nil {
+			return err
+		}
+
+		user.Role = auth.RoleAdmin
+		user.Disabled = false
+
+		return client.UserClient.UpdateDisabled(ctx, user.Id, false)
+	})
+}
+
+// updateUser applies a change made by an admin to the user and records it
+func updateUser(ctx context.Context, id int, change func(user *model.User) error) (dto.UserDto, error) {
+	user, err := client.UserClient.GetUserById(ctx, id)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return dto.UserDto{}, ErrUserNotFound
+	}
+
+	if err != nil {
+		return dto.UserDto{}, err
+	}
+
+	before := auditUser(user)
+
+	if err := change(&user); err != nil {
+		return dto.UserDto{}, err
+	}
+
+	log.Ctx(ctx).WithFields(logrus.Fields{"user_id": user.Id, "role": user.Role, "disabled": user.Disabled}).Info("User administered")
+	AuditService.Record(ctx, AuditUpdate, "user", user.Id, before, auditUser(user))
+
+	return dto.UserDto{
+		Id:       user.Id,
+		Name:     user.Name,
+		LastName: user.LastName,
+		Dni:      user.Dni,
+		Email:    user.Email,
+		Role:     user.Role,
+
+		EmailVerified: user.EmailVerified,
+		Disabled:      user.Disabled,
+	}, nil
+}
+
+// Authenticate checks the account a login token was issued to is still
+// active, and returns the identity with the role it has now. Role changes and
+// disabled accounts take effect on the tokens already issued, and a new
+// password revokes them.
+func (s *userService) Authenticate(ctx context.Context, identity auth.Identity) (auth.Identity, error) {
+	ctx, span := tracing.Start(ctx, "UserService.Authenticate")
+	defer span.End()
+
+	user, err := client.UserClient.GetUserById(ctx, identity.UserId)
+
+	if errors.Is(err, client.ErrNotFound) {
+		return identity, ErrUserNotFound
+	}
+
+	if err != nil {
+		return identity, err
+	}
+
+	if user.Disabled {
+		return identity, ErrAccountDisabled
+	}
+
+	if identity.TokenVersion != user.TokenVersion {
+		return identity, ErrTokenRevoked
+	}
+
+	identity.Role = user.Role
+
+	return identity, nil
+}
@@ -1,12 +1,22 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"project/auth"
 	"project/client"
 	"project/dto"
+	"project/mail"
+	"project/metrics"
 	"project/model"
+	"project/ratelimit"
 	"testing"
+	"time"
 )
 
 type TestUser struct{}
@@ -15,46 +25,50 @@ func init() {
 	client.UserClient = &TestUser{}
 }
 
-func (t TestUser) InsertUser(user model.User) model.User {
+func (t TestUser) InsertUser(ctx context.Context, user model.User) (model.User, error) {
 
 	if user.Name == "" {
-		user.Id = 0
-	} else {
-		user.Id = 1
+		return user, errors.New("error creating user")
 	}
 
-	return user
+	if user.Email == "taken@email.com" {
+		return user, client.ErrConflict
+	}
+
+	user.Id = 1
+
+	return user, nil
 }
 
-func (t TestUser) GetUserById(id int) model.User {
+func (t TestUser) GetUserById(ctx context.Context, id int) (model.User, error) {
 	var user model.User
 
 	if id > 10 {
-		user.Id = 0
-	} else {
-		user.Id = id
+		return user, client.ErrNotFound
 	}
 
-	return user
+	user.Id = id
+
+	return user, nil
 }
 
-func (t TestUser) GetUserByEmail(email string) model.User {
+func (t TestUser) GetUserByEmail(ctx context.Context, email string) (model.User, error) {
 	var user model.User
 
 	if email == "" {
-		user.Id = 0
-	} else {
-		user.Id = 1
-		user.Email = email
-
-		encryptedPassword, _ := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.DefaultCost)
-		user.Password = string(encryptedPassword)
+		return user, client.ErrNotFound
 	}
 
-	return user
+	user.Id = 1
+	user.Email = email
+
+	encryptedPassword, _ := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.DefaultCost)
+	user.Password = string(encryptedPassword)
+
+	return user, nil
 }
 
-func (t TestUser) GetUsers() model.Users {
+func (t TestUser) GetUsers(ctx context.Context) (model.Users, error) {
 
 	return model.Users{
 		model.User{
@@ -76,7 +90,172 @@ func (t TestUser) GetUsers() model.Users {
 			Password: "password2",
 			Role:     "Customer",
 		},
+	}, nil
+}
+
+func (t TestUser) UpdateUser(ctx context.Context, user model.User) (model.User, error) {
+
+	if user.Email == "taken@email.com" {
+		return user, client.ErrConflict
+	}
+
+	return user, nil
+}
+
+func (t TestUser) UpdatePassword(ctx context.Context, id int, password string) error {
+	return nil
+}
+
+func (t TestUser) UpdateRole(ctx context.Context, id int, role string) error {
+	return nil
+}
+
+func (t TestUser) UpdateDisabled(ctx context.Context, id int, disabled bool) error {
+	return nil
+}
+
+func (t TestUser) CountActiveUsersByRole(ctx context.Context, role string) (int64, error) {
+	return 0, nil
+}
+
+func (t TestUser) AnonymizeUser(ctx context.Context, user model.User, cancelled model.Reservations) error {
+	return nil
+}
+
+func (t TestUser) DeleteUser(ctx context.Context, user model.User, cancelled model.Reservations) error {
+	return nil
+}
+
+func (t TestUser) GetDeletedUsers(ctx context.Context) (model.Users, error) {
+
+	return model.Users{
+		model.User{
+			Id:        3,
+			Name:      "Jim",
+			Email:     "jim@email.com",
+			Password:  "password3",
+			DeletedAt: gorm.DeletedAt{Time: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), Valid: true},
+		},
+	}, nil
+}
+
+func (t TestUser) RestoreUser(ctx context.Context, id int) error {
+	if id > 10 {
+		return client.ErrNotFound
+	}
+
+	return nil
+}
+
+func (t TestUser) PurgeUsers(ctx context.Context, before time.Time) (int64, error) {
+	return 2, nil
+}
+
+// TestAccounts serves the users it holds and keeps the changes made to them
+type TestAccounts struct {
+	TestUser
+	users     map[int]model.User
+	cancelled model.Reservations
+}
+
+// newTestAccounts holds users 1 and 7, both with password "password1". User 7
+// has a verified email and a reservation that hasn't ended.
+func newTestAccounts(t *testing.T) *TestAccounts {
+	encryptedPassword, _ := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.MinCost)
+	mock := &TestAccounts{users: map[int]model.User{}}
+
+	users := model.Users{
+		{Id: 1, Name: "John", LastName: "Doe", Dni: "12345678", Email: "john@email.com", Role: "Customer"},
+		{Id: 7, Name: "Jane", LastName: "Doe", Dni: "87654321", Email: "jane@email.com", Role: "Customer", EmailVerified: true},
+	}
+
+	for _, user := range users {
+		user.Password = string(encryptedPassword)
+		mock.users[user.Id] = user
+	}
+
+	previous := client.UserClient
+	client.UserClient = mock
+	LoginAttempts = ratelimit.NewMemoryStore()
+	t.Cleanup(func() { client.UserClient = previous })
+
+	return mock
+}
+
+func (t *TestAccounts) GetUserById(ctx context.Context, id int) (model.User, error) {
+	user, ok := t.users[id]
+
+	if !ok {
+		return user, client.ErrNotFound
 	}
+
+	return user, nil
+}
+
+func (t *TestAccounts) GetUserByEmail(ctx context.Context, email string) (model.User, error) {
+	for _, user := range t.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+
+	return model.User{}, client.ErrNotFound
+}
+
+func (t *TestAccounts) UpdateUser(ctx context.Context, user model.User) (model.User, error) {
+	for _, other := range t.users {
+		if other.Id != user.Id && other.Email == user.Email {
+			return user, client.ErrConflict
+		}
+	}
+
+	t.users[user.Id] = user
+
+	return user, nil
+}
+
+func (t *TestAccounts) UpdatePassword(ctx context.Context, id int, password string) error {
+	user := t.users[id]
+	user.Password = password
+	user.TokenVersion++
+	t.users[id] = user
+
+	return nil
+}
+
+func (t *TestAccounts) UpdateRole(ctx context.Context, id int, role string) error {
+	user := t.users[id]
+	user.Role = role
+	t.users[id] = user
+
+	return nil
+}
+
+func (t *TestAccounts) UpdateDisabled(ctx context.Context, id int, disabled bool) error {
+	user := t.users[id]
+	user.Disabled = disabled
+	t.users[id] = user
+
+	return nil
+}
+
+func (t *TestAccounts) CountActiveUsersByRole(ctx context.Context, role string) (int64, error) {
+	var count int64
+
+	for _, user := range t.users {
+		if user.Role == role && !user.Disabled {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (t *TestAccounts) AnonymizeUser(ctx context.Context, user model.User, cancelled model.Reservations) error {
+	t.users[user.Id] = user
+	t.cancelled = cancelled
+
+	return nil
 }
 
 func TestInsertUser_Service_Error(t *testing.T) {
@@ -84,7 +263,7 @@ func TestInsertUser_Service_Error(t *testing.T) {
 	a := assert.New(t)
 	var user dto.UserDto
 
-	_, err := UserService.InsertUser(user)
+	_, err := UserService.InsertUser(context.Background(), user)
 
 	expectedResponse := "error creating user"
 
@@ -92,6 +271,19 @@ func TestInsertUser_Service_Error(t *testing.T) {
 	a.Equal(expectedResponse, err.Error())
 }
 
+func TestInsertUser_Service_Conflict(t *testing.T) {
+
+	a := assert.New(t)
+	user := dto.UserDto{Name: "John", Email: "taken@email.com", Password: "password1"}
+
+	_, err := UserService.InsertUser(context.Background(), user)
+
+	expectedResponse := "email already registered"
+
+	a.ErrorIs(err, ErrConflict)
+	a.Equal(expectedResponse, err.Error())
+}
+
 func TestInsertUser_Service_Success(t *testing.T) {
 
 	a := assert.New(t)
@@ -103,7 +295,7 @@ func TestInsertUser_Service_Success(t *testing.T) {
 		Password: "password1",
 	}
 
-	result, err := UserService.InsertUser(user)
+	result, err := UserService.InsertUser(context.Background(), user)
 
 	a.Nil(err)
 	a.NotEqual(user, result)
@@ -119,11 +311,11 @@ func TestGetUserById_Service_NotFound(t *testing.T) {
 
 	a := assert.New(t)
 
-	_, err := UserService.GetUserById(12)
+	_, err := UserService.GetUserById(adminCtx, 12)
 
 	expectedResponse := "user not found"
 
-	a.NotNil(err)
+	a.ErrorIs(err, ErrNotFound)
 	a.Equal(expectedResponse, err.Error())
 }
 
@@ -131,7 +323,7 @@ func TestGetUserById_Service_Found(t *testing.T) {
 
 	a := assert.New(t)
 
-	result, err := UserService.GetUserById(1)
+	result, err := UserService.GetUserById(adminCtx, 1)
 
 	expectedResponse := dto.UserDto{Id: 1}
 
@@ -143,7 +335,7 @@ func TestGetUsers_Service(t *testing.T) {
 
 	a := assert.New(t)
 
-	result, err := UserService.GetUsers()
+	result, err := UserService.GetUsers(adminCtx)
 
 	expectedResponse := dto.UsersDto{
 		dto.UserDto{
@@ -172,9 +364,10 @@ func TestGetUsers_Service(t *testing.T) {
 func TestUserLogin_Service_NotRegistered(t *testing.T) {
 
 	a := assert.New(t)
+	LoginAttempts = ratelimit.NewMemoryStore()
 	var user dto.UserDto
 
-	_, err := UserService.UserLogin(user)
+	_, err := UserService.UserLogin(context.Background(), user)
 
 	expectedResponse := "user not registered"
 
@@ -185,25 +378,639 @@ func TestUserLogin_Service_NotRegistered(t *testing.T) {
 func TestUserLogin_Service_IncorrectPassword(t *testing.T) {
 
 	a := assert.New(t)
+	LoginAttempts = ratelimit.NewMemoryStore()
 	user := dto.UserDto{Email: "email@email.com", Password: "password"}
 
-	_, err := UserService.UserLogin(user)
+	failures := metrics.LoginFailures.WithLabelValues("incorrect_password")
+	before := testutil.ToFloat64(failures)
+
+	_, err := UserService.UserLogin(context.Background(), user)
 
 	expectedResponse := "incorrect password"
 
 	a.NotNil(err)
 	a.Equal(expectedResponse, err.Error())
+	a.Equal(before+1, testutil.ToFloat64(failures))
 }
 
 func TestUserLogin_Service_Success(t *testing.T) {
 
 	a := assert.New(t)
+	LoginAttempts = ratelimit.NewMemoryStore()
 	user := dto.UserDto{Email: "email@email.com", Password: "password1"}
 
-	result, err := UserService.UserLogin(user)
+	result, err := UserService.UserLogin(context.Background(), user)
 
 	expectedResponse := dto.UserDto{Id: 1, Email: user.Email}
 
 	a.Nil(err)
-	a.Equal(expectedResponse, result)
+	a.Equal(expectedResponse, result.User)
+	a.Nil(result.Challenge)
+}
+
+func TestUpdateUser_Service(t *testing.T) {
+	a := assert.New(t)
+
+	profile := dto.UserProfileDto{Name: "John", LastName: "Doe", Dni: "12345678", Email: "john@email.com"}
+
+	result, err := UserService.UpdateUser(adminCtx, 1, profile)
+
+	a.Nil(err)
+	a.Equal(dto.UserDto{Id: 1, Name: "John", LastName: "Doe", Dni: "12345678", Email: "john@email.com"}, result)
+
+	profile.Email = "taken@email.com"
+	_, err = UserService.UpdateUser(adminCtx, 1, profile)
+	a.ErrorIs(err, ErrEmailRegistered)
+
+	_, err = UserService.UpdateUser(adminCtx, 11, profile)
+	a.ErrorIs(err, ErrUserNotFound)
+}
+
+func TestUpdateUser_Service_Owner(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+	ctx := asUser(1, auth.RoleCustomer)
+
+	result, err := UserService.UpdateUser(ctx, 1, dto.UserProfileDto{Name: "Johnny", LastName: "Doe", Dni: "12345678", Email: "john@email.com"})
+	a.Nil(err)
+	a.Equal("Johnny", result.Name)
+
+	// The new email has to be confirmed first
+	_, err = UserService.UpdateUser(ctx, 1, dto.UserProfileDto{Name: "Johnny", LastName: "Doe", Dni: "12345678", Email: "thief@email.com"})
+	a.ErrorIs(err, ErrEmailUnconfirmed)
+	a.Equal("john@email.com", mock.users[1].Email)
+}
+
+func TestDeleteUser_Service(t *testing.T) {
+
+	a := assert.New(t)
+
+	a.ErrorIs(UserService.DeleteUser(adminCtx, 12, false), ErrUserNotFound)
+	a.Nil(UserService.DeleteUser(adminCtx, 1, false))
+
+	// User 7 has a reservation that hasn't ended
+	a.ErrorIs(UserService.DeleteUser(adminCtx, 7, false), ErrUserHasReservations)
+	a.Nil(UserService.DeleteUser(adminCtx, 7, true))
+}
+
+func TestGetDeletedUsers_Service(t *testing.T) {
+
+	a := assert.New(t)
+
+	result, err := UserService.GetDeletedUsers(adminCtx)
+
+	a.Nil(err)
+	a.Len(result, 1)
+	a.Equal("jim@email.com", result[0].Email)
+	a.Empty(result[0].Password)
+	a.Equal(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), result[0].DeletedAt)
+}
+
+func TestRestoreUser_Service(t *testing.T) {
+
+	a := assert.New(t)
+
+	a.Nil(UserService.RestoreUser(adminCtx, 3))
+	a.ErrorIs(UserService.RestoreUser(adminCtx, 12), ErrUserNotFound)
+}
+
+func TestUpdateProfile_Service(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+
+	result, err := UserService.UpdateProfile(context.Background(), 1, dto.ProfileDto{Name: "Johnny", LastName: "Doe", Dni: "12345679"})
+
+	a.Nil(err)
+	a.Equal(dto.UserDto{Id: 1, Name: "Johnny", LastName: "Doe", Dni: "12345679", Email: "john@email.com", Role: "Customer"}, result)
+	a.Equal("Johnny", mock.users[1].Name)
+
+	_, err = UserService.UpdateProfile(context.Background(), 12, dto.ProfileDto{Name: "Johnny"})
+	a.ErrorIs(err, ErrUserNotFound)
+}
+
+func TestChangePassword_Service(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+	audit := newTestAudit(t)
+
+	err := UserService.ChangePassword(context.Background(), 1, dto.PasswordChangeDto{CurrentPassword: "wrong", NewPassword: "Password2!"})
+	a.ErrorIs(err, ErrCurrentPasswordIncorrect)
+
+	LoginAttempts = ratelimit.NewMemoryStore()
+	err = UserService.ChangePassword(context.Background(), 1, dto.PasswordChangeDto{CurrentPassword: "password1", NewPassword: "Password2!"})
+	a.Nil(err)
+	a.Nil(bcrypt.CompareHashAndPassword([]byte(mock.users[1].Password), []byte("Password2!")))
+
+	a.Len(audit.entries, 1)
+	a.Equal(`{"password":{"before":"[REDACTED]","after":"[REDACTED]"}}`, audit.entries[0].Changes)
+}
+
+func TestChangePassword_Service_Passwordless(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+	newTestToken(t)
+	mailer := newTestMailer(t)
+
+	// Accounts created through a login provider have no password
+	user := mock.users[1]
+	user.Password = ""
+	mock.users[1] = user
+
+	err := UserService.ChangePassword(context.Background(), 1, dto.PasswordChangeDto{CurrentPassword: "", NewPassword: "Password2!"})
+	a.ErrorIs(err, ErrConfirmationRequired)
+
+	// A code mailed to another account doesn't confirm this one
+	a.ErrorIs(UserService.RequestConfirmation(context.Background(), 7), ErrPasswordSet)
+
+	a.Nil(UserService.RequestConfirmation(context.Background(), 1))
+
+	messages := mailer.Messages()
+	a.Len(messages, 1)
+	a.Equal("john@email.com", messages[0].To)
+	a.Equal("Confirm it's you", messages[0].Subject)
+
+	code := mailedCode(t, messages[0])
+
+	err = UserService.ChangePassword(context.Background(), 1, dto.PasswordChangeDto{ConfirmationCode: code, NewPassword: "Password2!"})
+	a.Nil(err)
+	a.Nil(bcrypt.CompareHashAndPassword([]byte(mock.users[1].Password), []byte("Password2!")))
+
+	// The code is used once, and with a password set it is no longer taken
+	a.ErrorIs(UserService.RequestConfirmation(context.Background(), 1), ErrPasswordSet)
+
+	err = UserService.ChangePassword(context.Background(), 1, dto.PasswordChangeDto{ConfirmationCode: code, NewPassword: "Password3!"})
+	a.ErrorIs(err, ErrCurrentPasswordIncorrect)
+}
+
+func TestDeleteAccount_Service_Passwordless(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+	newTestAudit(t)
+	newTestToken(t)
+	mailer := newTestMailer(t)
+
+	for _, id := range []int{1, 7} {
+		user := mock.users[id]
+		user.Password = ""
+		mock.users[id] = user
+	}
+
+	a.Nil(UserService.RequestConfirmation(context.Background(), 7))
+	otherCode := mailedCode(t, mailer.Messages()[0])
+
+	a.ErrorIs(UserService.DeleteAccount(context.Background(), 1, dto.AccountDeletionDto{ConfirmationCode: otherCode}, false), ErrTokenInvalid)
+	a.ErrorIs(UserService.DeleteAccount(context.Background(), 1, dto.AccountDeletionDto{ConfirmationCode: "unknown"}, false), ErrTokenInvalid)
+
+	a.Nil(UserService.RequestConfirmation(context.Background(), 1))
+	code := mailedCode(t, mailer.Messages()[1])
+
+	a.Nil(UserService.DeleteAccount(context.Background(), 1, dto.AccountDeletionDto{ConfirmationCode: code}, false))
+	a.Equal("deleted-1@invalid", mock.users[1].Email)
+}
+
+func TestChangePassword_Service_Lockout(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAccounts(t)
+
+	// Wrong passwords count towards the login lockout of the account
+	_ = UserService.ChangePassword(context.Background(), 1, dto.PasswordChangeDto{CurrentPassword: "wrong", NewPassword: "Password2!"})
+
+	err := UserService.ChangePassword(context.Background(), 1, dto.PasswordChangeDto{CurrentPassword: "password1", NewPassword: "Password2!"})
+	a.ErrorIs(err, ErrLoginThrottled)
+}
+
+func TestRequestEmailChange_Service(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+	newTestToken(t)
+
+	mailer := newTestMailer(t)
+
+	err := UserService.RequestEmailChange(context.Background(), 1, dto.EmailChangeDto{Email: "johnny@email.com", Password: "password1"})
+	a.Nil(err)
+
+	// Nothing changes until the new email is confirmed
+	a.Equal("john@email.com", mock.users[1].Email)
+
+	messages := mailer.Messages()
+	a.Len(messages, 1)
+	a.Equal("johnny@email.com", messages[0].To)
+
+	a.Equal("Confirm your new email", messages[0].Subject)
+
+	token := mailedToken(t, messages[0])
+
+	result, err := UserService.ConfirmEmailChange(context.Background(), token)
+	a.Nil(err)
+	a.Equal("johnny@email.com", result.Email)
+	a.True(result.EmailVerified)
+	a.Equal("johnny@email.com", mock.users[1].Email)
+
+	// The previous email is told about the change
+	messages = mailer.Messages()
+	a.Len(messages, 2)
+	a.Equal("john@email.com", messages[1].To)
+
+	_, err = UserService.ConfirmEmailChange(context.Background(), token)
+	a.ErrorIs(err, ErrTokenInvalid)
+}
+
+func TestRequestEmailChange_Service_Rejected(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAccounts(t)
+	newTestToken(t)
+
+	err := UserService.RequestEmailChange(context.Background(), 1, dto.EmailChangeDto{Email: "jane@email.com", Password: "password1"})
+	a.ErrorIs(err, ErrEmailRegistered)
+
+	err = UserService.RequestEmailChange(context.Background(), 1, dto.EmailChangeDto{Email: "John@email.com", Password: "password1"})
+	a.ErrorIs(err, ErrEmailUnchanged)
+
+	// Without a mailer the change can't be confirmed
+	err = UserService.RequestEmailChange(context.Background(), 1, dto.EmailChangeDto{Email: "johnny@email.com", Password: "password1"})
+	a.ErrorIs(err, ErrMailUnavailable)
+
+	LoginAttempts = ratelimit.NewMemoryStore()
+	err = UserService.RequestEmailChange(context.Background(), 1, dto.EmailChangeDto{Email: "johnny@email.com", Password: "wrong"})
+	a.ErrorIs(err, ErrCurrentPasswordIncorrect)
+}
+
+func TestConfirmEmailChange_Service_Taken(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+	newTestToken(t)
+
+	token, _ := issueToken(context.Background(), 1, TokenEmailChange, "jane@email.com", time.Hour)
+
+	// Someone else registered the email after the change was requested
+	_, err := UserService.ConfirmEmailChange(context.Background(), token)
+	a.ErrorIs(err, ErrEmailRegistered)
+	a.Equal("john@email.com", mock.users[1].Email)
+}
+
+func TestDeleteAccount_Service(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+	audit := newTestAudit(t)
+
+	a.ErrorIs(UserService.DeleteAccount(context.Background(), 1, dto.AccountDeletionDto{Password: "wrong"}, false), ErrCurrentPasswordIncorrect)
+
+	LoginAttempts = ratelimit.NewMemoryStore()
+	a.Nil(UserService.DeleteAccount(context.Background(), 1, dto.AccountDeletionDto{Password: "password1"}, false))
+
+	user := mock.users[1]
+	a.Equal("Deleted", user.Name)
+	a.Equal("User", user.LastName)
+	a.Empty(user.Dni)
+	a.Equal("deleted-1@invalid", user.Email)
+	a.Empty(user.Password)
+	a.Empty(mock.cancelled)
+
+	// The audit log doesn't keep the erased data
+	a.Len(audit.entries, 1)
+	a.Equal(AuditAnonymize, audit.entries[0].Action)
+	a.Empty(audit.entries[0].Changes)
+}
+
+func TestDeleteAccount_Service_AuditExport(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAccounts(t)
+	newTestAudit(t)
+
+	_, err := UserService.UpdateUser(adminCtx, 1, dto.UserProfileDto{Name: "Johnny", LastName: "Doe", Dni: "12345679", Email: "johnny@email.com"})
+	a.Nil(err)
+
+	LoginAttempts = ratelimit.NewMemoryStore()
+	a.Nil(UserService.DeleteAccount(context.Background(), 1, dto.AccountDeletionDto{Password: "password1"}, false))
+
+	// The changes are still told apart, without the data of the deleted user
+	var entries dto.AuditEntriesDto
+
+	err = AuditService.ExportAuditEntries(adminCtx, dto.AuditFilterDto{Entity: "user"}, func(entryDto dto.AuditEntryDto) error {
+		entries = append(entries, entryDto)
+		return nil
+	})
+	a.Nil(err)
+	a.Len(entries, 2)
+
+	content, _ := json.Marshal(entries)
+	a.Contains(string(content), `"email":{"before":"[REDACTED]","after":"[REDACTED]"}`)
+
+	for _, value := range []string{"John", "Doe", "12345678", "12345679", "john@email.com", "johnny@email.com"} {
+		a.NotContains(string(content), value)
+	}
+}
+
+func TestDeleteAccount_Service_Reservations(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+
+	// User 7 has a reservation that hasn't ended
+	a.ErrorIs(UserService.DeleteAccount(context.Background(), 7, dto.AccountDeletionDto{Password: "password1"}, false), ErrUserHasReservations)
+	a.Equal("jane@email.com", mock.users[7].Email)
+
+	a.Nil(UserService.DeleteAccount(context.Background(), 7, dto.AccountDeletionDto{Password: "password1"}, true))
+	a.Len(mock.cancelled, 1)
+	a.Equal("deleted-7@invalid", mock.users[7].Email)
+}
+
+func TestInsertUser_Service_Verification(t *testing.T) {
+
+	a := assert.New(t)
+	newTestToken(t)
+	mailer := newTestMailer(t)
+
+	_, err := UserService.InsertUser(context.Background(), dto.UserDto{Name: "John", Email: "john@email.com", Password: "Password1!"})
+	a.Nil(err)
+
+	messages := mailer.Messages()
+	a.Len(messages, 1)
+	a.Equal("john@email.com", messages[0].To)
+	a.Equal("Confirm your email", messages[0].Subject)
+	a.Contains(messages[0].HTML, "/verify-email?token=")
+
+	// Signing up doesn't depend on the email being sent
+	Mailer = mail.Disabled{}
+
+	_, err = UserService.InsertUser(context.Background(), dto.UserDto{Name: "John", Email: "john@email.com", Password: "Password1!"})
+	a.Nil(err)
+}
+
+func TestVerifyEmail_Service(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+	newTestToken(t)
+	mailer := newTestMailer(t)
+
+	a.ErrorIs(UserService.RequestEmailVerification(context.Background(), 7), ErrEmailVerified)
+	a.ErrorIs(UserService.RequestEmailVerification(context.Background(), 12), ErrUserNotFound)
+
+	a.Nil(UserService.RequestEmailVerification(context.Background(), 1))
+	a.Nil(UserService.RequestEmailVerification(context.Background(), 1))
+
+	messages := mailer.Messages()
+	a.Len(messages, 2)
+
+	// Only the last link sent works
+	_, err := UserService.VerifyEmail(context.Background(), mailedToken(t, messages[0]))
+	a.ErrorIs(err, ErrTokenInvalid)
+
+	result, err := UserService.VerifyEmail(context.Background(), mailedToken(t, messages[1]))
+	a.Nil(err)
+	a.True(result.EmailVerified)
+	a.True(mock.users[1].EmailVerified)
+
+	_, err = UserService.VerifyEmail(context.Background(), mailedToken(t, messages[1]))
+	a.ErrorIs(err, ErrTokenInvalid)
+}
+
+func TestVerifyEmail_Service_EmailChanged(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+	newTestToken(t)
+
+	token, _ := issueToken(context.Background(), 1, TokenEmailVerification, "john@email.com", time.Hour)
+
+	// The email changed after the link was sent
+	_, err := UserService.UpdateUser(adminCtx, 1, dto.UserProfileDto{Name: "John", LastName: "Doe", Dni: "12345678", Email: "johnny@email.com"})
+	a.Nil(err)
+
+	_, err = UserService.VerifyEmail(context.Background(), token)
+	a.ErrorIs(err, ErrTokenInvalid)
+	a.False(mock.users[1].EmailVerified)
+}
+
+func TestUpdateUser_Service_EmailUnverified(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+	newTestToken(t)
+	mailer := newTestMailer(t)
+
+	result, err := UserService.UpdateUser(adminCtx, 7, dto.UserProfileDto{Name: "Jane", LastName: "Smith", Dni: "87654321", Email: "jane@email.com"})
+	a.Nil(err)
+	a.True(result.EmailVerified)
+	a.Empty(mailer.Messages())
+
+	result, err = UserService.UpdateUser(adminCtx, 7, dto.UserProfileDto{Name: "Jane", LastName: "Smith", Dni: "87654321", Email: "janes@email.com"})
+	a.Nil(err)
+	a.False(result.EmailVerified)
+	a.False(mock.users[7].EmailVerified)
+
+	// The new email is sent a link to verify it
+	messages := mailer.Messages()
+	a.Len(messages, 1)
+	a.Equal("janes@email.com", messages[0].To)
+}
+
+func TestPasswordReset_Service(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+	newTestToken(t)
+	mailer := newTestMailer(t)
+	ctx := context.Background()
+
+	// Unknown emails get the same answer and no email
+	a.Nil(UserService.RequestPasswordReset(ctx, "nobody@email.com"))
+	a.Empty(mailer.Messages())
+
+	a.Nil(UserService.RequestPasswordReset(ctx, "john@email.com"))
+
+	messages := mailer.Messages()
+	a.Len(messages, 1)
+	a.Equal("john@email.com", messages[0].To)
+	a.Equal("Reset your password", messages[0].Subject)
+	a.Contains(messages[0].Text, "expires in 1 hour")
+
+	token := mailedToken(t, messages[0])
+
+	// The failed logins before the reset are forgotten
+	loginFailed(ctx, loginKey(ctx, "john@email.com"))
+
+	a.Nil(UserService.ResetPassword(ctx, dto.PasswordResetDto{Token: token, NewPassword: "Password2!"}))
+	a.Nil(bcrypt.CompareHashAndPassword([]byte(mock.users[1].Password), []byte("Password2!")))
+	a.True(mock.users[1].EmailVerified)
+	a.Nil(checkLogin(ctx, loginKey(ctx, "john@email.com")))
+
+	// The user is told about the change
+	messages = mailer.Messages()
+	a.Len(messages, 2)
+	a.Equal("Your password was changed", messages[1].Subject)
+
+	a.ErrorIs(UserService.ResetPassword(ctx, dto.PasswordResetDto{Token: token, NewPassword: "Password3!"}), ErrTokenInvalid)
+	a.ErrorIs(UserService.ResetPassword(ctx, dto.PasswordResetDto{Token: "made-up", NewPassword: "Password3!"}), ErrTokenInvalid)
+}
+
+func TestPasswordReset_Service_MailUnavailable(t *testing.T) {
+
+	a := assert.New(t)
+	newTestAccounts(t)
+	newTestToken(t)
+
+	// A failed delivery doesn't tell the email is registered
+	a.Nil(UserService.RequestPasswordReset(context.Background(), "john@email.com"))
+}
+
+func TestGetUserById_Service_Unauthorized(t *testing.T) {
+
+	a := assert.New(t)
+
+	_, err := UserService.GetUserById(asUser(1, auth.RoleCustomer), 1)
+	a.Nil(err)
+
+	_, err = UserService.GetUserById(asUser(1, auth.RoleCustomer), 2)
+	a.ErrorIs(err, ErrPermissionDenied)
+
+	_, err = UserService.GetUserById(asUser(6, auth.RoleFrontDesk), 2)
+	a.Nil(err)
+
+	_, err = UserService.GetUsers(context.Background())
+	a.ErrorIs(err, ErrAuthenticationRequired)
+}
+
+func TestCreateUser_Service(t *testing.T) {
+
+	a := assert.New(t)
+	newTestToken(t)
+	newUser := dto.NewUserDto{Name: "Mary", LastName: "Doe", Dni: "12345678", Email: "mary@email.com", Password: "Password1!", Role: auth.RoleManager}
+
+	result, err := UserService.CreateUser(adminCtx, newUser)
+	a.Nil(err)
+	a.Equal(1, result.Id)
+	a.Equal(auth.RoleManager, result.Role)
+	a.Empty(result.Password)
+
+	_, err = UserService.CreateUser(asUser(6, auth.RoleFrontDesk), newUser)
+	a.ErrorIs(err, ErrPermissionDenied)
+
+	newUser.Role = "Owner"
+	_, err = UserService.CreateUser(adminCtx, newUser)
+	a.ErrorIs(err, ErrUnknownRole)
+
+	newUser.Role = auth.RoleCustomer
+	newUser.Email = "taken@email.com"
+	_, err = UserService.CreateUser(adminCtx, newUser)
+	a.ErrorIs(err, ErrEmailRegistered)
+}
+
+func TestSetRole_Service(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+	audit := newTestAudit(t)
+
+	result, err := UserService.SetRole(adminCtx, 7, auth.RoleFrontDesk)
+	a.Nil(err)
+	a.Equal(auth.RoleFrontDesk, result.Role)
+	a.Equal(auth.RoleFrontDesk, mock.users[7].Role)
+
+	a.Len(audit.entries, 1)
+	a.Contains(audit.entries[0].Changes, auth.RoleFrontDesk)
+
+	_, err = UserService.SetRole(adminCtx, 7, "Owner")
+	a.ErrorIs(err, ErrUnknownRole)
+
+	_, err = UserService.SetRole(adminCtx, 12, auth.RoleAdmin)
+	a.ErrorIs(err, ErrUserNotFound)
+
+	// Admins can't demote themselves, so one is always left
+	_, err = UserService.SetRole(adminCtx, 4, auth.RoleCustomer)
+	a.ErrorIs(err, ErrOwnAccount)
+
+	_, err = UserService.SetRole(asUser(7, auth.RoleFrontDesk), 7, auth.RoleAdmin)
+	a.ErrorIs(err, ErrPermissionDenied)
+}
+
+func TestSetDisabled_Service(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+	newTestToken(t)
+	mailer := newTestMailer(t)
+
+	result, err := UserService.SetDisabled(adminCtx, 1, true)
+	a.Nil(err)
+	a.True(result.Disabled)
+	a.True(mock.users[1].Disabled)
+
+	_, err = UserService.SetDisabled(adminCtx, 4, true)
+	a.ErrorIs(err, ErrOwnAccount)
+
+	// Disabled accounts can't log in, use their tokens or reset their password
+	_, err = UserService.UserLogin(context.Background(), dto.UserDto{Email: "john@email.com", Password: "password1"})
+	a.ErrorIs(err, ErrAccountDisabled)
+
+	_, err = UserService.Authenticate(context.Background(), auth.Identity{UserId: 1, Role: auth.RoleCustomer})
+	a.ErrorIs(err, ErrAccountDisabled)
+
+	a.Nil(UserService.RequestPasswordReset(context.Background(), "john@email.com"))
+	a.Empty(mailer.Messages())
+
+	_, err = UserService.SetDisabled(adminCtx, 1, false)
+	a.Nil(err)
+
+	_, err = UserService.UserLogin(context.Background(), dto.UserDto{Email: "john@email.com", Password: "password1"})
+	a.Nil(err)
+}
+
+func TestAuthenticate_Service(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+
+	// The role comes from the account, not from the token
+	user := mock.users[7]
+	user.Role = auth.RoleManager
+	mock.users[7] = user
+
+	identity, err := UserService.Authenticate(context.Background(), auth.Identity{UserId: 7, Role: auth.RoleCustomer})
+	a.Nil(err)
+	a.Equal(auth.Identity{UserId: 7, Role: auth.RoleManager}, identity)
+
+	_, err = UserService.Authenticate(context.Background(), auth.Identity{UserId: 12, Role: auth.RoleAdmin})
+	a.ErrorIs(err, ErrUserNotFound)
+
+	// A new password revokes the tokens issued before it
+	a.Nil(client.UserClient.UpdatePassword(context.Background(), 7, "new-hash"))
+
+	_, err = UserService.Authenticate(context.Background(), auth.Identity{UserId: 7, Role: auth.RoleManager})
+	a.ErrorIs(err, ErrTokenRevoked)
+
+	identity, err = UserService.Authenticate(context.Background(), auth.Identity{UserId: 7, Role: auth.RoleManager, TokenVersion: 1})
+	a.Nil(err)
+	a.Equal(7, identity.UserId)
+}
+
+func TestBootstrapAdmin_Service(t *testing.T) {
+
+	a := assert.New(t)
+	mock := newTestAccounts(t)
+
+	_, err := UserService.BootstrapAdmin(context.Background(), "nobody@email.com")
+	a.ErrorIs(err, ErrUserNotFound)
+
+	result, err := UserService.BootstrapAdmin(context.Background(), "jane@email.com")
+	a.Nil(err)
+	a.Equal(7, result.Id)
+	a.Equal(auth.RoleAdmin, mock.users[7].Role)
+
+	// Once there is an admin, they grant the role
+	_, err = UserService.BootstrapAdmin(context.Background(), "john@email.com")
+	a.ErrorIs(err, ErrAdminExists)
+	a.Equal(auth.RoleCustomer, mock.users[1].Role)
 }
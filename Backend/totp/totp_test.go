@@ -0,0 +1,93 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The SHA1 secret of the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	a := assert.New(t)
+
+	// The last 6 digits of the 8 digit codes in RFC 6238 appendix B
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, expected := range vectors {
+		code, err := Code(rfcSecret, Step(time.Unix(unix, 0)))
+		a.Nil(err)
+		a.Equal(expected, code, unix)
+	}
+
+	_, err := Code("not base32!", 1)
+	a.NotNil(err)
+}
+
+func TestVerify(t *testing.T) {
+	a := assert.New(t)
+	now := time.Unix(1234567890, 0)
+
+	step, ok := Verify(rfcSecret, "005924", now, 1)
+	a.True(ok)
+	a.Equal(Step(now), step)
+
+	// The code of the previous period is still accepted within the skew
+	step, ok = Verify(rfcSecret, "005924", now.Add(Period), 1)
+	a.True(ok)
+	a.Equal(Step(now), step)
+
+	_, ok = Verify(rfcSecret, "005924", now.Add(2*Period), 1)
+	a.False(ok)
+
+	_, ok = Verify(rfcSecret, "005 924", now, 0)
+	a.True(ok)
+
+	_, ok = Verify(rfcSecret, "005925", now, 1)
+	a.False(ok)
+
+	_, ok = Verify(rfcSecret, "5924", now, 1)
+	a.False(ok)
+}
+
+func TestNewSecret(t *testing.T) {
+	a := assert.New(t)
+
+	secret, err := NewSecret()
+	a.Nil(err)
+	a.Len(secret, 32)
+
+	other, err := NewSecret()
+	a.Nil(err)
+	a.NotEqual(secret, other)
+
+	code, err := Code(secret, Step(time.Now()))
+	a.Nil(err)
+	a.Len(code, Digits)
+}
+
+func TestUri(t *testing.T) {
+	a := assert.New(t)
+
+	uri, err := url.Parse(Uri("Miranda Hotels", "jane@email.com", "JBSWY3DPEHPK3PXP"))
+	a.Nil(err)
+
+	a.Equal("otpauth", uri.Scheme)
+	a.Equal("totp", uri.Host)
+	a.Equal("/Miranda Hotels:jane@email.com", uri.Path)
+	a.Equal("JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	a.Equal("Miranda Hotels", uri.Query().Get("issuer"))
+	a.Equal("6", uri.Query().Get("digits"))
+	a.Equal("30", uri.Query().Get("period"))
+}
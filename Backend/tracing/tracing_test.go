@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"project/config"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const incomingTraceId = "4bf92f3577b34da6a3ce929e0ef3eb01"
+
+func TestSetup_Exporters(t *testing.T) {
+	a := assert.New(t)
+
+	for _, exporter := range []string{"none", "stdout"} {
+		shutdown, err := Setup(context.Background(), config.TracingConfig{Exporter: exporter, ServiceName: "test", SampleRatio: 1})
+
+		a.Nil(err)
+		a.Nil(shutdown(context.Background()))
+	}
+
+	_, err := Setup(context.Background(), config.TracingConfig{Exporter: "jaeger"})
+	a.EqualError(err, `unknown tracing exporter "jaeger"`)
+}
+
+func TestPropagation(t *testing.T) {
+	a := assert.New(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	_, err := Setup(context.Background(), config.TracingConfig{Exporter: "none"})
+	a.Nil(err)
+
+	// Outgoing calls carry the trace of the request that made them
+	var traceparent string
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+
+	var handlerSpan trace.SpanContext
+
+	r := gin.New()
+	r.Use(otelgin.Middleware("test"))
+	r.GET("/availability", func(c *gin.Context) {
+		ctx, span := Start(c.Request.Context(), "HotelService.CheckAllAvailability")
+		defer span.End()
+
+		handlerSpan = span.SpanContext()
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+		response, err := Client.Do(req)
+
+		if err == nil {
+			response.Body.Close()
+		}
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/availability", nil)
+	req.Header.Set("traceparent", "00-"+incomingTraceId+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The incoming trace is continued
+	a.Equal(incomingTraceId, handlerSpan.TraceID().String())
+	a.Contains(traceparent, incomingTraceId)
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+	}
+
+	a.Contains(names, "HotelService.CheckAllAvailability")
+	a.Contains(names, "GET /availability")
+}
@@ -0,0 +1,7 @@
+// authHeaders adds the token of the logged in user to the headers of an API
+// request, the API tells who is asking from it
+export function authHeaders(headers = {}) {
+  const token = localStorage.getItem('token');
+
+  return token ? { ...headers, Authorization: `Bearer ${token}` } : headers;
+}
@@ -3,6 +3,7 @@ import { LoginContext, UserProfileContext } from '../../App';
 import { Link } from "react-router-dom";
 import Navbar from "../NavBar/NavBar";
 import "./AdminHotelReservations.css"
+import { authHeaders } from '../../auth';
 
 const AdminHotelReservations = () => {
   const [hotelReservations, setHotelReservations] = useState({ reservations: [] });
@@ -28,22 +29,22 @@ const AdminHotelReservations = () => {
     if (baseURL) {
       const fetchHotelReservations = async () => {
         try {
-          const response = await fetch(`${baseURL}/reservation`);
+          const response = await fetch(`${baseURL}/reservation`, { headers: authHeaders() });
           if (response.ok) {
             const data = await response.json();
             setHotelReservations({ reservations: data });
 
-            const hotelResponse = await fetch(`${baseURL}/hotel`);
+            const hotelResponse = await fetch(`${baseURL}/hotel`, { headers: authHeaders() });
             if (hotelResponse.ok) {
               const hotelData = await hotelResponse.json();
               setHotels(hotelData);
             } else {
               const errorData = await hotelResponse.json();
-              throw new Error(errorData.error);
+              throw new Error(errorData.detail || errorData.title);
             }
           } else {
             const errorData = await response.json();
-            throw new Error(errorData.error);
+            throw new Error(errorData.detail || errorData.title);
           }
         } catch (error) {
           setError(error.message);
@@ -2,6 +2,7 @@ import React, { useEffect, useState, useContext } from "react";
 import { LoginContext, UserProfileContext } from '../../App';
 import { Link } from "react-router-dom";
 import Navbar from "../NavBar/NavBar";
+import { authHeaders } from '../../auth';
 
 const AdminUserReservations = () => {
   const [userReservations, setUserReservations] = useState({ reservations: [] });
@@ -27,22 +28,22 @@ const AdminUserReservations = () => {
     if (baseURL) {
       const fetchUserReservations = async () => {
         try {
-          const response = await fetch(`${baseURL}/reservation`);
+          const response = await fetch(`${baseURL}/reservation`, { headers: authHeaders() });
           if (response.ok) {
             const data = await response.json();
             setUserReservations({ reservations: data });
 
-            const userResponse = await fetch(`${baseURL}/user`);
+            const userResponse = await fetch(`${baseURL}/user`, { headers: authHeaders() });
             if (userResponse.ok) {
               const userData = await userResponse.json();
               setUsers(userData);
             } else {
               const errorData = await userResponse.json();
-              throw new Error(errorData.error);
+              throw new Error(errorData.detail || errorData.title);
             }
           } else {
             const errorData = await response.json();
-            throw new Error(errorData.error);
+            throw new Error(errorData.detail || errorData.title);
           }
         } catch (error) {
           setError(error.message);
@@ -5,6 +5,7 @@ import Navbar from "../NavBar/NavBar";
 import "../HotelList/HotelList.css";
 import Calendar from "../Calendar/Calendar";
 import { format } from "date-fns";
+import { authHeaders } from '../../auth';
 
 const HotelAvailable = () => {
   const [hotels, setHotels] = useState([]);
@@ -42,13 +43,13 @@ const HotelAvailable = () => {
       const startDateTime = `${startDate}+${startTime}`;
       const endDateTime = `${endDate}+${endTime}`;
       const url = `${baseURL}/availability?start_date=${startDateTime}&end_date=${endDateTime}`;
-      const response = await fetch(url);
+      const response = await fetch(url, { headers: authHeaders() });
       if (response.ok) {
         const data = await response.json();
         setHotels(data);
       } else {
         const data = await response.json();
-        const errorMessage = data.error || "Error";
+        const errorMessage = data.detail || data.title || "Error";
         throw new Error(errorMessage);
       }
     } catch (error) {
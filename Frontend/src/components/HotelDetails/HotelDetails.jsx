@@ -5,6 +5,7 @@ import Navbar from "../NavBar/NavBar";
 import Calendar from "../Calendar/Calendar";
 import Reservation from "../Reserve/Reserve";
 import "./HotelDetails.css"
+import { authHeaders } from '../../auth';
 
 const HotelDetails = () => {
   const { id } = useParams();
@@ -37,13 +38,13 @@ const HotelDetails = () => {
     if (baseURL) {
       const fetchHotelDetails = async () => {
         try {
-          const response = await fetch(`${baseURL}/hotel/${id}`);
+          const response = await fetch(`${baseURL}/hotel/${id}`, { headers: authHeaders() });
           if (response.ok) {
             const data = await response.json();
             setHotel(data);
           } else {
             const errorData = await response.json();
-            throw new Error(errorData.error);
+            throw new Error(errorData.detail || errorData.title);
           }
         } catch (error) {
           setError(error.message);
@@ -62,12 +63,13 @@ const HotelDetails = () => {
     try {
       const response = await fetch(`${baseURL}/hotel/${id}`, {
         method: 'DELETE',
+        headers: authHeaders(),
       });
       if (response.ok) {
         navigate(`/`)
       } else {
         const errorData = await response.json();
-        throw new Error(errorData.error);
+        throw new Error(errorData.detail || errorData.title);
       }
     } catch (error) {
       setDeleteError(error.message);
@@ -3,6 +3,7 @@ import { Link } from "react-router-dom";
 import Navbar from "../NavBar/NavBar";
 import { LoginContext } from '../../App';
 import "./HotelList.css"
+import { authHeaders } from '../../auth';
 
 const HotelList = () => {
   const [hotels, setHotels] = useState([]);
@@ -26,13 +27,13 @@ const HotelList = () => {
         const fetchHotels = async () => {
             if (baseURL) {
                 try {
-                    const response = await fetch(`${baseURL}/hotel`);
+                    const response = await fetch(`${baseURL}/hotel`, { headers: authHeaders() });
                     if (response.ok) {
                         const data = await response.json();
                         setHotels(data);
                     } else {
                         const data = await response.json();
-                        const errorMessage = data.error || 'Error';
+                        const errorMessage = data.detail || data.title || 'Error';
                         throw new Error(errorMessage);
                     }
                 } catch (error) {
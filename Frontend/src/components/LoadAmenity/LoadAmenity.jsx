@@ -3,6 +3,7 @@ import { useNavigate } from 'react-router-dom';
 import { LoginContext, UserProfileContext } from '../../App';
 import Navbar from '../NavBar/NavBar';
 import './LoadAmenity.css';
+import { authHeaders } from '../../auth';
 
 function LoadAmenity() {
     const [name, setName] = useState('');
@@ -40,9 +41,9 @@ function LoadAmenity() {
 
             const response = await fetch(`${baseURL}/amenity`, {
                 method: 'POST',
-                headers: {
+                headers: authHeaders({
                     'Content-Type': 'application/json',
-                },
+                }),
                 body: JSON.stringify({
                     name
                 }),
@@ -52,7 +53,8 @@ function LoadAmenity() {
                 navigate('/');
             } else {
                 const data = await response.json();
-                const errorMessage = data.error || 'Error';
+                const fieldErrors = (data.errors || []).map((e) => `${e.field} ${e.message}`);
+                const errorMessage = [data.detail || data.title || 'Error', ...fieldErrors].join('. ');
                 throw new Error(errorMessage);
             }
         } catch (error) {
@@ -3,6 +3,7 @@ import { useNavigate } from 'react-router-dom';
 import { LoginContext, UserProfileContext } from '../../App';
 import Navbar from '../NavBar/NavBar';
 import './LoadHotel.css';
+import { authHeaders } from '../../auth';
 
 function LoadHotel() {
     const [name, setName] = useState('');
@@ -50,9 +51,9 @@ function LoadHotel() {
 
             const response = await fetch(`${baseURL}/hotel`, {
                 method: 'POST',
-                headers: {
+                headers: authHeaders({
                     'Content-Type': 'application/json',
-                },
+                }),
                 body: JSON.stringify({
                     name,
                     street_name,
@@ -70,7 +71,8 @@ function LoadHotel() {
                 setHotelId(data.id);
             } else {
                 const data = await response.json();
-                const errorMessage = data.error || 'Error';
+                const fieldErrors = (data.errors || []).map((e) => `${e.field} ${e.message}`);
+                const errorMessage = [data.detail || data.title || 'Error', ...fieldErrors].join('. ');
                 throw new Error(errorMessage);
             }
         } catch (error) {
@@ -90,6 +92,7 @@ function LoadHotel() {
 
             const response = await fetch(`${baseURL}/hotel/${hotelId}/images`, {
                 method: 'POST',
+                headers: authHeaders(),
                 body: formData,
             });
 
@@ -97,7 +100,7 @@ function LoadHotel() {
                 navigate('/');
             } else {
                 const errorData = await response.json();
-                throw new Error(errorData.error);
+                throw new Error(errorData.detail || errorData.title);
             }
         } catch (error) {
             console.error(error);
@@ -116,7 +119,7 @@ function LoadHotel() {
     useEffect(() => {
         const fetchAmenities = async () => {
             try {
-                const response = await fetch(`${baseURL}/amenity`);
+                const response = await fetch(`${baseURL}/amenity`, { headers: authHeaders() });
                 if (response.ok) {
                     const data = await response.json();
                     setAmenities(data);
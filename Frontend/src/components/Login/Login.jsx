@@ -11,6 +11,10 @@ function Login() {
   const [password, setPassword] = useState('');
   const [error, setError] = useState('');
   const [baseURL, setBaseURL] = useState('');
+  const [challenge, setChallenge] = useState(null);
+  const [enrollment, setEnrollment] = useState(null);
+  const [code, setCode] = useState('');
+  const [recoveryCodes, setRecoveryCodes] = useState(null);
   const navigate = useNavigate();
 
   const { loggedIn, setLoggedIn } = useContext(LoginContext);
@@ -38,32 +42,59 @@ function Login() {
         });
   }, []);
 
+  // completeLogin keeps the token of a finished login, the recovery codes of
+  // a login that enrolled the authenticator app are shown before moving on
+  const completeLogin = ({ token, user, recovery_codes }) => {
+    localStorage.setItem('token', token);
+    localStorage.setItem('userProfile', JSON.stringify(user));
+    setLoggedIn(true);
+    setUserProfile(user);
+
+    if (recovery_codes) {
+      setRecoveryCodes(recovery_codes);
+    } else {
+      navigate('/');
+    }
+  };
+
+  const postLogin = async (path, body) => {
+    const response = await fetch(`${baseURL}${path}`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify(body),
+    });
+    const data = await response.json();
+
+    if (!response.ok) {
+      const error = new Error(data.detail || data.title || 'Error');
+      error.code = data.code;
+      throw error;
+    }
+
+    return data;
+  };
+
   const handleLogin = async (e) => {
     e.preventDefault();
     setLoading(true);
     setError('');
 
     try {
-      const response = await fetch(`${baseURL}/login`, {
-        method: 'POST',
-        headers: {
-          'Content-Type': 'application/json',
-        },
-        body: JSON.stringify({ email, password }),
-      });
-
-      if (response.status === 202) {
-        const { token, user } = await response.json();
-        localStorage.setItem('token', token);
-        localStorage.setItem('userProfile', JSON.stringify(user));
-        setLoggedIn(true);
-        setUserProfile(user);
-        navigate('/');
-      } else {
-        const data = await response.json();
-        const errorMessage = data.error || 'Error';
-        throw new Error(errorMessage);
+      const data = await postLogin('/login', { email, password });
+
+      // The password checked out, the second factor is next
+      if (data.mfa_required) {
+        if (data.enrollment_required) {
+          setEnrollment(await postLogin('/login/mfa/enroll', { mfa_token: data.mfa_token }));
+        }
+
+        setChallenge(data);
+        return;
       }
+
+      completeLogin(data);
     } catch (error) {
       console.error(error);
       setError(error.message);
@@ -72,37 +103,93 @@ function Login() {
     }
   };
 
+  const handleMfa = async (e) => {
+    e.preventDefault();
+    setLoading(true);
+    setError('');
+
+    try {
+      completeLogin(await postLogin('/login/mfa', { mfa_token: challenge.mfa_token, code }));
+    } catch (error) {
+      console.error(error);
+      setError(error.message);
+
+      // The challenge expired, the login starts over
+      if (error.code === 'mfa_challenge_invalid') {
+        setChallenge(null);
+        setEnrollment(null);
+        setCode('');
+      }
+    } finally {
+      setLoading(false);
+    }
+  };
+
   return (
       <LoginContext.Provider value={{ loggedIn, setLoggedIn }}>
         <UserProfileContext.Provider value={{ userProfile, setUserProfile }}>
           <>
             <Navbar />
             <div className="contenedorLogin">
-              <div>
-                <h2>Inicio de Sesion</h2>
-                <form onSubmit={handleLogin}>
-                  <div>
-                    <label>Email:</label>
-                    <input
-                        type="email"
-                        value={email}
-                        onChange={(e) => setEmail(e.target.value)}
-                    />
-                  </div>
-                  <div>
-                    <label>Clave:</label>
-                    <input
-                        type="password"
-                        value={password}
-                        onChange={(e) => setPassword(e.target.value)}
-                    />
-                  </div>
-                  {error && <p className="error-message">{error}</p>}
-                  <button type="submit" disabled={loading}>
-                    {loading ? 'Cargando...' : 'Iniciar Sesion'}
-                  </button>
-                </form>
-              </div>
+              {recoveryCodes ? (
+                <div>
+                  <h2>Codigos de Recuperacion</h2>
+                  <p>Guardalos en un lugar seguro, cada uno sirve una vez si no tienes tu aplicacion de autenticacion.</p>
+                  <ul>
+                    {recoveryCodes.map(recoveryCode => <li key={recoveryCode}>{recoveryCode}</li>)}
+                  </ul>
+                  <button onClick={() => navigate('/')}>Continuar</button>
+                </div>
+              ) : challenge ? (
+                <div>
+                  <h2>Verificacion en Dos Pasos</h2>
+                  {enrollment && (
+                    <p>Agrega esta clave a tu aplicacion de autenticacion: <code>{enrollment.secret}</code></p>
+                  )}
+                  <form onSubmit={handleMfa}>
+                    <div>
+                      <label>Codigo:</label>
+                      <input
+                          type="text"
+                          inputMode="numeric"
+                          autoComplete="one-time-code"
+                          value={code}
+                          onChange={(e) => setCode(e.target.value)}
+                      />
+                    </div>
+                    {error && <p className="error-message">{error}</p>}
+                    <button type="submit" disabled={loading}>
+                      {loading ? 'Cargando...' : 'Verificar'}
+                    </button>
+                  </form>
+                </div>
+              ) : (
+                <div>
+                  <h2>Inicio de Sesion</h2>
+                  <form onSubmit={handleLogin}>
+                    <div>
+                      <label>Email:</label>
+                      <input
+                          type="email"
+                          value={email}
+                          onChange={(e) => setEmail(e.target.value)}
+                      />
+                    </div>
+                    <div>
+                      <label>Clave:</label>
+                      <input
+                          type="password"
+                          value={password}
+                          onChange={(e) => setPassword(e.target.value)}
+                      />
+                    </div>
+                    {error && <p className="error-message">{error}</p>}
+                    <button type="submit" disabled={loading}>
+                      {loading ? 'Cargando...' : 'Iniciar Sesion'}
+                    </button>
+                  </form>
+                </div>
+              )}
               <div>
                 <p>¿Aun no tienes una cuenta?</p>
                 <button onClick={() => navigate('/signup')}>Registrate</button>
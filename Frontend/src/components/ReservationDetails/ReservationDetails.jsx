@@ -6,6 +6,7 @@ import { UserProfileContext } from '../../App';
 import "./ReservationDetail.css"
 
 import Navbar from "../NavBar/NavBar";
+import { authHeaders } from '../../auth';
 
 const ReservationDetails = () => {
   const { id } = useParams();
@@ -35,23 +36,23 @@ const ReservationDetails = () => {
     const fetchReservationDetails = async () => {
       if (baseURL) {
         try {
-          const response = await fetch(`${baseURL}/reservation/${id}`);
+          const response = await fetch(`${baseURL}/reservation/${id}`, { headers: authHeaders() });
           if (response.ok) {
             const data = await response.json();
             setReservation(data);
 
-            const hotelResponse = await fetch(`${baseURL}/hotel/${data.hotel_id}`);
+            const hotelResponse = await fetch(`${baseURL}/hotel/${data.hotel_id}`, { headers: authHeaders() });
             if (hotelResponse.ok) {
               const hotelData = await hotelResponse.json();
               setHotel(hotelData);
             } else {
               const errorData = await hotelResponse.json();
-              throw new Error(errorData.error);
+              throw new Error(errorData.detail || errorData.title);
             }
 
           } else {
             const errorData = await response.json();
-            throw new Error(errorData.error);
+            throw new Error(errorData.detail || errorData.title);
           }
         } catch (error) {
           setError(error.message);
@@ -80,12 +81,13 @@ const ReservationDetails = () => {
       try {
         const response = await fetch(`${baseURL}/reservation/${id}`, {
           method: 'DELETE',
+          headers: authHeaders(),
         });
         if (response.ok) {
           navigate(`/user/reservations/${userProfile.id}`)
         } else {
           const errorData = await response.json();
-          throw new Error(errorData.error);
+          throw new Error(errorData.detail || errorData.title);
         }
       } catch (error) {
         setDeleteError(error.message);
@@ -2,6 +2,7 @@ import React, {useContext, useEffect, useState} from "react";
 import { useNavigate } from "react-router-dom";
 import { UserProfileContext } from '../../App';
 import { format, differenceInHours } from "date-fns";
+import { authHeaders } from '../../auth';
 
 const Reservation = ({ hotel_id, hotelRate, startDate, endDate }) => {
   const { userProfile } = useContext(UserProfileContext);
@@ -56,9 +57,9 @@ const Reservation = ({ hotel_id, hotelRate, startDate, endDate }) => {
 
         const response = await fetch(`${baseURL}/reserve`, {
           method: "POST",
-          headers: {
+          headers: authHeaders({
             "Content-Type": "application/json",
-          },
+          }),
           body: JSON.stringify(reservationData),
         });
 
@@ -69,7 +70,8 @@ const Reservation = ({ hotel_id, hotelRate, startDate, endDate }) => {
           navigate(url);
         } else {
           const data = await response.json();
-          const errorMessage = data.error || "Error";
+          const fieldErrors = (data.errors || []).map((e) => `${e.field} ${e.message}`);
+          const errorMessage = [data.detail || data.title || "Error", ...fieldErrors].join('. ');
           throw new Error(errorMessage);
         }
       } catch (error) {
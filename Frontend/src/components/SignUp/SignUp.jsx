@@ -56,7 +56,8 @@ function Signup() {
         navigate('/login');
       } else {
         const data = await response.json();
-        const errorMessage = data.error || 'Error';
+        const fieldErrors = (data.errors || []).map((e) => `${e.field} ${e.message}`);
+        const errorMessage = [data.detail || data.title || 'Error', ...fieldErrors].join('. ');
         throw new Error(errorMessage);
       }
     } catch (error) {
@@ -3,6 +3,7 @@ import { useParams, useNavigate } from 'react-router-dom';
 import { LoginContext, UserProfileContext } from '../../App';
 import Navbar from '../NavBar/NavBar';
 import '../LoadHotel/LoadHotel.css';
+import { authHeaders } from '../../auth';
 
 function UpdateHotel() {
     const { id } = useParams();
@@ -20,6 +21,7 @@ function UpdateHotel() {
 
     const [baseURL, setBaseURL] = useState('');
     const [error, setError] = useState('');
+    const [etag, setEtag] = useState('');
 
     const navigate = useNavigate();
 
@@ -38,10 +40,11 @@ function UpdateHotel() {
     useEffect(() => {
         const fetchHotelDetails = async () => {
             try {
-                const response = await fetch(`${baseURL}/hotel/${id}`);
+                const response = await fetch(`${baseURL}/hotel/${id}`, { headers: authHeaders() });
                 if (response.ok) {
                     const data = await response.json();
 
+                    setEtag(response.headers.get('ETag') || '');
                     setName(data.name);
                     setStreet_name(data.street_name);
                     setStreet_number(data.street_number.toString());
@@ -52,7 +55,7 @@ function UpdateHotel() {
 
                 } else {
                     const errorData = await response.json();
-                    throw new Error(errorData.error);
+                    throw new Error(errorData.detail || errorData.title);
                 }
             } catch (error) {
                 setError(error.message);
@@ -77,10 +80,11 @@ function UpdateHotel() {
             }
 
             const response = await fetch(`${baseURL}/hotel/${id}`, {
-                method: 'PUT',
-                headers: {
-                    'Content-Type': 'application/json',
-                },
+                method: 'PATCH',
+                headers: authHeaders({
+                    'Content-Type': 'application/merge-patch+json',
+                    ...(etag && { 'If-Match': etag }),
+                }),
                 body: JSON.stringify({
                     name,
                     street_name,
@@ -96,7 +100,8 @@ function UpdateHotel() {
                 navigate('/')
             } else {
                 const data = await response.json();
-                const errorMessage = data.error || 'Error';
+                const fieldErrors = (data.errors || []).map((e) => `${e.field} ${e.message}`);
+                const errorMessage = [data.detail || data.title || 'Error', ...fieldErrors].join('. ');
                 throw new Error(errorMessage);
             }
         } catch (error) {
@@ -116,13 +121,13 @@ function UpdateHotel() {
     useEffect(() => {
         const fetchAmenities = async () => {
             try {
-                const response = await fetch(`${baseURL}/amenity`);
+                const response = await fetch(`${baseURL}/amenity`, { headers: authHeaders() });
                 if (response.ok) {
                     const data = await response.json();
                     setAmenities(data);
                 } else {
                     const errorData = await response.json();
-                    throw new Error(errorData.error);
+                    throw new Error(errorData.detail || errorData.title);
                 }
             } catch (error) {
                 console.error(error);
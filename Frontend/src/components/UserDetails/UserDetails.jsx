@@ -4,6 +4,7 @@ import { LoginContext, UserProfileContext } from '../../App';
 import { useParams } from "react-router-dom";
 import "./UserDetails.css"
 import Navbar from "../NavBar/NavBar";
+import { authHeaders } from '../../auth';
 
 const UserDetails = () => {
   const { id } = useParams();
@@ -30,13 +31,13 @@ const UserDetails = () => {
     const fetchUserDetails = async () => {
       if (baseURL) {
         try {
-          const response = await fetch(`${baseURL}/user/${id}`);
+          const response = await fetch(`${baseURL}/user/${id}`, { headers: authHeaders() });
           if (response.ok) {
             const data = await response.json();
             setUser(data);
           } else {
             const errorData = await response.json();
-            throw new Error(errorData.error);
+            throw new Error(errorData.detail || errorData.title);
           }
         } catch (error) {
           setError(error.message);
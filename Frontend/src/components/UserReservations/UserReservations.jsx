@@ -4,6 +4,7 @@ import { useParams } from "react-router-dom";
 import { Link } from "react-router-dom";
 import Navbar from "../NavBar/NavBar";
 import "./UserReservations.css"
+import { authHeaders } from '../../auth';
 
 const UserReservations = () => {
   const { id } = useParams();
@@ -30,23 +31,23 @@ const UserReservations = () => {
     const fetchUserReservations = async () => {
         if (baseURL) {
             try {
-                const response = await fetch(`${baseURL}/user/reservations/${id}`);
+                const response = await fetch(`${baseURL}/user/reservations/${id}`, { headers: authHeaders() });
                 if (response.ok) {
                     const data = await response.json();
                     setUserReservations(data);
 
-                    const hotelResponse = await fetch(`${baseURL}/hotel`);
+                    const hotelResponse = await fetch(`${baseURL}/hotel`, { headers: authHeaders() });
                     if (hotelResponse.ok) {
                         const hotelData = await hotelResponse.json();
                         setHotels(hotelData);
                     } else {
                         const errorData = await hotelResponse.json();
-                        throw new Error(errorData.error);
+                        throw new Error(errorData.detail || errorData.title);
                     }
 
                 } else {
                     const errorData = await response.json();
-                    throw new Error(errorData.error);
+                    throw new Error(errorData.detail || errorData.title);
                 }
             } catch (error) {
                 setError(error.message);
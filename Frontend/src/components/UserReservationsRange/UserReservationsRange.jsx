@@ -5,6 +5,7 @@ import Navbar from "../NavBar/NavBar";
 import Calendar from "../Calendar/Calendar";
 import { format } from "date-fns";
 import "./UserReservationsRange.css"
+import { authHeaders } from '../../auth';
 
 const ReservationsInRange = () => {
   const [reservations, setReservations] = useState([]);
@@ -55,13 +56,13 @@ const ReservationsInRange = () => {
       const startDateTime = `${startDate}+${startTime}`;
       const endDateTime = `${endDate}+${endTime}`;
       const url = `${baseURL}/user/reservations/${id}/range?start_date=${startDateTime}&end_date=${endDateTime}`;
-      const response = await fetch(url);
+      const response = await fetch(url, { headers: authHeaders() });
       if (response.ok) {
         const data = await response.json();
         setReservations(data);
       } else {
         const data = await response.json();
-        const errorMessage = data.error || "Error";
+        const errorMessage = data.detail || data.title || "Error";
         throw new Error(errorMessage);
       }
     } catch (error) {